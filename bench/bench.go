@@ -0,0 +1,210 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bench provides the load-test fakes and measurement plumbing used to
+// stress the login and signing pipelines: a KMS signer and an Ethereum
+// JSON-RPC endpoint with configurable latency distributions, and a recorder
+// that reports request latency percentiles. Benchmarks in this package and the
+// loadtest command build on these so pipeline regressions show up as p50/p99
+// shifts before release.
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	module "github.com/heroiclabs/nakama/v3/runtime"
+)
+
+// LatencyDistribution samples synthetic service latency. Latency is drawn
+// uniformly between P50 and P99 for one call in a hundred and uniformly up to
+// P50 otherwise, which is crude but keeps tail behavior configurable without
+// pulling in a stats dependency.
+type LatencyDistribution struct {
+	P50 time.Duration
+	P99 time.Duration
+}
+
+// Sample returns one latency draw.
+func (d *LatencyDistribution) Sample() time.Duration {
+	if d == nil || d.P50 <= 0 {
+		return 0
+	}
+	p99 := d.P99
+	if p99 < d.P50 {
+		p99 = d.P50
+	}
+	if rand.Intn(100) == 0 {
+		return d.P50 + time.Duration(rand.Int63n(int64(p99-d.P50)+1))
+	}
+	return time.Duration(rand.Int63n(int64(d.P50) + 1))
+}
+
+// FakeKMS wraps a real signer implementation with sampled latency, standing in
+// for AWS KMS round trips during load tests.
+type FakeKMS struct {
+	Inner   module.KMSSigner
+	Latency *LatencyDistribution
+}
+
+// PublicKey implements module.KMSSigner.
+func (f *FakeKMS) PublicKey(ctx context.Context, derivationIndex uint32) ([]byte, error) {
+	f.sleep(ctx)
+	return f.Inner.PublicKey(ctx, derivationIndex)
+}
+
+// SignDigest implements module.KMSSigner.
+func (f *FakeKMS) SignDigest(ctx context.Context, derivationIndex uint32, digest []byte, sctx module.SigningContext) ([]byte, error) {
+	f.sleep(ctx)
+	return f.Inner.SignDigest(ctx, derivationIndex, digest, sctx)
+}
+
+func (f *FakeKMS) sleep(ctx context.Context) {
+	d := f.Latency.Sample()
+	if d == 0 {
+		return
+	}
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// FakeChain is an in-process Ethereum JSON-RPC stub with sampled latency. It
+// answers the minimal method set the module touches; everything else gets a
+// JSON-RPC method-not-found error.
+type FakeChain struct {
+	ChainID int64
+	Latency *LatencyDistribution
+
+	mu        sync.Mutex
+	submitted int
+}
+
+// Submitted reports how many raw transactions were accepted.
+func (c *FakeChain) Submitted() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.submitted
+}
+
+// Start serves the fake chain on an ephemeral port. Callers own the returned
+// server and must Close it.
+func (c *FakeChain) Start() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(c.handle))
+}
+
+func (c *FakeChain) handle(w http.ResponseWriter, r *http.Request) {
+	if d := c.Latency.Sample(); d > 0 {
+		time.Sleep(d)
+	}
+	var req struct {
+		ID     interface{}   `json:"id"`
+		Method string        `json:"method"`
+		Params []interface{} `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	switch req.Method {
+	case "eth_chainId":
+		resp["result"] = fmt.Sprintf("0x%x", c.ChainID)
+	case "eth_getTransactionCount":
+		resp["result"] = "0x0"
+	case "eth_sendRawTransaction":
+		c.mu.Lock()
+		c.submitted++
+		c.mu.Unlock()
+		// Loadtest clients only check for an error; a zero hash is fine.
+		resp["result"] = "0x" + fmt.Sprintf("%064x", 0)
+	default:
+		resp["error"] = map[string]interface{}{"code": -32601, "message": "method not found"}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Recorder accumulates per-request latencies across workers.
+type Recorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+}
+
+// Record adds one observation.
+func (r *Recorder) Record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors++
+		return
+	}
+	r.latencies = append(r.latencies, d)
+}
+
+// Percentile returns the given latency percentile (0-100) of successful
+// requests, or zero when nothing was recorded.
+func (r *Recorder) Percentile(p float64) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, len(r.latencies))
+	copy(sorted, r.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := int(p / 100 * float64(len(sorted)-1))
+	return sorted[idx]
+}
+
+// Summary renders the recorder's totals in the loadtest report format.
+func (r *Recorder) Summary() string {
+	r.mu.Lock()
+	count, errors := len(r.latencies), r.errors
+	r.mu.Unlock()
+	return fmt.Sprintf("requests=%d errors=%d p50=%v p99=%v",
+		count, errors, r.Percentile(50), r.Percentile(99))
+}
+
+// Run drives fn from workers goroutines for the given duration, recording one
+// observation per call.
+func Run(ctx context.Context, workers int, duration time.Duration, rec *Recorder, fn func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start := time.Now()
+				err := fn(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				rec.Record(time.Since(start), err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,141 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bench
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	module "github.com/heroiclabs/nakama/v3/runtime"
+)
+
+func newTestSigner(tb testing.TB) module.KMSSigner {
+	signer, err := module.NewMockKMSSigner([]byte("bench-master-key"))
+	if err != nil {
+		tb.Fatalf("mock signer: %v", err)
+	}
+	return signer
+}
+
+func BenchmarkKMSSignDigest(b *testing.B) {
+	signer := newTestSigner(b)
+	digest := sha256.Sum256([]byte("payload"))
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := signer.SignDigest(ctx, 0, digest[:], nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkKMSSignDigestParallel(b *testing.B) {
+	signer := newTestSigner(b)
+	digest := sha256.Sum256([]byte("payload"))
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		for pb.Next() {
+			if _, err := signer.SignDigest(ctx, 0, digest[:], nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkKMSPublicKey(b *testing.B) {
+	signer := newTestSigner(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := signer.PublicKey(ctx, uint32(i%64)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestLatencyDistributionBounds(t *testing.T) {
+	d := &LatencyDistribution{P50: 2 * time.Millisecond, P99: 10 * time.Millisecond}
+	for i := 0; i < 1000; i++ {
+		if s := d.Sample(); s < 0 || s > d.P99 {
+			t.Fatalf("sample %v outside [0, %v]", s, d.P99)
+		}
+	}
+	var zero *LatencyDistribution
+	if zero.Sample() != 0 {
+		t.Fatal("nil distribution should sample zero")
+	}
+}
+
+func TestRecorderPercentiles(t *testing.T) {
+	rec := &Recorder{}
+	for i := 1; i <= 100; i++ {
+		rec.Record(time.Duration(i)*time.Millisecond, nil)
+	}
+	if p50 := rec.Percentile(50); p50 < 49*time.Millisecond || p50 > 51*time.Millisecond {
+		t.Fatalf("p50 = %v", p50)
+	}
+	if p99 := rec.Percentile(99); p99 < 98*time.Millisecond {
+		t.Fatalf("p99 = %v", p99)
+	}
+}
+
+func TestFakeChainSendRawTransaction(t *testing.T) {
+	chain := &FakeChain{ChainID: 1}
+	server := chain.Start()
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1,
+		"method": "eth_sendRawTransaction",
+		"params": []string{"0x00"},
+	})
+	resp, err := http.Post(server.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var decoded struct {
+		Result string `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Result == "" {
+		t.Fatal("expected a transaction hash result")
+	}
+	if chain.Submitted() != 1 {
+		t.Fatalf("submitted = %d", chain.Submitted())
+	}
+}
+
+func TestRunDrivesWorkers(t *testing.T) {
+	rec := &Recorder{}
+	Run(context.Background(), 4, 50*time.Millisecond, rec, func(ctx context.Context) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if rec.Percentile(50) == 0 {
+		t.Fatal("expected recorded observations")
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command loadtest drives concurrent RPC traffic against a running server and
+// reports latency percentiles per RPC. It is meant to be pointed at a dev
+// deployment in sandbox mode backed by the mock KMS signer, optionally with
+// the bench package's fake chain standing in for the RPC node, e.g.:
+//
+//	loadtest -url http://127.0.0.1:7350 -session $TOKEN \
+//	    -rpc rpc_get_wallet= -rpc 'rpc_sign_and_send={"to":"0x...","gas":21000,...}' \
+//	    -workers 32 -duration 30s -memprofile mem.out
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/heroiclabs/nakama/v3/bench"
+)
+
+type rpcFlags []string
+
+func (f *rpcFlags) String() string { return strings.Join(*f, ",") }
+func (f *rpcFlags) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+func main() {
+	var (
+		serverURL  = flag.String("url", "http://127.0.0.1:7350", "server base URL")
+		httpKey    = flag.String("httpkey", "", "runtime HTTP key, for server-to-server RPCs")
+		session    = flag.String("session", "", "session token, for user RPCs")
+		workers    = flag.Int("workers", 16, "concurrent workers per RPC")
+		duration   = flag.Duration("duration", 10*time.Second, "how long to drive load")
+		memProfile = flag.String("memprofile", "", "write an allocation profile to this file")
+		cpuProfile = flag.String("cpuprofile", "", "write a CPU profile to this file")
+	)
+	var rpcs rpcFlags
+	flag.Var(&rpcs, "rpc", "RPC to drive as name=payload; repeatable")
+	flag.Parse()
+
+	if len(rpcs) == 0 {
+		fmt.Fprintln(os.Stderr, "loadtest: at least one -rpc is required")
+		os.Exit(2)
+	}
+	if *httpKey == "" && *session == "" {
+		fmt.Fprintln(os.Stderr, "loadtest: one of -httpkey or -session is required")
+		os.Exit(2)
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+			os.Exit(1)
+		}
+		defer pprof.StopCPUProfile()
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	exitCode := 0
+	for _, spec := range rpcs {
+		name, payload, _ := strings.Cut(spec, "=")
+		rec := &bench.Recorder{}
+		bench.Run(context.Background(), *workers, *duration, rec, func(ctx context.Context) error {
+			return callRPC(ctx, client, *serverURL, *httpKey, *session, name, payload)
+		})
+		fmt.Printf("%s: %s\n", name, rec.Summary())
+		if strings.Contains(rec.Summary(), "requests=0") {
+			exitCode = 1
+		}
+	}
+
+	if *memProfile != "" {
+		f, err := os.Create(*memProfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "loadtest: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	os.Exit(exitCode)
+}
+
+// callRPC issues one runtime RPC call using either the HTTP key or a user
+// session for auth.
+func callRPC(ctx context.Context, client *http.Client, base, httpKey, session, name, payload string) error {
+	endpoint := fmt.Sprintf("%s/v2/rpc/%s?unwrap", strings.TrimRight(base, "/"), url.PathEscape(name))
+	if httpKey != "" {
+		endpoint += "&http_key=" + url.QueryEscape(httpKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader([]byte(payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set("Authorization", "Bearer "+session)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc %s returned status %d", name, resp.StatusCode)
+	}
+	return nil
+}
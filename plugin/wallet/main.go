@@ -0,0 +1,40 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The wallet plugin target. Build with:
+//
+//	go build -buildmode=plugin -o wallet.so ./plugin/wallet
+//
+// It registers the wallet and custody surfaces only, gated by the configured
+// profile as usual. Auth RPCs stay with the auth plugin (see plugin/auth);
+// the two load side by side and share the server's session layer, so
+// sessions minted by the auth plugin authorize wallet calls here.
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	module "github.com/heroiclabs/nakama/v3/runtime"
+)
+
+// InitModule is the entrypoint the Nakama server resolves when loading the
+// plugin.
+func InitModule(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, initializer nkruntime.Initializer) error {
+	return module.InitWalletModule(ctx, logger, db, nk, initializer)
+}
+
+// main is unused; Nakama loads the plugin through InitModule.
+func main() {}
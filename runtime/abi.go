@@ -0,0 +1,243 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// The ABI registry maps allowlisted contract addresses to their ABIs so that
+// calldata can be decoded into a human-readable view at signing time. The
+// decoded view rides along on transaction records and audit entries; raw
+// calldata is always preserved unchanged.
+
+const abiCollection = "abi_registry"
+
+// abiEntry is one function in an uploaded contract ABI, the subset of the
+// standard solc ABI JSON the decoder needs.
+type abiEntry struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Inputs []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	} `json:"inputs"`
+}
+
+// DecodedArg is one decoded calldata argument.
+type DecodedArg struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// DecodedCall is the human-readable view of a calldata payload.
+type DecodedCall struct {
+	Contract  string       `json:"contract"`
+	Method    string       `json:"method"`
+	Signature string       `json:"signature"`
+	Args      []DecodedArg `json:"args,omitempty"`
+}
+
+func abiRegistryKey(chainID int64, address string) string {
+	return fmt.Sprintf("%d:%s", chainID, strings.ToLower(address))
+}
+
+// UploadABIRequest is the payload for rpc_admin_upload_abi.
+type UploadABIRequest struct {
+	Address string          `json:"address"`
+	ChainID int64           `json:"chainId,omitempty"` // Defaults to the configured chain.
+	ABI     json.RawMessage `json:"abi"`
+}
+
+// rpcAdminUploadABI stores or replaces the ABI for an allowlisted contract.
+// Server-to-server only.
+func rpcAdminUploadABI(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req UploadABIRequest
+	if err := unmarshalPayload(payload, &req); err != nil {
+		return "", rpcError(errCodeBadInput, "Expects payload with address and abi fields.", codes.InvalidArgument)
+	}
+	if _, err := parseHexAddress(req.Address); err != nil {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Invalid contract address: %v.", err), codes.InvalidArgument)
+	}
+	var entries []abiEntry
+	if err := json.Unmarshal(req.ABI, &entries); err != nil {
+		return "", rpcError(errCodeBadInput, "ABI must be a standard ABI JSON array.", codes.InvalidArgument)
+	}
+	chainID := req.ChainID
+	if chainID == 0 {
+		chainID = cfg.EVMChainID
+	}
+
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: abiCollection,
+		Key:        abiRegistryKey(chainID, req.Address),
+		Value:      string(req.ABI),
+	}}); err != nil {
+		logger.Error("ABI registry write failed: %v", err)
+		return "", rpcError(errCodeInternal, "ABI upload failed.", codes.Internal)
+	}
+
+	functions := 0
+	for _, e := range entries {
+		if e.Type == "function" {
+			functions++
+		}
+	}
+	out, _ := json.Marshal(map[string]interface{}{"stored": true, "functions": functions})
+	return string(out), nil
+}
+
+// loadABI fetches the registered ABI for a contract, returning nil when the
+// contract has no registered ABI.
+func loadABI(ctx context.Context, nk nkruntime.NakamaModule, chainID int64, address string) ([]abiEntry, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: abiCollection,
+		Key:        abiRegistryKey(chainID, address),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	var entries []abiEntry
+	if err := json.Unmarshal([]byte(objects[0].Value), &entries); err != nil {
+		return nil, fmt.Errorf("stored ABI for %s is corrupt: %w", address, err)
+	}
+	return entries, nil
+}
+
+// decodeCalldata decodes calldata against the contract's registered ABI.
+// Returns nil (not an error) when no ABI is registered or the selector is
+// unknown: decoding is best-effort and must never block signing.
+func decodeCalldata(ctx context.Context, nk nkruntime.NakamaModule, chainID int64, address string, data []byte) (*DecodedCall, error) {
+	if len(data) < 4 {
+		return nil, nil
+	}
+	entries, err := loadABI(ctx, nk, chainID, address)
+	if err != nil || entries == nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		if e.Type != "function" {
+			continue
+		}
+		types := make([]string, 0, len(e.Inputs))
+		for _, in := range e.Inputs {
+			types = append(types, in.Type)
+		}
+		signature := fmt.Sprintf("%s(%s)", e.Name, strings.Join(types, ","))
+		selector := keccak256([]byte(signature))[:4]
+		if !strings.EqualFold(hex.EncodeToString(selector), hex.EncodeToString(data[:4])) {
+			continue
+		}
+
+		decoded := &DecodedCall{
+			Contract:  strings.ToLower(address),
+			Method:    e.Name,
+			Signature: signature,
+		}
+		args := data[4:]
+		for i, in := range e.Inputs {
+			name := in.Name
+			if name == "" {
+				name = fmt.Sprintf("arg%d", i)
+			}
+			value := decodeABIValue(in.Type, args, i)
+			decoded.Args = append(decoded.Args, DecodedArg{Name: name, Type: in.Type, Value: value})
+		}
+		return decoded, nil
+	}
+	return nil, nil
+}
+
+// word returns the i-th 32-byte head word of the encoded arguments, or nil
+// when out of range.
+func word(args []byte, i int) []byte {
+	start := i * 32
+	if start+32 > len(args) {
+		return nil
+	}
+	return args[start : start+32]
+}
+
+// decodeABIValue decodes the argument at head slot i. Unsupported or
+// malformed values degrade to the raw head word as 0x-hex so the decoded view
+// is always complete.
+func decodeABIValue(typ string, args []byte, i int) interface{} {
+	w := word(args, i)
+	if w == nil {
+		return nil
+	}
+	raw := "0x" + hex.EncodeToString(w)
+
+	switch {
+	case typ == "address":
+		return "0x" + hex.EncodeToString(w[12:])
+	case typ == "bool":
+		return w[31] == 1
+	case strings.HasPrefix(typ, "uint"):
+		return new(big.Int).SetBytes(w).String()
+	case strings.HasPrefix(typ, "int"):
+		v := new(big.Int).SetBytes(w)
+		// Two's complement for negative values.
+		if w[0]&0x80 != 0 {
+			max := new(big.Int).Lsh(big.NewInt(1), 256)
+			v.Sub(v, max)
+		}
+		return v.String()
+	case typ == "string", typ == "bytes":
+		offset := new(big.Int).SetBytes(w)
+		if !offset.IsInt64() || offset.Int64()+32 > int64(len(args)) {
+			return raw
+		}
+		start := offset.Int64()
+		length := new(big.Int).SetBytes(args[start : start+32])
+		if !length.IsInt64() || start+32+length.Int64() > int64(len(args)) {
+			return raw
+		}
+		body := args[start+32 : start+32+length.Int64()]
+		if typ == "string" {
+			return string(body)
+		}
+		return "0x" + hex.EncodeToString(body)
+	case strings.HasPrefix(typ, "bytes"):
+		// Fixed-size bytesN, left-aligned in the word.
+		n, err := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+		if err != nil || n < 1 || n > 32 {
+			return raw
+		}
+		return "0x" + hex.EncodeToString(w[:n])
+	default:
+		// Arrays, tuples and anything else keep the raw head word.
+		return raw
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// Launch-day login surges should degrade gracefully: clients that can't be
+// admitted right now get a QUEUE_FULL error with a retry-after hint instead
+// of piling up until the database times out. Two limits apply, both tunable
+// at runtime through rpc_admin_set_login_limits: a cap on logins in flight,
+// and a token bucket on account creation — the expensive path — so a stampede
+// of brand-new players drains at a sustainable rate.
+
+// concurrencyRetryAfter is the backoff hinted when the in-flight cap is hit;
+// in-flight logins turn over quickly so a short retry usually succeeds.
+const concurrencyRetryAfter = 2 * time.Second
+
+var metricLoginRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "nakama_module_login_rejections_total",
+	Help: "Logins rejected by the admission controller, by limit hit.",
+}, []string{"limit"})
+
+func init() {
+	metricsRegistry.MustRegister(metricLoginRejections)
+}
+
+// LoginLimits are the live-tunable admission thresholds. Zero values disable
+// the corresponding limit.
+type LoginLimits struct {
+	// MaxConcurrent caps logins in flight on this node.
+	MaxConcurrent int `json:"maxConcurrent"`
+	// CreatePerMinute refills the account-creation token bucket.
+	CreatePerMinute int `json:"createPerMinute"`
+	// CreateBurst bounds the bucket, absorbing short spikes.
+	CreateBurst int `json:"createBurst"`
+}
+
+// admissionController enforces LoginLimits. Limits are per node: each cluster
+// node admits independently, so cluster capacity scales with node count.
+type admissionController struct {
+	mu       sync.Mutex
+	limits   LoginLimits
+	inFlight int
+	tokens   float64
+	refilled time.Time
+}
+
+var loginAdmission = &admissionController{}
+
+// setLimits replaces the active thresholds and refills the creation bucket to
+// the new burst size so a raised limit takes effect immediately.
+func (a *admissionController) setLimits(limits LoginLimits) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.limits = limits
+	a.tokens = float64(limits.CreateBurst)
+	a.refilled = moduleClock.Now()
+}
+
+// admit reserves an in-flight login slot. The returned release function must
+// be called when the login completes, admitted or not.
+func (a *admissionController) admit() (func(), error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.limits.MaxConcurrent > 0 && a.inFlight >= a.limits.MaxConcurrent {
+		metricLoginRejections.WithLabelValues("concurrent").Inc()
+		return nil, rpcErrorRetry(errCodeQueueFull, "Login queue is full; retry shortly.", concurrencyRetryAfter, codes.ResourceExhausted)
+	}
+	a.inFlight++
+	released := false
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if !released {
+			released = true
+			a.inFlight--
+		}
+	}, nil
+}
+
+// admitCreate takes one token from the account-creation bucket, or reports
+// how long until the next token when the bucket is dry.
+func (a *admissionController) admitCreate() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.limits.CreatePerMinute <= 0 {
+		return nil
+	}
+	now := moduleClock.Now()
+	rate := float64(a.limits.CreatePerMinute) / 60
+	a.tokens += now.Sub(a.refilled).Seconds() * rate
+	if burst := float64(a.limits.CreateBurst); a.tokens > burst {
+		a.tokens = burst
+	}
+	a.refilled = now
+	if a.tokens < 1 {
+		metricLoginRejections.WithLabelValues("create").Inc()
+		retryAfter := time.Duration((1 - a.tokens) / rate * float64(time.Second))
+		return rpcErrorRetry(errCodeQueueFull, "Account creation is rate limited; retry shortly.", retryAfter, codes.ResourceExhausted)
+	}
+	a.tokens--
+	return nil
+}
+
+// rpcAdminSetLoginLimits replaces the admission thresholds without a restart.
+// Node-local like the thresholds themselves: apply to every node when tuning
+// a cluster mid-launch.
+func rpcAdminSetLoginLimits(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var limits LoginLimits
+	if err := unmarshalPayload(payload, &limits); err != nil || limits.MaxConcurrent < 0 || limits.CreatePerMinute < 0 || limits.CreateBurst < 0 {
+		return "", rpcError(errCodeBadInput, "Expects non-negative maxConcurrent, createPerMinute and createBurst.", codes.InvalidArgument)
+	}
+	if limits.CreatePerMinute > 0 && limits.CreateBurst == 0 {
+		// A rate with no burst would reject every create; default to one
+		// minute of headroom.
+		limits.CreateBurst = limits.CreatePerMinute
+	}
+
+	loginAdmission.setLimits(limits)
+
+	if err := appendAudit(ctx, nk, "login.limits_updated", "", map[string]interface{}{
+		"maxConcurrent":   limits.MaxConcurrent,
+		"createPerMinute": limits.CreatePerMinute,
+		"createBurst":     limits.CreateBurst,
+	}); err != nil {
+		logger.Error("Audit append failed for login limits update: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(&limits)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
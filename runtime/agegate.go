@@ -0,0 +1,255 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Age gating is claims-driven: a Cognito `custom:age_band` claim names the
+// band outright, or a `birthdate` claim is bucketed into child, teen or
+// adult. The band is stored at login — like the country claim — so wallet
+// and signing RPCs can enforce the configured band policies without a token
+// in hand. Blocked actions come back with a dedicated code the client
+// renders as a parental-consent flow; teen bands can instead carry a daily
+// spend cap.
+
+const (
+	ageCollection = "age"
+	ageBandKey    = "band"
+	ageSpendKey   = "spend"
+
+	ageBandChild = "child"
+	ageBandTeen  = "teen"
+	ageBandAdult = "adult"
+
+	// Birthdate bucketing thresholds, in years.
+	ageTeenMin  = 13
+	ageAdultMin = 18
+)
+
+// ageBandPolicy is the configured restriction set for one band. A nil policy
+// for a band means no restrictions.
+type ageBandPolicy struct {
+	// BlockWallet refuses wallet provisioning outright.
+	BlockWallet bool `json:"blockWallet,omitempty"`
+	// BlockSigning refuses transaction signing.
+	BlockSigning bool `json:"blockSigning,omitempty"`
+	// DailySpendCapWei caps the summed value signed per UTC day.
+	DailySpendCapWei string `json:"dailySpendCapWei,omitempty"`
+}
+
+type ageBandRecord struct {
+	Band      string `json:"band"`
+	Source    string `json:"source"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+type ageSpendRecord struct {
+	Day      string `json:"day"`
+	TotalWei string `json:"totalWei"`
+}
+
+// loadAgeBandPolicies parses NAKAMA_AGE_BAND_POLICIES, a JSON object keyed by
+// band name. Absent means no age restrictions.
+func loadAgeBandPolicies(ctx context.Context) (map[string]*ageBandPolicy, error) {
+	raw := moduleEnv(ctx, "NAKAMA_AGE_BAND_POLICIES")
+	if raw == "" {
+		return nil, nil
+	}
+	var decoded map[string]*ageBandPolicy
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return nil, fmt.Errorf("invalid NAKAMA_AGE_BAND_POLICIES: %w", err)
+	}
+	policies := make(map[string]*ageBandPolicy, len(decoded))
+	for band, policy := range decoded {
+		if policy != nil && policy.DailySpendCapWei != "" {
+			if _, err := parseWei(policy.DailySpendCapWei); err != nil {
+				return nil, fmt.Errorf("invalid NAKAMA_AGE_BAND_POLICIES: band %q: %w", band, err)
+			}
+		}
+		policies[strings.ToLower(band)] = policy
+	}
+	return policies, nil
+}
+
+// ageBandFromClaims derives the band, preferring the explicit claim over
+// birthdate bucketing. Empty means the token carries no age signal.
+func ageBandFromClaims(claims *CognitoClaims) (band, source string) {
+	if claims.AgeBand != "" {
+		return strings.ToLower(claims.AgeBand), "claim"
+	}
+	if claims.Birthdate == "" {
+		return "", ""
+	}
+	born, err := time.Parse("2006-01-02", claims.Birthdate)
+	if err != nil {
+		return "", ""
+	}
+	years := 0
+	now := moduleClock.Now().UTC()
+	for born.AddDate(years+1, 0, 0).Before(now) || born.AddDate(years+1, 0, 0).Equal(now) {
+		years++
+	}
+	switch {
+	case years < ageTeenMin:
+		return ageBandChild, "birthdate"
+	case years < ageAdultMin:
+		return ageBandTeen, "birthdate"
+	default:
+		return ageBandAdult, "birthdate"
+	}
+}
+
+// storeAgeBand records a user's band at login, overwriting older derivations.
+func storeAgeBand(ctx context.Context, nk nkruntime.NakamaModule, userID, band, source string) error {
+	value, err := json.Marshal(&ageBandRecord{
+		Band:      band,
+		Source:    source,
+		UpdatedAt: moduleClock.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: ageCollection,
+		Key:        ageBandKey,
+		UserID:     userID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// userAgeBand returns the stored band, empty when the user never presented
+// an age claim.
+func userAgeBand(ctx context.Context, nk nkruntime.NakamaModule, userID string) (string, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: ageCollection,
+		Key:        ageBandKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return "", err
+	}
+	if len(objects) == 0 {
+		return "", nil
+	}
+	record := &ageBandRecord{}
+	if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+		return "", err
+	}
+	return record.Band, nil
+}
+
+// checkAgeWalletAccess refuses wallet provisioning for bands configured as
+// blocked.
+func checkAgeWalletAccess(ctx context.Context, nk nkruntime.NakamaModule, userID string) error {
+	policy, err := ageBandPolicyFor(ctx, nk, userID)
+	if err != nil {
+		return rpcError(errCodeInternal, "Age policy lookup failed.", codes.Internal)
+	}
+	if policy != nil && policy.BlockWallet {
+		return rpcError(errCodeParentalConsent, "A parent or guardian must approve wallet access for this account.", codes.PermissionDenied)
+	}
+	return nil
+}
+
+// checkAgeSigningPolicy refuses or caps signing per the caller's band: a
+// blocked band fails outright, a capped band accumulates the signed value
+// against its UTC-day allowance.
+func checkAgeSigningPolicy(ctx context.Context, nk nkruntime.NakamaModule, userID string, value *big.Int) error {
+	policy, err := ageBandPolicyFor(ctx, nk, userID)
+	if err != nil {
+		return rpcError(errCodeInternal, "Age policy lookup failed.", codes.Internal)
+	}
+	if policy == nil {
+		return nil
+	}
+	if policy.BlockSigning {
+		return rpcError(errCodeParentalConsent, "A parent or guardian must approve transactions for this account.", codes.PermissionDenied)
+	}
+	if policy.DailySpendCapWei == "" {
+		return nil
+	}
+	capWei, err := parseWei(policy.DailySpendCapWei)
+	if err != nil {
+		return rpcError(errCodeInternal, "Age policy lookup failed.", codes.Internal)
+	}
+
+	day := moduleClock.Now().UTC().Format("2006-01-02")
+	spent := new(big.Int)
+	var version string
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: ageCollection,
+		Key:        ageSpendKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return rpcError(errCodeInternal, "Age policy lookup failed.", codes.Internal)
+	}
+	if len(objects) > 0 {
+		record := &ageSpendRecord{}
+		if err := json.Unmarshal([]byte(objects[0].Value), record); err == nil && record.Day == day {
+			if prior, ok := new(big.Int).SetString(record.TotalWei, 10); ok {
+				spent = prior
+			}
+		}
+		version = objects[0].Version
+	}
+
+	spent.Add(spent, value)
+	if spent.Cmp(capWei) > 0 {
+		return rpcError(errCodeBudgetExceeded, "Daily spending limit for this account's age band is reached.", codes.ResourceExhausted)
+	}
+	updated, err := json.Marshal(&ageSpendRecord{Day: day, TotalWei: spent.String()})
+	if err != nil {
+		return rpcError(errCodeInternal, "Age policy lookup failed.", codes.Internal)
+	}
+	// The conditional write makes concurrent signs race on the counter rather
+	// than both slipping under the cap.
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: ageCollection,
+		Key:        ageSpendKey,
+		UserID:     userID,
+		Value:      string(updated),
+		Version:    version,
+	}}); err != nil {
+		return rpcErrorRetry(errCodeRetryLater, "Spending check conflicted; retry shortly.", time.Second, codes.Aborted)
+	}
+	return nil
+}
+
+// ageBandPolicyFor resolves the configured policy for a user's stored band.
+func ageBandPolicyFor(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*ageBandPolicy, error) {
+	if len(cfg.AgeBandPolicies) == 0 {
+		return nil, nil
+	}
+	band, err := userAgeBand(ctx, nk, userID)
+	if err != nil {
+		return nil, fmt.Errorf("age band lookup failed: %w", err)
+	}
+	if band == "" {
+		return nil, nil
+	}
+	return cfg.AgeBandPolicies[band], nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Deployments that terminate Cognito auth at an AWS Application Load Balancer
+// receive the authenticated user's claims in the x-amzn-oidc-data header: a
+// JWT signed ES256 by the ALB with a key published at the regional
+// public-keys endpoint. rpc_login_alb exchanges that header for a Nakama
+// session so clients behind the balancer never resend raw Cognito tokens.
+// Because every balancer in a region signs with keys from the same endpoint,
+// the token's signer field must match the configured ALB ARN.
+
+const (
+	albOIDCDataHeader  = "x-amzn-oidc-data"
+	albKeyFetchTimeout = 5 * time.Second
+)
+
+// albKeyCache holds fetched ALB public keys by kid. ALB keys rotate rarely
+// and old kids are never reused, so entries are kept for the process
+// lifetime.
+var albKeyCache sync.Map // kid -> *ecdsa.PublicKey
+
+// albClaims are the user claims the ALB forwards. The payload carries the
+// upstream OIDC claims directly; there is no token_use field.
+type albClaims struct {
+	jwt.RegisteredClaims
+	Email           string `json:"email,omitempty"`
+	CognitoUsername string `json:"username,omitempty"`
+}
+
+// albPublicKey fetches (or returns the cached) ALB signing key for a kid from
+// the regional public-keys endpoint.
+func albPublicKey(kid string) (*ecdsa.PublicKey, error) {
+	if cached, ok := albKeyCache.Load(kid); ok {
+		return cached.(*ecdsa.PublicKey), nil
+	}
+
+	url := fmt.Sprintf("https://public-keys.auth.elb.%s.amazonaws.com/%s", cfg.CognitoRegion, kid)
+	client := &http.Client{Timeout: albKeyFetchTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("alb key fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("alb key fetch returned status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16*1024))
+	if err != nil {
+		return nil, fmt.Errorf("alb key fetch read failed: %w", err)
+	}
+
+	block, _ := pem.Decode(body)
+	if block == nil {
+		return nil, fmt.Errorf("alb key endpoint did not return PEM")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("alb key parse failed: %w", err)
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("alb key is not an ECDSA public key")
+	}
+
+	albKeyCache.Store(kid, key)
+	return key, nil
+}
+
+// verifyALBOIDCData validates an x-amzn-oidc-data header value: ES256
+// signature against the regional key, signer match against the configured
+// balancer ARN, and expiry.
+func verifyALBOIDCData(data string) (*albClaims, error) {
+	claims := &albClaims{}
+	token, err := jwt.ParseWithClaims(data, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token missing kid header")
+		}
+		return albPublicKey(kid)
+	},
+		jwt.WithValidMethods([]string{"ES256"}),
+		jwt.WithExpirationRequired(),
+		// ALB emits padded base64 segments, unlike standard JWTs.
+		jwt.WithPaddingAllowed(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, _ := token.Header["signer"].(string)
+	if signer != cfg.ALBSignerARN {
+		return nil, fmt.Errorf("token signer %q is not the configured balancer", signer)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("token missing sub claim")
+	}
+	return claims, nil
+}
+
+// albOIDCDataFromContext reads the ALB claims header of an HTTP RPC call.
+func albOIDCDataFromContext(ctx context.Context) string {
+	headers, ok := ctx.Value(nkruntime.RUNTIME_CTX_HEADERS).(map[string][]string)
+	if !ok {
+		return ""
+	}
+	for name, values := range headers {
+		if strings.EqualFold(name, albOIDCDataHeader) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// rpcLoginALB exchanges the ALB-forwarded claims header for a Nakama session.
+// The header is read from the HTTP request directly; a data field in the
+// payload is accepted as a fallback for transports that strip it.
+func rpcLoginALB(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	data := albOIDCDataFromContext(ctx)
+	if data == "" && payload != "" {
+		var req struct {
+			Data string `json:"data"`
+		}
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed login request.", codes.InvalidArgument)
+		}
+		data = req.Data
+	}
+	if data == "" {
+		return "", rpcError(errCodeBadInput, "Expects the x-amzn-oidc-data header or a data field.", codes.InvalidArgument)
+	}
+
+	claims, err := verifyALBOIDCData(data)
+	if err != nil {
+		logger.Debug("ALB claims verification failed: %v", err)
+		metricLogins.WithLabelValues("failure").Inc()
+		return "", rpcError(errCodeAuthFailed, "ALB claims verification failed.", codes.Unauthenticated)
+	}
+
+	rawClaims, _ := decodeClaimsMap(data)
+	return establishSession(ctx, logger, nk, &CognitoClaims{
+		RegisteredClaims: claims.RegisteredClaims,
+		Email:            claims.Email,
+		CognitoUsername:  claims.CognitoUsername,
+	}, rawClaims, "")
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Soft-launch admission: with NAKAMA_ALLOWLIST_ENABLED set, only explicitly
+// invited users get through login. Invitations are storage entries keyed by
+// Cognito sub or lowercased email so they survive restarts and are editable
+// live through the admin RPCs; members of an optional Cognito group pass
+// without an entry so internal staff pools need no bookkeeping. Everyone
+// else receives NOT_INVITED and a waitlist event is emitted for the growth
+// pipeline.
+
+const allowlistCollection = "allowlist"
+
+// allowlistEntry is one invitation.
+type allowlistEntry struct {
+	// Key is the invited sub or lowercased email.
+	Key     string `json:"key"`
+	Note    string `json:"note,omitempty"`
+	AddedAt int64  `json:"addedAt"`
+}
+
+// claimGroups extracts the Cognito group memberships from a raw claim set.
+func claimGroups(claims map[string]interface{}) []string {
+	raw, _ := claims["cognito:groups"].([]interface{})
+	groups := make([]string, 0, len(raw))
+	for _, g := range raw {
+		if s, ok := g.(string); ok {
+			groups = append(groups, s)
+		}
+	}
+	return groups
+}
+
+// checkAllowlist enforces soft-launch admission for a login. Returns nil when
+// the mode is disabled or the subject is invited.
+func checkAllowlist(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, claims *CognitoClaims, rawClaims map[string]interface{}) error {
+	if !cfg.AllowlistEnabled {
+		return nil
+	}
+
+	if cfg.AllowlistCognitoGroup != "" && rawClaims != nil {
+		for _, group := range claimGroups(rawClaims) {
+			if group == cfg.AllowlistCognitoGroup {
+				return nil
+			}
+		}
+	}
+
+	reads := []*nkruntime.StorageRead{{Collection: allowlistCollection, Key: strings.ToLower(claims.Subject)}}
+	email := strings.ToLower(claims.Email)
+	if email != "" {
+		reads = append(reads, &nkruntime.StorageRead{Collection: allowlistCollection, Key: email})
+	}
+	objects, err := nk.StorageRead(ctx, reads)
+	if err != nil {
+		// Fail closed: an unreadable allowlist admitting everyone would defeat
+		// the closed beta.
+		logger.Error("Allowlist read failed for sub %v: %v", claims.Subject, err)
+		return rpcError(errCodeInternal, "Login admission check failed.", codes.Internal)
+	}
+	if len(objects) > 0 {
+		return nil
+	}
+
+	metricLogins.WithLabelValues("not_invited").Inc()
+	if err := appendAudit(ctx, nk, "login.waitlisted", "", map[string]interface{}{
+		"sub": claims.Subject,
+	}); err != nil {
+		logger.Warn("Audit append failed for waitlisted sub %v: %v", claims.Subject, err)
+	}
+	// The waitlist event rides the SNS pipeline only; there is no user stream
+	// or per-user webhook for an account that was never created.
+	if eventPublisher != nil {
+		if data, err := json.Marshal(&WalletEvent{
+			Type:      "login.waitlisted",
+			Details:   map[string]interface{}{"sub": claims.Subject, "email": email},
+			CreatedAt: moduleClock.Now().Unix(),
+		}); err == nil {
+			eventPublisher.enqueue(string(data))
+		}
+	}
+	return rpcError(errCodeNotInvited, "Account is not invited to this environment yet.", codes.PermissionDenied)
+}
+
+// rpcAdminAllowlistAdd adds subs or emails to the allowlist. Server-to-server
+// only.
+func rpcAdminAllowlistAdd(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Keys []string `json:"keys"`
+		Note string   `json:"note,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || len(req.Keys) == 0 {
+		return "", rpcError(errCodeBadInput, "Expects a non-empty keys list of subs or emails.", codes.InvalidArgument)
+	}
+
+	writes := make([]*nkruntime.StorageWrite, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" {
+			return "", rpcError(errCodeBadInput, "Allowlist keys must be non-empty.", codes.InvalidArgument)
+		}
+		value, err := json.Marshal(&allowlistEntry{
+			Key:     key,
+			Note:    req.Note,
+			AddedAt: moduleClock.Now().Unix(),
+		})
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Entry encoding failed.", codes.Internal)
+		}
+		writes = append(writes, &nkruntime.StorageWrite{
+			Collection: allowlistCollection,
+			Key:        key,
+			Value:      string(value),
+		})
+	}
+	if _, err := nk.StorageWrite(ctx, writes); err != nil {
+		logger.Error("Allowlist write failed: %v", err)
+		return "", rpcError(errCodeInternal, "Allowlist update failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "allowlist.added", "", map[string]interface{}{
+		"keys": req.Keys,
+	}); err != nil {
+		logger.Error("Audit append failed for allowlist add: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+	return `{"added":true}`, nil
+}
+
+// rpcAdminAllowlistRemove removes subs or emails from the allowlist.
+// Server-to-server only.
+func rpcAdminAllowlistRemove(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Keys []string `json:"keys"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || len(req.Keys) == 0 {
+		return "", rpcError(errCodeBadInput, "Expects a non-empty keys list of subs or emails.", codes.InvalidArgument)
+	}
+
+	deletes := make([]*nkruntime.StorageDelete, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		deletes = append(deletes, &nkruntime.StorageDelete{
+			Collection: allowlistCollection,
+			Key:        strings.ToLower(strings.TrimSpace(key)),
+		})
+	}
+	if err := nk.StorageDelete(ctx, deletes); err != nil {
+		logger.Error("Allowlist delete failed: %v", err)
+		return "", rpcError(errCodeInternal, "Allowlist update failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "allowlist.removed", "", map[string]interface{}{
+		"keys": req.Keys,
+	}); err != nil {
+		logger.Error("Audit append failed for allowlist remove: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+	return `{"removed":true}`, nil
+}
+
+// rpcAdminAllowlistList pages through allowlist entries. Server-to-server
+// only.
+func rpcAdminAllowlistList(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Limit  int    `json:"limit,omitempty"`
+		Cursor string `json:"cursor,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed listing request.", codes.InvalidArgument)
+		}
+	}
+	req.Limit = normalizeListLimit(req.Limit)
+
+	objects, cursor, err := nk.StorageList(ctx, "", "", allowlistCollection, req.Limit, req.Cursor)
+	if err != nil {
+		logger.Error("Allowlist listing failed: %v", err)
+		return "", rpcError(errCodeInternal, "Allowlist listing failed.", codes.Internal)
+	}
+
+	entries := make([]*allowlistEntry, 0, len(objects))
+	for _, obj := range objects {
+		entry := &allowlistEntry{}
+		if err := json.Unmarshal([]byte(obj.Value), entry); err != nil {
+			logger.Warn("Skipping corrupt allowlist entry %v: %v", obj.Key, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"entries": entries,
+		"cursor":  cursor,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
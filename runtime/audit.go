@@ -0,0 +1,76 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+const auditCollection = "audit_log"
+
+// AuditEntry is one immutable record in the module audit log. Entries are
+// system-owned storage objects and are never updated after being written.
+type AuditEntry struct {
+	ID      string                 `json:"id"`
+	Event   string                 `json:"event"`
+	UserID  string                 `json:"userId,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	// Digest is the canonical-JSON SHA-256 of event, userId and details, so
+	// log consumers can detect tampering and deduplicate replayed entries.
+	Digest    string `json:"digest"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+// appendAudit writes an audit entry. Audit failures are surfaced to callers
+// so that sensitive operations do not proceed unrecorded.
+func appendAudit(ctx context.Context, nk nkruntime.NakamaModule, event string, userID string, details map[string]interface{}) error {
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return err
+	}
+	digest, err := payloadDigest(map[string]interface{}{
+		"event":   event,
+		"userId":  userID,
+		"details": details,
+	})
+	if err != nil {
+		return err
+	}
+	entry := &AuditEntry{
+		ID:        id,
+		Event:     event,
+		UserID:    userID,
+		Details:   details,
+		Digest:    digest,
+		CreatedAt: moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: auditCollection,
+		Key:        fmt.Sprintf("%d_%s", entry.CreatedAt, entry.ID),
+		Value:      string(value),
+	}}); err != nil {
+		return fmt.Errorf("audit write failed: %w", err)
+	}
+	sinkExport("audit", entry)
+	return nil
+}
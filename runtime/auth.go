@@ -0,0 +1,385 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// customIDPrefix namespaces Cognito subjects inside Nakama's custom ID
+// identity space so they can't collide with other custom auth users.
+const customIDPrefix = "cognito:"
+
+// CognitoClaims are the ID token claims the module cares about beyond the
+// registered set.
+type CognitoClaims struct {
+	jwt.RegisteredClaims
+	TokenUse        string `json:"token_use,omitempty"`
+	AuthTime        int64  `json:"auth_time,omitempty"`
+	Email           string `json:"email,omitempty"`
+	EmailVerified   bool   `json:"email_verified,omitempty"`
+	CognitoUsername string `json:"cognito:username,omitempty"`
+	Nonce           string `json:"nonce,omitempty"`
+	Country         string `json:"custom:country,omitempty"`
+	Birthdate       string `json:"birthdate,omitempty"`
+	AgeBand         string `json:"custom:age_band,omitempty"`
+}
+
+// customID maps a Cognito subject to the Nakama custom identity it owns.
+func customID(sub string) string {
+	return customIDPrefix + sub
+}
+
+// classifyTokenError buckets a parse failure for metricTokenFailures. The
+// jwt library wraps the causes it knows; anything else is "other" rather
+// than leaking free-form error text into a label.
+func classifyTokenError(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return "bad_signature"
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return "malformed"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "wrong_issuer"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "not_yet_valid"
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		// Covers keyfunc failures: missing kid header or a kid absent from
+		// the JWKS.
+		return "unknown_key"
+	default:
+		return "other"
+	}
+}
+
+// verifyIDToken validates a Cognito ID token against the configured issuer:
+// signature via the cached JWKS, issuer, expiry, token_use, and membership in
+// the given audience set when one is configured. Different RPC flows pass
+// different audience sets (login clients vs the linking companion app). A
+// non-nil tenant swaps in that tenant's issuer, key set and audiences.
+func verifyIDToken(tenant *TenantConfig, tokenString string, audiences []string) (*CognitoClaims, error) {
+	issuer := cfg.Issuer()
+	keys := jwksManager
+	if tenant != nil {
+		issuer = tenant.Issuer()
+		keys = tenantKeys(tenant)
+		if len(tenant.LoginAudiences) > 0 {
+			audiences = tenant.LoginAudiences
+		}
+	}
+
+	claims := &CognitoClaims{}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(idTokenAlgs),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token missing kid header")
+		}
+		return keys.Key(kid)
+	}, opts...)
+	if err != nil {
+		metricTokenFailures.WithLabelValues(classifyTokenError(err)).Inc()
+		return nil, err
+	}
+
+	if len(audiences) > 0 {
+		matched := false
+	audienceCheck:
+		for _, allowed := range audiences {
+			for _, aud := range claims.Audience {
+				if aud == allowed {
+					matched = true
+					break audienceCheck
+				}
+			}
+		}
+		if !matched {
+			metricTokenFailures.WithLabelValues("wrong_audience").Inc()
+			return nil, fmt.Errorf("token audience %v not in the allowed set", claims.Audience)
+		}
+	}
+
+	if claims.TokenUse != "id" {
+		metricTokenFailures.WithLabelValues("bad_token_use").Inc()
+		return nil, fmt.Errorf("expected an ID token, got token_use %q", claims.TokenUse)
+	}
+	if claims.Subject == "" {
+		metricTokenFailures.WithLabelValues("malformed").Inc()
+		return nil, fmt.Errorf("token missing sub claim")
+	}
+	return claims, nil
+}
+
+// LoginRequest is the payload for rpc_login.
+type LoginRequest struct {
+	Token string `json:"token"`
+	// Tenant names the title this login belongs to on multi-tenant
+	// clusters; see tenant.go. Empty is the default tenant.
+	Tenant string `json:"tenant,omitempty"`
+	// Platform optionally names the client platform (e.g. ios, android,
+	// web) for failure analytics; see loginstats.go.
+	Platform string `json:"platform,omitempty"`
+	// Nonce is the nonce the client bound into its OIDC authorization
+	// request, checked against the token's nonce claim; see nonce.go.
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// LoginResponse is returned by rpc_login on success.
+type LoginResponse struct {
+	Token    string `json:"token"`
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	Created  bool   `json:"created"`
+	// Flags is the feature-flag assignment computed at login; see flags.go.
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+// rpcLogin exchanges a Cognito ID token for a Nakama session. New subjects
+// get an account created on first login.
+func rpcLogin(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	var req LoginRequest
+	if err := unmarshalPayload(payload, &req); err != nil || req.Token == "" {
+		return "", rpcError(errCodeBadInput, "Expects payload with a non-empty token field.", codes.InvalidArgument)
+	}
+
+	ctx = loginPlatformContext(ctx, req.Platform)
+
+	tenant, err := tenantByID(req.Tenant)
+	if err != nil {
+		recordLoginFailure(ctx, logger, nk, loginFailUnknownTenant, req.Tenant, nil)
+		return "", rpcError(errCodeBadInput, "Unknown tenant.", codes.InvalidArgument)
+	}
+
+	claims, err := verifyIDToken(tenant, req.Token, cfg.LoginAudiences)
+	if err != nil {
+		logger.Debug("Cognito token verification failed: %v", err)
+		metricLogins.WithLabelValues("failure").Inc()
+		// The unverified claims still tell us which issuer and audience the
+		// client brought, which is exactly what failure triage needs.
+		failedClaims := &CognitoClaims{}
+		_, _, _ = jwt.NewParser().ParseUnverified(req.Token, failedClaims)
+		recordLoginFailure(ctx, logger, nk, loginFailVerify, err.Error(), failedClaims)
+		return "", rpcError(errCodeAuthFailed, "ID token verification failed.", codes.Unauthenticated)
+	}
+	if err := checkTokenFreshness(claims, tokenOpLogin); err != nil {
+		recordLoginFailure(ctx, logger, nk, loginFailStaleToken, "", claims)
+		return "", err
+	}
+	if err := checkLoginNonce(ctx, nk, req.Nonce, claims.Nonce); err != nil {
+		logger.Debug("Login nonce check failed for sub %v: %v", claims.Subject, err)
+		metricLogins.WithLabelValues("nonce").Inc()
+		recordLoginFailure(ctx, logger, nk, loginFailNonce, err.Error(), claims)
+		return "", rpcError(errCodeAuthFailed, "Token nonce validation failed.", codes.Unauthenticated)
+	}
+
+	rawClaims, _ := decodeClaimsMap(req.Token)
+	return establishSession(ctx, logger, nk, claims, rawClaims, req.Tenant)
+}
+
+// gateLogin runs the pre-account login gates shared by every door into the
+// module — rpc_login, the ALB header exchange and the stock-auth hook: surge
+// admission, claim ban rules, claim assertions, the soft-launch allowlist
+// and the live pool status check. On success the caller must invoke the
+// returned release when its login work completes.
+func gateLogin(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, claims *CognitoClaims, rawClaims map[string]interface{}) (func(), error) {
+	// Surge protection: shed load here, before any storage or network work,
+	// so an overloaded node answers QUEUE_FULL instead of timing out.
+	release, err := loginAdmission.admit()
+	if err != nil {
+		recordLoginFailure(ctx, logger, nk, loginFailQueueFull, "", claims)
+		return nil, err
+	}
+
+	// Claim-based gating runs before any account work, so banned subjects
+	// never touch AuthenticateCustom.
+	if rawClaims != nil {
+		if rule := matchBanRules(cfg.BanRules, rawClaims); rule != nil {
+			release()
+			metricLogins.WithLabelValues("banned").Inc()
+			if err := appendAudit(ctx, nk, "login.banned", "", map[string]interface{}{
+				"sub":   claims.Subject,
+				"claim": rule.Claim,
+			}); err != nil {
+				logger.Warn("Audit append failed for banned login of sub %v: %v", claims.Subject, err)
+			}
+			recordLoginFailure(ctx, logger, nk, loginFailBanned, rule.Claim, claims)
+			return nil, rpcError(errCodeAccountDisabled, "Account is disabled.", codes.PermissionDenied)
+		}
+	}
+
+	// Deployment-specific claim assertions and compiled-in validators; see
+	// claimrules.go. The reason stays in the server log.
+	if reason := checkClaimAssertions(ctx, rawClaims); reason != "" {
+		release()
+		logger.Debug("Claim assertion refused login for sub %v: %v", claims.Subject, reason)
+		metricLogins.WithLabelValues("assertion").Inc()
+		recordLoginFailure(ctx, logger, nk, loginFailAssertion, reason, claims)
+		return nil, rpcError(errCodeAuthFailed, "ID token does not satisfy this deployment's requirements.", codes.Unauthenticated)
+	}
+
+	// Soft-launch admission: uninvited subjects are turned away before any
+	// account exists for them; see allowlist.go.
+	if err := checkAllowlist(ctx, logger, nk, claims, rawClaims); err != nil {
+		release()
+		recordLoginFailure(ctx, logger, nk, loginFailNotInvited, "", claims)
+		return nil, err
+	}
+
+	// Live pool status, when configured: tokens from disabled users still
+	// carry valid signatures, so the claim checks above can't catch them.
+	if err := checkUserEnabled(ctx, logger, nk, claims.Subject); err != nil {
+		release()
+		recordLoginFailure(ctx, logger, nk, loginFailDisabled, "", claims)
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// establishSession turns verified Cognito claims into a Nakama session,
+// creating the account on first login. Shared between the direct token login
+// and the ALB header exchange.
+func establishSession(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, claims *CognitoClaims, rawClaims map[string]interface{}, tenantID string) (string, error) {
+	release, err := gateLogin(ctx, logger, nk, claims, rawClaims)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	username := claims.CognitoUsername
+	if username == "" {
+		username = claims.Subject
+	}
+
+	id := customID(claims.Subject)
+
+	// Fast path: existing accounts log in without serialization.
+	var userID string
+	var created bool
+	err = withRetry(ctx, logger, "authenticate_custom", func() error {
+		var authErr error
+		userID, username, created, authErr = nk.AuthenticateCustom(ctx, id, username, false)
+		return authErr
+	})
+	if err != nil {
+		// Account creation is the expensive path, so it pays a token from
+		// the creation bucket before the bootstrap guard.
+		if err := loginAdmission.admitCreate(); err != nil {
+			recordLoginFailure(ctx, logger, nk, loginFailQueueFull, "create", claims)
+			return "", err
+		}
+		// Brand-new subject: serialize bootstrap per external ID so exactly
+		// one concurrent login runs account creation; the rest wait on the
+		// guard and reuse the created account.
+		guardErr := withLoginGuard(ctx, nk, id, func() error {
+			return withRetry(ctx, logger, "authenticate_custom_create", func() error {
+				userID, username, created, err = nk.AuthenticateCustom(ctx, id, username, true)
+				return err
+			})
+		})
+		if guardErr == nil {
+			guardErr = err
+		}
+		if guardErr != nil {
+			logger.Error("AuthenticateCustom failed for sub %v: %v", claims.Subject, guardErr)
+			metricLogins.WithLabelValues("failure").Inc()
+			recordLoginFailure(ctx, logger, nk, loginFailInternal, "authenticate_custom", claims)
+			return "", rpcError(errCodeInternal, "Authentication failed.", codes.Internal)
+		}
+	}
+	metricLogins.WithLabelValues("success").Inc()
+
+	if claims.Country != "" {
+		// Best effort; jurisdiction checks degrade to IP lookup when absent.
+		if err := storeUserCountry(ctx, nk, userID, claims.Country, "claim"); err != nil {
+			logger.Warn("Country claim store failed for user %v: %v", userID, err)
+		}
+	}
+	if band, source := ageBandFromClaims(claims); band != "" {
+		// Best effort; an unwritten band leaves the user unrestricted until
+		// the next login, matching a user with no age claim at all.
+		if err := storeAgeBand(ctx, nk, userID, band, source); err != nil {
+			logger.Warn("Age band store failed for user %v: %v", userID, err)
+		}
+	}
+
+	// Best effort; dormancy tracking must not fail logins.
+	if err := touchActivity(ctx, nk, userID, "login"); err != nil {
+		logger.Warn("Activity record failed for user %v: %v", userID, err)
+	}
+
+	// Metadata updates happen off the login path; the worker retries failures.
+	if err := queueMetadataSync(ctx, nk, userID, claims); err != nil {
+		logger.Warn("Metadata sync enqueue failed for user %v: %v", userID, err)
+	}
+
+	// Flags ride in both the response and the session vars so client and
+	// server hooks agree on the assignment for the session's lifetime.
+	flags := evaluateFlags(ctx, logger, nk, loginFlagAttributes(ctx, logger, nk, userID, claims.Country))
+
+	vars := sessionVarsForFlags(flags)
+	if tenantID != "" {
+		// The tenant rides in the session so every later call resolves its
+		// storage namespace and policy set without re-stating it.
+		if vars == nil {
+			vars = make(map[string]string, 1)
+		}
+		vars[sessionTenantVar] = tenantID
+	}
+
+	token, _, err := nk.AuthenticateTokenGenerate(userID, username, 0, vars)
+	if err != nil {
+		logger.Error("Session token generation failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Session creation failed.", codes.Internal)
+	}
+
+	resp := &LoginResponse{
+		Token:    token,
+		UserID:   userID,
+		Username: username,
+		Created:  created,
+		Flags:    flags,
+	}
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// subFromCustomID extracts the Cognito subject from a module-owned custom ID,
+// or returns false if the custom ID belongs to another auth scheme.
+func subFromCustomID(id string) (string, bool) {
+	if !strings.HasPrefix(id, customIDPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(id, customIDPrefix), true
+}
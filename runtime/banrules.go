@@ -0,0 +1,117 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Logins can be refused based on ID token claims, so accounts disabled or
+// flagged in Cognito stop getting sessions without a separate ban store. Rules
+// are claim name/value predicates evaluated before AuthenticateCustom.
+
+// banRule refuses login when the named claim matches. Equals matches one
+// value; OneOf matches any of a set. A rule with neither matches whenever the
+// claim is present and truthy-looking is NOT supported — every rule must state
+// its values explicitly.
+type banRule struct {
+	Claim  string   `json:"claim"`
+	Equals string   `json:"equals,omitempty"`
+	OneOf  []string `json:"oneOf,omitempty"`
+}
+
+// defaultBanRules applies when NAKAMA_LOGIN_BAN_RULES is unset: the
+// conventional custom:banned flag in its common encodings.
+var defaultBanRules = []*banRule{
+	{Claim: "custom:banned", OneOf: []string{"true", "1"}},
+}
+
+// loadBanRules parses the configured claim-based ban rules.
+func loadBanRules(ctx context.Context) ([]*banRule, error) {
+	raw := moduleEnv(ctx, "NAKAMA_LOGIN_BAN_RULES")
+	if raw == "" {
+		return defaultBanRules, nil
+	}
+	var rules []*banRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid NAKAMA_LOGIN_BAN_RULES: %w", err)
+	}
+	for _, rule := range rules {
+		if rule.Claim == "" || (rule.Equals == "" && len(rule.OneOf) == 0) {
+			return nil, fmt.Errorf("invalid NAKAMA_LOGIN_BAN_RULES: each rule needs a claim and equals or oneOf")
+		}
+	}
+	return rules, nil
+}
+
+// decodeClaimsMap extracts the full claim set of an already-verified token,
+// so rules can reference claims the typed CognitoClaims struct doesn't model.
+func decodeClaimsMap(tokenString string) (map[string]interface{}, error) {
+	parts := strings.Split(tokenString, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+	// ALB-issued tokens pad their segments; raw decoding covers standard JWTs.
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("malformed token payload: %w", err)
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	return claims, nil
+}
+
+// claimString renders a claim value for rule comparison. Cognito encodes
+// custom attributes as strings but standard flags may arrive as booleans or
+// numbers.
+func claimString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case bool:
+		return strconv.FormatBool(t)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// matchBanRules returns the first rule the claim set violates, or nil.
+func matchBanRules(rules []*banRule, claims map[string]interface{}) *banRule {
+	for _, rule := range rules {
+		raw, ok := claims[rule.Claim]
+		if !ok {
+			continue
+		}
+		value := claimString(raw)
+		if rule.Equals != "" && value == rule.Equals {
+			return rule
+		}
+		for _, candidate := range rule.OneOf {
+			if value == candidate {
+				return rule
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// With NAKAMA_EVM_BROADCAST enabled the module submits signed transactions to
+// the configured NAKAMA_EVM_RPC_URL node itself instead of leaving broadcast
+// to the chain watcher. The submission is a plain eth_sendRawTransaction over
+// JSON-RPC — the module speaks the wire protocol directly, like every other
+// endpoint it talks to, rather than pulling in a chain client library.
+// Transport failures are retried with the module-wide backoff; a rejection
+// from the node itself (bad nonce, underpriced, insufficient funds) is
+// permanent and marks the record failed. Either way the signed transaction
+// stays persisted, so nothing is lost to a flaky node.
+
+const evmBroadcastTimeout = 15 * time.Second
+
+// evmBroadcastClient keeps connections to the RPC node pooled; broadcast sits
+// on the user signing path and should not pay a TLS handshake per call.
+var evmBroadcastClient = &http.Client{
+	Timeout: evmBroadcastTimeout,
+	Transport: &http.Transport{
+		MaxIdleConns:        8,
+		MaxIdleConnsPerHost: 8,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+var metricTxBroadcast = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "nakama_module_tx_broadcast_total",
+	Help: "Transaction broadcast attempts by result.",
+}, []string{"result"})
+
+func init() {
+	metricsRegistry.MustRegister(metricTxBroadcast)
+}
+
+// txRejectedError is a definitive refusal from the node: the transaction as
+// signed will never be accepted, so retrying is pointless.
+type txRejectedError struct {
+	message string
+}
+
+func (e *txRejectedError) Error() string {
+	return fmt.Sprintf("node rejected transaction: %s", e.message)
+}
+
+// ethSendRawTransaction submits one signed transaction and returns the hash
+// the node computed for it. A JSON-RPC error object comes back as a
+// txRejectedError; transport and decoding failures come back as-is for the
+// retry classifier.
+func ethSendRawTransaction(ctx context.Context, raw string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, evmBroadcastTimeout)
+	defer cancel()
+
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":[%q]}`, raw)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.EVMRPCURL, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := evmBroadcastClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("eth_sendRawTransaction failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", fmt.Errorf("eth_sendRawTransaction response malformed: %w", err)
+	}
+	if decoded.Error != nil {
+		return "", &txRejectedError{message: decoded.Error.Message}
+	}
+	return decoded.Result, nil
+}
+
+// broadcastTransactionRecord submits a signed transaction record to the node
+// and advances its status to broadcast. A node that already knows the
+// transaction — a previous attempt landed before its response was lost — is
+// treated as success. Returns a txRejectedError when the node refused the
+// transaction outright.
+func broadcastTransactionRecord(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID string, record *TransactionRecord) error {
+	err := withRetry(ctx, logger, "tx_broadcast", func() error {
+		_, err := ethSendRawTransaction(ctx, record.Raw)
+		return err
+	})
+	if err != nil {
+		// Re-submissions of a transaction the pool already holds are not
+		// failures; the first attempt simply won.
+		msg := strings.ToLower(err.Error())
+		if !strings.Contains(msg, "already known") && !strings.Contains(msg, "known transaction") {
+			var rejected *txRejectedError
+			if errors.As(err, &rejected) {
+				metricTxBroadcast.WithLabelValues("rejected").Inc()
+			} else {
+				metricTxBroadcast.WithLabelValues("error").Inc()
+			}
+			return err
+		}
+	}
+	metricTxBroadcast.WithLabelValues("ok").Inc()
+
+	record.Status = txStatusBroadcast
+	// Best effort: a missed status write leaves the record signed, which the
+	// watcher resolves the same way it resolves watcher-broadcast flows.
+	if writeErr := writeTransactionRecord(ctx, nk, userID, record); writeErr != nil {
+		logger.Warn("Broadcast status write failed for tx %v: %v", record.ID, writeErr)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// The response cache is per process, so on multi-node clusters a freeze,
+// unlink or transaction observed on one node leaves stale entries on the
+// others until the TTL runs out. The invalidation bus closes that window
+// with a storage-version tick: writers append the affected user to a shared
+// sequence record, and every node polls it and drops that user's cached
+// responses. A node that falls behind the retained window flushes its whole
+// cache rather than guess what it missed, so staleness stays bounded by the
+// poll interval either way.
+
+const (
+	cacheBusCollection = "cache_bus"
+	cacheBusKey        = "tick"
+	// cacheBusRetained is how many recent invalidations the tick record
+	// keeps; pollers further behind than this flush everything.
+	cacheBusRetained     = 256
+	cacheBusPollInterval = 2 * time.Second
+	cacheBusCASAttempts  = 5
+)
+
+// cacheBusEntry is one published invalidation.
+type cacheBusEntry struct {
+	Seq    uint64 `json:"seq"`
+	UserID string `json:"userId"`
+	Reason string `json:"reason,omitempty"`
+	Node   string `json:"node"`
+	At     int64  `json:"at"`
+}
+
+// cacheBusTick is the shared sequence record.
+type cacheBusTick struct {
+	Seq     uint64           `json:"seq"`
+	Entries []*cacheBusEntry `json:"entries"`
+}
+
+var (
+	cacheBusMu       sync.Mutex
+	cacheBusLastSeen uint64
+)
+
+// cacheInvalidateCluster drops a user's cached responses on this node and
+// publishes the invalidation for the rest of the cluster. Publishing is best
+// effort: a lost tick degrades to TTL expiry, same as before the bus.
+func cacheInvalidateCluster(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, reason string) {
+	respCacheInvalidate(userID)
+	if cfg.ResponseCacheTTL <= 0 {
+		return
+	}
+
+	for attempt := 0; attempt < cacheBusCASAttempts; attempt++ {
+		tick, version, err := readCacheBusTick(ctx, nk)
+		if err != nil {
+			logger.Warn("Cache bus read failed: %v", err)
+			return
+		}
+		tick.Seq++
+		tick.Entries = append(tick.Entries, &cacheBusEntry{
+			Seq:    tick.Seq,
+			UserID: userID,
+			Reason: reason,
+			Node:   nodeID,
+			At:     moduleClock.Now().Unix(),
+		})
+		if len(tick.Entries) > cacheBusRetained {
+			tick.Entries = tick.Entries[len(tick.Entries)-cacheBusRetained:]
+		}
+		value, err := json.Marshal(tick)
+		if err != nil {
+			logger.Warn("Cache bus encoding failed: %v", err)
+			return
+		}
+		if version == "" {
+			version = "*"
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: cacheBusCollection,
+			Key:        cacheBusKey,
+			Value:      string(value),
+			Version:    version,
+		}}); err != nil {
+			continue // CAS race, retry.
+		}
+		return
+	}
+	logger.Warn("Cache bus publish contended out for user %v", userID)
+}
+
+func readCacheBusTick(ctx context.Context, nk nkruntime.NakamaModule) (*cacheBusTick, string, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: cacheBusCollection,
+		Key:        cacheBusKey,
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+	tick := &cacheBusTick{}
+	if len(objects) == 0 {
+		return tick, "", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), tick); err != nil {
+		return &cacheBusTick{}, objects[0].Version, nil
+	}
+	return tick, objects[0].Version, nil
+}
+
+// runCacheBusPoller applies cluster invalidations on this node. Unlike the
+// leased workers every node runs its own poller — each process has its own
+// cache to clean.
+func runCacheBusPoller(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+	ticker := time.NewTicker(cacheBusPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		tick, _, err := readCacheBusTick(ctx, nk)
+		if err != nil {
+			logger.Warn("Cache bus poll failed: %v", err)
+			continue
+		}
+
+		cacheBusMu.Lock()
+		lastSeen := cacheBusLastSeen
+		cacheBusMu.Unlock()
+		if tick.Seq <= lastSeen {
+			continue
+		}
+
+		// A gap beyond the retained entries means invalidations were lost to
+		// this node; flush rather than serve who-knows-what.
+		oldestRetained := tick.Seq
+		if len(tick.Entries) > 0 {
+			oldestRetained = tick.Entries[0].Seq
+		}
+		if lastSeen+1 < oldestRetained {
+			respCacheFlush()
+		} else {
+			for _, entry := range tick.Entries {
+				if entry.Seq > lastSeen && entry.Node != nodeID {
+					respCacheInvalidate(entry.UserID)
+				}
+			}
+		}
+
+		cacheBusMu.Lock()
+		if tick.Seq > cacheBusLastSeen {
+			cacheBusLastSeen = tick.Seq
+		}
+		cacheBusMu.Unlock()
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Canonical JSON gives byte-identical output for semantically equal values:
+// object keys are sorted, whitespace is dropped, numbers keep their source
+// representation and nothing is HTML-escaped. Anything hashed or signed —
+// audit payload digests, idempotency keys, webhook HMACs — must go through
+// this encoder rather than json.Marshal so the result does not depend on
+// field ordering or encoder quirks.
+
+// canonicalJSON encodes a value deterministically. The value is first
+// round-tripped through json.Marshal, so anything marshalable is accepted.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonicalString emits a JSON string literal without HTML escaping;
+// json.Marshal would turn <, > and & into \u escapes and break the promise
+// above for partners verifying digests with an RFC 8785-style encoder.
+func writeCanonicalString(buf *bytes.Buffer, s string) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	// Encode appends a newline the canonical form must not carry.
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// writeCanonical emits one decoded JSON value with sorted object keys.
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonicalString(buf, k); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, value[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case json.Number:
+		buf.WriteString(value.String())
+	case string:
+		if err := writeCanonicalString(buf, value); err != nil {
+			return err
+		}
+	case bool:
+		if value {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("canonical json: unexpected type %T", v)
+	}
+	return nil
+}
+
+// payloadDigest returns the hex SHA-256 digest of a value's canonical JSON
+// encoding. Equal payloads always digest identically regardless of how their
+// fields were ordered at the source.
+func payloadDigest(v interface{}) (string, error) {
+	canonical, err := canonicalJSON(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalJSONSortsKeys(t *testing.T) {
+	out, err := canonicalJSON(map[string]interface{}{
+		"zed":   1,
+		"alpha": "x",
+		"mid":   true,
+	})
+	if err != nil {
+		t.Fatalf("canonicalJSON failed: %v", err)
+	}
+	expected := `{"alpha":"x","mid":true,"zed":1}`
+	if string(out) != expected {
+		t.Fatalf("expected %s, got %s", expected, out)
+	}
+}
+
+func TestCanonicalJSONStableAcrossFieldOrdering(t *testing.T) {
+	var a, b interface{}
+	if err := json.Unmarshal([]byte(`{"b":2,"a":{"y":[1,2,3],"x":null}}`), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"a":{"x":null,"y":[1,2,3]},"b":2}`), &b); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := canonicalJSON(a)
+	if err != nil {
+		t.Fatalf("canonicalJSON failed: %v", err)
+	}
+	cb, err := canonicalJSON(b)
+	if err != nil {
+		t.Fatalf("canonicalJSON failed: %v", err)
+	}
+	if string(ca) != string(cb) {
+		t.Fatalf("canonical forms differ: %s vs %s", ca, cb)
+	}
+}
+
+func TestCanonicalJSONNestedStructures(t *testing.T) {
+	type inner struct {
+		B string `json:"b"`
+		A int    `json:"a"`
+	}
+	out, err := canonicalJSON(map[string]interface{}{
+		"list": []interface{}{inner{B: "s", A: 7}, nil},
+	})
+	if err != nil {
+		t.Fatalf("canonicalJSON failed: %v", err)
+	}
+	expected := `{"list":[{"a":7,"b":"s"},null]}`
+	if string(out) != expected {
+		t.Fatalf("expected %s, got %s", expected, out)
+	}
+}
+
+func TestCanonicalJSONDoesNotEscapeHTML(t *testing.T) {
+	out, err := canonicalJSON(map[string]interface{}{
+		"a<b": "x & y > z",
+	})
+	if err != nil {
+		t.Fatalf("canonicalJSON failed: %v", err)
+	}
+	expected := `{"a<b":"x & y > z"}`
+	if string(out) != expected {
+		t.Fatalf("expected %s, got %s", expected, out)
+	}
+}
+
+func TestCanonicalJSONPreservesNumbers(t *testing.T) {
+	decoder := json.NewDecoder(strings.NewReader(`{"wei":"1000000000000000000","n":18446744073709551615}`))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	out, err := canonicalJSON(v)
+	if err != nil {
+		t.Fatalf("canonicalJSON failed: %v", err)
+	}
+	expected := `{"n":18446744073709551615,"wei":"1000000000000000000"}`
+	if string(out) != expected {
+		t.Fatalf("expected %s, got %s", expected, out)
+	}
+}
+
+func TestPayloadDigestStable(t *testing.T) {
+	d1, err := payloadDigest(map[string]interface{}{"event": "tx.signed", "userId": "u1"})
+	if err != nil {
+		t.Fatalf("payloadDigest failed: %v", err)
+	}
+	d2, err := payloadDigest(map[string]interface{}{"userId": "u1", "event": "tx.signed"})
+	if err != nil {
+		t.Fatalf("payloadDigest failed: %v", err)
+	}
+	if d1 != d2 {
+		t.Fatalf("digests differ for equal payloads: %s vs %s", d1, d2)
+	}
+	d3, err := payloadDigest(map[string]interface{}{"event": "tx.signed", "userId": "u2"})
+	if err != nil {
+		t.Fatalf("payloadDigest failed: %v", err)
+	}
+	if d1 == d3 {
+		t.Fatal("digests collide for different payloads")
+	}
+}
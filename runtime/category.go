@@ -0,0 +1,110 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Transactions are categorized once, at signing time, from deployment-
+// configured destination and method selector rules. The category is stored on
+// the record so listings, statements and analytics events all agree on it —
+// recategorizing history would silently rewrite reports users have already
+// exported.
+
+// Transaction categories.
+const (
+	txCategoryMarketplace = "marketplace"
+	txCategoryReward      = "reward"
+	txCategoryTransfer    = "transfer"
+	txCategoryMint        = "mint"
+)
+
+var txCategories = map[string]bool{
+	txCategoryMarketplace: true,
+	txCategoryReward:      true,
+	txCategoryTransfer:    true,
+	txCategoryMint:        true,
+}
+
+// categoryRule assigns a category when a transaction matches. To and Selector
+// are each optional but at least one must be set; when both are set both must
+// match. Rules are evaluated in order and the first match wins.
+type categoryRule struct {
+	Category string `json:"category"`
+	// To matches the destination address, case-insensitively.
+	To string `json:"to,omitempty"`
+	// Selector matches the 4-byte method selector of the calldata, e.g.
+	// "0xa9059cbb" for ERC-20 transfer.
+	Selector string `json:"selector,omitempty"`
+}
+
+// loadCategoryRules parses the configured categorization rules.
+func loadCategoryRules(ctx context.Context) ([]*categoryRule, error) {
+	raw := moduleEnv(ctx, "NAKAMA_TX_CATEGORY_RULES")
+	if raw == "" {
+		return nil, nil
+	}
+	var rules []*categoryRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid NAKAMA_TX_CATEGORY_RULES: %w", err)
+	}
+	for _, rule := range rules {
+		if !txCategories[rule.Category] {
+			return nil, fmt.Errorf("invalid NAKAMA_TX_CATEGORY_RULES: unknown category %q", rule.Category)
+		}
+		if rule.To == "" && rule.Selector == "" {
+			return nil, fmt.Errorf("invalid NAKAMA_TX_CATEGORY_RULES: each rule needs a to address or a selector")
+		}
+		if rule.Selector != "" {
+			selector := strings.TrimPrefix(strings.ToLower(rule.Selector), "0x")
+			if len(selector) != 8 {
+				return nil, fmt.Errorf("invalid NAKAMA_TX_CATEGORY_RULES: selector %q is not 4 bytes", rule.Selector)
+			}
+			rule.Selector = selector
+		}
+	}
+	return rules, nil
+}
+
+// categorizeTransaction resolves the category for a destination and calldata.
+// Plain value transfers default to the transfer category; contract calls that
+// match no rule stay uncategorized.
+func categorizeTransaction(to, data string) string {
+	selector := strings.TrimPrefix(strings.ToLower(data), "0x")
+	if len(selector) >= 8 {
+		selector = selector[:8]
+	} else {
+		selector = ""
+	}
+
+	for _, rule := range cfg.CategoryRules {
+		if rule.To != "" && !strings.EqualFold(rule.To, to) {
+			continue
+		}
+		if rule.Selector != "" && rule.Selector != selector {
+			continue
+		}
+		return rule.Category
+	}
+
+	if selector == "" {
+		return txCategoryTransfer
+	}
+	return ""
+}
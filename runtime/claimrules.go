@@ -0,0 +1,178 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Deployments carry bespoke token rules beyond the standard checks: a
+// required custom:tenant claim, a minimum auth_time, specific amr values.
+// Two extension points cover them. NAKAMA_CLAIM_ASSERTIONS holds JSON rules
+// (claim, operator, value) evaluated after signature and issuer validation;
+// sibling Go modules compiled into the same plugin can additionally register
+// validator functions for logic rules can't express. A token failing either
+// is refused before any account work, like the ban rules.
+
+// Assertion operators.
+const (
+	claimOpEquals   = "eq"
+	claimOpNotEqual = "ne"
+	claimOpIn       = "in"
+	claimOpGTE      = "gte"
+	claimOpLTE      = "lte"
+	claimOpExists   = "exists"
+	// claimOpContains matches when an array claim (amr, cognito:groups)
+	// contains the value.
+	claimOpContains = "contains"
+)
+
+// claimAssertion is one configured rule. Value is compared as a string
+// except under gte/lte, which compare numerically.
+type claimAssertion struct {
+	Claim  string   `json:"claim"`
+	Op     string   `json:"op"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// loadClaimAssertions parses NAKAMA_CLAIM_ASSERTIONS. Absent means no extra
+// assertions.
+func loadClaimAssertions(ctx context.Context) ([]*claimAssertion, error) {
+	raw := moduleEnv(ctx, "NAKAMA_CLAIM_ASSERTIONS")
+	if raw == "" {
+		return nil, nil
+	}
+	var rules []*claimAssertion
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("invalid NAKAMA_CLAIM_ASSERTIONS: %w", err)
+	}
+	for _, rule := range rules {
+		if rule.Claim == "" {
+			return nil, fmt.Errorf("invalid NAKAMA_CLAIM_ASSERTIONS: each rule needs a claim")
+		}
+		switch rule.Op {
+		case claimOpEquals, claimOpNotEqual, claimOpGTE, claimOpLTE, claimOpContains:
+			if rule.Value == "" {
+				return nil, fmt.Errorf("invalid NAKAMA_CLAIM_ASSERTIONS: operator %q on %q needs a value", rule.Op, rule.Claim)
+			}
+		case claimOpIn:
+			if len(rule.Values) == 0 {
+				return nil, fmt.Errorf("invalid NAKAMA_CLAIM_ASSERTIONS: operator in on %q needs values", rule.Claim)
+			}
+		case claimOpExists:
+		default:
+			return nil, fmt.Errorf("invalid NAKAMA_CLAIM_ASSERTIONS: unknown operator %q", rule.Op)
+		}
+	}
+	return rules, nil
+}
+
+// check reports whether the claim set satisfies the assertion.
+func (r *claimAssertion) check(claims map[string]interface{}) bool {
+	raw, present := claims[r.Claim]
+	if !present {
+		return false
+	}
+	switch r.Op {
+	case claimOpExists:
+		return true
+	case claimOpEquals:
+		return claimString(raw) == r.Value
+	case claimOpNotEqual:
+		return claimString(raw) != r.Value
+	case claimOpIn:
+		value := claimString(raw)
+		for _, candidate := range r.Values {
+			if value == candidate {
+				return true
+			}
+		}
+		return false
+	case claimOpGTE, claimOpLTE:
+		actual, err := strconv.ParseFloat(claimString(raw), 64)
+		if err != nil {
+			return false
+		}
+		bound, err := strconv.ParseFloat(r.Value, 64)
+		if err != nil {
+			return false
+		}
+		if r.Op == claimOpGTE {
+			return actual >= bound
+		}
+		return actual <= bound
+	case claimOpContains:
+		entries, ok := raw.([]interface{})
+		if !ok {
+			return false
+		}
+		for _, entry := range entries {
+			if claimString(entry) == r.Value {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// ClaimValidator is a compiled-in custom validator. Returning an error
+// refuses the login; the error text stays server-side.
+type ClaimValidator func(ctx context.Context, claims map[string]interface{}) error
+
+var (
+	claimValidatorsMu sync.Mutex
+	claimValidators   []ClaimValidator
+)
+
+// RegisterClaimValidator adds a validator run on every login after the
+// configured assertions. For sibling Go modules in the same plugin; call
+// before or during their InitModule.
+func RegisterClaimValidator(fn ClaimValidator) {
+	claimValidatorsMu.Lock()
+	claimValidators = append(claimValidators, fn)
+	claimValidatorsMu.Unlock()
+}
+
+// checkClaimAssertions runs the configured rules and registered validators
+// against a verified token's full claim set. Returns the failure reason for
+// the server log, or empty when the token passes.
+func checkClaimAssertions(ctx context.Context, claims map[string]interface{}) string {
+	if claims == nil {
+		if len(cfg.ClaimAssertions) > 0 {
+			return "claim set unavailable"
+		}
+		return ""
+	}
+	for _, rule := range cfg.ClaimAssertions {
+		if !rule.check(claims) {
+			return fmt.Sprintf("claim %q failed %s assertion", rule.Claim, rule.Op)
+		}
+	}
+	claimValidatorsMu.Lock()
+	validators := claimValidators
+	claimValidatorsMu.Unlock()
+	for _, validate := range validators {
+		if err := validate(ctx, claims); err != nil {
+			return err.Error()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,268 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Fraudulent transactions go through a tracked clawback workflow: flagging a
+// confirmed transaction freezes the involved wallet and opens a case with a
+// recovery proposal — a reverse transfer when the destination is a
+// game-controlled address, a treasury compensation entry otherwise. Cases are
+// resolved explicitly and every transition is audited.
+
+const (
+	clawbackCollection = "clawbacks"
+	freezeCollection   = "wallet_freeze"
+	freezeKey          = "freeze"
+)
+
+// Clawback case statuses and proposal kinds.
+const (
+	clawbackStatusOpen     = "open"
+	clawbackStatusResolved = "resolved"
+
+	clawbackProposalReverse    = "reverse_transfer"
+	clawbackProposalCompensate = "treasury_compensation"
+)
+
+// clawbackCase tracks one flagged transaction through resolution.
+type clawbackCase struct {
+	ID         string `json:"id"`
+	UserID     string `json:"userId"`
+	TxID       string `json:"txId"`
+	TxHash     string `json:"txHash"`
+	Reason     string `json:"reason"`
+	Proposal   string `json:"proposal"`
+	Status     string `json:"status"`
+	Resolution string `json:"resolution,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+	CreatedAt  int64  `json:"createdAt"`
+	ResolvedAt int64  `json:"resolvedAt,omitempty"`
+}
+
+// walletFreeze marks a user's wallets unusable for signing.
+type walletFreeze struct {
+	Frozen    bool   `json:"frozen"`
+	Reason    string `json:"reason,omitempty"`
+	CaseID    string `json:"caseId,omitempty"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// setWalletFreeze writes a user's freeze state.
+func setWalletFreeze(ctx context.Context, nk nkruntime.NakamaModule, userID string, freeze *walletFreeze) error {
+	freeze.UpdatedAt = moduleClock.Now().Unix()
+	value, err := json.Marshal(freeze)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: freezeCollection,
+		Key:        freezeKey,
+		UserID:     userID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// checkWalletFrozen refuses signing for frozen wallets.
+func checkWalletFrozen(ctx context.Context, nk nkruntime.NakamaModule, userID string) error {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: freezeCollection,
+		Key:        freezeKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return err
+	}
+	if len(objects) == 0 {
+		return nil
+	}
+	freeze := &walletFreeze{}
+	if err := json.Unmarshal([]byte(objects[0].Value), freeze); err != nil {
+		return err
+	}
+	if freeze.Frozen {
+		return rpcError(errCodePermissionDenied, "Wallet is frozen pending investigation.", codes.PermissionDenied)
+	}
+	return nil
+}
+
+// isGameControlledAddress reports whether an address belongs to the game
+// operator, which decides the clawback proposal kind.
+func isGameControlledAddress(address string) bool {
+	return cfg.GameControlledAddresses[strings.ToLower(address)]
+}
+
+// rpcAdminFlagFraud flags a transaction as fraudulent: the wallet is frozen
+// and a clawback case with a recovery proposal is opened.
+func rpcAdminFlagFraud(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID string `json:"userId"`
+		TxID   string `json:"txId"`
+		Reason string `json:"reason"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" || req.TxID == "" || req.Reason == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId, txId and reason.", codes.InvalidArgument)
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: txCollection,
+		Key:        req.TxID,
+		UserID:     req.UserID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "Transaction record not found.", codes.NotFound)
+	}
+	record := &TransactionRecord{}
+	if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+		logger.Error("Transaction record corrupt at %v: %v", req.TxID, err)
+		return "", rpcError(errCodeInternal, "Transaction record corrupt.", codes.Internal)
+	}
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Case creation failed.", codes.Internal)
+	}
+	proposal := clawbackProposalCompensate
+	if isGameControlledAddress(record.To) {
+		proposal = clawbackProposalReverse
+	}
+	c := &clawbackCase{
+		ID:        id,
+		UserID:    req.UserID,
+		TxID:      record.ID,
+		TxHash:    record.Hash,
+		Reason:    req.Reason,
+		Proposal:  proposal,
+		Status:    clawbackStatusOpen,
+		CreatedAt: moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(c)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Case encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: clawbackCollection,
+		Key:        c.ID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Clawback case write failed: %v", err)
+		return "", rpcError(errCodeInternal, "Case creation failed.", codes.Internal)
+	}
+
+	if err := setWalletFreeze(ctx, nk, req.UserID, &walletFreeze{Frozen: true, Reason: req.Reason, CaseID: c.ID}); err != nil {
+		logger.Error("Wallet freeze failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Wallet freeze failed.", codes.Internal)
+	}
+	cacheInvalidateCluster(ctx, logger, nk, req.UserID, "wallet_frozen")
+
+	if err := appendAudit(ctx, nk, "clawback.opened", req.UserID, map[string]interface{}{
+		"caseId":   c.ID,
+		"txId":     c.TxID,
+		"reason":   c.Reason,
+		"proposal": c.Proposal,
+	}); err != nil {
+		logger.Error("Audit append failed for clawback case %v: %v", c.ID, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, _ := json.Marshal(c)
+	return string(out), nil
+}
+
+// rpcAdminResolveClawback records a case outcome and unfreezes the wallet.
+func rpcAdminResolveClawback(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		CaseID     string `json:"caseId"`
+		Resolution string `json:"resolution"`
+		Notes      string `json:"notes,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.CaseID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a caseId and resolution.", codes.InvalidArgument)
+	}
+	switch req.Resolution {
+	case "recovered", "compensated", "dismissed":
+	default:
+		return "", rpcError(errCodeBadInput, "Resolution must be recovered, compensated or dismissed.", codes.InvalidArgument)
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: clawbackCollection,
+		Key:        req.CaseID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "Clawback case not found.", codes.NotFound)
+	}
+	c := &clawbackCase{}
+	if err := json.Unmarshal([]byte(objects[0].Value), c); err != nil {
+		logger.Error("Clawback case corrupt at %v: %v", req.CaseID, err)
+		return "", rpcError(errCodeInternal, "Case record corrupt.", codes.Internal)
+	}
+	if c.Status != clawbackStatusOpen {
+		return "", rpcError(errCodeBadInput, "Case is already resolved.", codes.FailedPrecondition)
+	}
+
+	c.Status = clawbackStatusResolved
+	c.Resolution = req.Resolution
+	c.Notes = req.Notes
+	c.ResolvedAt = moduleClock.Now().Unix()
+	value, err := json.Marshal(c)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Case encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: clawbackCollection,
+		Key:        c.ID,
+		Value:      string(value),
+		Version:    objects[0].Version,
+	}}); err != nil {
+		logger.Error("Clawback case update failed for %v: %v", c.ID, err)
+		return "", rpcError(errCodeInternal, "Case update failed.", codes.Internal)
+	}
+
+	if err := setWalletFreeze(ctx, nk, c.UserID, &walletFreeze{Frozen: false, CaseID: c.ID}); err != nil {
+		logger.Error("Wallet unfreeze failed for user %v: %v", c.UserID, err)
+		return "", rpcError(errCodeInternal, "Wallet unfreeze failed.", codes.Internal)
+	}
+	cacheInvalidateCluster(ctx, logger, nk, c.UserID, "wallet_unfrozen")
+
+	if err := appendAudit(ctx, nk, "clawback.resolved", c.UserID, map[string]interface{}{
+		"caseId":     c.ID,
+		"resolution": c.Resolution,
+		"notes":      c.Notes,
+	}); err != nil {
+		logger.Error("Audit append failed for clawback case %v: %v", c.ID, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, _ := json.Marshal(c)
+	return string(out), nil
+}
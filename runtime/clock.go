@@ -0,0 +1,98 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// Time and ID generation go through package-level injection points so tests
+// of time- and ID-dependent behaviour (TTLs, lease expiry, approval windows)
+// can run deterministically. Production code never constructs times or IDs
+// directly; it calls moduleClock.Now() and moduleIDs.NewID().
+
+// Clock supplies the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator supplies unique identifiers for records and tokens.
+type IDGenerator interface {
+	NewID() (string, error)
+}
+
+// realClock reads the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// uuidGenerator issues random version-4 UUIDs.
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID() (string, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// The active implementations; replaced by tests only.
+var (
+	moduleClock Clock       = realClock{}
+	moduleIDs   IDGenerator = uuidGenerator{}
+)
+
+// FakeClock is a manually advanced Clock for tests.
+type FakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+// NewFakeClock returns a FakeClock frozen at the given time.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{t: t}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// SeqIDGenerator is a deterministic IDGenerator for tests, issuing
+// "id-1", "id-2", ... in order.
+type SeqIDGenerator struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (g *SeqIDGenerator) NewID() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	return fmt.Sprintf("id-%d", g.n), nil
+}
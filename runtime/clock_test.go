@@ -0,0 +1,65 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"testing"
+	"time"
+)
+
+// withFakeClock swaps the module clock for the duration of a test.
+func withFakeClock(t *testing.T, at time.Time) *FakeClock {
+	t.Helper()
+	prev := moduleClock
+	t.Cleanup(func() { moduleClock = prev })
+	clock := NewFakeClock(at)
+	moduleClock = clock
+	return clock
+}
+
+func TestSeqIDGeneratorDeterministic(t *testing.T) {
+	gen := &SeqIDGenerator{}
+	for i, want := range []string{"id-1", "id-2", "id-3"} {
+		got, err := gen.NewID()
+		if err != nil {
+			t.Fatalf("NewID %d: %v", i, err)
+		}
+		if got != want {
+			t.Fatalf("NewID %d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestRespCacheExpiresByClock(t *testing.T) {
+	prevCfg := cfg
+	t.Cleanup(func() { cfg = prevCfg })
+	cfg = &Config{ResponseCacheTTL: 5 * time.Second}
+	clock := withFakeClock(t, time.Unix(1700000000, 0))
+
+	respCachePut("user-1", "get_wallet:", `{"ok":true}`, "v1")
+	if entry := respCacheGet("user-1", "get_wallet:"); entry == nil || entry.Version != "v1" {
+		t.Fatalf("expected live cache entry, got %+v", entry)
+	}
+
+	clock.Advance(4 * time.Second)
+	if entry := respCacheGet("user-1", "get_wallet:"); entry == nil {
+		t.Fatal("entry expired before its TTL")
+	}
+
+	clock.Advance(2 * time.Second)
+	if entry := respCacheGet("user-1", "get_wallet:"); entry != nil {
+		t.Fatalf("entry survived past its TTL: %+v", entry)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Large responses (transaction history, exports) get two relief valves:
+// clients may request gzip compression of the response body, and bodies above
+// the configured size threshold are delivered in chunks the client pulls
+// through rpc_continue_response. Chunk state lives in process memory with a
+// short TTL — a dropped continuation simply re-runs the original request.
+
+const (
+	// responseEncodingGzip marks a gzip+base64 response envelope.
+	responseEncodingGzip = "gzip+base64"
+	// chunkTTL is how long an unconsumed continuation stays claimable.
+	chunkTTL = time.Minute
+)
+
+// EncodedResponse wraps an RPC body that was compressed or chunked. Plain
+// responses are returned without this envelope.
+type EncodedResponse struct {
+	// Encoding is set when Data is transformed, currently only gzip+base64.
+	Encoding string `json:"encoding,omitempty"`
+	// Data is this chunk (or the whole body when it fit in one).
+	Data string `json:"data"`
+	// Next is the continuation token for the rest of the body, empty on the
+	// last chunk.
+	Next string `json:"next,omitempty"`
+}
+
+// pendingChunk is the undelivered remainder of a chunked response.
+type pendingChunk struct {
+	UserID   string
+	Encoding string
+	Rest     string
+	Expires  time.Time
+}
+
+var (
+	chunkMu    sync.Mutex
+	chunkStore = make(map[string]*pendingChunk)
+)
+
+// encodeResponse applies the negotiated transforms to a finished RPC body.
+// Bodies that fit under the chunk threshold and were not compressed pass
+// through untouched.
+func encodeResponse(userID, body string, wantGzip bool) (string, error) {
+	encoding := ""
+	data := body
+	if wantGzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(body)); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+		data = base64.StdEncoding.EncodeToString(buf.Bytes())
+		encoding = responseEncodingGzip
+	}
+
+	if cfg.ResponseChunkBytes <= 0 || len(data) <= cfg.ResponseChunkBytes {
+		if encoding == "" {
+			return body, nil
+		}
+		out, err := json.Marshal(&EncodedResponse{Encoding: encoding, Data: data})
+		return string(out), err
+	}
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", err
+	}
+	token := id
+	chunkMu.Lock()
+	chunkStore[token] = &pendingChunk{
+		UserID:   userID,
+		Encoding: encoding,
+		Rest:     data[cfg.ResponseChunkBytes:],
+		Expires:  moduleClock.Now().Add(chunkTTL),
+	}
+	// Opportunistically drop expired continuations while holding the lock.
+	now := moduleClock.Now()
+	for key, chunk := range chunkStore {
+		if now.After(chunk.Expires) {
+			delete(chunkStore, key)
+		}
+	}
+	chunkMu.Unlock()
+
+	out, err := json.Marshal(&EncodedResponse{
+		Encoding: encoding,
+		Data:     data[:cfg.ResponseChunkBytes],
+		Next:     token,
+	})
+	return string(out), err
+}
+
+// rpcContinueResponse returns the next chunk of a previously chunked
+// response. Tokens are single-use and bound to the requesting user.
+func rpcContinueResponse(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	var req struct {
+		Next string `json:"next"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.Next == "" {
+		return "", rpcError(errCodeBadInput, "Expects a next token.", codes.InvalidArgument)
+	}
+
+	chunkMu.Lock()
+	chunk := chunkStore[req.Next]
+	if chunk != nil {
+		delete(chunkStore, req.Next)
+	}
+	chunkMu.Unlock()
+	if chunk == nil || chunk.UserID != userID || moduleClock.Now().After(chunk.Expires) {
+		return "", rpcError(errCodeNotFound, "Continuation expired or unknown; re-run the original request.", codes.NotFound)
+	}
+
+	resp := &EncodedResponse{Encoding: chunk.Encoding, Data: chunk.Rest}
+	if cfg.ResponseChunkBytes > 0 && len(chunk.Rest) > cfg.ResponseChunkBytes {
+		id, err := moduleIDs.NewID()
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Continuation failed.", codes.Internal)
+		}
+		resp.Data = chunk.Rest[:cfg.ResponseChunkBytes]
+		resp.Next = id
+		chunkMu.Lock()
+		chunkStore[resp.Next] = &pendingChunk{
+			UserID:   userID,
+			Encoding: chunk.Encoding,
+			Rest:     chunk.Rest[cfg.ResponseChunkBytes:],
+			Expires:  moduleClock.Now().Add(chunkTTL),
+		}
+		chunkMu.Unlock()
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
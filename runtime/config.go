@@ -0,0 +1,996 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Deployment profiles control which RPCs are registered and which subsystems
+// start, so deployments that don't want custody carry none of its surface.
+const (
+	profileAuthOnly    = "auth-only"
+	profileWalletRead  = "wallet-read"
+	profileFullCustody = "full-custody"
+)
+
+// Config carries all module-level settings. Values are sourced from the
+// Nakama runtime environment (runtime.env in the server config) first, then
+// from OS environment variables, so the same keys work in both local.yml and
+// container deployments.
+type Config struct {
+	// Profile selects the deployment profile: auth-only, wallet-read or
+	// full-custody.
+	Profile string
+
+	// Cognito issuer settings.
+	CognitoRegion     string
+	CognitoUserPoolID string
+	CognitoClientID   string
+	// LoginAudiences and LinkAudiences are the accepted aud values for the
+	// login and linking flows respectively; the companion web app used for
+	// linking typically has its own Cognito app client. Both default to the
+	// global client ID.
+	LoginAudiences []string
+	LinkAudiences  []string
+
+	// ALBSignerARN is the Application Load Balancer allowed to forward
+	// authenticated claims via x-amzn-oidc-data. Empty disables the ALB
+	// login exchange.
+	ALBSignerARN string
+
+	// JWKSCacheTTL is how long fetched JWKS documents are reused before a
+	// refresh is attempted, when the endpoint sends no caching headers of
+	// its own. Endpoints that do send Cache-Control or Expires set their own
+	// lifetime, clamped to the bounds below.
+	JWKSCacheTTL time.Duration
+	// JWKSMinTTL and JWKSMaxTTL clamp header-derived document lifetimes, so
+	// a misconfigured IdP can neither hammer the module with refreshes nor
+	// pin stale keys for days.
+	JWKSMinTTL time.Duration
+	JWKSMaxTTL time.Duration
+	// JWKSPrefetch enables scheduled background refresh of tenant JWKS
+	// documents so multi-issuer deployments never refresh in login-path
+	// lockstep; see jwksprefetch.go.
+	JWKSPrefetch bool
+	// JWKSPrefetchConcurrency bounds how many issuers refresh at once.
+	JWKSPrefetchConcurrency int
+	// JWKSMaxIssuers caps how many tenant issuers keep cached key managers;
+	// the least recently used is evicted past the cap. Zero is unbounded.
+	JWKSMaxIssuers int
+
+	// LinkTicketSecret signs link tickets issued to the web portal. Tickets
+	// cannot be minted or verified without it.
+	LinkTicketSecret string
+	// LinkTicketTTL is how long an issued link ticket stays consumable.
+	LinkTicketTTL time.Duration
+	// LinkRequireEmailMatch refuses links to accounts that already carry an
+	// email unless the incoming identity's verified email matches, guarding
+	// against social-engineering link hijacks.
+	LinkRequireEmailMatch bool
+
+	// KYCProviderURL is the third-party verification session base URL.
+	// Empty disables the KYC subsystem.
+	KYCProviderURL string
+	// KYCWebhookSecret authenticates provider result webhooks.
+	KYCWebhookSecret string
+	// KYCTxThresholdWei gates transactions at or above this value behind
+	// approved KYC. Nil disables the gate.
+	KYCTxThresholdWei *big.Int
+
+	// GeoIPURL is an optional country lookup service queried with ?ip=.
+	GeoIPURL string
+	// RestrictedCountries is the set of ISO country codes subject to
+	// jurisdiction restrictions.
+	RestrictedCountries map[string]bool
+	// RestrictedOperations is the set of operation classes the country list
+	// applies to.
+	RestrictedOperations map[string]bool
+
+	// FeeMaxBaseFeeMultiplier bounds maxFeePerGas to this multiple of the
+	// network base fee. Zero disables the ceiling.
+	FeeMaxBaseFeeMultiplier int
+	// FeeMaxPriorityWei is an absolute cap on maxPriorityFeePerGas. Nil or
+	// zero disables the cap.
+	FeeMaxPriorityWei *big.Int
+	// FeeClampEnabled clamps out-of-range fees down instead of rejecting the
+	// request.
+	FeeClampEnabled bool
+
+	// GasBudgetUserDailyWei caps sponsored gas per user per UTC day. Nil
+	// means uncapped.
+	GasBudgetUserDailyWei *big.Int
+	// GasBudgetGlobalDailyWei caps sponsored gas across all users per UTC
+	// day. Nil means uncapped.
+	GasBudgetGlobalDailyWei *big.Int
+
+	// BanRules are claim predicates that refuse login, e.g. for accounts
+	// flagged disabled in Cognito.
+	BanRules []*banRule
+
+	// ClaimAssertions are deployment-specific token rules evaluated after
+	// standard validation; see claimrules.go.
+	ClaimAssertions []*claimAssertion
+
+	// TokenMaxAge caps accepted token age per operation class, forcing a
+	// fresh interactive login for sensitive flows; see freshness.go.
+	TokenMaxAge map[string]time.Duration
+
+	// CategoryRules categorize transactions at signing time from destination
+	// and method selector; see category.go.
+	CategoryRules []*categoryRule
+
+	// LoginFailureSampleRate is the fraction of login failures recorded for
+	// analytics, 0 to 1; see loginstats.go.
+	LoginFailureSampleRate float64
+
+	// ServiceIdentities are the named server-to-server callers and their
+	// scopes. Empty disables scope enforcement.
+	ServiceIdentities map[string]*ServiceIdentity
+
+	// TxContextSchema declares the allowed game context keys on sign
+	// requests.
+	TxContextSchema map[string]*txContextField
+
+	// EVMChainID is the chain ID transactions are signed for.
+	EVMChainID int64
+	// EVMRPCURL is an optional Ethereum JSON-RPC endpoint, used for chain
+	// reads (fees, balances, code) and, with EVMBroadcast on, for submitting
+	// signed transactions.
+	EVMRPCURL string
+	// EVMBroadcast submits signed transactions to EVMRPCURL directly instead
+	// of leaving broadcast to the chain watcher; see broadcast.go.
+	EVMBroadcast bool
+	// EVMBlobTxEnabled permits EIP-4844 blob transactions. Off by default;
+	// only enable on networks that actually support them.
+	EVMBlobTxEnabled bool
+	// MerkleDistributorAddress is the deployed MerkleDistributor contract
+	// large airdrops claim against; see merkle.go. Empty disables merkle
+	// distributions.
+	MerkleDistributorAddress string
+	// GameControlledAddresses is the lowercased set of on-chain addresses the
+	// operator controls; funds there can be reversed directly during clawback.
+	GameControlledAddresses map[string]bool
+
+	// MaxPayloadBytes caps RPC request payloads; see payload.go. Zero
+	// disables the cap.
+	MaxPayloadBytes int
+	// PayloadLimits overrides the byte cap for specific RPCs by name.
+	PayloadLimits map[string]int
+	// PayloadMaxDepth caps JSON nesting in payloads. Zero disables.
+	PayloadMaxDepth int
+	// PayloadStrictFields rejects payload fields the request schema doesn't
+	// declare instead of silently dropping them.
+	PayloadStrictFields bool
+
+	// ResponseCacheTTL bounds how long cacheable RPC responses (wallet
+	// reads) are served from memory. Zero disables response caching.
+	ResponseCacheTTL time.Duration
+	// ResponseChunkBytes is the size above which responses are delivered in
+	// chunks via rpc_continue_response. Zero disables chunking.
+	ResponseChunkBytes int
+
+	// MaxInFlightTx caps unconfirmed transactions per user. Zero disables
+	// the cap.
+	MaxInFlightTx int
+	// TxAuthSecret signs authorization artifacts for server-initiated
+	// transactions. Empty rejects any request carrying one.
+	TxAuthSecret string
+	// KMSCallsPerMinute sheds signer load before the AWS quota is hit. Zero
+	// disables the budget.
+	KMSCallsPerMinute int
+
+	// DormancyMonths is how many months without login or transaction mark a
+	// wallet dormant. Zero disables the dormancy policy.
+	DormancyMonths int
+	// DormancySweepEnabled permits segregating dormant assets after notice;
+	// jurisdictions without a segregation duty leave this off.
+	DormancySweepEnabled bool
+	// DormancyCustodyAddress is the segregated custody address dormant
+	// assets are earmarked for.
+	DormancyCustodyAddress string
+
+	// LogRedactPII scrubs emails, Cognito subjects and wallet addresses from
+	// module log lines; see redact.go.
+	LogRedactPII bool
+
+	// FlagProviderURL points at a remote feature-flag service consulted at
+	// login. Empty evaluates the storage-backed rules instead; see flags.go.
+	FlagProviderURL string
+
+	// Tenants are per-title overrides keyed by tenant ID when several games
+	// share this cluster. Empty means single-tenant; see tenant.go.
+	Tenants map[string]*TenantConfig
+
+	// PriceFeedURL points at a historic price service used to add fiat
+	// valuations to exported statements. Empty leaves the fiat columns
+	// blank; see statement.go.
+	PriceFeedURL string
+
+	// CognitoStatusURL enables a live AdminGetUser check at login and link so
+	// disabled Cognito users are rejected before their tokens expire. The
+	// endpoint speaks the Cognito IDP JSON protocol; point it at a
+	// credential-holding proxy in front of the regional API. Empty skips the
+	// check; see status.go.
+	CognitoStatusURL string
+
+	// SNSTopicARN mirrors wallet events onto an SNS topic for SQS consumers,
+	// alongside or instead of the HTTP webhook; see publisher.go.
+	SNSTopicARN string
+	// SNSEndpointURL is the SNS API endpoint, typically a credential-holding
+	// proxy in front of the regional API. Required when SNSTopicARN is set.
+	SNSEndpointURL string
+
+	// SinkKind selects the analytics data sink exporter: "firehose",
+	// "bigquery" or "http". Empty disables the sink; see sink.go.
+	SinkKind string
+	// SinkURL is the sink endpoint: a credential-holding proxy in front of
+	// the Firehose regional API, a BigQuery insertAll URL, or any HTTP
+	// endpoint accepting NDJSON. Required when SinkKind is set.
+	SinkURL string
+	// SinkStream is the Firehose delivery stream name. Required for the
+	// firehose sink kind.
+	SinkStream string
+	// SinkAuthToken is sent as a bearer token by the bigquery and http sinks.
+	SinkAuthToken string
+
+	// ProofSigningSecret countersigns wallet ownership proof bundles with
+	// HMAC-SHA256 and is shared with partner services out of band. Empty
+	// disables proof issuance; see ownership.go.
+	ProofSigningSecret string
+
+	// WebhookURL mirrors wallet events to an external HTTP consumer. Empty
+	// disables outbound webhooks; see webhook.go.
+	WebhookURL string
+	// WebhookSecret signs outbound webhook bodies with HMAC-SHA256.
+	WebhookSecret string
+
+	// AlertWebhookURL receives operational alerts (dead-letter depth). Empty
+	// disables alerting; see dlq.go.
+	AlertWebhookURL string
+	// DLQAlertDepth is the per-class dead-letter depth that triggers an
+	// alert. Zero disables depth alerts.
+	DLQAlertDepth int
+
+	// AgeBandPolicies are age-based restrictions keyed by band (child, teen,
+	// adult or custom claim values). Empty disables age gating; see
+	// agegate.go.
+	AgeBandPolicies map[string]*ageBandPolicy
+
+	// AMLProviderURL points at an address risk screening adapter consulted
+	// before outbound transfers are signed. Empty disables screening; see
+	// aml.go.
+	AMLProviderURL string
+	// AMLAPIKey is sent as a bearer token to the screening adapter.
+	AMLAPIKey string
+	// AMLCacheTTL bounds how long screening verdicts are reused.
+	AMLCacheTTL time.Duration
+	// AMLBlockRisks are the lowercased risk levels that refuse a transfer.
+	AMLBlockRisks map[string]bool
+
+	// TreasuryAddresses are the on-chain treasury and deposit addresses whose
+	// balances back the bridged virtual currency; see reconcile.go.
+	TreasuryAddresses []string
+	// BridgeCurrency is the virtual wallet currency key that bridges
+	// on-chain. Empty disables ledger reconciliation.
+	BridgeCurrency string
+	// BridgeRateWei is how many wei one unit of the bridged currency
+	// represents.
+	BridgeRateWei *big.Int
+	// ReconcileToleranceWei is the largest reconciliation gap tolerated
+	// before an alert fires.
+	ReconcileToleranceWei *big.Int
+
+	// ExplorerTxURLs maps a chain ID to its transaction explorer URL template
+	// with a {hash} placeholder; see explorer.go.
+	ExplorerTxURLs map[int64]string
+	// ExplorerAddressURLs maps a chain ID to its address explorer URL
+	// template with an {address} placeholder.
+	ExplorerAddressURLs map[int64]string
+
+	// MilestoneTxCounts are the confirmed-transaction counts that unlock
+	// achievements, e.g. first and tenth transaction; see milestones.go.
+	MilestoneTxCounts []int
+	// MilestoneVolumeWei are cumulative confirmed volume thresholds that
+	// unlock achievements. Empty disables volume milestones.
+	MilestoneVolumeWei []*big.Int
+
+	// AllowlistEnabled restricts login to invited subs and emails during a
+	// soft launch; see allowlist.go.
+	AllowlistEnabled bool
+	// AllowlistCognitoGroup names a Cognito group whose members bypass the
+	// allowlist, e.g. internal staff.
+	AllowlistCognitoGroup string
+
+	// RequireTxIntent refuses client-built sign requests that reference no
+	// pre-authorized intent; see intent.go.
+	RequireTxIntent bool
+
+	// SandboxMode enables development-only surfaces such as rpc_faucet.
+	SandboxMode bool
+	// FaucetAmountWei is minted per faucet claim in sandbox mode.
+	FaucetAmountWei *big.Int
+	// FaucetDailyLimit caps faucet claims per user per UTC day.
+	FaucetDailyLimit int
+	// WalletMasterKey seeds the mock signer's key derivation. Development and
+	// sandbox use only.
+	WalletMasterKey string
+	// WalletKeyMode selects derived (shared master, default) or per-user
+	// (dedicated KMS/HSM key per wallet) key provisioning.
+	WalletKeyMode string
+	// WalletSchemaPhase stages the wallet storage schema migration: legacy,
+	// dual or v2; see walletschema.go.
+	WalletSchemaPhase string
+	// KMSDefaultBackend is the signer backend ID new wallets are provisioned
+	// on. Existing wallets keep the backend recorded on their record.
+	KMSDefaultBackend string
+	// KMSEndpointURL is the AWS KMS wire-protocol endpoint backing the "aws"
+	// signer backend, fronted by a credential-holding proxy like the other
+	// AWS touchpoints. Empty leaves the backend unregistered.
+	KMSEndpointURL string
+	// KMSKeyARNTemplate renders a derivation index into the AWS key ARN or
+	// alias holding that index's key, e.g. "alias/nakama-wallet-%d". Empty
+	// limits the aws backend to per-user keys.
+	KMSKeyARNTemplate string
+	// LoginLimits are the boot-time login admission thresholds; see
+	// admission.go. Tunable live through rpc_admin_set_login_limits.
+	LoginLimits LoginLimits
+
+	// WalletDeleteGraceDays is the soft-delete window between account
+	// deletion and the final wallet purge; see walletdelete.go.
+	WalletDeleteGraceDays int
+	// MaxWalletsPerUser bounds labeled wallets per user. Zero disables the
+	// bound; the default wallet is always allowed.
+	MaxWalletsPerUser int
+}
+
+// cfg is the active module configuration, set once during InitModule.
+var cfg *Config
+
+// moduleEnv resolves a configuration key from the runtime environment map,
+// falling back to the process environment.
+func moduleEnv(ctx context.Context, key string) string {
+	if env, ok := ctx.Value(nkruntime.RUNTIME_CTX_ENV).(map[string]string); ok {
+		if v, ok := env[key]; ok && v != "" {
+			return v
+		}
+	}
+	return os.Getenv(key)
+}
+
+func moduleEnvDuration(ctx context.Context, key string, def time.Duration) (time.Duration, error) {
+	v := moduleEnv(ctx, key)
+	if v == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration for %s: %w", key, err)
+	}
+	return d, nil
+}
+
+// loadConfig reads module configuration at init time. Missing optional values
+// fall back to defaults; missing required values are reported so the server
+// fails loudly at startup rather than at first request.
+func loadConfig(ctx context.Context) (*Config, error) {
+	c := &Config{
+		CognitoRegion:      moduleEnv(ctx, "NAKAMA_COGNITO_REGION"),
+		CognitoUserPoolID:  moduleEnv(ctx, "NAKAMA_COGNITO_USER_POOL_ID"),
+		CognitoClientID:    moduleEnv(ctx, "NAKAMA_COGNITO_CLIENT_ID"),
+		ALBSignerARN:       moduleEnv(ctx, "NAKAMA_ALB_SIGNER_ARN"),
+		LinkTicketSecret:   moduleEnv(ctx, "NAKAMA_LINK_TICKET_SECRET"),
+		WalletMasterKey:    moduleEnv(ctx, "NAKAMA_WALLET_MASTER_KEY"),
+		KYCProviderURL:     moduleEnv(ctx, "NAKAMA_KYC_PROVIDER_URL"),
+		KYCWebhookSecret:   moduleEnv(ctx, "NAKAMA_KYC_WEBHOOK_SECRET"),
+		EVMRPCURL:          moduleEnv(ctx, "NAKAMA_EVM_RPC_URL"),
+		TxAuthSecret:       moduleEnv(ctx, "NAKAMA_TX_AUTH_SECRET"),
+		FlagProviderURL:    moduleEnv(ctx, "NAKAMA_FLAG_PROVIDER_URL"),
+		CognitoStatusURL:   moduleEnv(ctx, "NAKAMA_COGNITO_STATUS_URL"),
+		PriceFeedURL:       moduleEnv(ctx, "NAKAMA_PRICE_FEED_URL"),
+		SNSTopicARN:        moduleEnv(ctx, "NAKAMA_SNS_TOPIC_ARN"),
+		SNSEndpointURL:     moduleEnv(ctx, "NAKAMA_SNS_ENDPOINT_URL"),
+		SinkKind:           moduleEnv(ctx, "NAKAMA_SINK_KIND"),
+		SinkURL:            moduleEnv(ctx, "NAKAMA_SINK_URL"),
+		SinkStream:         moduleEnv(ctx, "NAKAMA_SINK_STREAM"),
+		SinkAuthToken:      moduleEnv(ctx, "NAKAMA_SINK_AUTH_TOKEN"),
+		ProofSigningSecret: moduleEnv(ctx, "NAKAMA_PROOF_SIGNING_SECRET"),
+		WebhookURL:         moduleEnv(ctx, "NAKAMA_WEBHOOK_URL"),
+		WebhookSecret:      moduleEnv(ctx, "NAKAMA_WEBHOOK_SECRET"),
+		AlertWebhookURL:    moduleEnv(ctx, "NAKAMA_ALERT_WEBHOOK_URL"),
+	}
+
+	audienceList := func(key string) []string {
+		var out []string
+		for _, aud := range strings.Split(moduleEnv(ctx, key), ",") {
+			if aud = strings.TrimSpace(aud); aud != "" {
+				out = append(out, aud)
+			}
+		}
+		return out
+	}
+	c.LoginAudiences = audienceList("NAKAMA_COGNITO_LOGIN_AUDIENCES")
+	c.LinkAudiences = audienceList("NAKAMA_COGNITO_LINK_AUDIENCES")
+	if len(c.LoginAudiences) == 0 && c.CognitoClientID != "" {
+		c.LoginAudiences = []string{c.CognitoClientID}
+	}
+	if len(c.LinkAudiences) == 0 {
+		c.LinkAudiences = c.LoginAudiences
+	}
+
+	c.Profile = moduleEnv(ctx, "NAKAMA_MODULE_PROFILE")
+	if c.Profile == "" {
+		c.Profile = profileFullCustody
+	}
+	switch c.Profile {
+	case profileAuthOnly, profileWalletRead, profileFullCustody:
+	default:
+		return nil, fmt.Errorf("invalid NAKAMA_MODULE_PROFILE: %q", c.Profile)
+	}
+
+	c.WalletKeyMode = moduleEnv(ctx, "NAKAMA_WALLET_KEY_MODE")
+	if c.WalletKeyMode == "" {
+		c.WalletKeyMode = walletKeyModeDerived
+	}
+	switch c.WalletKeyMode {
+	case walletKeyModeDerived, walletKeyModePerUser:
+	default:
+		return nil, fmt.Errorf("invalid NAKAMA_WALLET_KEY_MODE: %q", c.WalletKeyMode)
+	}
+	c.WalletSchemaPhase = moduleEnv(ctx, "NAKAMA_WALLET_SCHEMA_PHASE")
+	if c.WalletSchemaPhase == "" {
+		c.WalletSchemaPhase = walletSchemaPhaseLegacy
+	}
+	switch c.WalletSchemaPhase {
+	case walletSchemaPhaseLegacy, walletSchemaPhaseDual, walletSchemaPhaseV2:
+	default:
+		return nil, fmt.Errorf("invalid NAKAMA_WALLET_SCHEMA_PHASE: %q", c.WalletSchemaPhase)
+	}
+
+	// NAKAMA_WALLET_SIGNER_BACKEND is the preferred name;
+	// NAKAMA_KMS_DEFAULT_BACKEND is honored for existing deployments.
+	c.KMSDefaultBackend = moduleEnv(ctx, "NAKAMA_WALLET_SIGNER_BACKEND")
+	if c.KMSDefaultBackend == "" {
+		c.KMSDefaultBackend = moduleEnv(ctx, "NAKAMA_KMS_DEFAULT_BACKEND")
+	}
+	if c.KMSDefaultBackend == "" {
+		c.KMSDefaultBackend = kmsBackendMock
+	}
+	c.KMSEndpointURL = moduleEnv(ctx, "NAKAMA_KMS_ENDPOINT_URL")
+	c.KMSKeyARNTemplate = moduleEnv(ctx, "NAKAMA_KMS_KEY_ARN_TEMPLATE")
+	if c.KMSKeyARNTemplate != "" && strings.Count(c.KMSKeyARNTemplate, "%d") != 1 {
+		return nil, fmt.Errorf("invalid NAKAMA_KMS_KEY_ARN_TEMPLATE: %q", c.KMSKeyARNTemplate)
+	}
+	if c.KMSDefaultBackend == kmsBackendAWS && c.KMSEndpointURL == "" {
+		return nil, fmt.Errorf("signer backend %q requires NAKAMA_KMS_ENDPOINT_URL", kmsBackendAWS)
+	}
+
+	loginLimit := func(key string, target *int) error {
+		if v := moduleEnv(ctx, key); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				return fmt.Errorf("invalid %s: %q", key, v)
+			}
+			*target = limit
+		}
+		return nil
+	}
+	if err := loginLimit("NAKAMA_LOGIN_MAX_CONCURRENT", &c.LoginLimits.MaxConcurrent); err != nil {
+		return nil, err
+	}
+	if err := loginLimit("NAKAMA_LOGIN_CREATE_PER_MINUTE", &c.LoginLimits.CreatePerMinute); err != nil {
+		return nil, err
+	}
+	if err := loginLimit("NAKAMA_LOGIN_CREATE_BURST", &c.LoginLimits.CreateBurst); err != nil {
+		return nil, err
+	}
+	if c.LoginLimits.CreatePerMinute > 0 && c.LoginLimits.CreateBurst == 0 {
+		c.LoginLimits.CreateBurst = c.LoginLimits.CreatePerMinute
+	}
+
+	c.DLQAlertDepth = 100
+	if v := moduleEnv(ctx, "NAKAMA_DLQ_ALERT_DEPTH"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_DLQ_ALERT_DEPTH: %q", v)
+		}
+		c.DLQAlertDepth = depth
+	}
+
+	c.WalletDeleteGraceDays = 30
+	if v := moduleEnv(ctx, "NAKAMA_WALLET_DELETE_GRACE_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_WALLET_DELETE_GRACE_DAYS: %q", v)
+		}
+		c.WalletDeleteGraceDays = days
+	}
+
+	c.MaxWalletsPerUser = 3
+	if v := moduleEnv(ctx, "NAKAMA_MAX_WALLETS_PER_USER"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_MAX_WALLETS_PER_USER: %q", v)
+		}
+		c.MaxWalletsPerUser = limit
+	}
+
+	c.GeoIPURL = moduleEnv(ctx, "NAKAMA_GEOIP_URL")
+	c.RestrictedCountries = make(map[string]bool)
+	for _, country := range strings.Split(moduleEnv(ctx, "NAKAMA_RESTRICTED_COUNTRIES"), ",") {
+		if country = strings.ToUpper(strings.TrimSpace(country)); country != "" {
+			c.RestrictedCountries[country] = true
+		}
+	}
+	c.RestrictedOperations = map[string]bool{geoOpExport: true, geoOpTransfer: true}
+	if v := moduleEnv(ctx, "NAKAMA_RESTRICTED_OPERATIONS"); v != "" {
+		c.RestrictedOperations = make(map[string]bool)
+		for _, op := range strings.Split(v, ",") {
+			if op = strings.TrimSpace(op); op != "" {
+				c.RestrictedOperations[op] = true
+			}
+		}
+	}
+
+	c.LinkRequireEmailMatch = true
+	if v := moduleEnv(ctx, "NAKAMA_LINK_REQUIRE_EMAIL_MATCH"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_LINK_REQUIRE_EMAIL_MATCH: %q", v)
+		}
+		c.LinkRequireEmailMatch = b
+	}
+
+	var err error
+	if c.TxContextSchema, err = loadTxContextSchema(ctx); err != nil {
+		return nil, err
+	}
+	if c.BanRules, err = loadBanRules(ctx); err != nil {
+		return nil, err
+	}
+	if c.ClaimAssertions, err = loadClaimAssertions(ctx); err != nil {
+		return nil, err
+	}
+	if c.AgeBandPolicies, err = loadAgeBandPolicies(ctx); err != nil {
+		return nil, err
+	}
+	if c.TokenMaxAge, err = loadTokenMaxAge(ctx); err != nil {
+		return nil, err
+	}
+	if c.CategoryRules, err = loadCategoryRules(ctx); err != nil {
+		return nil, err
+	}
+	c.LoginFailureSampleRate = 1
+	if v := moduleEnv(ctx, "NAKAMA_LOGIN_FAILURE_SAMPLE_RATE"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid NAKAMA_LOGIN_FAILURE_SAMPLE_RATE: %q", v)
+		}
+		c.LoginFailureSampleRate = rate
+	}
+	if c.Tenants, err = loadTenants(ctx); err != nil {
+		return nil, err
+	}
+	if c.SNSTopicARN != "" && c.SNSEndpointURL == "" {
+		return nil, fmt.Errorf("NAKAMA_SNS_TOPIC_ARN requires NAKAMA_SNS_ENDPOINT_URL")
+	}
+	switch c.SinkKind {
+	case "", sinkKindFirehose, sinkKindBigQuery, sinkKindHTTP:
+	default:
+		return nil, fmt.Errorf("invalid NAKAMA_SINK_KIND: %q", c.SinkKind)
+	}
+	if c.SinkKind != "" && c.SinkURL == "" {
+		return nil, fmt.Errorf("NAKAMA_SINK_KIND requires NAKAMA_SINK_URL")
+	}
+	if c.SinkKind == sinkKindFirehose && c.SinkStream == "" {
+		return nil, fmt.Errorf("NAKAMA_SINK_KIND %q requires NAKAMA_SINK_STREAM", c.SinkKind)
+	}
+	if c.ServiceIdentities, err = loadServiceIdentities(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, budget := range []struct {
+		key  string
+		into **big.Int
+	}{
+		{"NAKAMA_GAS_BUDGET_USER_DAILY_WEI", &c.GasBudgetUserDailyWei},
+		{"NAKAMA_GAS_BUDGET_GLOBAL_DAILY_WEI", &c.GasBudgetGlobalDailyWei},
+		{"NAKAMA_FEE_MAX_PRIORITY_WEI", &c.FeeMaxPriorityWei},
+	} {
+		if v := moduleEnv(ctx, budget.key); v != "" {
+			amount, ok := new(big.Int).SetString(v, 10)
+			if !ok || amount.Sign() < 0 {
+				return nil, fmt.Errorf("invalid %s: %q", budget.key, v)
+			}
+			*budget.into = amount
+		}
+	}
+
+	explorerTemplates := func(key string) (map[int64]string, error) {
+		v := moduleEnv(ctx, key)
+		if v == "" {
+			return nil, nil
+		}
+		out := make(map[int64]string)
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			pair := strings.SplitN(part, "=", 2)
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("invalid %s entry: %q", key, part)
+			}
+			chainID, err := strconv.ParseInt(strings.TrimSpace(pair[0]), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s chain ID: %q", key, pair[0])
+			}
+			out[chainID] = strings.TrimSpace(pair[1])
+		}
+		return out, nil
+	}
+	if c.ExplorerTxURLs, err = explorerTemplates("NAKAMA_EXPLORER_TX_URLS"); err != nil {
+		return nil, err
+	}
+	if c.ExplorerAddressURLs, err = explorerTemplates("NAKAMA_EXPLORER_ADDRESS_URLS"); err != nil {
+		return nil, err
+	}
+
+	c.MilestoneTxCounts = []int{1, 10}
+	if v := moduleEnv(ctx, "NAKAMA_MILESTONE_TX_COUNTS"); v != "" {
+		c.MilestoneTxCounts = nil
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			count, err := strconv.Atoi(part)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("invalid NAKAMA_MILESTONE_TX_COUNTS entry: %q", part)
+			}
+			c.MilestoneTxCounts = append(c.MilestoneTxCounts, count)
+		}
+	}
+	if v := moduleEnv(ctx, "NAKAMA_MILESTONE_VOLUME_WEI"); v != "" {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			amount, ok := new(big.Int).SetString(part, 10)
+			if !ok || amount.Sign() <= 0 {
+				return nil, fmt.Errorf("invalid NAKAMA_MILESTONE_VOLUME_WEI entry: %q", part)
+			}
+			c.MilestoneVolumeWei = append(c.MilestoneVolumeWei, amount)
+		}
+	}
+
+	if v := moduleEnv(ctx, "NAKAMA_KYC_TX_THRESHOLD_WEI"); v != "" {
+		threshold, ok := new(big.Int).SetString(v, 10)
+		if !ok || threshold.Sign() < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_KYC_TX_THRESHOLD_WEI: %q", v)
+		}
+		c.KYCTxThresholdWei = threshold
+	}
+
+	if v := moduleEnv(ctx, "NAKAMA_KMS_CALLS_PER_MINUTE"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_KMS_CALLS_PER_MINUTE: %q", v)
+		}
+		c.KMSCallsPerMinute = limit
+	}
+
+	c.MaxInFlightTx = 10
+	if v := moduleEnv(ctx, "NAKAMA_MAX_INFLIGHT_TX"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_MAX_INFLIGHT_TX: %q", v)
+		}
+		c.MaxInFlightTx = limit
+	}
+
+	c.FeeMaxBaseFeeMultiplier = 10
+	if v := moduleEnv(ctx, "NAKAMA_FEE_MAX_BASEFEE_MULTIPLIER"); v != "" {
+		multiplier, err := strconv.Atoi(v)
+		if err != nil || multiplier < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_FEE_MAX_BASEFEE_MULTIPLIER: %q", v)
+		}
+		c.FeeMaxBaseFeeMultiplier = multiplier
+	}
+	if v := moduleEnv(ctx, "NAKAMA_FEE_CLAMP_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_FEE_CLAMP_ENABLED: %q", v)
+		}
+		c.FeeClampEnabled = b
+	}
+
+	c.MaxPayloadBytes = payloadDefaultMaxBytes
+	if v := moduleEnv(ctx, "NAKAMA_MAX_PAYLOAD_BYTES"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_MAX_PAYLOAD_BYTES: %q", v)
+		}
+		c.MaxPayloadBytes = size
+	}
+	// Per-RPC overrides: "rpc_name=bytes,rpc_other=bytes".
+	if v := moduleEnv(ctx, "NAKAMA_PAYLOAD_LIMITS"); v != "" {
+		c.PayloadLimits = make(map[string]int)
+		for _, pair := range strings.Split(v, ",") {
+			name, limit, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			size, err := strconv.Atoi(limit)
+			if !ok || name == "" || err != nil || size < 0 {
+				return nil, fmt.Errorf("invalid NAKAMA_PAYLOAD_LIMITS entry: %q", pair)
+			}
+			c.PayloadLimits[name] = size
+		}
+	}
+	c.PayloadMaxDepth = payloadDefaultMaxDepth
+	if v := moduleEnv(ctx, "NAKAMA_PAYLOAD_MAX_DEPTH"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_PAYLOAD_MAX_DEPTH: %q", v)
+		}
+		c.PayloadMaxDepth = depth
+	}
+	if v := moduleEnv(ctx, "NAKAMA_EVM_BROADCAST"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_EVM_BROADCAST: %q", v)
+		}
+		if b && c.EVMRPCURL == "" {
+			return nil, fmt.Errorf("NAKAMA_EVM_BROADCAST requires NAKAMA_EVM_RPC_URL")
+		}
+		c.EVMBroadcast = b
+	}
+	if v := moduleEnv(ctx, "NAKAMA_PAYLOAD_STRICT_FIELDS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_PAYLOAD_STRICT_FIELDS: %q", v)
+		}
+		c.PayloadStrictFields = b
+	}
+
+	c.ResponseChunkBytes = 256 * 1024
+	if v := moduleEnv(ctx, "NAKAMA_RESPONSE_CHUNK_BYTES"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_RESPONSE_CHUNK_BYTES: %q", v)
+		}
+		c.ResponseChunkBytes = size
+	}
+
+	if v := moduleEnv(ctx, "NAKAMA_DORMANCY_MONTHS"); v != "" {
+		months, err := strconv.Atoi(v)
+		if err != nil || months < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_DORMANCY_MONTHS: %q", v)
+		}
+		c.DormancyMonths = months
+	}
+	if v := moduleEnv(ctx, "NAKAMA_DORMANCY_SWEEP_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_DORMANCY_SWEEP_ENABLED: %q", v)
+		}
+		c.DormancySweepEnabled = b
+	}
+	c.DormancyCustodyAddress = moduleEnv(ctx, "NAKAMA_DORMANCY_CUSTODY_ADDRESS")
+
+	if v := moduleEnv(ctx, "NAKAMA_LOG_REDACT_PII"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_LOG_REDACT_PII: %q", v)
+		}
+		c.LogRedactPII = b
+	}
+
+	if v := moduleEnv(ctx, "NAKAMA_REQUIRE_TX_INTENT"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_REQUIRE_TX_INTENT: %q", v)
+		}
+		c.RequireTxIntent = b
+	}
+
+	if v := moduleEnv(ctx, "NAKAMA_ALLOWLIST_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_ALLOWLIST_ENABLED: %q", v)
+		}
+		c.AllowlistEnabled = b
+	}
+	c.AllowlistCognitoGroup = moduleEnv(ctx, "NAKAMA_ALLOWLIST_COGNITO_GROUP")
+
+	if v := moduleEnv(ctx, "NAKAMA_SANDBOX_MODE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_SANDBOX_MODE: %q", v)
+		}
+		c.SandboxMode = b
+	}
+	c.FaucetAmountWei, _ = new(big.Int).SetString(faucetDefaultAmount, 10)
+	if v := moduleEnv(ctx, "NAKAMA_FAUCET_AMOUNT_WEI"); v != "" {
+		amount, ok := new(big.Int).SetString(v, 10)
+		if !ok || amount.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_FAUCET_AMOUNT_WEI: %q", v)
+		}
+		c.FaucetAmountWei = amount
+	}
+	c.FaucetDailyLimit = faucetDefaultDaily
+	if v := moduleEnv(ctx, "NAKAMA_FAUCET_DAILY_LIMIT"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_FAUCET_DAILY_LIMIT: %q", v)
+		}
+		c.FaucetDailyLimit = limit
+	}
+
+	if v := moduleEnv(ctx, "NAKAMA_EVM_BLOB_TX_ENABLED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_EVM_BLOB_TX_ENABLED: %q", v)
+		}
+		c.EVMBlobTxEnabled = b
+	}
+
+	c.GameControlledAddresses = make(map[string]bool)
+	for _, address := range strings.Split(moduleEnv(ctx, "NAKAMA_GAME_CONTROLLED_ADDRESSES"), ",") {
+		if address = strings.ToLower(strings.TrimSpace(address)); address != "" {
+			c.GameControlledAddresses[address] = true
+		}
+	}
+
+	c.EVMChainID = 1
+	if v := moduleEnv(ctx, "NAKAMA_EVM_CHAIN_ID"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_EVM_CHAIN_ID: %q", v)
+		}
+		c.EVMChainID = id
+	}
+
+	c.AMLProviderURL = moduleEnv(ctx, "NAKAMA_AML_PROVIDER_URL")
+	c.AMLAPIKey = moduleEnv(ctx, "NAKAMA_AML_API_KEY")
+	if c.AMLCacheTTL, err = moduleEnvDuration(ctx, "NAKAMA_AML_CACHE_TTL", time.Hour); err != nil {
+		return nil, err
+	}
+	c.AMLBlockRisks = map[string]bool{"severe": true, "sanctioned": true}
+	if v := moduleEnv(ctx, "NAKAMA_AML_BLOCK_RISKS"); v != "" {
+		c.AMLBlockRisks = make(map[string]bool)
+		for _, risk := range strings.Split(v, ",") {
+			if risk = strings.ToLower(strings.TrimSpace(risk)); risk != "" {
+				c.AMLBlockRisks[risk] = true
+			}
+		}
+	}
+
+	for _, address := range strings.Split(moduleEnv(ctx, "NAKAMA_TREASURY_ADDRESSES"), ",") {
+		if address = strings.ToLower(strings.TrimSpace(address)); address != "" {
+			c.TreasuryAddresses = append(c.TreasuryAddresses, address)
+		}
+	}
+	if v := moduleEnv(ctx, "NAKAMA_MERKLE_DISTRIBUTOR_ADDRESS"); v != "" {
+		if _, err := parseHexAddress(v); err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_MERKLE_DISTRIBUTOR_ADDRESS: %q", v)
+		}
+		c.MerkleDistributorAddress = v
+	}
+	c.BridgeCurrency = strings.TrimSpace(moduleEnv(ctx, "NAKAMA_BRIDGE_CURRENCY"))
+	c.BridgeRateWei = big.NewInt(1)
+	if v := moduleEnv(ctx, "NAKAMA_BRIDGE_RATE_WEI"); v != "" {
+		rate, ok := new(big.Int).SetString(v, 10)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_BRIDGE_RATE_WEI: %q", v)
+		}
+		c.BridgeRateWei = rate
+	}
+	c.ReconcileToleranceWei = new(big.Int)
+	if v := moduleEnv(ctx, "NAKAMA_RECONCILE_TOLERANCE_WEI"); v != "" {
+		tolerance, ok := new(big.Int).SetString(v, 10)
+		if !ok || tolerance.Sign() < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_RECONCILE_TOLERANCE_WEI: %q", v)
+		}
+		c.ReconcileToleranceWei = tolerance
+	}
+
+	if c.JWKSCacheTTL, err = moduleEnvDuration(ctx, "NAKAMA_JWKS_CACHE_TTL", time.Hour); err != nil {
+		return nil, err
+	}
+	if c.JWKSMinTTL, err = moduleEnvDuration(ctx, "NAKAMA_JWKS_MIN_TTL", time.Minute); err != nil {
+		return nil, err
+	}
+	if c.JWKSMaxTTL, err = moduleEnvDuration(ctx, "NAKAMA_JWKS_MAX_TTL", 24*time.Hour); err != nil {
+		return nil, err
+	}
+	if c.JWKSMinTTL > c.JWKSMaxTTL {
+		return nil, fmt.Errorf("NAKAMA_JWKS_MIN_TTL %v exceeds NAKAMA_JWKS_MAX_TTL %v", c.JWKSMinTTL, c.JWKSMaxTTL)
+	}
+	c.JWKSMaxIssuers = 64
+	if v := moduleEnv(ctx, "NAKAMA_JWKS_MAX_ISSUERS"); v != "" {
+		max, err := strconv.Atoi(v)
+		if err != nil || max < 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_JWKS_MAX_ISSUERS: %q", v)
+		}
+		c.JWKSMaxIssuers = max
+	}
+	if v := moduleEnv(ctx, "NAKAMA_JWKS_PREFETCH"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid NAKAMA_JWKS_PREFETCH: %q", v)
+		}
+		c.JWKSPrefetch = b
+	}
+	c.JWKSPrefetchConcurrency = 4
+	if v := moduleEnv(ctx, "NAKAMA_JWKS_PREFETCH_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid NAKAMA_JWKS_PREFETCH_CONCURRENCY: %q", v)
+		}
+		c.JWKSPrefetchConcurrency = n
+	}
+	if c.LinkTicketTTL, err = moduleEnvDuration(ctx, "NAKAMA_LINK_TICKET_TTL", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	if c.ResponseCacheTTL, err = moduleEnvDuration(ctx, "NAKAMA_RESPONSE_CACHE_TTL", 5*time.Second); err != nil {
+		return nil, err
+	}
+
+	if c.CognitoRegion == "" || c.CognitoUserPoolID == "" {
+		return nil, fmt.Errorf("NAKAMA_COGNITO_REGION and NAKAMA_COGNITO_USER_POOL_ID must be set")
+	}
+
+	return c, nil
+}
+
+// WalletReadEnabled reports whether wallet read surfaces are part of the
+// deployment profile.
+func (c *Config) WalletReadEnabled() bool {
+	return c.Profile == profileWalletRead || c.Profile == profileFullCustody
+}
+
+// CustodyEnabled reports whether signing and other custody surfaces are part
+// of the deployment profile.
+func (c *Config) CustodyEnabled() bool {
+	return c.Profile == profileFullCustody
+}
+
+// ReconcileEnabled reports whether the nightly ledger reconciliation worker
+// has enough configuration to run.
+func (c *Config) ReconcileEnabled() bool {
+	return c.BridgeCurrency != "" && len(c.TreasuryAddresses) > 0 && c.EVMRPCURL != ""
+}
+
+// SinkEnabled reports whether an analytics data sink is configured.
+func (c *Config) SinkEnabled() bool {
+	return c.SinkKind != ""
+}
+
+// Issuer returns the expected `iss` claim for ID tokens from the configured
+// user pool.
+func (c *Config) Issuer() string {
+	return fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", c.CognitoRegion, c.CognitoUserPoolID)
+}
+
+// JWKSURL returns the conventional Cognito JWKS endpoint for the configured
+// user pool.
+func (c *Config) JWKSURL() string {
+	return c.Issuer() + "/.well-known/jwks.json"
+}
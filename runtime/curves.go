@@ -0,0 +1,179 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// KMSSigner's base methods are secp256k1 because EVM wallets came first.
+// Other chains need other curves (ed25519 for Solana and Aptos), so signer
+// backends can additionally implement CurveSigner: callers state the curve,
+// backends advertise which ones they serve, and unsupported combinations fail
+// with a uniform error instead of each chain integration growing its own
+// signer interface.
+
+// KeyCurve names a signing curve a backend may serve.
+type KeyCurve string
+
+const (
+	CurveSecp256k1 KeyCurve = "secp256k1"
+	CurveEd25519   KeyCurve = "ed25519"
+)
+
+// CurveSigner is implemented by signer backends that serve more than one
+// signing curve. The base KMSSigner methods remain the secp256k1 path.
+type CurveSigner interface {
+	// SupportedCurves lists the curves this backend can serve.
+	SupportedCurves() []KeyCurve
+	// PublicKeyForCurve returns the public key for the wallet at the given
+	// derivation index on the given curve: uncompressed 65 bytes for
+	// secp256k1, 32 bytes for ed25519.
+	PublicKeyForCurve(ctx context.Context, curve KeyCurve, derivationIndex uint32) ([]byte, error)
+	// SignDigestForCurve signs a digest on the given curve: R||S||V for
+	// secp256k1, a 64-byte signature for ed25519. The signing context
+	// accompanies the call to the backend.
+	SignDigestForCurve(ctx context.Context, curve KeyCurve, derivationIndex uint32, digest []byte, sctx SigningContext) ([]byte, error)
+}
+
+// errUnsupportedCurve is the uniform error for backend/curve mismatches.
+func errUnsupportedCurve(backend interface{}, curve KeyCurve) error {
+	return fmt.Errorf("kms: signer backend %T does not support curve %q", backend, curve)
+}
+
+// curveSupported reports whether a backend advertises a curve.
+func curveSupported(signer CurveSigner, curve KeyCurve) bool {
+	for _, c := range signer.SupportedCurves() {
+		if c == curve {
+			return true
+		}
+	}
+	return false
+}
+
+// curveSigner returns a signer backend's multi-curve interface, verifying it
+// can serve the requested curve.
+func curveSigner(ctx context.Context, backendID string, curve KeyCurve) (CurveSigner, error) {
+	base, err := GetKMSSigner(ctx, backendID)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := base.(CurveSigner)
+	if !ok {
+		return nil, errUnsupportedCurve(base, curve)
+	}
+	if !curveSupported(signer, curve) {
+		return nil, errUnsupportedCurve(signer, curve)
+	}
+	return signer, nil
+}
+
+// --- MockKMSSigner multi-curve support ---
+
+// SupportedCurves implements CurveSigner. The mock serves both curves it
+// knows how to derive.
+func (s *MockKMSSigner) SupportedCurves() []KeyCurve {
+	return []KeyCurve{CurveSecp256k1, CurveEd25519}
+}
+
+// ed25519Key derives a deterministic ed25519 key for a derivation index. The
+// derivation label differs from the secp256k1 path so the curves never share
+// seed material.
+func (s *MockKMSSigner) ed25519Key(derivationIndex uint32) (ed25519.PrivateKey, error) {
+	mac := hmac.New(sha256.New, s.master)
+	mac.Write([]byte("wallet-ed25519/"))
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], derivationIndex)
+	mac.Write(idx[:])
+	return ed25519.NewKeyFromSeed(mac.Sum(nil)), nil
+}
+
+// PublicKeyForCurve implements CurveSigner.
+func (s *MockKMSSigner) PublicKeyForCurve(ctx context.Context, curve KeyCurve, derivationIndex uint32) ([]byte, error) {
+	switch curve {
+	case CurveSecp256k1:
+		return s.PublicKey(ctx, derivationIndex)
+	case CurveEd25519:
+		priv, err := s.ed25519Key(derivationIndex)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	default:
+		return nil, errUnsupportedCurve(s, curve)
+	}
+}
+
+// SignDigestForCurve implements CurveSigner.
+func (s *MockKMSSigner) SignDigestForCurve(ctx context.Context, curve KeyCurve, derivationIndex uint32, digest []byte, sctx SigningContext) ([]byte, error) {
+	switch curve {
+	case CurveSecp256k1:
+		return s.SignDigest(ctx, derivationIndex, digest, sctx)
+	case CurveEd25519:
+		priv, err := s.ed25519Key(derivationIndex)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.Sign(priv, digest), nil
+	default:
+		return nil, errUnsupportedCurve(s, curve)
+	}
+}
+
+// --- Dispatcher multi-curve support ---
+
+// SupportedCurves implements CurveSigner, reporting the wrapped backend's
+// capabilities. A backend without multi-curve support serves secp256k1 only.
+func (d *kmsDispatcher) SupportedCurves() []KeyCurve {
+	if signer, ok := d.inner.(CurveSigner); ok {
+		return signer.SupportedCurves()
+	}
+	return []KeyCurve{CurveSecp256k1}
+}
+
+// PublicKeyForCurve implements CurveSigner with the dispatcher's caching and
+// budgeting applied.
+func (d *kmsDispatcher) PublicKeyForCurve(ctx context.Context, curve KeyCurve, derivationIndex uint32) ([]byte, error) {
+	if curve == CurveSecp256k1 {
+		return d.PublicKey(ctx, derivationIndex)
+	}
+	signer, ok := d.inner.(CurveSigner)
+	if !ok || !curveSupported(signer, curve) {
+		return nil, errUnsupportedCurve(d.inner, curve)
+	}
+	return d.cachedPublicKey(fmt.Sprintf("curve/%s/%d", curve, derivationIndex), "get_public_key", func() ([]byte, error) {
+		return signer.PublicKeyForCurve(ctx, curve, derivationIndex)
+	})
+}
+
+// SignDigestForCurve implements CurveSigner with call budgeting applied.
+func (d *kmsDispatcher) SignDigestForCurve(ctx context.Context, curve KeyCurve, derivationIndex uint32, digest []byte, sctx SigningContext) ([]byte, error) {
+	if curve == CurveSecp256k1 {
+		return d.SignDigest(ctx, derivationIndex, digest, sctx)
+	}
+	signer, ok := d.inner.(CurveSigner)
+	if !ok || !curveSupported(signer, curve) {
+		return nil, errUnsupportedCurve(d.inner, curve)
+	}
+	if err := d.reserveCall("sign"); err != nil {
+		return nil, err
+	}
+	return signer.SignDigestForCurve(ctx, curve, derivationIndex, digest, sctx)
+}
@@ -0,0 +1,263 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Background jobs that fail permanently — a metadata sync past its retry
+// budget, a webhook nobody answers — land in a shared dead-letter store
+// instead of vanishing into the log. Operators list, retry or discard
+// entries through admin RPCs; each job class registers a retry handler that
+// knows how to re-run its payload. When a class's depth crosses the
+// configured threshold an alert is posted to the ops webhook. Depth is
+// tracked per node in memory, which is enough for alerting; the store itself
+// is the durable record.
+
+const (
+	dlqCollection = "dead_letters"
+	// dlqAlertInterval throttles repeat alerts per class.
+	dlqAlertInterval = time.Hour
+	dlqAlertTimeout  = 5 * time.Second
+)
+
+// dlqEntry is one permanently failed job.
+type dlqEntry struct {
+	ID       string `json:"id"`
+	Class    string `json:"class"`
+	UserID   string `json:"userId,omitempty"`
+	Payload  string `json:"payload"`
+	Reason   string `json:"reason"`
+	Attempts int    `json:"attempts"`
+	FailedAt int64  `json:"failedAt"`
+}
+
+// dlqRetryHandler re-runs one dead-lettered payload. Registered per class in
+// InitModule.
+type dlqRetryHandler func(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, entry *dlqEntry) error
+
+var dlqRetryHandlers = make(map[string]dlqRetryHandler)
+
+var dlqDepth = struct {
+	sync.Mutex
+	byClass     map[string]int
+	lastAlertAt map[string]time.Time
+}{byClass: make(map[string]int), lastAlertAt: make(map[string]time.Time)}
+
+// deadLetter records a permanently failed job and fires a depth alert when
+// the class crosses the configured threshold. Best effort by design: callers
+// have already exhausted their own retries.
+func deadLetter(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, class, userID, payload, reason string, attempts int) {
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		logger.Error("Dead letter ID generation failed: %v", err)
+		return
+	}
+	entry := &dlqEntry{
+		ID:       id,
+		Class:    class,
+		UserID:   userID,
+		Payload:  payload,
+		Reason:   reason,
+		Attempts: attempts,
+		FailedAt: moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: dlqCollection,
+		Key:        entry.ID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Dead letter write failed for %v job: %v", class, err)
+		return
+	}
+
+	dlqDepth.Lock()
+	dlqDepth.byClass[class]++
+	depth := dlqDepth.byClass[class]
+	alert := cfg.DLQAlertDepth > 0 && depth >= cfg.DLQAlertDepth &&
+		moduleClock.Now().Sub(dlqDepth.lastAlertAt[class]) >= dlqAlertInterval
+	if alert {
+		dlqDepth.lastAlertAt[class] = moduleClock.Now()
+	}
+	dlqDepth.Unlock()
+
+	if alert {
+		go alertDLQDepth(logger, class, depth)
+	}
+}
+
+// alertDLQDepth posts a depth alert to the ops webhook.
+func alertDLQDepth(logger nkruntime.Logger, class string, depth int) {
+	if cfg.AlertWebhookURL == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dlqAlertTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"alert": "dlq_depth",
+		"class": class,
+		"depth": depth,
+		"node":  nodeID,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.AlertWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Warn("DLQ depth alert failed for class %v: %v", class, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// rpcAdminListDeadLetters lists dead-letter entries, optionally filtered by
+// class. Server-to-server only.
+func rpcAdminListDeadLetters(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Class  string `json:"class,omitempty"`
+		Limit  int    `json:"limit,omitempty"`
+		Cursor string `json:"cursor,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed listing request.", codes.InvalidArgument)
+		}
+	}
+	req.Limit = normalizeListLimit(req.Limit)
+
+	objects, cursor, err := nk.StorageList(ctx, "", "", dlqCollection, req.Limit, req.Cursor)
+	if err != nil {
+		logger.Error("Dead letter listing failed: %v", err)
+		return "", rpcError(errCodeInternal, "Dead letter listing failed.", codes.Internal)
+	}
+
+	entries := make([]*dlqEntry, 0, len(objects))
+	for _, obj := range objects {
+		entry := &dlqEntry{}
+		if err := json.Unmarshal([]byte(obj.Value), entry); err != nil {
+			logger.Warn("Skipping corrupt dead letter %v: %v", obj.Key, err)
+			continue
+		}
+		if req.Class != "" && entry.Class != req.Class {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"entries": entries,
+		"cursor":  cursor,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// rpcAdminResolveDeadLetters retries or discards dead-letter entries by ID.
+// A successful retry removes the entry; a failed retry leaves it in place
+// with the new error in the per-ID result.
+func rpcAdminResolveDeadLetters(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		IDs    []string `json:"ids"`
+		Action string   `json:"action"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || len(req.IDs) == 0 || (req.Action != "retry" && req.Action != "discard") {
+		return "", rpcError(errCodeBadInput, "Expects ids and an action of retry or discard.", codes.InvalidArgument)
+	}
+
+	results := make(map[string]string, len(req.IDs))
+	for _, id := range req.IDs {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: dlqCollection,
+			Key:        id,
+		}})
+		if err != nil || len(objects) == 0 {
+			results[id] = "not found"
+			continue
+		}
+		entry := &dlqEntry{}
+		if err := json.Unmarshal([]byte(objects[0].Value), entry); err != nil {
+			results[id] = "corrupt"
+			continue
+		}
+
+		if req.Action == "retry" {
+			handler, ok := dlqRetryHandlers[entry.Class]
+			if !ok {
+				results[id] = fmt.Sprintf("no retry handler for class %q", entry.Class)
+				continue
+			}
+			if err := handler(ctx, logger, nk, entry); err != nil {
+				results[id] = fmt.Sprintf("retry failed: %v", err)
+				continue
+			}
+		}
+
+		if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+			Collection: dlqCollection,
+			Key:        id,
+		}}); err != nil {
+			results[id] = fmt.Sprintf("delete failed: %v", err)
+			continue
+		}
+		dlqDepth.Lock()
+		if dlqDepth.byClass[entry.Class] > 0 {
+			dlqDepth.byClass[entry.Class]--
+		}
+		dlqDepth.Unlock()
+		results[id] = "ok"
+	}
+
+	if err := appendAudit(ctx, nk, "dlq.resolved", "", map[string]interface{}{
+		"action":  req.Action,
+		"results": results,
+	}); err != nil {
+		logger.Error("Audit append failed for DLQ resolution: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"results": results})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
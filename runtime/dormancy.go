@@ -0,0 +1,252 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Custodial wallets whose owners stop logging in fall under the dormancy
+// policy: after the configured number of months without a login or signed
+// transaction the user is notified, and — where the jurisdiction requires
+// segregation — a recoverable ledger entry earmarks the wallet's assets for
+// the segregated custody address. The sweep itself only writes the ledger
+// entry and audit trail; moving funds stays with treasury tooling so the
+// entry can be reversed if the user returns.
+
+const (
+	lastActivityKey     = "last_activity"
+	dormancyKey         = "dormancy"
+	dormancyCollection  = "dormancy_ledger"
+	dormancyInterval    = 24 * time.Hour
+	dormancyNoticeGrace = 30 * 24 * time.Hour
+
+	// notificationCodeDormancy tags dormancy notices for clients.
+	notificationCodeDormancy = 102
+)
+
+// lastActivity records when a user last logged in or signed a transaction.
+type lastActivity struct {
+	LoginAt int64 `json:"loginAt,omitempty"`
+	TxAt    int64 `json:"txAt,omitempty"`
+}
+
+func (a *lastActivity) latest() int64 {
+	if a.TxAt > a.LoginAt {
+		return a.TxAt
+	}
+	return a.LoginAt
+}
+
+// dormancyState tracks where a user sits in the dormancy pipeline.
+type dormancyState struct {
+	NotifiedAt int64 `json:"notifiedAt,omitempty"`
+	SweptAt    int64 `json:"sweptAt,omitempty"`
+}
+
+// touchActivity records a login or transaction as wallet activity. Best
+// effort: activity tracking must not fail the hot path.
+func touchActivity(ctx context.Context, nk nkruntime.NakamaModule, userID, kind string) error {
+	activity := &lastActivity{}
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: walletMetaCollection,
+		Key:        lastActivityKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return err
+	}
+	if len(objects) > 0 {
+		_ = json.Unmarshal([]byte(objects[0].Value), activity)
+	}
+	now := moduleClock.Now().Unix()
+	switch kind {
+	case "login":
+		activity.LoginAt = now
+	case "tx":
+		activity.TxAt = now
+	}
+	value, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: walletMetaCollection,
+		Key:        lastActivityKey,
+		UserID:     userID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// readDormancyState returns a user's dormancy record and its storage version.
+func readDormancyState(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*dormancyState, string, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: walletMetaCollection,
+		Key:        dormancyKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+	state := &dormancyState{}
+	if len(objects) == 0 {
+		return state, "*", nil
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), state); err != nil {
+		return nil, "", err
+	}
+	return state, objects[0].Version, nil
+}
+
+func writeDormancyState(ctx context.Context, nk nkruntime.NakamaModule, userID string, state *dormancyState, version string) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: walletMetaCollection,
+		Key:        dormancyKey,
+		UserID:     userID,
+		Value:      string(value),
+		Version:    version,
+	}})
+	return err
+}
+
+// runDormancyPass scans wallet owners' last-activity timestamps and advances
+// dormant accounts through notice and, where configured, segregation.
+func runDormancyPass(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+	if cfg.DormancyMonths <= 0 {
+		return
+	}
+	threshold := moduleClock.Now().AddDate(0, -cfg.DormancyMonths, 0).Unix()
+
+	// Dormancy is account-level, but wallets are namespaced per tenant, so
+	// every tenant's wallet collection gets scanned.
+	for _, collection := range tenantCollections(walletCollection) {
+		runDormancyScan(ctx, logger, nk, collection, threshold)
+	}
+}
+
+// runDormancyScan advances dormancy for owners found in one wallet collection.
+func runDormancyScan(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, collection string, threshold int64) {
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", collection, 100, cursor)
+		if err != nil {
+			logger.Error("Dormancy wallet scan failed: %v", err)
+			return
+		}
+		for _, obj := range objects {
+			userID := obj.UserId
+			if userID == "" {
+				continue
+			}
+			wallet := &Wallet{}
+			if err := json.Unmarshal([]byte(obj.Value), wallet); err != nil {
+				continue
+			}
+
+			activity := &lastActivity{LoginAt: wallet.CreatedAt}
+			if activityObjects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+				Collection: walletMetaCollection,
+				Key:        lastActivityKey,
+				UserID:     userID,
+			}}); err == nil && len(activityObjects) > 0 {
+				_ = json.Unmarshal([]byte(activityObjects[0].Value), activity)
+			}
+			if activity.latest() >= threshold {
+				continue
+			}
+
+			state, version, err := readDormancyState(ctx, nk, userID)
+			if err != nil {
+				logger.Warn("Dormancy state read failed for user %v: %v", userID, err)
+				continue
+			}
+
+			if state.NotifiedAt == 0 {
+				if err := nk.NotificationSend(ctx, userID, "Your wallet is inactive", map[string]interface{}{
+					"dormantSince": activity.latest(),
+					"policyMonths": cfg.DormancyMonths,
+				}, notificationCodeDormancy, "", true); err != nil {
+					logger.Warn("Dormancy notice failed for user %v: %v", userID, err)
+					continue
+				}
+				state.NotifiedAt = moduleClock.Now().Unix()
+				if err := writeDormancyState(ctx, nk, userID, state, version); err != nil {
+					logger.Warn("Dormancy state write failed for user %v: %v", userID, err)
+					continue
+				}
+				if err := appendAudit(ctx, nk, "dormancy.notified", userID, map[string]interface{}{
+					"dormantSince": activity.latest(),
+				}); err != nil {
+					logger.Warn("Audit append failed for dormancy notice of user %v: %v", userID, err)
+				}
+				continue
+			}
+
+			// Segregation happens a grace period after notice, only where the
+			// jurisdiction config requires it.
+			if state.SweptAt != 0 || !cfg.DormancySweepEnabled || cfg.DormancyCustodyAddress == "" {
+				continue
+			}
+			if moduleClock.Now().Unix() < state.NotifiedAt+int64(dormancyNoticeGrace.Seconds()) {
+				continue
+			}
+
+			entry := map[string]interface{}{
+				"userId":         userID,
+				"address":        wallet.Address,
+				"label":          wallet.Label,
+				"custodyAddress": cfg.DormancyCustodyAddress,
+				"recoverable":    true,
+				"createdAt":      moduleClock.Now().Unix(),
+			}
+			value, err := json.Marshal(entry)
+			if err != nil {
+				continue
+			}
+			if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+				Collection: dormancyCollection,
+				Key:        userID + ":" + walletKey(wallet.Label),
+				Value:      string(value),
+			}}); err != nil {
+				logger.Warn("Dormancy ledger write failed for user %v: %v", userID, err)
+				continue
+			}
+			state.SweptAt = moduleClock.Now().Unix()
+			if err := writeDormancyState(ctx, nk, userID, state, version); err != nil {
+				logger.Warn("Dormancy state write failed for user %v: %v", userID, err)
+				continue
+			}
+			if err := appendAudit(ctx, nk, "dormancy.swept", userID, map[string]interface{}{
+				"address":        wallet.Address,
+				"custodyAddress": cfg.DormancyCustodyAddress,
+			}); err != nil {
+				logger.Warn("Audit append failed for dormancy sweep of user %v: %v", userID, err)
+			}
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Structured error codes returned to clients in the error envelope. Clients
+// are expected to branch on these rather than on message text.
+const (
+	errCodeAccountDisabled  = "ACCOUNT_DISABLED"
+	errCodeAMLBlocked       = "AML_BLOCKED"
+	errCodeApprovalRequired = "APPROVAL_REQUIRED"
+	errCodeAuthFailed       = "AUTH_FAILED"
+	errCodeBadInput         = "BAD_INPUT"
+	errCodeBudgetExceeded   = "BUDGET_EXCEEDED"
+	errCodeEmailMismatch    = "EMAIL_MISMATCH"
+	errCodeGeoRestricted    = "GEO_RESTRICTED"
+	errCodeInternal         = "INTERNAL"
+	errCodeKYCRequired      = "KYC_REQUIRED"
+	errCodeNotFound         = "NOT_FOUND"
+	errCodeNotModified      = "NOT_MODIFIED"
+	errCodePermissionDenied = "PERMISSION_DENIED"
+	errCodeQueueFull        = "QUEUE_FULL"
+	errCodeRetryLater       = "RETRY_LATER"
+	errCodeStaleToken       = "STALE_TOKEN"
+	errCodeNotInvited       = "NOT_INVITED"
+	errCodeParentalConsent  = "PARENTAL_CONSENT_REQUIRED"
+	errCodeTicketExpired    = "TICKET_EXPIRED"
+	errCodeTooManyPending   = "TOO_MANY_PENDING"
+	errCodeTicketInvalid    = "TICKET_INVALID"
+	errCodeTicketUsed       = "TICKET_USED"
+	errCodeVersionMismatch  = "VERSION_MISMATCH"
+)
+
+// retryableCodes classifies which error codes a client may safely retry
+// without changing the request: transient capacity and upstream availability
+// conditions. Everything else either needs a different request or a human.
+// The mapping is published through rpc_schema so client SDKs stay in sync.
+var retryableCodes = map[string]bool{
+	errCodeQueueFull:      true,
+	errCodeRetryLater:     true,
+	errCodeTooManyPending: true,
+}
+
+// httpStatusFor is the REST gateway's gRPC-to-HTTP status translation. The
+// envelope carries the resolved status so clients behind proxies that
+// flatten statuses (or SDKs reading the body only) still see what the
+// gateway emitted: 400 for bad requests, 401/403 for auth, 429 for
+// capacity, 503 for upstream availability.
+func httpStatusFor(grpcCode codes.Code) int {
+	switch grpcCode {
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return 400
+	case codes.Unauthenticated:
+		return 401
+	case codes.PermissionDenied:
+		return 403
+	case codes.NotFound:
+		return 404
+	case codes.AlreadyExists, codes.Aborted:
+		return 409
+	case codes.ResourceExhausted:
+		return 429
+	case codes.Unimplemented:
+		return 501
+	case codes.Unavailable:
+		return 503
+	case codes.DeadlineExceeded:
+		return 504
+	default:
+		return 500
+	}
+}
+
+// rpcError builds the module's structured error envelope. The message sent to
+// the client is a small JSON document so web and game clients can branch on a
+// stable code, while the gRPC code drives HTTP status mapping at the gateway.
+// Every envelope carries retryable so clients never guess from the code.
+func rpcError(code string, message string, grpcCode codes.Code) error {
+	envelope, err := json.Marshal(map[string]interface{}{
+		"code":       code,
+		"message":    message,
+		"retryable":  retryableCodes[code],
+		"httpStatus": httpStatusFor(grpcCode),
+	})
+	if err != nil {
+		return nkruntime.NewError(message, int(codes.Internal))
+	}
+	return nkruntime.NewError(string(envelope), int(grpcCode))
+}
+
+// rpcErrorRetry is rpcError plus a retryAfterMs hint telling clients how long
+// to back off before resubmitting. Errors carrying a hint are retryable by
+// definition.
+func rpcErrorRetry(code string, message string, retryAfter time.Duration, grpcCode codes.Code) error {
+	envelope, err := json.Marshal(map[string]interface{}{
+		"code":         code,
+		"message":      message,
+		"retryable":    true,
+		"retryAfterMs": retryAfter.Milliseconds(),
+		"httpStatus":   httpStatusFor(grpcCode),
+	})
+	if err != nil {
+		return nkruntime.NewError(message, int(codes.Internal))
+	}
+	return nkruntime.NewError(string(envelope), int(grpcCode))
+}
+
+// withErrorEnvelope guarantees every error leaving an RPC handler is a
+// structured envelope with a gRPC code the gateway can translate. Plain
+// errors from helpers that bubble up unclassified — storage failures,
+// encoding bugs — would otherwise surface as generic 500s with free-text
+// bodies; they become INTERNAL envelopes here, with the original error kept
+// server-side in the log.
+func withErrorEnvelope(name string, fn func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error)) func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+		out, err := fn(ctx, logger, db, nk, payload)
+		if err == nil {
+			return out, nil
+		}
+		var structured *nkruntime.Error
+		if errors.As(err, &structured) {
+			return out, err
+		}
+		logger.Error("RPC %v failed with unclassified error: %v", name, err)
+		return "", rpcError(errCodeInternal, "Internal error.", codes.Internal)
+	}
+}
+
+// userIDFromContext returns the calling session's user ID, or empty for
+// server-to-server calls made with the runtime HTTP key.
+func userIDFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(nkruntime.RUNTIME_CTX_USER_ID).(string)
+	return userID
+}
+
+// requireUser guards RPCs that only make sense for an authenticated session.
+func requireUser(ctx context.Context) (string, error) {
+	userID := userIDFromContext(ctx)
+	if userID == "" {
+		return "", rpcError(errCodePermissionDenied, "RPC requires an authenticated user session.", codes.Unauthenticated)
+	}
+	return userID, nil
+}
+
+// requireServer guards server-to-server RPCs invoked with the runtime HTTP
+// key. Calls carrying a user session are rejected.
+func requireServer(ctx context.Context) error {
+	if userIDFromContext(ctx) != "" {
+		return rpcError(errCodePermissionDenied, "RPC is restricted to server-to-server callers.", codes.PermissionDenied)
+	}
+	return nil
+}
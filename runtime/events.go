@@ -0,0 +1,110 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Connected clients receive wallet updates live over a per-user realtime
+// stream instead of polling rpc_list_transactions. A socket session joins its
+// stream via rpc_subscribe_wallet_events; the chain watcher (running out of
+// process) delivers detected events through rpc_admin_push_chain_event.
+
+// walletEventStreamMode is the custom stream mode wallet events are pushed
+// on. The subject is the receiving user's ID.
+const walletEventStreamMode uint8 = 101
+
+// WalletEvent is the envelope pushed to subscribed clients.
+type WalletEvent struct {
+	// Type classifies the event, e.g. "tx.confirmed", "transfer.incoming".
+	Type      string                 `json:"type"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+	CreatedAt int64                  `json:"createdAt"`
+}
+
+// pushWalletEvent delivers an event to a user's wallet event stream. Users
+// with no subscribed sessions simply receive nothing; events are not queued.
+func pushWalletEvent(ctx context.Context, nk nkruntime.NakamaModule, userID string, event *WalletEvent) error {
+	if event.CreatedAt == 0 {
+		event.CreatedAt = moduleClock.Now().Unix()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// Events are mirrored to the external webhook consumer off the request
+	// path; delivery outcomes are recorded in webhook.go. The endpoint is
+	// per tenant on multi-tenant clusters.
+	tenant := tenantFromContext(ctx)
+	if url, _ := tenantWebhook(tenant); url != "" {
+		go forwardWebhook(webhookLogger, nk, tenant, userID, event, string(data))
+	}
+	// SQS consumers get the same payload through the SNS batcher.
+	if eventPublisher != nil {
+		eventPublisher.enqueue(string(data))
+	}
+	return nk.StreamSend(walletEventStreamMode, userID, "", "", string(data), nil, true)
+}
+
+// rpcSubscribeWalletEvents joins the calling socket session to the user's
+// wallet event stream. Must be called over a realtime socket; the
+// subscription lasts for the life of the session.
+func rpcSubscribeWalletEvents(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	sessionID, ok := ctx.Value(nkruntime.RUNTIME_CTX_SESSION_ID).(string)
+	if !ok || sessionID == "" {
+		return "", rpcError(errCodeBadInput, "Subscription requires a realtime socket session.", codes.FailedPrecondition)
+	}
+
+	if _, err := nk.StreamUserJoin(walletEventStreamMode, userID, "", "", userID, sessionID, true, false, ""); err != nil {
+		logger.Error("Wallet event stream join failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Subscription failed.", codes.Internal)
+	}
+
+	return `{"subscribed":true}`, nil
+}
+
+// rpcAdminPushChainEvent accepts a detected chain event from the watcher and
+// pushes it to the target user's stream. Server-to-server only.
+func rpcAdminPushChainEvent(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID  string                 `json:"userId"`
+		Type    string                 `json:"type"`
+		Details map[string]interface{} `json:"details,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" || req.Type == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId and event type.", codes.InvalidArgument)
+	}
+
+	if err := pushWalletEvent(ctx, nk, req.UserID, &WalletEvent{Type: req.Type, Details: req.Details}); err != nil {
+		logger.Error("Wallet event push failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Event push failed.", codes.Internal)
+	}
+
+	return `{"pushed":true}`, nil
+}
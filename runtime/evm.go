@@ -0,0 +1,338 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// AccessListEntry is one EIP-2930 access list tuple: an address and the
+// storage keys the transaction will touch there.
+type AccessListEntry struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storageKeys,omitempty"` // 0x-prefixed 32-byte hex.
+}
+
+// EVMTransactionRequest describes a transaction the client wants signed.
+// Transactions are built as EIP-1559 dynamic fee transactions, or as EIP-4844
+// blob transactions when blob fields are present and the deployment enables
+// them.
+type EVMTransactionRequest struct {
+	To    string `json:"to"`
+	Value string `json:"value,omitempty"` // Wei, decimal string.
+	Data  string `json:"data,omitempty"`  // 0x-prefixed hex.
+	Gas   uint64 `json:"gas"`
+	// Fee fields are Wei, decimal strings.
+	MaxFeePerGas         string `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas"`
+	// AccessList optionally pre-declares touched state (EIP-2930).
+	AccessList []*AccessListEntry `json:"accessList,omitempty"`
+	// Blob transaction fields (EIP-4844). Setting either selects a type-3
+	// transaction; the blobs themselves travel with the broadcaster, not
+	// through the signer.
+	MaxFeePerBlobGas    string   `json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes []string `json:"blobVersionedHashes,omitempty"`
+	// Nonce is optional when the module manages nonces itself (see
+	// txnonce.go); a supplied value always wins. Signing still requires it
+	// to be resolved by then.
+	Nonce *uint64 `json:"nonce"`
+	// WalletLabel selects which of the user's wallets signs; empty means the
+	// default wallet.
+	WalletLabel string `json:"walletLabel,omitempty"`
+	// Memo is an optional UTF-8 message carried on-chain for plain transfers:
+	// it is hex-encoded into the transaction data, so it is only accepted
+	// when data is empty. Used for gifting and support reconciliation.
+	Memo string `json:"memo,omitempty"`
+	// SponsorGas asks the operator to pay the transaction fee, subject to
+	// the configured gas budgets.
+	SponsorGas bool `json:"sponsorGas,omitempty"`
+	// IntentID references a server-created pre-authorization; see intent.go.
+	IntentID string `json:"intentId,omitempty"`
+	// Context carries optional game context tags (feature, item, match)
+	// validated against the configured schema.
+	Context map[string]string `json:"context,omitempty"`
+	// Authorization ties a server-initiated transaction to the game event
+	// that caused it; verified at signing time when present.
+	Authorization *TxAuthorization `json:"authorization,omitempty"`
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// ethereumAddress derives the 0x-prefixed address for an uncompressed
+// secp256k1 public key.
+func ethereumAddress(uncompressedPub []byte) string {
+	return "0x" + hex.EncodeToString(keccak256(uncompressedPub[1:])[12:])
+}
+
+// parseHexAddress validates and decodes a 0x-prefixed 20-byte address.
+func parseHexAddress(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return nil, fmt.Errorf("address must be 0x-prefixed")
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("address is not valid hex")
+	}
+	if len(b) != 20 {
+		return nil, fmt.Errorf("address must be 20 bytes, got %d", len(b))
+	}
+	return b, nil
+}
+
+// parseWei parses a non-negative decimal Wei amount, with empty treated as
+// zero.
+func parseWei(s string) (*big.Int, error) {
+	if s == "" {
+		return new(big.Int), nil
+	}
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok || v.Sign() < 0 {
+		return nil, fmt.Errorf("amount %q is not a non-negative decimal integer", s)
+	}
+	return v, nil
+}
+
+// parseHexData decodes optional 0x-prefixed calldata.
+func parseHexData(s string) ([]byte, error) {
+	if s == "" || s == "0x" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("data must be 0x-prefixed hex")
+	}
+	b, err := hex.DecodeString(s[2:])
+	if err != nil {
+		return nil, fmt.Errorf("data is not valid hex")
+	}
+	return b, nil
+}
+
+// validateEVMTransactionRequest checks request fields and returns the parsed
+// components used to build the transaction.
+func validateEVMTransactionRequest(req *EVMTransactionRequest) (to []byte, value *big.Int, data []byte, maxFee *big.Int, maxPriority *big.Int, err error) {
+	if to, err = parseHexAddress(req.To); err != nil {
+		return
+	}
+	if value, err = parseWei(req.Value); err != nil {
+		return
+	}
+	if data, err = parseHexData(req.Data); err != nil {
+		return
+	}
+	if req.Gas == 0 {
+		err = fmt.Errorf("gas must be set")
+		return
+	}
+	if maxFee, err = parseWei(req.MaxFeePerGas); err != nil {
+		return
+	}
+	if maxPriority, err = parseWei(req.MaxPriorityFeePerGas); err != nil {
+		return
+	}
+	if maxFee.Sign() == 0 {
+		err = fmt.Errorf("maxFeePerGas must be set")
+		return
+	}
+	if maxPriority.Cmp(maxFee) > 0 {
+		err = fmt.Errorf("maxPriorityFeePerGas exceeds maxFeePerGas")
+		return
+	}
+	if req.Nonce == nil {
+		err = fmt.Errorf("nonce must be set")
+		return
+	}
+	return
+}
+
+// memoMaxBytes bounds on-chain memos; every byte is paid calldata.
+const memoMaxBytes = 256
+
+// applyMemo folds a UTF-8 memo into the transaction data of a plain
+// transfer. Requests that already carry calldata cannot also carry a memo.
+func applyMemo(req *EVMTransactionRequest) error {
+	if req.Memo == "" {
+		return nil
+	}
+	if req.Data != "" && req.Data != "0x" {
+		return fmt.Errorf("memo is only supported on plain transfers without data")
+	}
+	if !utf8.ValidString(req.Memo) {
+		return fmt.Errorf("memo must be valid UTF-8")
+	}
+	if len(req.Memo) > memoMaxBytes {
+		return fmt.Errorf("memo exceeds %d bytes", memoMaxBytes)
+	}
+	req.Data = "0x" + hex.EncodeToString([]byte(req.Memo))
+	return nil
+}
+
+// parseAccessList validates an EIP-2930 access list and returns its RLP
+// structure.
+func parseAccessList(entries []*AccessListEntry) ([]interface{}, error) {
+	accessList := make([]interface{}, 0, len(entries))
+	for i, entry := range entries {
+		address, err := parseHexAddress(entry.Address)
+		if err != nil {
+			return nil, fmt.Errorf("access list entry %d: %w", i, err)
+		}
+		keys := make([]interface{}, 0, len(entry.StorageKeys))
+		for _, key := range entry.StorageKeys {
+			if !strings.HasPrefix(key, "0x") {
+				return nil, fmt.Errorf("access list entry %d: storage key must be 0x-prefixed hex", i)
+			}
+			b, err := hex.DecodeString(key[2:])
+			if err != nil || len(b) != 32 {
+				return nil, fmt.Errorf("access list entry %d: storage key must be 32 bytes of hex", i)
+			}
+			keys = append(keys, b)
+		}
+		accessList = append(accessList, []interface{}{address, keys})
+	}
+	return accessList, nil
+}
+
+// isBlobTransaction reports whether a request selects a type-3 (EIP-4844)
+// transaction.
+func isBlobTransaction(req *EVMTransactionRequest) bool {
+	return req.MaxFeePerBlobGas != "" || len(req.BlobVersionedHashes) > 0
+}
+
+// parseBlobFields validates EIP-4844 blob fee and commitment fields. Both
+// must be present together; versioned hashes are 32 bytes with the 0x01
+// (KZG) version prefix.
+func parseBlobFields(req *EVMTransactionRequest) (maxFeePerBlobGas *big.Int, hashes [][]byte, err error) {
+	if !isBlobTransaction(req) {
+		return nil, nil, nil
+	}
+	if !cfg.EVMBlobTxEnabled {
+		return nil, nil, fmt.Errorf("blob transactions are not enabled for this deployment")
+	}
+	if req.MaxFeePerBlobGas == "" || len(req.BlobVersionedHashes) == 0 {
+		return nil, nil, fmt.Errorf("blob transactions require both maxFeePerBlobGas and blobVersionedHashes")
+	}
+	if maxFeePerBlobGas, err = parseWei(req.MaxFeePerBlobGas); err != nil {
+		return nil, nil, err
+	}
+	if maxFeePerBlobGas.Sign() == 0 {
+		return nil, nil, fmt.Errorf("maxFeePerBlobGas must be set")
+	}
+	for i, h := range req.BlobVersionedHashes {
+		if !strings.HasPrefix(h, "0x") {
+			return nil, nil, fmt.Errorf("blob versioned hash %d must be 0x-prefixed hex", i)
+		}
+		b, err := hex.DecodeString(h[2:])
+		if err != nil || len(b) != 32 {
+			return nil, nil, fmt.Errorf("blob versioned hash %d must be 32 bytes of hex", i)
+		}
+		if b[0] != 0x01 {
+			return nil, nil, fmt.Errorf("blob versioned hash %d has unsupported version 0x%02x", i, b[0])
+		}
+		hashes = append(hashes, b)
+	}
+	return maxFeePerBlobGas, hashes, nil
+}
+
+// signEVMTransaction builds, signs and serializes a transaction for the given
+// wallet: EIP-1559 dynamic fee (type 2) normally, or EIP-4844 blob (type 3)
+// when blob fields are present. It returns the raw signed transaction and its
+// hash. The transaction is NOT broadcast; submitting it to a network is the
+// caller's responsibility. The purpose names the operation class and is bound
+// into the signing context sent to the custody backend.
+func signEVMTransaction(ctx context.Context, wallet *Wallet, req *EVMTransactionRequest, purpose string) (raw []byte, hash []byte, err error) {
+	to, value, data, maxFee, maxPriority, err := validateEVMTransactionRequest(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	accessList, err := parseAccessList(req.AccessList)
+	if err != nil {
+		return nil, nil, err
+	}
+	maxFeePerBlobGas, blobHashes, err := parseBlobFields(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	chainID := big.NewInt(cfg.EVMChainID)
+	fields := []interface{}{
+		chainID,
+		*req.Nonce,
+		maxPriority,
+		maxFee,
+		req.Gas,
+		to,
+		value,
+		data,
+		accessList,
+	}
+	txType := byte(0x02)
+	if maxFeePerBlobGas != nil {
+		txType = 0x03
+		blobs := make([]interface{}, 0, len(blobHashes))
+		for _, h := range blobHashes {
+			blobs = append(blobs, h)
+		}
+		fields = append(fields, maxFeePerBlobGas, blobs)
+	}
+
+	unsigned, err := rlpEncode(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	digest := keccak256([]byte{txType}, unsigned)
+
+	sctx := signingContextFor(wallet, purpose)
+	var sig []byte
+	if wallet.KeyARN != "" {
+		signer, err := perUserKeySigner(ctx, wallet.Backend)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sig, err = signer.SignWithKey(ctx, wallet.KeyARN, digest, sctx); err != nil {
+			return nil, nil, fmt.Errorf("signing failed: %w", err)
+		}
+	} else {
+		signer, err := GetKMSSigner(ctx, wallet.Backend)
+		if err != nil {
+			return nil, nil, err
+		}
+		if sig, err = signer.SignDigest(ctx, wallet.DerivationIndex, digest, sctx); err != nil {
+			return nil, nil, fmt.Errorf("signing failed: %w", err)
+		}
+	}
+
+	r := new(big.Int).SetBytes(sig[0:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	yParity := uint64(sig[64])
+
+	signed, err := rlpEncode(append(fields, yParity, r, s))
+	if err != nil {
+		return nil, nil, err
+	}
+	raw = append([]byte{txType}, signed...)
+	return raw, keccak256(raw), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"testing"
+)
+
+// benchSigningSetup points the package globals at a mock signer so the real
+// signing path can be measured without a server. State is restored on cleanup.
+func benchSigningSetup(b *testing.B) {
+	prevCfg, prevSigner, prevBackends := cfg, kmsSigner, kmsBackends
+	b.Cleanup(func() { cfg, kmsSigner, kmsBackends = prevCfg, prevSigner, prevBackends })
+
+	cfg = &Config{EVMChainID: 1}
+	signer, err := NewMockKMSSigner([]byte("bench-master-key"))
+	if err != nil {
+		b.Fatalf("mock signer: %v", err)
+	}
+	kmsSigner = signer
+	kmsBackends = map[string]KMSSigner{kmsBackendMock: signer}
+}
+
+func BenchmarkSignEVMTransaction(b *testing.B) {
+	benchSigningSetup(b)
+	ctx := context.Background()
+	wallet := &Wallet{Address: "0x0000000000000000000000000000000000000001"}
+	nonce := uint64(0)
+	req := &EVMTransactionRequest{
+		To:                   "0x000000000000000000000000000000000000dead",
+		Value:                "1000000000000000000",
+		Gas:                  21000,
+		MaxFeePerGas:         "30000000000",
+		MaxPriorityFeePerGas: "1000000000",
+		Nonce:                &nonce,
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := signEVMTransaction(ctx, wallet, req, signPurposeUserTx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignEVMTransactionParallel(b *testing.B) {
+	benchSigningSetup(b)
+	wallet := &Wallet{Address: "0x0000000000000000000000000000000000000001"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		nonce := uint64(0)
+		req := &EVMTransactionRequest{
+			To:                   "0x000000000000000000000000000000000000dead",
+			Value:                "1000000000000000000",
+			Gas:                  21000,
+			MaxFeePerGas:         "30000000000",
+			MaxPriorityFeePerGas: "1000000000",
+			Nonce:                &nonce,
+		}
+		for pb.Next() {
+			if _, _, err := signEVMTransaction(ctx, wallet, req, signPurposeUserTx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import "strings"
+
+// Clients render "view on explorer" buttons from fully formed links the
+// module computes, so per-chain URL logic lives in configuration rather than
+// in every client. Templates are configured per network with {hash} and
+// {address} placeholders and links are filled in at response time, never
+// stored, so a template change applies to old records too.
+
+// explorerTxURL renders the transaction link for a network, or "" when no
+// template is configured.
+func explorerTxURL(chainID int64, hash string) string {
+	tmpl := cfg.ExplorerTxURLs[chainID]
+	if tmpl == "" || hash == "" {
+		return ""
+	}
+	return strings.ReplaceAll(tmpl, "{hash}", hash)
+}
+
+// explorerAddressURL renders the address link for a network, or "" when no
+// template is configured.
+func explorerAddressURL(chainID int64, address string) string {
+	tmpl := cfg.ExplorerAddressURLs[chainID]
+	if tmpl == "" || address == "" {
+		return ""
+	}
+	return strings.ReplaceAll(tmpl, "{address}", address)
+}
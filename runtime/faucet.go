@@ -0,0 +1,135 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Sandbox deployments expose rpc_faucet so QA can fund wallets and test
+// purchase flows without manual transfers. Minted balances live on a
+// per-user storage record — they are bookkeeping only and never touch a
+// chain. Claims are rate limited per user per UTC day.
+
+const (
+	faucetCollection    = "sandbox_balances"
+	faucetKeyNative     = "native"
+	faucetClaimsPerCAS  = 5 // CAS retry attempts, matching the other counters.
+	faucetDefaultDaily  = 5
+	faucetDefaultAmount = "1000000000000000000" // 1 ether in Wei.
+)
+
+// faucetBalance is a user's minted sandbox balance and claim history.
+type faucetBalance struct {
+	// Balance is total minted Wei as a decimal string.
+	Balance string `json:"balance"`
+	// ClaimDay and ClaimCount implement the per-day rate limit.
+	ClaimDay   string `json:"claimDay"`
+	ClaimCount int    `json:"claimCount"`
+	UpdatedAt  int64  `json:"updatedAt"`
+}
+
+// rpcFaucet mints the configured sandbox amount to the calling user, subject
+// to the daily claim limit. Registered only in sandbox mode.
+func rpcFaucet(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// The wallet must exist so the minted balance has an address to belong to.
+	if _, err := ensureWallet(ctx, logger, nk, userID); err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Error("Wallet provisioning failed for faucet claim by user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal)
+	}
+
+	day := gasSpendDay(moduleClock.Now())
+	var record *faucetBalance
+	for attempt := 0; attempt < faucetClaimsPerCAS; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: faucetCollection,
+			Key:        faucetKeyNative,
+			UserID:     userID,
+		}})
+		if err != nil {
+			logger.Error("Faucet balance read failed for user %v: %v", userID, err)
+			return "", rpcError(errCodeInternal, "Faucet claim failed.", codes.Internal)
+		}
+
+		record = &faucetBalance{Balance: "0"}
+		version := "*"
+		if len(objects) > 0 {
+			if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+				logger.Error("Faucet balance corrupt for user %v: %v", userID, err)
+				return "", rpcError(errCodeInternal, "Faucet claim failed.", codes.Internal)
+			}
+			version = objects[0].Version
+		}
+
+		if record.ClaimDay != day {
+			record.ClaimDay = day
+			record.ClaimCount = 0
+		}
+		if record.ClaimCount >= cfg.FaucetDailyLimit {
+			return "", rpcError(errCodeBudgetExceeded, "Daily faucet limit reached.", codes.ResourceExhausted)
+		}
+
+		balance, ok := new(big.Int).SetString(record.Balance, 10)
+		if !ok {
+			balance = new(big.Int)
+		}
+		record.Balance = new(big.Int).Add(balance, cfg.FaucetAmountWei).String()
+		record.ClaimCount++
+		record.UpdatedAt = moduleClock.Now().Unix()
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Faucet claim failed.", codes.Internal)
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection:     faucetCollection,
+			Key:            faucetKeyNative,
+			UserID:         userID,
+			Value:          string(value),
+			Version:        version,
+			PermissionRead: 1,
+		}}); err != nil {
+			continue // CAS race, retry.
+		}
+
+		logger.Info("Faucet minted %v Wei to user %v (claim %v/%v today)",
+			cfg.FaucetAmountWei, userID, record.ClaimCount, cfg.FaucetDailyLimit)
+		out, err := json.Marshal(map[string]interface{}{
+			"minted":          cfg.FaucetAmountWei.String(),
+			"balance":         record.Balance,
+			"claimsRemaining": cfg.FaucetDailyLimit - record.ClaimCount,
+		})
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+		}
+		return string(out), nil
+	}
+	return "", rpcError(errCodeInternal, fmt.Sprintf("Faucet contention for user %s, try again.", userID), codes.Aborted)
+}
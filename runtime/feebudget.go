@@ -0,0 +1,188 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// When the operator sponsors gas, spend is budgeted: worst-case fees
+// (gas limit x max fee) are accumulated per user per day and globally per
+// day, and sponsorship is refused once a configured cap would be exceeded.
+
+const gasSpendCollection = "gas_spend"
+
+// gasSpendRecord accumulates sponsored spend for one scope and day.
+type gasSpendRecord struct {
+	// ByChain maps chain ID to total worst-case Wei as a decimal string.
+	ByChain map[string]string `json:"byChain"`
+	// ByFeature maps the game context feature tag to total worst-case Wei.
+	ByFeature map[string]string `json:"byFeature,omitempty"`
+	Count     int               `json:"count"`
+}
+
+func (r *gasSpendRecord) total() *big.Int {
+	total := new(big.Int)
+	for _, v := range r.ByChain {
+		if amount, ok := new(big.Int).SetString(v, 10); ok {
+			total.Add(total, amount)
+		}
+	}
+	return total
+}
+
+func gasSpendDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// addGasSpend accumulates amount into the record at key, enforcing the cap
+// when set. The compare-and-swap loop keeps concurrent signers consistent.
+func addGasSpend(ctx context.Context, nk nkruntime.NakamaModule, key string, chainID int64, feature string, amount *big.Int, cap *big.Int) error {
+	chainKey := strconv.FormatInt(chainID, 10)
+	for attempt := 0; attempt < 5; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: gasSpendCollection,
+			Key:        key,
+		}})
+		if err != nil {
+			return err
+		}
+
+		record := &gasSpendRecord{ByChain: make(map[string]string)}
+		version := "*"
+		if len(objects) > 0 {
+			if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+				return fmt.Errorf("gas spend record corrupt at %s: %w", key, err)
+			}
+			version = objects[0].Version
+		}
+
+		current := new(big.Int)
+		if v, ok := record.ByChain[chainKey]; ok {
+			current, _ = new(big.Int).SetString(v, 10)
+		}
+		record.ByChain[chainKey] = new(big.Int).Add(current, amount).String()
+		if feature != "" {
+			if record.ByFeature == nil {
+				record.ByFeature = make(map[string]string)
+			}
+			current := new(big.Int)
+			if v, ok := record.ByFeature[feature]; ok {
+				current, _ = new(big.Int).SetString(v, 10)
+			}
+			record.ByFeature[feature] = new(big.Int).Add(current, amount).String()
+		}
+		record.Count++
+
+		if cap != nil && record.total().Cmp(cap) > 0 {
+			return rpcError(errCodeBudgetExceeded, "Sponsored gas budget exhausted.", codes.ResourceExhausted)
+		}
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: gasSpendCollection,
+			Key:        key,
+			Value:      string(value),
+			Version:    version,
+		}}); err != nil {
+			continue // CAS race, retry.
+		}
+		return nil
+	}
+	return fmt.Errorf("gas spend contention at %s, giving up", key)
+}
+
+// checkAndRecordGasSponsorship enforces per-user and global daily budgets for
+// a sponsored transaction and records its worst-case fee. The two records are
+// updated independently; a crash between them can under-count the global
+// ledger by one transaction, which budget caps tolerate.
+func checkAndRecordGasSponsorship(ctx context.Context, nk nkruntime.NakamaModule, userID string, chainID int64, feature string, gas uint64, maxFeePerGas *big.Int) error {
+	worstCase := new(big.Int).Mul(new(big.Int).SetUint64(gas), maxFeePerGas)
+	day := gasSpendDay(moduleClock.Now())
+
+	if err := addGasSpend(ctx, nk, fmt.Sprintf("user:%s:%s", userID, day), chainID, feature, worstCase, cfg.GasBudgetUserDailyWei); err != nil {
+		return err
+	}
+	return addGasSpend(ctx, nk, "global:"+day, chainID, feature, worstCase, cfg.GasBudgetGlobalDailyWei)
+}
+
+// rpcAdminGasReport aggregates sponsored gas spend over the trailing N days
+// (default 7), broken down by day and chain. Server-to-server only.
+func rpcAdminGasReport(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Days int `json:"days,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed report request.", codes.InvalidArgument)
+		}
+	}
+	if req.Days <= 0 || req.Days > 90 {
+		req.Days = 7
+	}
+
+	type dayReport struct {
+		Day       string            `json:"day"`
+		ByChain   map[string]string `json:"byChain"`
+		ByFeature map[string]string `json:"byFeature,omitempty"`
+		Count     int               `json:"count"`
+		Total     string            `json:"totalWei"`
+	}
+	days := make([]*dayReport, 0, req.Days)
+	for i := 0; i < req.Days; i++ {
+		day := gasSpendDay(moduleClock.Now().AddDate(0, 0, -i))
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: gasSpendCollection,
+			Key:        "global:" + day,
+		}})
+		if err != nil {
+			logger.Error("Gas report read failed for %v: %v", day, err)
+			return "", rpcError(errCodeInternal, "Report generation failed.", codes.Internal)
+		}
+		report := &dayReport{Day: day, ByChain: make(map[string]string), Total: "0"}
+		if len(objects) > 0 {
+			record := &gasSpendRecord{}
+			if json.Unmarshal([]byte(objects[0].Value), record) == nil {
+				report.ByChain = record.ByChain
+				report.ByFeature = record.ByFeature
+				report.Count = record.Count
+				report.Total = record.total().String()
+			}
+		}
+		days = append(days, report)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"days": days})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
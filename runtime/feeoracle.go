@@ -0,0 +1,249 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// Fee data comes from one shared oracle instead of every sign request hitting
+// the node independently. The oracle refreshes per network on demand with a
+// short TTL via eth_feeHistory, serving the base fee and priority fee
+// percentiles from cache in between. When the node is unreachable the last
+// snapshot is served stale rather than failing callers; staleness is exposed
+// in estimator responses and in metrics so operators see degraded data.
+
+const (
+	feeOracleTTL          = 15 * time.Second
+	feeOracleFetchTimeout = 5 * time.Second
+	// feeOracleBlockCount is the eth_feeHistory window the percentiles are
+	// averaged over.
+	feeOracleBlockCount = 5
+)
+
+// feeOraclePercentiles are the priority fee percentiles requested from the
+// node, keyed into feeSnapshot.Priority as "p25" etc.
+var feeOraclePercentiles = []int{25, 50, 75}
+
+var (
+	metricFeeOracleRefresh = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nakama_module_fee_oracle_refreshes_total",
+		Help: "Fee oracle refresh attempts by result.",
+	}, []string{"result"})
+
+	metricFeeOracleStale = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nakama_module_fee_oracle_stale_served_total",
+		Help: "Fee oracle reads served from an expired snapshot.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(metricFeeOracleRefresh, metricFeeOracleStale)
+}
+
+// feeSnapshot is one network's cached fee data.
+type feeSnapshot struct {
+	ChainID   int64
+	BaseFee   *big.Int
+	Priority  map[string]*big.Int
+	FetchedAt time.Time
+}
+
+// feeOracle caches fee snapshots per network.
+type feeOracle struct {
+	mu        sync.Mutex
+	snapshots map[int64]*feeSnapshot
+}
+
+var feeOracleShared = &feeOracle{snapshots: make(map[int64]*feeSnapshot)}
+
+// fetchFeeHistory queries the node for the current base fee and priority fee
+// percentiles averaged over the recent block window.
+func fetchFeeHistory(ctx context.Context, chainID int64) (*feeSnapshot, error) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1,
+		"method": "eth_feeHistory",
+		"params": []interface{}{fmt.Sprintf("0x%x", feeOracleBlockCount), "latest", feeOraclePercentiles},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.EVMRPCURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := &http.Client{Timeout: feeOracleFetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fee history fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Result struct {
+			BaseFeePerGas []string   `json:"baseFeePerGas"`
+			Reward        [][]string `json:"reward"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("fee history response malformed: %w", err)
+	}
+	if decoded.Error != nil {
+		return nil, fmt.Errorf("fee history fetch failed: %s", decoded.Error.Message)
+	}
+	if len(decoded.Result.BaseFeePerGas) == 0 {
+		return nil, fmt.Errorf("node did not report a base fee")
+	}
+
+	parseHexWei := func(s string) (*big.Int, error) {
+		v, ok := new(big.Int).SetString(strings.TrimPrefix(s, "0x"), 16)
+		if !ok {
+			return nil, fmt.Errorf("fee value %q is not valid hex", s)
+		}
+		return v, nil
+	}
+
+	// The last baseFeePerGas entry is the node's prediction for the next block.
+	baseFee, err := parseHexWei(decoded.Result.BaseFeePerGas[len(decoded.Result.BaseFeePerGas)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	priority := make(map[string]*big.Int, len(feeOraclePercentiles))
+	for i, pct := range feeOraclePercentiles {
+		sum := new(big.Int)
+		blocks := 0
+		for _, rewards := range decoded.Result.Reward {
+			if i >= len(rewards) {
+				continue
+			}
+			v, err := parseHexWei(rewards[i])
+			if err != nil {
+				return nil, err
+			}
+			sum.Add(sum, v)
+			blocks++
+		}
+		if blocks > 0 {
+			sum.Div(sum, big.NewInt(int64(blocks)))
+		}
+		priority[fmt.Sprintf("p%d", pct)] = sum
+	}
+
+	return &feeSnapshot{
+		ChainID:   chainID,
+		BaseFee:   baseFee,
+		Priority:  priority,
+		FetchedAt: moduleClock.Now(),
+	}, nil
+}
+
+// snapshot returns the network's fee snapshot, refreshing it when the TTL has
+// lapsed. A failed refresh serves the previous snapshot stale when one exists.
+func (o *feeOracle) snapshot(ctx context.Context, chainID int64) (snap *feeSnapshot, stale bool, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	cached := o.snapshots[chainID]
+	if cached != nil && moduleClock.Now().Sub(cached.FetchedAt) < feeOracleTTL {
+		return cached, false, nil
+	}
+
+	fresh, err := fetchFeeHistory(ctx, chainID)
+	if err != nil {
+		metricFeeOracleRefresh.WithLabelValues("failure").Inc()
+		if cached != nil {
+			metricFeeOracleStale.Inc()
+			return cached, true, nil
+		}
+		return nil, false, err
+	}
+	metricFeeOracleRefresh.WithLabelValues("success").Inc()
+	o.snapshots[chainID] = fresh
+	return fresh, false, nil
+}
+
+// FeeEstimateResponse is returned by rpc_get_fee_estimate.
+type FeeEstimateResponse struct {
+	ChainID         int64             `json:"chainId"`
+	BaseFeePerGas   string            `json:"baseFeePerGas"`
+	PriorityFees    map[string]string `json:"priorityFees"`
+	FetchedAt       int64             `json:"fetchedAt"`
+	AgeSeconds      int64             `json:"ageSeconds"`
+	Stale           bool              `json:"stale"`
+	SuggestedMaxFee string            `json:"suggestedMaxFee"`
+	// FiatTransferCost values a plain 21000-gas transfer at the suggested max
+	// fee in the caller's display currency, when a price feed is configured.
+	FiatTransferCost string `json:"fiatTransferCost,omitempty"`
+	FiatCurrency     string `json:"fiatCurrency,omitempty"`
+}
+
+// rpcGetFeeEstimate serves the oracle's current snapshot so clients populate
+// sign requests with sane fees instead of guessing.
+func rpcGetFeeEstimate(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	snap, stale, err := feeOracleShared.snapshot(ctx, cfg.EVMChainID)
+	if err != nil {
+		logger.Warn("Fee oracle refresh failed with no cached snapshot: %v", err)
+		return "", rpcError(errCodeRetryLater, "Fee data is unavailable; retry shortly.", codes.Unavailable)
+	}
+
+	resp := &FeeEstimateResponse{
+		ChainID:       snap.ChainID,
+		BaseFeePerGas: snap.BaseFee.String(),
+		PriorityFees:  make(map[string]string, len(snap.Priority)),
+		FetchedAt:     snap.FetchedAt.Unix(),
+		AgeSeconds:    int64(moduleClock.Now().Sub(snap.FetchedAt).Seconds()),
+		Stale:         stale,
+	}
+	for pct, v := range snap.Priority {
+		resp.PriorityFees[pct] = v.String()
+	}
+	// Suggested ceiling: double the base fee plus the median priority fee,
+	// leaving headroom for one full base fee increase.
+	suggested := new(big.Int).Mul(snap.BaseFee, big.NewInt(2))
+	if median := snap.Priority["p50"]; median != nil {
+		suggested.Add(suggested, median)
+	}
+	resp.SuggestedMaxFee = suggested.String()
+
+	prefs := userPreferences(ctx, nk, userID)
+	transferCost := new(big.Int).Mul(suggested, big.NewInt(transferNativeGas))
+	resp.FiatTransferCost, resp.FiatCurrency = fiatValueAt(ctx, snap.ChainID, transferCost.String(), moduleClock.Now().Unix(), prefs.FiatCurrency)
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// A buggy client (or a hostile one on a sponsored path) can state an absurd
+// maxFeePerGas and burn funds on fees. Sign requests are sanity checked
+// against the network's current base fee: maxFeePerGas may not exceed the
+// configured multiple of it and maxPriorityFeePerGas is capped absolutely.
+// Out-of-range values are either rejected with a descriptive error or clamped
+// down, per configuration. Without an RPC endpoint the multiplier check is
+// skipped — the absolute priority cap still applies.
+
+// fetchBaseFee returns the network's current base fee from the shared fee
+// oracle, so bursts of sign requests share one node call; see feeoracle.go.
+func fetchBaseFee(ctx context.Context) (*big.Int, error) {
+	snap, _, err := feeOracleShared.snapshot(ctx, cfg.EVMChainID)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Set(snap.BaseFee), nil
+}
+
+// validateFeeSanity checks (and in clamp mode adjusts) a request's fee fields
+// before signing.
+func validateFeeSanity(ctx context.Context, logger nkruntime.Logger, req *EVMTransactionRequest) error {
+	maxFee, err := parseWei(req.MaxFeePerGas)
+	if err != nil {
+		return err
+	}
+	maxPriority, err := parseWei(req.MaxPriorityFeePerGas)
+	if err != nil {
+		return err
+	}
+	clamped := false
+
+	if cfg.FeeMaxPriorityWei != nil && cfg.FeeMaxPriorityWei.Sign() > 0 && maxPriority.Cmp(cfg.FeeMaxPriorityWei) > 0 {
+		if !cfg.FeeClampEnabled {
+			return rpcError(errCodeBadInput,
+				fmt.Sprintf("maxPriorityFeePerGas %s exceeds the allowed maximum %s Wei.", maxPriority, cfg.FeeMaxPriorityWei),
+				codes.InvalidArgument)
+		}
+		maxPriority = new(big.Int).Set(cfg.FeeMaxPriorityWei)
+		clamped = true
+	}
+
+	if cfg.FeeMaxBaseFeeMultiplier > 0 && cfg.EVMRPCURL != "" {
+		baseFee, err := fetchBaseFee(ctx)
+		if err != nil {
+			// Fail open: fee protection must not take signing down with the
+			// RPC node. The budget checks still bound sponsored spend.
+			logger.Warn("Base fee lookup failed, skipping fee ceiling check: %v", err)
+		} else if baseFee.Sign() > 0 {
+			ceiling := new(big.Int).Mul(baseFee, big.NewInt(int64(cfg.FeeMaxBaseFeeMultiplier)))
+			if maxFee.Cmp(ceiling) > 0 {
+				if !cfg.FeeClampEnabled {
+					return rpcError(errCodeBadInput,
+						fmt.Sprintf("maxFeePerGas %s exceeds %dx the current base fee (%s Wei).", maxFee, cfg.FeeMaxBaseFeeMultiplier, baseFee),
+						codes.InvalidArgument)
+				}
+				maxFee = ceiling
+				clamped = true
+			}
+		}
+	}
+
+	if clamped {
+		if maxPriority.Cmp(maxFee) > 0 {
+			maxPriority = new(big.Int).Set(maxFee)
+		}
+		req.MaxFeePerGas = maxFee.String()
+		req.MaxPriorityFeePerGas = maxPriority.String()
+	}
+	return nil
+}
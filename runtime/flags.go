@@ -0,0 +1,225 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// LiveOps gates features per user at login: a flag set is computed from user
+// attributes (groups, account age, geography) and returned in LoginResponse
+// as well as stamped into the session token's vars, so both the client and
+// later server hooks see the same assignment. Rules live in a system storage
+// object by default; deployments running a dedicated flag service set
+// NAKAMA_FLAG_PROVIDER_URL and the module defers to it, falling back to the
+// storage rules when the service is unreachable.
+
+const (
+	flagCollection   = "feature_flags"
+	flagRulesKey     = "rules"
+	flagFetchTimeout = 3 * time.Second
+
+	// sessionFlagPrefix namespaces flag assignments inside session vars.
+	sessionFlagPrefix = "flag_"
+)
+
+// flagAttributes are the user attributes rules are evaluated against.
+type flagAttributes struct {
+	UserID    string   `json:"userId"`
+	Country   string   `json:"country,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	CreatedAt int64    `json:"createdAt,omitempty"`
+}
+
+// flagRule assigns one flag value when all of its conditions match. Rules are
+// evaluated in order; the first match per flag wins.
+type flagRule struct {
+	Flag  string `json:"flag"`
+	Value string `json:"value"`
+	// Countries limits the rule to users in these countries. Empty matches all.
+	Countries []string `json:"countries,omitempty"`
+	// Groups limits the rule to members of any of these groups. Empty matches
+	// all.
+	Groups []string `json:"groups,omitempty"`
+	// CreatedBefore/CreatedAfter bound the account creation time (Unix
+	// seconds). Zero disables the bound.
+	CreatedBefore int64 `json:"createdBefore,omitempty"`
+	CreatedAfter  int64 `json:"createdAfter,omitempty"`
+}
+
+// matches reports whether all of the rule's conditions hold for the user.
+func (r *flagRule) matches(attrs *flagAttributes) bool {
+	if len(r.Countries) > 0 {
+		found := false
+		for _, c := range r.Countries {
+			if strings.EqualFold(c, attrs.Country) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Groups) > 0 {
+		found := false
+		for _, g := range r.Groups {
+			for _, member := range attrs.Groups {
+				if g == member {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if r.CreatedBefore > 0 && attrs.CreatedAt >= r.CreatedBefore {
+		return false
+	}
+	if r.CreatedAfter > 0 && attrs.CreatedAt <= r.CreatedAfter {
+		return false
+	}
+	return true
+}
+
+// loginFlagAttributes gathers the attributes flags are evaluated against.
+// Lookups are best effort: a failed account or group read degrades to fewer
+// attributes, never to a failed login.
+func loginFlagAttributes(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, country string) *flagAttributes {
+	attrs := &flagAttributes{UserID: userID, Country: country}
+
+	if account, err := nk.AccountGetId(ctx, userID); err != nil {
+		logger.Warn("Account read failed for flag evaluation of user %v: %v", userID, err)
+	} else if account.User.GetCreateTime() != nil {
+		attrs.CreatedAt = account.User.GetCreateTime().Seconds
+	}
+
+	if groups, _, err := nk.UserGroupsList(ctx, userID, 100, nil, ""); err != nil {
+		logger.Warn("Group listing failed for flag evaluation of user %v: %v", userID, err)
+	} else {
+		for _, ug := range groups {
+			attrs.Groups = append(attrs.Groups, ug.Group.GetName())
+		}
+	}
+
+	return attrs
+}
+
+// storageFlagRules reads the rule list from the system storage object.
+func storageFlagRules(ctx context.Context, nk nkruntime.NakamaModule) ([]*flagRule, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: flagCollection,
+		Key:        flagRulesKey,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	var rules struct {
+		Rules []*flagRule `json:"rules"`
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), &rules); err != nil {
+		return nil, fmt.Errorf("feature flag rules corrupt: %w", err)
+	}
+	return rules.Rules, nil
+}
+
+// remoteFlags asks the configured flag service for the user's assignment.
+func remoteFlags(ctx context.Context, attrs *flagAttributes) (map[string]string, error) {
+	body, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, flagFetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.FlagProviderURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("flag provider returned %s", resp.Status)
+	}
+	var out struct {
+		Flags map[string]string `json:"flags"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return out.Flags, nil
+}
+
+// evaluateFlags computes the user's flag set. The remote provider wins when
+// configured and reachable; otherwise the storage rules apply.
+func evaluateFlags(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, attrs *flagAttributes) map[string]string {
+	if cfg.FlagProviderURL != "" {
+		flags, err := remoteFlags(ctx, attrs)
+		if err == nil {
+			return flags
+		}
+		logger.Warn("Flag provider unreachable, falling back to storage rules: %v", err)
+	}
+
+	rules, err := storageFlagRules(ctx, nk)
+	if err != nil {
+		logger.Warn("Feature flag rules read failed: %v", err)
+		return nil
+	}
+	var flags map[string]string
+	for _, rule := range rules {
+		if rule.Flag == "" {
+			continue
+		}
+		if _, assigned := flags[rule.Flag]; assigned {
+			continue
+		}
+		if rule.matches(attrs) {
+			if flags == nil {
+				flags = make(map[string]string)
+			}
+			flags[rule.Flag] = rule.Value
+		}
+	}
+	return flags
+}
+
+// sessionVarsForFlags renders a flag set as session token vars.
+func sessionVarsForFlags(flags map[string]string) map[string]string {
+	if len(flags) == 0 {
+		return nil
+	}
+	vars := make(map[string]string, len(flags))
+	for flag, value := range flags {
+		vars[sessionFlagPrefix+flag] = value
+	}
+	return vars
+}
@@ -0,0 +1,119 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Step-up-worthy operations shouldn't accept a week-old cached ID token: a
+// valid signature proves the token, not that the person is still at the
+// keyboard. NAKAMA_TOKEN_MAX_AGE configures a maximum token age per
+// operation class ("link=300,recover=600"); tokens older than the class
+// limit are refused with STALE_TOKEN so clients know to run a fresh
+// interactive Cognito login. Age is measured from auth_time when the pool
+// emits it, falling back to iat.
+
+// Token freshness operation classes.
+const (
+	tokenOpLogin   = "login"
+	tokenOpLink    = "link"
+	tokenOpRecover = "recover"
+	tokenOpExport  = "export"
+)
+
+// loadTokenMaxAge parses NAKAMA_TOKEN_MAX_AGE. Absent means no freshness
+// requirements.
+func loadTokenMaxAge(ctx context.Context) (map[string]time.Duration, error) {
+	raw := moduleEnv(ctx, "NAKAMA_TOKEN_MAX_AGE")
+	if raw == "" {
+		return nil, nil
+	}
+	known := map[string]bool{tokenOpLogin: true, tokenOpLink: true, tokenOpRecover: true, tokenOpExport: true}
+	out := make(map[string]time.Duration)
+	for _, part := range strings.Split(raw, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid NAKAMA_TOKEN_MAX_AGE entry: %q", part)
+		}
+		op := strings.TrimSpace(pair[0])
+		if !known[op] {
+			return nil, fmt.Errorf("invalid NAKAMA_TOKEN_MAX_AGE: unknown operation class %q", op)
+		}
+		seconds, err := strconv.ParseInt(strings.TrimSpace(pair[1]), 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid NAKAMA_TOKEN_MAX_AGE age: %q", pair[1])
+		}
+		out[op] = time.Duration(seconds) * time.Second
+	}
+	return out, nil
+}
+
+// checkTokenFreshness refuses a token older than the operation class allows.
+// Classes without a configured limit accept any unexpired token.
+func checkTokenFreshness(claims *CognitoClaims, op string) error {
+	maxAge, ok := cfg.TokenMaxAge[op]
+	if !ok || maxAge <= 0 {
+		return nil
+	}
+	issued := claims.AuthTime
+	if issued == 0 && claims.IssuedAt != nil {
+		issued = claims.IssuedAt.Unix()
+	}
+	if issued == 0 {
+		return rpcError(errCodeStaleToken, "Token carries no issue time; a fresh login is required.", codes.Unauthenticated)
+	}
+	if moduleClock.Now().Sub(time.Unix(issued, 0)) > maxAge {
+		return rpcError(errCodeStaleToken, "Token is too old for this operation; log in again.", codes.Unauthenticated)
+	}
+	return nil
+}
+
+// requireFreshUserToken verifies a step-up token presented by an already
+// authenticated session: signature and issuer, the class age limit, and that
+// the token's subject is the identity the calling account is linked to.
+func requireFreshUserToken(ctx context.Context, nk nkruntime.NakamaModule, userID, token, op string) error {
+	if _, required := cfg.TokenMaxAge[op]; !required {
+		return nil
+	}
+	if token == "" {
+		return rpcError(errCodeStaleToken, "Operation requires a fresh ID token.", codes.Unauthenticated)
+	}
+	claims, err := verifyIDToken(nil, token, cfg.LoginAudiences)
+	if err != nil {
+		return rpcError(errCodeAuthFailed, "ID token verification failed.", codes.Unauthenticated)
+	}
+	if err := checkTokenFreshness(claims, op); err != nil {
+		return err
+	}
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return rpcError(errCodeInternal, "Account lookup failed.", codes.Internal)
+	}
+	if account.GetCustomId() != customID(claims.Subject) {
+		return rpcError(errCodePermissionDenied, "Token does not belong to the calling account.", codes.PermissionDenied)
+	}
+	return nil
+}
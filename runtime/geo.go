@@ -0,0 +1,221 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Jurisdiction policy restricts regulated operations (key export, external
+// transfers) for configured country lists. A user's country comes from the
+// Cognito custom:country claim captured at login, or from a GeoIP lookup of
+// the client IP when a lookup service is configured. Admins can exempt
+// individual users.
+
+const (
+	geoCollection  = "geo"
+	geoCountryKey  = "country"
+	geoOverrideKey = "override"
+)
+
+// Restricted operation classes.
+const (
+	geoOpExport   = "export"
+	geoOpTransfer = "transfer"
+)
+
+// geoRecord stores a user's resolved country.
+type geoRecord struct {
+	Country   string `json:"country"`
+	Source    string `json:"source"` // "claim" or "ip"
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// geoIPCache memoizes lookup-service responses per IP.
+var geoIPCache = struct {
+	sync.Mutex
+	entries map[string]string
+}{entries: make(map[string]string)}
+
+// storeUserCountry records a user's country, overwriting older resolutions.
+func storeUserCountry(ctx context.Context, nk nkruntime.NakamaModule, userID, country, source string) error {
+	value, err := json.Marshal(&geoRecord{
+		Country:   strings.ToUpper(country),
+		Source:    source,
+		UpdatedAt: moduleClock.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: geoCollection,
+		Key:        geoCountryKey,
+		UserID:     userID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// lookupGeoIP resolves a country code for an IP via the configured lookup
+// service, caching results. Returns empty when unconfigured or on failure.
+func lookupGeoIP(ip string) string {
+	if cfg.GeoIPURL == "" || ip == "" {
+		return ""
+	}
+	geoIPCache.Lock()
+	country, ok := geoIPCache.entries[ip]
+	geoIPCache.Unlock()
+	if ok {
+		return country
+	}
+
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Get(cfg.GeoIPURL + "?ip=" + url.QueryEscape(ip))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	var body struct {
+		Country string `json:"country"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) != nil || body.Country == "" {
+		return ""
+	}
+
+	country = strings.ToUpper(body.Country)
+	geoIPCache.Lock()
+	geoIPCache.entries[ip] = country
+	geoIPCache.Unlock()
+	return country
+}
+
+// resolveUserCountry returns the user's best-known country code: the stored
+// claim/IP resolution first, then a live GeoIP lookup of the current client
+// IP. Empty means unknown.
+func resolveUserCountry(ctx context.Context, nk nkruntime.NakamaModule, userID string) (string, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: geoCollection,
+		Key:        geoCountryKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return "", err
+	}
+	if len(objects) > 0 {
+		record := &geoRecord{}
+		if json.Unmarshal([]byte(objects[0].Value), record) == nil && record.Country != "" {
+			return record.Country, nil
+		}
+	}
+
+	clientIP, _ := ctx.Value(nkruntime.RUNTIME_CTX_CLIENT_IP).(string)
+	if country := lookupGeoIP(clientIP); country != "" {
+		_ = storeUserCountry(ctx, nk, userID, country, "ip")
+		return country, nil
+	}
+	return "", nil
+}
+
+// hasGeoOverride reports whether an admin exempted the user from
+// jurisdiction restrictions.
+func hasGeoOverride(ctx context.Context, nk nkruntime.NakamaModule, userID string) (bool, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: geoCollection,
+		Key:        geoOverrideKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return false, err
+	}
+	if len(objects) == 0 {
+		return false, nil
+	}
+	var override struct {
+		Exempt bool `json:"exempt"`
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), &override); err != nil {
+		return false, nil
+	}
+	return override.Exempt, nil
+}
+
+// checkJurisdiction blocks a restricted operation for users resolved to a
+// restricted country, unless the user carries an admin override.
+func checkJurisdiction(ctx context.Context, nk nkruntime.NakamaModule, userID string, operation string) error {
+	if len(cfg.RestrictedCountries) == 0 || !cfg.RestrictedOperations[operation] {
+		return nil
+	}
+	country, err := resolveUserCountry(ctx, nk, userID)
+	if err != nil {
+		return rpcError(errCodeInternal, "Jurisdiction lookup failed.", codes.Internal)
+	}
+	if country == "" || !cfg.RestrictedCountries[country] {
+		return nil
+	}
+	exempt, err := hasGeoOverride(ctx, nk, userID)
+	if err != nil {
+		return rpcError(errCodeInternal, "Jurisdiction lookup failed.", codes.Internal)
+	}
+	if exempt {
+		return nil
+	}
+	return rpcError(errCodeGeoRestricted, fmt.Sprintf("Operation %q is not available in your region.", operation), codes.PermissionDenied)
+}
+
+// rpcAdminSetGeoOverride sets or clears a user's jurisdiction exemption.
+// Server-to-server only.
+func rpcAdminSetGeoOverride(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		UserID string `json:"userId"`
+		Exempt bool   `json:"exempt"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" {
+		return "", rpcError(errCodeBadInput, "Expects payload with userId and exempt fields.", codes.InvalidArgument)
+	}
+
+	value, _ := json.Marshal(map[string]bool{"exempt": req.Exempt})
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: geoCollection,
+		Key:        geoOverrideKey,
+		UserID:     req.UserID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Geo override write failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Override update failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "geo.override", req.UserID, map[string]interface{}{"exempt": req.Exempt}); err != nil {
+		logger.Error("Audit append failed for geo override: %v", err)
+	}
+	out, _ := json.Marshal(map[string]interface{}{"userId": req.UserID, "exempt": req.Exempt})
+	return string(out), nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// The login guard serializes first-login bootstrap per external ID so two
+// near-simultaneous logins for a brand-new subject cannot both run account
+// creation, metadata writes and wallet provisioning. Within one node an
+// in-memory wait map is enough; across nodes a short storage lease arbitrates.
+
+const loginLeaseCollection = "login_locks"
+
+// loginLeaseTTL bounds how long a crashed node can hold a bootstrap lease.
+const loginLeaseTTL = 10 * time.Second
+
+type loginGuard struct {
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+var guard = &loginGuard{inflight: make(map[string]chan struct{})}
+
+// acquireLocal blocks until no other goroutine on this node holds the guard
+// for the external ID, then claims it. Returns false if ctx expired while
+// waiting.
+func (g *loginGuard) acquireLocal(ctx context.Context, externalID string) bool {
+	for {
+		g.mu.Lock()
+		ch, held := g.inflight[externalID]
+		if !held {
+			g.inflight[externalID] = make(chan struct{})
+			g.mu.Unlock()
+			return true
+		}
+		g.mu.Unlock()
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (g *loginGuard) releaseLocal(externalID string) {
+	g.mu.Lock()
+	if ch, ok := g.inflight[externalID]; ok {
+		close(ch)
+		delete(g.inflight, externalID)
+	}
+	g.mu.Unlock()
+}
+
+type loginLease struct {
+	ExpiresAt int64 `json:"expiresAt"`
+}
+
+// acquireLease claims the cross-node storage lease for the external ID,
+// waiting out a live lease held elsewhere. The returned version is needed to
+// release.
+func acquireLease(ctx context.Context, nk nkruntime.NakamaModule, externalID string) (string, error) {
+	deadline := moduleClock.Now().Add(loginLeaseTTL)
+	for moduleClock.Now().Before(deadline) {
+		value, _ := json.Marshal(&loginLease{ExpiresAt: moduleClock.Now().Add(loginLeaseTTL).Unix()})
+		acks, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: loginLeaseCollection,
+			Key:        externalID,
+			Value:      string(value),
+			Version:    "*",
+		}})
+		if err == nil {
+			return acks[0].Version, nil
+		}
+
+		// Lease exists. If it has expired (holder crashed), steal it with a
+		// conditional overwrite; otherwise wait for release.
+		objects, readErr := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: loginLeaseCollection,
+			Key:        externalID,
+		}})
+		if readErr != nil {
+			return "", readErr
+		}
+		if len(objects) > 0 {
+			lease := &loginLease{}
+			if json.Unmarshal([]byte(objects[0].Value), lease) == nil && moduleClock.Now().Unix() > lease.ExpiresAt {
+				acks, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+					Collection: loginLeaseCollection,
+					Key:        externalID,
+					Value:      string(value),
+					Version:    objects[0].Version,
+				}})
+				if err == nil {
+					return acks[0].Version, nil
+				}
+			}
+		}
+
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	return "", fmt.Errorf("login lease for %s not released in time", externalID)
+}
+
+func releaseLease(ctx context.Context, nk nkruntime.NakamaModule, externalID, version string) {
+	_ = nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: loginLeaseCollection,
+		Key:        externalID,
+		Version:    version,
+	}})
+}
+
+// withLoginGuard runs fn while holding both the node-local and cross-node
+// guard for the external ID. Used around the account bootstrap path only;
+// existing accounts log in without taking the guard.
+func withLoginGuard(ctx context.Context, nk nkruntime.NakamaModule, externalID string, fn func() error) error {
+	if !guard.acquireLocal(ctx, externalID) {
+		return ctx.Err()
+	}
+	defer guard.releaseLocal(externalID)
+
+	version, err := acquireLease(ctx, nk, externalID)
+	if err != nil {
+		return err
+	}
+	defer releaseLease(ctx, nk, externalID, version)
+
+	return fn()
+}
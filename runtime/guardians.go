@@ -0,0 +1,366 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Guardians are a social-recovery style control: a user designates other
+// Nakama users and a threshold K, and designated sensitive operations then
+// need K approvals submitted through rpc_guardian_approve within the approval
+// window. The feature is opt-in per user — accounts without a guardian set
+// are unaffected.
+
+const (
+	guardianCollection      = "guardians"
+	guardianKeySet          = "set"
+	guardianApprovalTTL     = time.Hour
+	guardianApprovalMaxSize = 10
+
+	// notificationCodeGuardian tags guardian notifications for clients.
+	notificationCodeGuardian = 101
+)
+
+// Guarded operation classes.
+const (
+	guardianOpRotate = "rotate"
+)
+
+// guardianSet is a user's designated guardians and approval threshold.
+type guardianSet struct {
+	Guardians []string `json:"guardians"`
+	Threshold int      `json:"threshold"`
+	UpdatedAt int64    `json:"updatedAt"`
+}
+
+// guardianRequest is one pending approval window for a guarded operation.
+type guardianRequest struct {
+	UserID    string           `json:"userId"`
+	Operation string           `json:"operation"`
+	Threshold int              `json:"threshold"`
+	Approvals map[string]int64 `json:"approvals"`
+	CreatedAt int64            `json:"createdAt"`
+	ExpiresAt int64            `json:"expiresAt"`
+}
+
+func (r *guardianRequest) approved() bool {
+	return len(r.Approvals) >= r.Threshold
+}
+
+func (r *guardianRequest) expired() bool {
+	return moduleClock.Now().Unix() >= r.ExpiresAt
+}
+
+// guardianRequestKey keys one pending request per user and operation.
+func guardianRequestKey(userID, operation string) string {
+	return userID + ":" + operation
+}
+
+// guardianSetForUser reads a user's guardian set, nil when none configured.
+func guardianSetForUser(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*guardianSet, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: guardianCollection,
+		Key:        guardianKeySet,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	set := &guardianSet{}
+	if err := json.Unmarshal([]byte(objects[0].Value), set); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// requireGuardianApproval gates an operation on K-of-N guardian approval when
+// the user has a guardian set. The first call opens an approval window and
+// notifies the guardians; once enough approvals arrive, the next call
+// consumes the request and lets the operation proceed.
+func requireGuardianApproval(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, operation string) error {
+	set, err := guardianSetForUser(ctx, nk, userID)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		return nil
+	}
+
+	key := guardianRequestKey(userID, operation)
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: guardianCollection,
+		Key:        key,
+	}})
+	if err != nil {
+		return err
+	}
+	if len(objects) > 0 {
+		request := &guardianRequest{}
+		if err := json.Unmarshal([]byte(objects[0].Value), request); err == nil && !request.expired() {
+			if request.approved() {
+				// Single-use: consume the approval before proceeding.
+				if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+					Collection: guardianCollection,
+					Key:        key,
+					Version:    objects[0].Version,
+				}}); err != nil {
+					return err
+				}
+				return nil
+			}
+			return rpcError(errCodeApprovalRequired,
+				fmt.Sprintf("Operation needs %d guardian approvals, has %d.", request.Threshold, len(request.Approvals)),
+				codes.PermissionDenied)
+		}
+	}
+
+	now := moduleClock.Now()
+	request := &guardianRequest{
+		UserID:    userID,
+		Operation: operation,
+		Threshold: set.Threshold,
+		Approvals: make(map[string]int64),
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(guardianApprovalTTL).Unix(),
+	}
+	value, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: guardianCollection,
+		Key:        key,
+		Value:      string(value),
+	}}); err != nil {
+		return err
+	}
+
+	for _, guardian := range set.Guardians {
+		if err := nk.NotificationSend(ctx, guardian, "Guardian approval requested", map[string]interface{}{
+			"userId":    userID,
+			"operation": operation,
+			"expiresAt": request.ExpiresAt,
+		}, notificationCodeGuardian, "", true); err != nil {
+			logger.Warn("Guardian notification failed for %v: %v", guardian, err)
+		}
+	}
+	if err := appendAudit(ctx, nk, "guardian.approval_requested", userID, map[string]interface{}{
+		"operation": operation,
+		"threshold": request.Threshold,
+	}); err != nil {
+		return err
+	}
+	return rpcError(errCodeApprovalRequired,
+		fmt.Sprintf("Operation needs %d guardian approvals; guardians have been notified.", request.Threshold),
+		codes.PermissionDenied)
+}
+
+// rpcSetGuardians designates the calling user's guardians and threshold. An
+// empty guardian list removes the set.
+func rpcSetGuardians(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireSigningSession(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		Guardians []string `json:"guardians"`
+		Threshold int      `json:"threshold"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil {
+		return "", rpcError(errCodeBadInput, "Expects guardians and a threshold.", codes.InvalidArgument)
+	}
+
+	if len(req.Guardians) == 0 {
+		if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+			Collection: guardianCollection,
+			Key:        guardianKeySet,
+			UserID:     userID,
+		}}); err != nil {
+			logger.Error("Guardian set delete failed for user %v: %v", userID, err)
+			return "", rpcError(errCodeInternal, "Guardian update failed.", codes.Internal)
+		}
+		if err := appendAudit(ctx, nk, "guardian.set_removed", userID, nil); err != nil {
+			return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+		}
+		return `{"removed":true}`, nil
+	}
+
+	if len(req.Guardians) > guardianApprovalMaxSize {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("At most %d guardians are supported.", guardianApprovalMaxSize), codes.InvalidArgument)
+	}
+	if req.Threshold < 1 || req.Threshold > len(req.Guardians) {
+		return "", rpcError(errCodeBadInput, "Threshold must be between 1 and the guardian count.", codes.InvalidArgument)
+	}
+	seen := make(map[string]bool, len(req.Guardians))
+	for _, guardian := range req.Guardians {
+		if guardian == userID {
+			return "", rpcError(errCodeBadInput, "You cannot be your own guardian.", codes.InvalidArgument)
+		}
+		if seen[guardian] {
+			return "", rpcError(errCodeBadInput, "Guardian list contains duplicates.", codes.InvalidArgument)
+		}
+		seen[guardian] = true
+		if _, err := nk.AccountGetId(ctx, guardian); err != nil {
+			return "", rpcError(errCodeNotFound, fmt.Sprintf("Guardian %s not found.", guardian), codes.NotFound)
+		}
+	}
+
+	set := &guardianSet{
+		Guardians: req.Guardians,
+		Threshold: req.Threshold,
+		UpdatedAt: moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(set)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Guardian encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: guardianCollection,
+		Key:        guardianKeySet,
+		UserID:     userID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Guardian set write failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Guardian update failed.", codes.Internal)
+	}
+
+	for _, guardian := range req.Guardians {
+		if err := nk.NotificationSend(ctx, guardian, "You were designated a guardian", map[string]interface{}{
+			"userId": userID,
+		}, notificationCodeGuardian, "", true); err != nil {
+			logger.Warn("Guardian notification failed for %v: %v", guardian, err)
+		}
+	}
+	if err := appendAudit(ctx, nk, "guardian.set_updated", userID, map[string]interface{}{
+		"guardians": req.Guardians,
+		"threshold": req.Threshold,
+	}); err != nil {
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, _ := json.Marshal(set)
+	return string(out), nil
+}
+
+// rpcGuardianApprove records the calling guardian's approval for a user's
+// pending operation.
+func rpcGuardianApprove(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	guardianID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireSigningSession(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		UserID    string `json:"userId"`
+		Operation string `json:"operation"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" || req.Operation == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId and operation.", codes.InvalidArgument)
+	}
+
+	set, err := guardianSetForUser(ctx, nk, req.UserID)
+	if err != nil {
+		logger.Error("Guardian set read failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Guardian lookup failed.", codes.Internal)
+	}
+	isGuardian := false
+	if set != nil {
+		for _, g := range set.Guardians {
+			if g == guardianID {
+				isGuardian = true
+				break
+			}
+		}
+	}
+	if !isGuardian {
+		return "", rpcError(errCodePermissionDenied, "You are not a guardian for this user.", codes.PermissionDenied)
+	}
+
+	key := guardianRequestKey(req.UserID, req.Operation)
+	for attempt := 0; attempt < 5; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: guardianCollection,
+			Key:        key,
+		}})
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Approval lookup failed.", codes.Internal)
+		}
+		if len(objects) == 0 {
+			return "", rpcError(errCodeNotFound, "No pending approval request for this operation.", codes.NotFound)
+		}
+		request := &guardianRequest{}
+		if err := json.Unmarshal([]byte(objects[0].Value), request); err != nil {
+			return "", rpcError(errCodeInternal, "Approval record corrupt.", codes.Internal)
+		}
+		if request.expired() {
+			return "", rpcError(errCodeTicketExpired, "The approval window has expired.", codes.FailedPrecondition)
+		}
+		request.Approvals[guardianID] = moduleClock.Now().Unix()
+
+		value, err := json.Marshal(request)
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Approval encoding failed.", codes.Internal)
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: guardianCollection,
+			Key:        key,
+			Value:      string(value),
+			Version:    objects[0].Version,
+		}}); err != nil {
+			// Lost a CAS race with another guardian's approval, retry.
+			continue
+		}
+
+		if err := appendAudit(ctx, nk, "guardian.approved", req.UserID, map[string]interface{}{
+			"guardian":  guardianID,
+			"operation": req.Operation,
+			"approvals": len(request.Approvals),
+			"threshold": request.Threshold,
+		}); err != nil {
+			return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+		}
+		if request.approved() {
+			if err := nk.NotificationSend(ctx, req.UserID, "Guardian approval granted", map[string]interface{}{
+				"operation": req.Operation,
+			}, notificationCodeGuardian, "", true); err != nil {
+				logger.Warn("Approval notification failed for user %v: %v", req.UserID, err)
+			}
+		}
+
+		out, _ := json.Marshal(map[string]interface{}{
+			"approvals": len(request.Approvals),
+			"threshold": request.Threshold,
+			"approved":  request.approved(),
+		})
+		return string(out), nil
+	}
+	return "", rpcError(errCodeRetryLater, "Approval contention, try again.", codes.Aborted)
+}
@@ -0,0 +1,85 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/heroiclabs/nakama-common/api"
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Teams that prefer stock Nakama SDK auth over rpc_login can pass a raw
+// Cognito ID token as the custom ID. The before-hook below detects that
+// shape, verifies the token exactly like rpc_login would, and rewrites the
+// custom ID to the module's cognito:{sub} form with the interesting claims
+// injected as session vars. Plain custom IDs pass through untouched so other
+// custom auth users are unaffected.
+
+// looksLikeIDToken reports whether a custom ID is shaped like a JWT rather
+// than an opaque identifier.
+func looksLikeIDToken(id string) bool {
+	return strings.Count(id, ".") == 2 && strings.HasPrefix(id, "eyJ")
+}
+
+// beforeAuthenticateCustom rewrites Cognito ID tokens submitted as custom IDs
+// into verified cognito:{sub} identities.
+func beforeAuthenticateCustom(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, in *api.AuthenticateCustomRequest) (*api.AuthenticateCustomRequest, error) {
+	if in.GetAccount() == nil || !looksLikeIDToken(in.GetAccount().GetId()) {
+		return in, nil
+	}
+	token := in.GetAccount().GetId()
+
+	claims, err := verifyIDToken(nil, token, cfg.LoginAudiences)
+	if err != nil {
+		logger.Debug("Cognito token verification failed in authenticate hook: %v", err)
+		metricLogins.WithLabelValues("failure").Inc()
+		return nil, rpcError(errCodeAuthFailed, "ID token verification failed.", codes.Unauthenticated)
+	}
+
+	// This door runs the same pre-account gates as rpc_login — admission,
+	// ban rules, claim assertions, allowlist and live pool status — so stock
+	// SDK auth is not a way around any of them.
+	rawClaims, _ := decodeClaimsMap(token)
+	release, err := gateLogin(ctx, logger, nk, claims, rawClaims)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	in.Account.Id = customID(claims.Subject)
+	if in.Username == "" {
+		if claims.CognitoUsername != "" {
+			in.Username = claims.CognitoUsername
+		} else {
+			in.Username = claims.Subject
+		}
+	}
+	if in.Account.Vars == nil {
+		in.Account.Vars = make(map[string]string)
+	}
+	in.Account.Vars["cognito_sub"] = claims.Subject
+	if claims.Email != "" {
+		in.Account.Vars["email"] = claims.Email
+	}
+	if claims.Country != "" {
+		in.Account.Vars["country"] = claims.Country
+	}
+	metricLogins.WithLabelValues("success").Inc()
+	return in, nil
+}
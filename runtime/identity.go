@@ -0,0 +1,122 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Legacy clients authenticated with custom IDs that predate the "cognito:"
+// convention. Rather than widening the CustomId check, wallet access for such
+// accounts is granted through an explicit identity record written by an admin
+// or migration job, so every grant is deliberate and auditable.
+
+const (
+	identityCollection = "wallet_identities"
+	identityKeyGrant   = "grant"
+)
+
+// identityGrant records an explicit wallet access grant for one user.
+type identityGrant struct {
+	// ExternalID is the identity the wallet is keyed to, typically the
+	// account's legacy custom ID.
+	ExternalID string `json:"externalId"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// identityGrantForUser reads a user's explicit grant, nil when none exists.
+func identityGrantForUser(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*identityGrant, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: identityCollection,
+		Key:        identityKeyGrant,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	grant := &identityGrant{}
+	if err := json.Unmarshal([]byte(objects[0].Value), grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
+
+// rpcAdminGrantWalletAccess writes an explicit wallet identity grant for a
+// legacy account. Server-to-server only.
+func rpcAdminGrantWalletAccess(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID     string `json:"userId"`
+		ExternalID string `json:"externalId,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId and optional externalId.", codes.InvalidArgument)
+	}
+
+	account, err := nk.AccountGetId(ctx, req.UserID)
+	if err != nil {
+		return "", rpcError(errCodeNotFound, "User not found.", codes.NotFound)
+	}
+	// Default the external identity to the account's existing custom ID so
+	// migrations don't have to re-state it.
+	if req.ExternalID == "" {
+		req.ExternalID = account.GetCustomId()
+	}
+	if req.ExternalID == "" {
+		return "", rpcError(errCodeBadInput, "Account has no custom ID; externalId must be supplied.", codes.InvalidArgument)
+	}
+
+	grant := &identityGrant{
+		ExternalID: req.ExternalID,
+		CreatedAt:  moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(grant)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Grant encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: identityCollection,
+		Key:        identityKeyGrant,
+		UserID:     req.UserID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Wallet access grant write failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Grant write failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "wallet.access_granted", req.UserID, map[string]interface{}{
+		"externalId": grant.ExternalID,
+	}); err != nil {
+		logger.Error("Audit append failed for wallet access grant: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(grant)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
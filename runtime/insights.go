@@ -0,0 +1,240 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Users who opt in through their preferences get a weekly spending summary:
+// the worker aggregates the previous UTC week's signed transactions per
+// user, splits rewards from spending by transaction category, renders the
+// summary in the user's locale and delivers it as a persistent notification
+// plus a wallet event — which rides the webhook dispatcher, where the email
+// pipeline picks it up. The worker runs hourly under a lease and each user
+// is summarized at most once per week, tracked by a marker record.
+
+const (
+	insightsKey          = "insights"
+	insightsPassInterval = time.Hour
+
+	notificationCodeInsights = 104
+
+	// insightsRewardCategory is the transaction category counted as rewards
+	// rather than spending; see category.go.
+	insightsRewardCategory = "reward"
+)
+
+// insightsMarker records the last week a user was summarized for.
+type insightsMarker struct {
+	LastWeek string `json:"lastWeek"`
+	SentAt   int64  `json:"sentAt"`
+}
+
+// insightsTemplates are the localized summary strings, keyed by the primary
+// language subtag of the user's locale. The %s placeholders are the spent
+// and reward amounts in native units.
+var insightsTemplates = map[string]struct{ Title, Body string }{
+	"en": {"Your weekly wallet summary", "You spent %s this week and earned %s in rewards across %d transactions."},
+	"es": {"Tu resumen semanal de cartera", "Esta semana gastaste %s y ganaste %s en recompensas en %d transacciones."},
+	"de": {"Deine wöchentliche Wallet-Übersicht", "Du hast diese Woche %s ausgegeben und %s an Belohnungen über %d Transaktionen erhalten."},
+	"ja": {"今週のウォレットサマリー", "今週は%sを使い、%d件の取引で%sの報酬を獲得しました。"},
+}
+
+// insightsWeekOf labels the ISO week containing t, e.g. "2026-W35".
+func insightsWeekOf(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// insightsFormatEther renders a wei amount in native units with four decimal
+// places, enough precision for a summary line.
+func insightsFormatEther(wei *big.Int) string {
+	ether := new(big.Rat).SetFrac(wei, big.NewInt(1e18))
+	return strings.TrimRight(strings.TrimRight(ether.FloatString(4), "0"), ".") + " ETH"
+}
+
+// insightsSummary is one user's aggregated week.
+type insightsSummary struct {
+	Week       string `json:"week"`
+	SpentWei   string `json:"spentWei"`
+	RewardsWei string `json:"rewardsWei"`
+	TxCount    int    `json:"txCount"`
+}
+
+// aggregateUserWeek sums a user's transactions inside the window across all
+// tenant collections.
+func aggregateUserWeek(ctx context.Context, nk nkruntime.NakamaModule, userID string, from, until time.Time) (*insightsSummary, error) {
+	spent := new(big.Int)
+	rewards := new(big.Int)
+	count := 0
+	for _, collection := range tenantCollections(txCollection) {
+		cursor := ""
+		for {
+			objects, next, err := nk.StorageList(ctx, "", userID, collection, 100, cursor)
+			if err != nil {
+				return nil, err
+			}
+			for _, obj := range objects {
+				record := &TransactionRecord{}
+				if err := json.Unmarshal([]byte(obj.Value), record); err != nil {
+					continue
+				}
+				if record.CreatedAt < from.Unix() || record.CreatedAt >= until.Unix() || record.Status == txStatusFailed {
+					continue
+				}
+				value, ok := new(big.Int).SetString(record.Value, 10)
+				if !ok {
+					continue
+				}
+				count++
+				if record.Category == insightsRewardCategory {
+					rewards.Add(rewards, value)
+				} else {
+					spent.Add(spent, value)
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+	return &insightsSummary{
+		SpentWei:   spent.String(),
+		RewardsWei: rewards.String(),
+		TxCount:    count,
+	}, nil
+}
+
+// sendInsights renders and delivers one user's summary.
+func sendInsights(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID string, prefs *UserPreferences, summary *insightsSummary) {
+	lang := "en"
+	if prefs.Locale != "" {
+		if primary := strings.ToLower(strings.SplitN(prefs.Locale, "-", 2)[0]); primary != "" {
+			if _, ok := insightsTemplates[primary]; ok {
+				lang = primary
+			}
+		}
+	}
+	template := insightsTemplates[lang]
+	spent, _ := new(big.Int).SetString(summary.SpentWei, 10)
+	earned, _ := new(big.Int).SetString(summary.RewardsWei, 10)
+	var body string
+	if lang == "ja" {
+		// The Japanese template orders its placeholders differently.
+		body = fmt.Sprintf(template.Body, insightsFormatEther(spent), summary.TxCount, insightsFormatEther(earned))
+	} else {
+		body = fmt.Sprintf(template.Body, insightsFormatEther(spent), insightsFormatEther(earned), summary.TxCount)
+	}
+
+	content := map[string]interface{}{
+		"week":       summary.Week,
+		"spentWei":   summary.SpentWei,
+		"rewardsWei": summary.RewardsWei,
+		"txCount":    summary.TxCount,
+		"body":       body,
+	}
+	if err := nk.NotificationSend(ctx, userID, template.Title, content, notificationCodeInsights, "", true); err != nil {
+		logger.Warn("Insights notification failed for user %v: %v", userID, err)
+	}
+	// The wallet event mirrors to the webhook consumer, which is where the
+	// email pipeline listens.
+	if err := pushWalletEvent(ctx, nk, userID, &WalletEvent{
+		Type:    "insights.weekly",
+		Details: content,
+	}); err != nil {
+		logger.Warn("Insights event push failed for user %v: %v", userID, err)
+	}
+}
+
+// runInsightsPass summarizes the previous UTC week for every opted-in user
+// who has not been summarized for it yet.
+func runInsightsPass(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+	now := moduleClock.Now().UTC()
+	// The window is the last fully completed week, Monday to Monday.
+	weekStart := now.Truncate(24*time.Hour).AddDate(0, 0, -(int(now.Weekday())+6)%7)
+	from := weekStart.AddDate(0, 0, -7)
+	week := insightsWeekOf(from)
+
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", prefsCollection, 100, cursor)
+		if err != nil {
+			logger.Warn("Insights preference listing failed: %v", err)
+			return
+		}
+		for _, obj := range objects {
+			prefs := &UserPreferences{}
+			if err := json.Unmarshal([]byte(obj.Value), prefs); err != nil || !prefs.WeeklyInsights {
+				continue
+			}
+			userID := obj.UserId
+
+			markerObjs, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+				Collection: walletMetaCollection,
+				Key:        insightsKey,
+				UserID:     userID,
+			}})
+			if err != nil {
+				continue
+			}
+			marker := &insightsMarker{}
+			if len(markerObjs) > 0 {
+				if err := json.Unmarshal([]byte(markerObjs[0].Value), marker); err == nil && marker.LastWeek == week {
+					continue
+				}
+			}
+
+			summary, err := aggregateUserWeek(ctx, nk, userID, from, weekStart)
+			if err != nil {
+				logger.Warn("Insights aggregation failed for user %v: %v", userID, err)
+				continue
+			}
+			summary.Week = week
+			// Only active users hear from us; an empty week sends nothing
+			// but still advances the marker.
+			if summary.TxCount > 0 {
+				sendInsights(ctx, logger, nk, userID, prefs, summary)
+			}
+
+			marker.LastWeek = week
+			marker.SentAt = moduleClock.Now().Unix()
+			value, err := json.Marshal(marker)
+			if err != nil {
+				continue
+			}
+			if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+				Collection: walletMetaCollection,
+				Key:        insightsKey,
+				UserID:     userID,
+				Value:      string(value),
+			}}); err != nil {
+				logger.Warn("Insights marker write failed for user %v: %v", userID, err)
+			}
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Module owns the mutable state this package historically scattered across
+// globals: configuration, the JWKS managers, the signer backends, the clock
+// and ID source, the admission controller and the dead-letter retry table.
+// newModule builds a fully wired instance without touching package state;
+// install publishes it as the active module in one step.
+//
+// The package-level variables (cfg, jwksManager, kmsSigner and friends)
+// remain as the legacy call surface. Each is an alias of the active
+// instance's field, and install swaps them all under one lock, so a second
+// InitModule — a plugin reload, or the auth and wallet entrypoints racing at
+// boot — replaces the state coherently instead of mutating maps the previous
+// instance still holds. Tests construct a Module with a crafted Config and
+// install it, instead of poking individual globals. Handlers still read the
+// aliases; they migrate to explicit *Module receivers as files are touched.
+type Module struct {
+	cfg        *Config
+	clock      Clock
+	ids        IDGenerator
+	jwks       *JWKSManager
+	tenantKeys *jwksCache
+	admission  *admissionController
+	dlqRetry   map[string]dlqRetryHandler
+	backends   map[string]KMSSigner
+	signer     KMSSigner
+}
+
+// moduleMu serializes install against concurrent InitModule calls.
+var moduleMu sync.Mutex
+
+// newModule loads configuration and builds the state set for the given
+// surfaces. Nothing here reads or writes package state, so concurrent
+// constructions are independent.
+func newModule(ctx context.Context, logger nkruntime.Logger, surface moduleSurface) (*Module, nkruntime.Logger, error) {
+	c, err := loadConfig(ctx)
+	if err != nil {
+		return nil, logger, err
+	}
+	// Redaction applies to the module logger and, during registration, to
+	// every RPC handler's per-call logger. No-op unless NAKAMA_LOG_REDACT_PII
+	// is set.
+	logger = redactLogger(c, logger)
+
+	m := &Module{
+		cfg:       c,
+		clock:     realClock{},
+		ids:       uuidGenerator{},
+		admission: &admissionController{},
+		dlqRetry:  make(map[string]dlqRetryHandler),
+		backends:  make(map[string]KMSSigner),
+	}
+
+	// Both surfaces verify ID tokens — the wallet half for fresh-token
+	// checks on sensitive flows — so the key sets initialize for every
+	// entrypoint. Tenant key managers are created lazily on first use and
+	// bounded by the configured issuer cap; see jwksCache in jwks.go.
+	m.jwks = newJWKSManager(resolveJWKSURL(c, logger), c.JWKSCacheTTL, c.JWKSMinTTL, c.JWKSMaxTTL)
+	m.tenantKeys = &jwksCache{entries: make(map[string]*jwksCacheEntry)}
+	m.tenantKeys.setMax(c.JWKSMaxIssuers)
+
+	if surface&surfaceAuth != 0 {
+		m.admission.setLimits(c.LoginLimits)
+		m.dlqRetry[dlqClassMetadataSync] = retryMetadataSync
+	}
+
+	if surface&surfaceWallet != 0 && c.WalletReadEnabled() {
+		master := c.WalletMasterKey
+		if master == "" {
+			// Development fallback so local servers boot without configuration.
+			master = "nakama-dev-wallet-master"
+			logger.Warn("NAKAMA_WALLET_MASTER_KEY not set, using insecure development master key")
+		}
+		mock, err := NewMockKMSSigner([]byte(master))
+		if err != nil {
+			return nil, logger, err
+		}
+		// All signer traffic goes through the dispatcher for public key
+		// caching and call budgeting. Backends are resolvable by ID so
+		// wallets keep signing on the backend they were provisioned on.
+		m.backends[kmsBackendMock] = newKMSDispatcher(mock)
+		if c.KMSEndpointURL != "" {
+			aws, err := NewAWSKMSSigner(c.KMSEndpointURL, c.KMSKeyARNTemplate)
+			if err != nil {
+				return nil, logger, err
+			}
+			m.backends[kmsBackendAWS] = newKMSDispatcher(aws)
+		}
+
+		backendID := c.KMSDefaultBackend
+		if backendID == "" {
+			backendID = kmsBackendMock
+		}
+		signer, ok := m.backends[backendID]
+		if !ok {
+			return nil, logger, fmt.Errorf("kms: unknown signer backend %q", backendID)
+		}
+		m.signer = signer
+		m.dlqRetry[dlqClassWebhook] = retryWebhookDelivery
+	}
+
+	return m, logger, nil
+}
+
+// install publishes the instance as the active module. The aliases change as
+// one unit, so callers racing a re-init see either the old state set or the
+// new one, never a mixture.
+func (m *Module) install() {
+	moduleMu.Lock()
+	defer moduleMu.Unlock()
+	cfg = m.cfg
+	moduleClock = m.clock
+	moduleIDs = m.ids
+	jwksManager = m.jwks
+	tenantJWKS = m.tenantKeys
+	loginAdmission = m.admission
+	dlqRetryHandlers = m.dlqRetry
+	kmsBackends = m.backends
+	kmsSigner = m.signer
+}
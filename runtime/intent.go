@@ -0,0 +1,178 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Intents let the authoritative game server pre-authorize a spend without
+// holding the transaction itself: the server registers user, action and a
+// value ceiling with an expiry, hands the intent ID to the client, and the
+// client's rpc_sign_and_send must reference it. The signer refuses anything
+// outside an active intent, so a compromised client can at worst execute the
+// exact spend the game already approved. Unlike the HMAC authorization
+// artifact (txauth.go), which proves provenance of a server-built request,
+// an intent bounds a client-built one.
+
+const intentCollection = "tx_intents"
+
+// intentDefaultTTL applies when the creating server sets no expiry.
+const intentDefaultTTL = 5 * time.Minute
+
+// TxIntent is one pre-authorized spend.
+type TxIntent struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	// Action is the game action the intent authorizes; the transaction's
+	// context feature tag must match.
+	Action string `json:"action"`
+	// To optionally pins the destination address.
+	To string `json:"to,omitempty"`
+	// MaxValueWei caps the transaction value.
+	MaxValueWei string `json:"maxValueWei"`
+	ExpiresAt   int64  `json:"expiresAt"`
+	CreatedAt   int64  `json:"createdAt"`
+}
+
+// rpcAdminCreateIntent registers a pre-authorized intent for a user.
+// Server-to-server only.
+func rpcAdminCreateIntent(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID      string `json:"userId"`
+		Action      string `json:"action"`
+		To          string `json:"to,omitempty"`
+		MaxValueWei string `json:"maxValueWei"`
+		// TTLSeconds bounds the intent's life; defaults to five minutes.
+		TTLSeconds int64 `json:"ttlSeconds,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" || req.Action == "" {
+		return "", rpcError(errCodeBadInput, "Expects userId, action and maxValueWei.", codes.InvalidArgument)
+	}
+	if _, err := parseWei(req.MaxValueWei); err != nil {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Invalid maxValueWei: %v.", err), codes.InvalidArgument)
+	}
+	if req.To != "" {
+		if _, err := parseHexAddress(req.To); err != nil {
+			return "", rpcError(errCodeBadInput, fmt.Sprintf("Invalid to address: %v.", err), codes.InvalidArgument)
+		}
+	}
+	ttl := intentDefaultTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Intent ID generation failed.", codes.Internal)
+	}
+	intent := &TxIntent{
+		ID:          id,
+		UserID:      req.UserID,
+		Action:      req.Action,
+		To:          req.To,
+		MaxValueWei: req.MaxValueWei,
+		ExpiresAt:   moduleClock.Now().Add(ttl).Unix(),
+		CreatedAt:   moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(intent)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Intent encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: intentCollection,
+		Key:        intent.ID,
+		UserID:     req.UserID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Intent write failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Intent creation failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "intent.created", req.UserID, map[string]interface{}{
+		"intentId":    intent.ID,
+		"action":      intent.Action,
+		"maxValueWei": intent.MaxValueWei,
+		"expiresAt":   intent.ExpiresAt,
+	}); err != nil {
+		logger.Error("Audit append failed for intent %v: %v", intent.ID, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(intent)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// consumeIntent validates a referenced intent against the transaction and
+// redeems it. The versioned delete makes each intent single-use even under
+// concurrent submissions.
+func consumeIntent(ctx context.Context, nk nkruntime.NakamaModule, userID, intentID string, req *EVMTransactionRequest, value *big.Int) error {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: intentCollection,
+		Key:        intentID,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return fmt.Errorf("intent lookup failed: %w", err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("intent %q is unknown, used or belongs to another user", intentID)
+	}
+	intent := &TxIntent{}
+	if err := json.Unmarshal([]byte(objects[0].Value), intent); err != nil {
+		return fmt.Errorf("intent record corrupt: %w", err)
+	}
+	if moduleClock.Now().Unix() > intent.ExpiresAt {
+		return fmt.Errorf("intent %q has expired", intentID)
+	}
+	if req.Context["feature"] != intent.Action {
+		return fmt.Errorf("transaction action %q does not match intent action %q", req.Context["feature"], intent.Action)
+	}
+	if intent.To != "" && !strings.EqualFold(intent.To, req.To) {
+		return fmt.Errorf("transaction destination does not match the intent")
+	}
+	maxValue, err := parseWei(intent.MaxValueWei)
+	if err != nil {
+		return fmt.Errorf("intent record corrupt: %w", err)
+	}
+	if value.Cmp(maxValue) > 0 {
+		return fmt.Errorf("transaction value exceeds the intent ceiling")
+	}
+	if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: intentCollection,
+		Key:        intentID,
+		UserID:     userID,
+		Version:    objects[0].Version,
+	}}); err != nil {
+		return fmt.Errorf("intent %q was consumed concurrently", intentID)
+	}
+	return nil
+}
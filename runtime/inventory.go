@@ -0,0 +1,281 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// The custody disaster-recovery runbook requires a periodic key ceremony: an
+// encrypted inventory of every wallet's key binding — key ARN or derivation
+// index, never private material — is exported to offline storage, and on the
+// next ceremony the previous inventory is validated against live records to
+// prove the stored copy still describes reality. The inventory is sealed
+// with AES-256-GCM under a key derived from a ceremony passphrase that never
+// leaves the operators' custody.
+
+// inventoryVersion stamps exported inventories so future format changes can
+// still validate old ceremonies.
+const inventoryVersion = 1
+
+// inventoryMinPassphrase is the minimum ceremony passphrase length.
+const inventoryMinPassphrase = 16
+
+// inventoryEntry is one wallet's key binding.
+type inventoryEntry struct {
+	UserID          string `json:"userId"`
+	Label           string `json:"label,omitempty"`
+	Address         string `json:"address"`
+	Backend         string `json:"backend,omitempty"`
+	KeyARN          string `json:"keyArn,omitempty"`
+	DerivationIndex uint32 `json:"derivationIndex"`
+	CreatedAt       int64  `json:"createdAt"`
+}
+
+// keyInventory is the exported document, encrypted as a whole.
+type keyInventory struct {
+	Version    int               `json:"version"`
+	ExportedAt int64             `json:"exportedAt"`
+	Node       string            `json:"node"`
+	Wallets    []*inventoryEntry `json:"wallets"`
+}
+
+// collectKeyInventory walks all wallet records and extracts their key
+// bindings.
+func collectKeyInventory(ctx context.Context, nk nkruntime.NakamaModule) (*keyInventory, error) {
+	inventory := &keyInventory{
+		Version:    inventoryVersion,
+		ExportedAt: moduleClock.Now().Unix(),
+		Node:       nodeID,
+	}
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", tenantCollection(ctx, walletCollection), 100, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("wallet listing failed: %w", err)
+		}
+		for _, obj := range objects {
+			wallet := &Wallet{}
+			if err := json.Unmarshal([]byte(obj.Value), wallet); err != nil {
+				return nil, fmt.Errorf("wallet record %v/%v is malformed: %w", obj.UserId, obj.Key, err)
+			}
+			inventory.Wallets = append(inventory.Wallets, &inventoryEntry{
+				UserID:          obj.UserId,
+				Label:           wallet.Label,
+				Address:         wallet.Address,
+				Backend:         wallet.Backend,
+				KeyARN:          wallet.KeyARN,
+				DerivationIndex: wallet.DerivationIndex,
+				CreatedAt:       wallet.CreatedAt,
+			})
+		}
+		if next == "" {
+			return inventory, nil
+		}
+		cursor = next
+	}
+}
+
+// inventorySeal encrypts a serialized inventory under the ceremony
+// passphrase: AES-256-GCM keyed by the passphrase's SHA-256, with the nonce
+// prefixed to the ciphertext.
+func inventorySeal(passphrase string, plaintext []byte) (string, error) {
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// inventoryOpen reverses inventorySeal.
+func inventoryOpen(passphrase string, encoded string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("inventory ciphertext is truncated")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// inventoryKeyFor identifies one wallet across export and validation.
+func inventoryKeyFor(userID, label string) string {
+	return userID + "/" + walletKey(label)
+}
+
+// rpcAdminExportKeyInventory exports the encrypted key inventory for offline
+// storage. Restricted to server-to-server callers with the treasury scope.
+func rpcAdminExportKeyInventory(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	req := struct {
+		Passphrase string `json:"passphrase"`
+	}{}
+	if err := unmarshalPayload(payload, &req); err != nil {
+		return "", rpcError(errCodeBadInput, "Request payload is not valid JSON.", codes.InvalidArgument)
+	}
+	if len(req.Passphrase) < inventoryMinPassphrase {
+		return "", rpcError(errCodeBadInput,
+			fmt.Sprintf("Ceremony passphrase must be at least %d characters.", inventoryMinPassphrase), codes.InvalidArgument)
+	}
+
+	inventory, err := collectKeyInventory(ctx, nk)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := json.Marshal(inventory)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := inventorySeal(req.Passphrase, plaintext)
+	if err != nil {
+		return "", err
+	}
+
+	// The audit trail records that a ceremony happened, never its contents.
+	if err := appendAudit(ctx, nk, "inventory.exported", "", map[string]interface{}{
+		"wallets": len(inventory.Wallets),
+		"version": inventoryVersion,
+	}); err != nil {
+		return "", rpcError(errCodeInternal, "Audit write failed; export aborted.", codes.Internal)
+	}
+
+	resp, err := json.Marshal(map[string]interface{}{
+		"version":    inventoryVersion,
+		"exportedAt": inventory.ExportedAt,
+		"wallets":    len(inventory.Wallets),
+		"inventory":  sealed,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
+
+// rpcAdminValidateKeyInventory decrypts a previously exported inventory and
+// compares it against live wallet records, reporting drift in either
+// direction. Validation never mutates records; the runbook treats any
+// mismatch as an incident.
+func rpcAdminValidateKeyInventory(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	req := struct {
+		Passphrase string `json:"passphrase"`
+		Inventory  string `json:"inventory"`
+	}{}
+	if err := unmarshalPayload(payload, &req); err != nil {
+		return "", rpcError(errCodeBadInput, "Request payload is not valid JSON.", codes.InvalidArgument)
+	}
+	if req.Inventory == "" {
+		return "", rpcError(errCodeBadInput, "inventory is required.", codes.InvalidArgument)
+	}
+	plaintext, err := inventoryOpen(req.Passphrase, req.Inventory)
+	if err != nil {
+		return "", rpcError(errCodeBadInput, "Inventory could not be decrypted; check the passphrase and ciphertext.", codes.InvalidArgument)
+	}
+	stored := &keyInventory{}
+	if err := json.Unmarshal(plaintext, stored); err != nil {
+		return "", rpcError(errCodeBadInput, "Decrypted inventory is malformed.", codes.InvalidArgument)
+	}
+	if stored.Version != inventoryVersion {
+		return "", rpcError(errCodeBadInput,
+			fmt.Sprintf("Inventory version %d is not supported.", stored.Version), codes.InvalidArgument)
+	}
+
+	live, err := collectKeyInventory(ctx, nk)
+	if err != nil {
+		return "", err
+	}
+	liveByKey := make(map[string]*inventoryEntry, len(live.Wallets))
+	for _, entry := range live.Wallets {
+		liveByKey[inventoryKeyFor(entry.UserID, entry.Label)] = entry
+	}
+
+	matched := 0
+	mismatched := []string{}
+	missing := []string{}
+	for _, entry := range stored.Wallets {
+		key := inventoryKeyFor(entry.UserID, entry.Label)
+		current, ok := liveByKey[key]
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		delete(liveByKey, key)
+		if current.Address != entry.Address || current.KeyARN != entry.KeyARN ||
+			current.DerivationIndex != entry.DerivationIndex || current.Backend != entry.Backend {
+			mismatched = append(mismatched, key)
+			continue
+		}
+		matched++
+	}
+	// Wallets provisioned since the export are expected between ceremonies
+	// and reported separately from drift.
+	added := make([]string, 0, len(liveByKey))
+	for key := range liveByKey {
+		added = append(added, key)
+	}
+
+	if err := appendAudit(ctx, nk, "inventory.validated", "", map[string]interface{}{
+		"exportedAt": stored.ExportedAt,
+		"matched":    matched,
+		"mismatched": len(mismatched),
+		"missing":    len(missing),
+		"added":      len(added),
+	}); err != nil {
+		return "", rpcError(errCodeInternal, "Audit write failed; validation aborted.", codes.Internal)
+	}
+
+	resp, err := json.Marshal(map[string]interface{}{
+		"exportedAt": stored.ExportedAt,
+		"checked":    len(stored.Wallets),
+		"matched":    matched,
+		"mismatched": mismatched,
+		"missing":    missing,
+		"added":      added,
+		"clean":      len(mismatched) == 0 && len(missing) == 0,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
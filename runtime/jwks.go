@@ -0,0 +1,339 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JWKSManager fetches and caches the signing keys published by the configured
+// issuer. Keys are refreshed when the document lifetime lapses or when a
+// token presents an unknown key ID, which covers routine Cognito key
+// rotation. The lifetime follows the endpoint's Cache-Control or Expires
+// headers when present, clamped to the configured bounds, so an IdP that
+// shortens its cache window ahead of a rotation is honored without operators
+// retuning NAKAMA_JWKS_CACHE_TTL; endpoints without caching headers fall
+// back to the configured TTL.
+type JWKSManager struct {
+	url        string
+	defaultTTL time.Duration
+	minTTL     time.Duration
+	maxTTL     time.Duration
+
+	client *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// ttl is the current effective document lifetime: header-derived after a
+	// fetch that carried caching headers, the configured default otherwise.
+	ttl time.Duration
+}
+
+var jwksManager *JWKSManager
+
+func newJWKSManager(url string, ttl, minTTL, maxTTL time.Duration) *JWKSManager {
+	return &JWKSManager{
+		url:        url,
+		defaultTTL: ttl,
+		minTTL:     minTTL,
+		maxTTL:     maxTTL,
+		ttl:        ttl,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		keys:       make(map[string]*rsa.PublicKey),
+	}
+}
+
+// Key returns the RSA public key for the given key ID, refreshing the cached
+// JWKS document if the key is unknown or the cache is stale.
+func (m *JWKSManager) Key(kid string) (*rsa.PublicKey, error) {
+	m.mu.RLock()
+	key, ok := m.keys[kid]
+	fresh := moduleClock.Now().Sub(m.fetchedAt) < m.ttl
+	m.mu.RUnlock()
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := m.refresh(); err != nil {
+		// A stale key beats a hard failure if the endpoint is briefly down.
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	m.mu.RLock()
+	key, ok = m.keys[kid]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("jwks: unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+type jwksDocument struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+func (m *JWKSManager) refresh() error {
+	resp, err := m.client.Get(m.url)
+	if err != nil {
+		return fmt.Errorf("jwks: fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("jwks: fetch returned status %d", resp.StatusCode)
+	}
+
+	var doc jwksDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return fmt.Errorf("jwks: decode failed: %w", err)
+	}
+
+	ttl := m.defaultTTL
+	if lifetime, ok := jwksDocumentLifetime(resp.Header, moduleClock.Now()); ok {
+		if lifetime < m.minTTL {
+			lifetime = m.minTTL
+		}
+		if lifetime > m.maxTTL {
+			lifetime = m.maxTTL
+		}
+		ttl = lifetime
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("jwks: document contained no usable RSA keys")
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.fetchedAt = moduleClock.Now()
+	m.ttl = ttl
+	m.mu.Unlock()
+	return nil
+}
+
+// jwksDocumentLifetime derives a cache lifetime from the response's
+// Cache-Control or Expires headers. The boolean is false when neither header
+// says anything usable, in which case the configured TTL applies.
+// Cache-Control wins over Expires, and within it s-maxage wins over max-age,
+// per RFC 9111; no-store and no-cache map to a zero lifetime, which the
+// caller clamps up to the configured minimum.
+func jwksDocumentLifetime(header http.Header, now time.Time) (time.Duration, bool) {
+	if control := header.Get("Cache-Control"); control != "" {
+		maxAge, sMaxAge := -1, -1
+		noCache := false
+		for _, directive := range strings.Split(control, ",") {
+			directive = strings.ToLower(strings.TrimSpace(directive))
+			switch {
+			case directive == "no-store" || directive == "no-cache":
+				noCache = true
+			case strings.HasPrefix(directive, "s-maxage="):
+				if v, err := strconv.Atoi(directive[len("s-maxage="):]); err == nil && v >= 0 {
+					sMaxAge = v
+				}
+			case strings.HasPrefix(directive, "max-age="):
+				if v, err := strconv.Atoi(directive[len("max-age="):]); err == nil && v >= 0 {
+					maxAge = v
+				}
+			}
+		}
+		switch {
+		case sMaxAge >= 0:
+			return time.Duration(sMaxAge) * time.Second, true
+		case maxAge >= 0:
+			return time.Duration(maxAge) * time.Second, true
+		case noCache:
+			return 0, true
+		}
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			// An unparseable Expires means "already expired" per RFC 9111.
+			return 0, true
+		}
+		lifetime := at.Sub(now)
+		if lifetime < 0 {
+			lifetime = 0
+		}
+		return lifetime, true
+	}
+	return 0, false
+}
+
+// keyCount reports how many keys the manager currently caches.
+func (m *JWKSManager) keyCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.keys)
+}
+
+// lastFetched reports when the manager last loaded its document, zero if
+// never. Used by the prefetch scheduler; see jwksprefetch.go.
+func (m *JWKSManager) lastFetched() time.Time {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.fetchedAt
+}
+
+// effectiveTTL reports the current document lifetime, header-derived or
+// configured. Used by the prefetch scheduler; see jwksprefetch.go.
+func (m *JWKSManager) effectiveTTL() time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ttl
+}
+
+var (
+	metricJWKSIssuers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nakama_module_jwks_cached_issuers",
+		Help: "Tenant issuers with a cached key manager.",
+	})
+	metricJWKSKeys = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nakama_module_jwks_cached_keys",
+		Help: "Total signing keys cached across tenant issuers.",
+	})
+	metricJWKSEvictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nakama_module_jwks_evictions_total",
+		Help: "Tenant key managers evicted from the JWKS cache.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(metricJWKSIssuers, metricJWKSKeys, metricJWKSEvictions)
+}
+
+// jwksCache bounds the per-tenant key managers. Managers are created lazily
+// on the first login for their tenant and evicted least-recently-used past
+// the configured cap, so a cluster serving thousands of configured tenants
+// only holds key material for the ones actually logging in. Each cached
+// manager keeps its own refresh schedule: keys re-fetch when that issuer's
+// TTL lapses or a token presents an unknown kid, never in lockstep.
+type jwksCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*jwksCacheEntry
+}
+
+type jwksCacheEntry struct {
+	manager  *JWKSManager
+	lastUsed time.Time
+}
+
+// setMax applies the configured issuer cap. Zero means unbounded.
+func (c *jwksCache) setMax(max int) {
+	c.mu.Lock()
+	c.max = max
+	c.mu.Unlock()
+}
+
+// manager returns the key manager for an issuer, creating it on first use
+// and evicting the least-recently-used issuer when the cache is full.
+func (c *jwksCache) manager(id, url string, ttl, minTTL, maxTTL time.Duration) *JWKSManager {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[id]; ok {
+		entry.lastUsed = moduleClock.Now()
+		c.updateMetricsLocked()
+		return entry.manager
+	}
+
+	if c.max > 0 && len(c.entries) >= c.max {
+		oldestID := ""
+		var oldest time.Time
+		for entryID, entry := range c.entries {
+			if oldestID == "" || entry.lastUsed.Before(oldest) {
+				oldestID, oldest = entryID, entry.lastUsed
+			}
+		}
+		delete(c.entries, oldestID)
+		metricJWKSEvictions.Inc()
+	}
+
+	entry := &jwksCacheEntry{
+		manager:  newJWKSManager(url, ttl, minTTL, maxTTL),
+		lastUsed: moduleClock.Now(),
+	}
+	c.entries[id] = entry
+	c.updateMetricsLocked()
+	return entry.manager
+}
+
+// snapshot returns the currently cached managers by issuer ID, without
+// touching recency. Used by the prefetch scheduler; see jwksprefetch.go.
+func (c *jwksCache) snapshot() map[string]*JWKSManager {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]*JWKSManager, len(c.entries))
+	for id, entry := range c.entries {
+		out[id] = entry.manager
+	}
+	return out
+}
+
+// hasRoom reports whether another issuer fits without evicting one, so
+// background warming never displaces an issuer with live logins.
+func (c *jwksCache) hasRoom() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max == 0 || len(c.entries) < c.max
+}
+
+func (c *jwksCache) updateMetricsLocked() {
+	metricJWKSIssuers.Set(float64(len(c.entries)))
+	keys := 0
+	for _, entry := range c.entries {
+		keys += entry.manager.keyCount()
+	}
+	metricJWKSKeys.Set(float64(keys))
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWKSDocumentLifetime(t *testing.T) {
+	now := time.Unix(1700000000, 0).UTC()
+	for _, tc := range []struct {
+		name     string
+		headers  map[string]string
+		lifetime time.Duration
+		ok       bool
+	}{
+		{"no headers", nil, 0, false},
+		{"max-age", map[string]string{"Cache-Control": "public, max-age=600"}, 600 * time.Second, true},
+		{"s-maxage wins over max-age", map[string]string{"Cache-Control": "s-maxage=300, max-age=600"}, 300 * time.Second, true},
+		{"no-cache", map[string]string{"Cache-Control": "no-cache"}, 0, true},
+		{"no-store", map[string]string{"Cache-Control": "no-store"}, 0, true},
+		{"unknown directives only", map[string]string{"Cache-Control": "private"}, 0, false},
+		{"expires in the future", map[string]string{"Expires": now.Add(15 * time.Minute).Format(http.TimeFormat)}, 15 * time.Minute, true},
+		{"expires in the past", map[string]string{"Expires": now.Add(-time.Minute).Format(http.TimeFormat)}, 0, true},
+		{"expires unparseable", map[string]string{"Expires": "not a date"}, 0, true},
+		{"cache-control wins over expires", map[string]string{
+			"Cache-Control": "max-age=60",
+			"Expires":       now.Add(15 * time.Minute).Format(http.TimeFormat),
+		}, time.Minute, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tc.headers {
+				header.Set(k, v)
+			}
+			lifetime, ok := jwksDocumentLifetime(header, now)
+			if ok != tc.ok || lifetime != tc.lifetime {
+				t.Fatalf("got (%v, %v), want (%v, %v)", lifetime, ok, tc.lifetime, tc.ok)
+			}
+		})
+	}
+}
+
+func TestJWKSKeyExpiresByClock(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := fmt.Sprintf(`{"keys":[{"kty":"RSA","kid":"k1","use":"sig","n":%q,"e":%q}]}`,
+		base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()))
+
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Cache-Control", "max-age=120")
+		fmt.Fprint(w, doc)
+	}))
+	defer server.Close()
+
+	clock := withFakeClock(t, time.Unix(1700000000, 0))
+	manager := newJWKSManager(server.URL, time.Hour, time.Minute, 24*time.Hour)
+
+	if _, err := manager.Key("k1"); err != nil {
+		t.Fatalf("initial Key failed: %v", err)
+	}
+	if fetches != 1 {
+		t.Fatalf("expected 1 fetch, got %d", fetches)
+	}
+	if got := manager.effectiveTTL(); got != 120*time.Second {
+		t.Fatalf("effective TTL = %v, want 120s", got)
+	}
+
+	// Within the header-derived lifetime the cache answers.
+	clock.Advance(time.Minute)
+	if _, err := manager.Key("k1"); err != nil {
+		t.Fatalf("cached Key failed: %v", err)
+	}
+	if fetches != 1 {
+		t.Fatalf("expected cached answer, got %d fetches", fetches)
+	}
+
+	// Past it the document is refreshed.
+	clock.Advance(2 * time.Minute)
+	if _, err := manager.Key("k1"); err != nil {
+		t.Fatalf("refreshed Key failed: %v", err)
+	}
+	if fetches != 2 {
+		t.Fatalf("expected refresh after TTL, got %d fetches", fetches)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// With hundreds of configured pools, lazy JWKS refresh concentrates fetches
+// at TTL boundaries: every issuer whose keys lapsed since the last login
+// burst refreshes at once, hammering the Cognito endpoints. The prefetcher
+// refreshes keys in the background instead, on a per-issuer schedule
+// staggered by a deterministic jitter, under a concurrency cap, in two
+// tiers: issuers with a live key manager (recent logins) refresh every TTL,
+// while configured-but-cold tenants warm at a slower cadence and only while
+// the issuer cache has spare room, so warming never evicts an active
+// issuer. Key caches are per process, so every node runs its own prefetcher.
+
+const (
+	// jwksPrefetchTick is how often the scheduler looks for due issuers.
+	jwksPrefetchTick = time.Minute
+	// jwksPrefetchColdFactor slows the cold tier relative to the cache TTL.
+	jwksPrefetchColdFactor = 4
+	// jwksPrefetchJitterFrac staggers each issuer's refresh ahead of its
+	// deadline by up to this fraction of the interval.
+	jwksPrefetchJitterFrac = 0.2
+	// jwksPrefetchBootSpread spreads first fetches after a process start so
+	// a rolling deploy doesn't storm the issuers either.
+	jwksPrefetchBootSpread = 5 * time.Minute
+)
+
+// jwksJitterFrac maps an issuer ID to a stable fraction in [0, 1), so each
+// issuer keeps the same slot in the schedule across ticks and restarts.
+func jwksJitterFrac(id string) float64 {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return float64(h.Sum32()%1000) / 1000
+}
+
+// jwksPrefetchDue reports whether an issuer should refresh now: its document
+// age has reached the interval minus the issuer's jitter slot, so refreshes
+// land early and spread out instead of expiring together.
+func jwksPrefetchDue(id string, fetchedAt time.Time, interval time.Duration, bootAt time.Time) bool {
+	now := moduleClock.Now()
+	if fetchedAt.IsZero() {
+		// Never fetched: spread initial warms across the boot window.
+		return now.Sub(bootAt) >= time.Duration(jwksJitterFrac(id)*float64(jwksPrefetchBootSpread))
+	}
+	early := time.Duration(jwksJitterFrac(id) * jwksPrefetchJitterFrac * float64(interval))
+	return now.Sub(fetchedAt) >= interval-early
+}
+
+// runJWKSPrefetcher refreshes issuer keys on the staggered schedule until
+// the module context ends.
+func runJWKSPrefetcher(ctx context.Context, logger nkruntime.Logger) {
+	bootAt := moduleClock.Now()
+	ticker := time.NewTicker(jwksPrefetchTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runJWKSPrefetchPass(logger, bootAt)
+		}
+	}
+}
+
+// runJWKSPrefetchPass refreshes every due issuer, bounded by the configured
+// concurrency.
+func runJWKSPrefetchPass(logger nkruntime.Logger, bootAt time.Time) {
+	due := make(map[string]*JWKSManager)
+
+	// Active tier: the default issuer plus every tenant with live logins.
+	// Each issuer refreshes at its own effective lifetime, which tracks the
+	// endpoint's caching headers; see jwksDocumentLifetime in jwks.go.
+	if jwksManager != nil && jwksPrefetchDue("", jwksManager.lastFetched(), jwksManager.effectiveTTL(), bootAt) {
+		due[""] = jwksManager
+	}
+	cached := tenantJWKS.snapshot()
+	for id, manager := range cached {
+		if jwksPrefetchDue(id, manager.lastFetched(), manager.effectiveTTL(), bootAt) {
+			due[id] = manager
+		}
+	}
+
+	// Cold tier: configured tenants nobody has logged into yet, warmed at a
+	// slower cadence while the cache has room for them.
+	for id, tenant := range cfg.Tenants {
+		if _, ok := cached[id]; ok {
+			continue
+		}
+		if !tenantJWKS.hasRoom() {
+			break
+		}
+		if jwksPrefetchDue(id, time.Time{}, cfg.JWKSCacheTTL*jwksPrefetchColdFactor, bootAt) {
+			due[id] = tenantKeys(tenant)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	sem := make(chan struct{}, cfg.JWKSPrefetchConcurrency)
+	var wg sync.WaitGroup
+	for id, manager := range due {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string, manager *JWKSManager) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := manager.refresh(); err != nil {
+				// The login path retries on unknown kids, so a failed
+				// prefetch degrades to the lazy behavior.
+				logger.Warn("JWKS prefetch for issuer %q failed: %v", id, err)
+			}
+		}(id, manager)
+	}
+	wg.Wait()
+}
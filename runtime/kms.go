@@ -0,0 +1,153 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// SigningContext ties one signing call to the identity and purpose behind
+// it. Backends forward it to the custody service (AWS KMS EncryptionContext,
+// enforced in key policy) and it is recorded in the audit log, so a signature
+// can never be produced without an attributable reason.
+type SigningContext map[string]string
+
+// Signing purposes recorded in each call's SigningContext.
+const (
+	signPurposeUserTx         = "user_tx"
+	signPurposeDepositForward = "deposit_forward"
+	signPurposeOwnershipProof = "ownership_proof"
+)
+
+// signingContextFor builds the SigningContext for a wallet operation. The
+// same map is attached to the audit entry written for the operation, so the
+// audit trail and the KMS CloudTrail entries carry identical attribution.
+func signingContextFor(wallet *Wallet, purpose string) SigningContext {
+	sctx := SigningContext{"purpose": purpose}
+	if wallet.ExternalID != "" {
+		sctx["externalId"] = wallet.ExternalID
+	}
+	return sctx
+}
+
+// KMSSigner abstracts the custody backend holding wallet private keys. The
+// module never sees private key material directly: it requests public keys
+// for address derivation and digests to be signed.
+type KMSSigner interface {
+	// PublicKey returns the uncompressed secp256k1 public key (65 bytes,
+	// 0x04-prefixed) for the wallet at the given derivation index.
+	PublicKey(ctx context.Context, derivationIndex uint32) ([]byte, error)
+	// SignDigest signs a 32-byte digest and returns a 65-byte Ethereum
+	// signature laid out as R || S || V, where V is the recovery ID (0 or 1).
+	// The signing context accompanies the call to the backend.
+	SignDigest(ctx context.Context, derivationIndex uint32, digest []byte, sctx SigningContext) ([]byte, error)
+}
+
+// kmsBackendMock is the built-in development backend ID, and the backend
+// every wallet lived on before backend IDs were recorded.
+const kmsBackendMock = "mock"
+
+var (
+	// kmsSigner is the default backend new wallets are provisioned on, set
+	// once during InitModule from NAKAMA_KMS_DEFAULT_BACKEND.
+	kmsSigner KMSSigner
+	// kmsBackends routes signing by the backend ID recorded on each wallet,
+	// so during a provider migration old wallets keep signing on their
+	// original backend while new wallets land on the default.
+	kmsBackends = make(map[string]KMSSigner)
+)
+
+// registerKMSBackend makes a signer backend resolvable by ID. Called during
+// InitModule only; the map is read-only afterwards.
+func registerKMSBackend(id string, signer KMSSigner) {
+	kmsBackends[id] = signer
+}
+
+// GetKMSSigner resolves the signer backend for a wallet's backend ID. The
+// empty ID belongs to wallets provisioned before backend IDs were recorded
+// and resolves to the mock backend they were created on.
+func GetKMSSigner(ctx context.Context, backendID string) (KMSSigner, error) {
+	if len(kmsBackends) == 0 {
+		return nil, fmt.Errorf("kms: signer backends not initialized")
+	}
+	if backendID == "" {
+		backendID = kmsBackendMock
+	}
+	signer, ok := kmsBackends[backendID]
+	if !ok {
+		return nil, fmt.Errorf("kms: unknown signer backend %q", backendID)
+	}
+	return signer, nil
+}
+
+// MockKMSSigner derives per-wallet secp256k1 keys from a shared master secret
+// using HMAC-SHA256 and signs locally. It exists for development and sandbox
+// environments only; nothing it signs should ever reach a real network.
+type MockKMSSigner struct {
+	master []byte
+}
+
+// NewMockKMSSigner builds a mock signer from the configured master secret.
+func NewMockKMSSigner(master []byte) (*MockKMSSigner, error) {
+	if len(master) == 0 {
+		return nil, fmt.Errorf("kms: mock signer requires a non-empty master secret")
+	}
+	return &MockKMSSigner{master: master}, nil
+}
+
+func (s *MockKMSSigner) privateKey(derivationIndex uint32) (*secp256k1.PrivateKey, error) {
+	mac := hmac.New(sha256.New, s.master)
+	mac.Write([]byte("wallet/"))
+	var idx [4]byte
+	binary.BigEndian.PutUint32(idx[:], derivationIndex)
+	mac.Write(idx[:])
+	var scalar secp256k1.ModNScalar
+	if overflow := scalar.SetByteSlice(mac.Sum(nil)); overflow || scalar.IsZero() {
+		return nil, fmt.Errorf("kms: derived scalar out of range for index %d", derivationIndex)
+	}
+	return secp256k1.NewPrivateKey(&scalar), nil
+}
+
+func (s *MockKMSSigner) PublicKey(ctx context.Context, derivationIndex uint32) ([]byte, error) {
+	priv, err := s.privateKey(derivationIndex)
+	if err != nil {
+		return nil, err
+	}
+	return priv.PubKey().SerializeUncompressed(), nil
+}
+
+func (s *MockKMSSigner) SignDigest(ctx context.Context, derivationIndex uint32, digest []byte, sctx SigningContext) ([]byte, error) {
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("kms: digest must be 32 bytes, got %d", len(digest))
+	}
+	priv, err := s.privateKey(derivationIndex)
+	if err != nil {
+		return nil, err
+	}
+	// SignCompact produces [V+27 || R || S]; rearrange to Ethereum's R||S||V.
+	compact := ecdsa.SignCompact(priv, digest, false)
+	sig := make([]byte, 65)
+	copy(sig[0:32], compact[1:33])
+	copy(sig[32:64], compact[33:65])
+	sig[64] = compact[0] - 27
+	return sig, nil
+}
@@ -0,0 +1,283 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// AWSKMSSigner backs wallets with AWS KMS asymmetric keys. Like the other
+// AWS touchpoints in this module the signer speaks the service's wire
+// protocol — the KMS JSON API — against an endpoint fronted by a
+// credential-holding proxy; see status.go for the same arrangement. Derived
+// mode maps each derivation index onto a key ARN through the configured
+// template (one KMS key or alias per index, provisioned out of band);
+// per-user mode creates a dedicated ECC_SECG_P256K1 key per wallet. KMS
+// returns DER: SPKI documents from GetPublicKey and ASN.1 (r, s) sequences
+// from Sign, which are normalized here to the uncompressed-point and
+// low-s R || S || V layouts the rest of the module expects.
+
+const (
+	// kmsBackendAWS is the backend ID wallets signed by AWS KMS record.
+	kmsBackendAWS = "aws"
+
+	kmsTimeout = 10 * time.Second
+
+	// X-Amz-Target values for the KMS JSON API.
+	kmsTargetGetPublicKey = "TrentService.GetPublicKey"
+	kmsTargetSign         = "TrentService.Sign"
+	kmsTargetCreateKey    = "TrentService.CreateKey"
+	kmsTargetDisableKey   = "TrentService.DisableKey"
+
+	kmsSigningAlgorithm = "ECDSA_SHA_256"
+	kmsKeySpec          = "ECC_SECG_P256K1"
+)
+
+// AWSKMSSigner signs through the AWS KMS wire protocol.
+type AWSKMSSigner struct {
+	endpoint string
+	// keyARNTemplate renders a derivation index into the key ARN or alias
+	// holding that index's key, e.g. "alias/nakama-wallet-%d". Empty limits
+	// the backend to per-user keys.
+	keyARNTemplate string
+
+	client *http.Client
+}
+
+// NewAWSKMSSigner builds an AWS KMS signer against the configured endpoint.
+func NewAWSKMSSigner(endpoint, keyARNTemplate string) (*AWSKMSSigner, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("kms: aws signer requires an endpoint")
+	}
+	if keyARNTemplate != "" && strings.Count(keyARNTemplate, "%d") != 1 {
+		return nil, fmt.Errorf("kms: key ARN template must contain exactly one %%d, got %q", keyARNTemplate)
+	}
+	return &AWSKMSSigner{
+		endpoint:       endpoint,
+		keyARNTemplate: keyARNTemplate,
+		client:         &http.Client{Timeout: kmsTimeout},
+	}, nil
+}
+
+// call issues one KMS JSON API request and decodes the response into out.
+// The signing context travels as a request header for the credential-holding
+// proxy to enforce and log; the KMS Sign API itself has no context field.
+func (s *AWSKMSSigner) call(ctx context.Context, target string, sctx SigningContext, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	if len(sctx) > 0 {
+		encoded, err := json.Marshal(sctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Nakama-Signing-Context", string(encoded))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kms: %s failed: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var decoded struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&decoded)
+		return fmt.Errorf("kms: %s returned HTTP %d: %s", target, resp.StatusCode, decoded.Type)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("kms: %s response malformed: %w", target, err)
+	}
+	return nil
+}
+
+// keyARNForIndex renders the derived-mode key ARN for a derivation index.
+func (s *AWSKMSSigner) keyARNForIndex(derivationIndex uint32) (string, error) {
+	if s.keyARNTemplate == "" {
+		return "", fmt.Errorf("kms: aws backend has no key ARN template; derived-mode wallets are unsupported")
+	}
+	return fmt.Sprintf(s.keyARNTemplate, derivationIndex), nil
+}
+
+// publicKeyByARN fetches and decodes one key's uncompressed public point.
+func (s *AWSKMSSigner) publicKeyByARN(ctx context.Context, keyARN string) ([]byte, error) {
+	var out struct {
+		PublicKey string `json:"PublicKey"`
+	}
+	if err := s.call(ctx, kmsTargetGetPublicKey, nil, map[string]string{"KeyId": keyARN}, &out); err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("kms: public key is not valid base64: %w", err)
+	}
+	return publicKeyFromSPKI(der)
+}
+
+// publicKeyFromSPKI extracts the uncompressed secp256k1 point from the DER
+// SubjectPublicKeyInfo document KMS returns.
+func publicKeyFromSPKI(der []byte) ([]byte, error) {
+	var spki struct {
+		Algorithm asn1.RawValue
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, fmt.Errorf("kms: public key DER malformed: %w", err)
+	}
+	pub, err := secp256k1.ParsePubKey(spki.PublicKey.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("kms: public key point invalid: %w", err)
+	}
+	return pub.SerializeUncompressed(), nil
+}
+
+// ethSignatureFromDER converts a DER ECDSA signature into Ethereum's
+// R || S || V layout: both halves padded to 32 bytes, S canonicalized to the
+// low half of the order, and V recovered by trial against the key that
+// signed.
+func ethSignatureFromDER(der, digest, expectedPub []byte) ([]byte, error) {
+	var decoded struct {
+		R *big.Int
+		S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &decoded); err != nil {
+		return nil, fmt.Errorf("kms: signature DER malformed: %w", err)
+	}
+	order := secp256k1.Params().N
+	if decoded.R.Sign() <= 0 || decoded.S.Sign() <= 0 || decoded.R.Cmp(order) >= 0 || decoded.S.Cmp(order) >= 0 {
+		return nil, fmt.Errorf("kms: signature values out of range")
+	}
+	// KMS does not canonicalize; fold high-S down so the chain accepts it.
+	if decoded.S.Cmp(new(big.Int).Rsh(order, 1)) > 0 {
+		decoded.S.Sub(order, decoded.S)
+	}
+
+	sig := make([]byte, 65)
+	decoded.R.FillBytes(sig[0:32])
+	decoded.S.FillBytes(sig[32:64])
+	// Two points recover from any (r, s); the recovery ID is the one that
+	// yields the signing key.
+	compact := make([]byte, 65)
+	copy(compact[1:33], sig[0:32])
+	copy(compact[33:65], sig[32:64])
+	for v := byte(0); v < 2; v++ {
+		compact[0] = v + 27
+		pub, _, err := ecdsa.RecoverCompact(compact, digest)
+		if err == nil && bytes.Equal(pub.SerializeUncompressed(), expectedPub) {
+			sig[64] = v
+			return sig, nil
+		}
+	}
+	return nil, fmt.Errorf("kms: signature does not recover to the signing key")
+}
+
+// signByARN signs a digest with one key and normalizes the result.
+func (s *AWSKMSSigner) signByARN(ctx context.Context, keyARN string, digest []byte, sctx SigningContext) ([]byte, error) {
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("kms: digest must be 32 bytes, got %d", len(digest))
+	}
+	// The public key pins the recovery ID below. The dispatcher caches its
+	// own copy for address derivation; this fetch rides the same budget.
+	expectedPub, err := s.publicKeyByARN(ctx, keyARN)
+	if err != nil {
+		return nil, err
+	}
+	var out struct {
+		Signature string `json:"Signature"`
+	}
+	in := map[string]string{
+		"KeyId":            keyARN,
+		"Message":          base64.StdEncoding.EncodeToString(digest),
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": kmsSigningAlgorithm,
+	}
+	if err := s.call(ctx, kmsTargetSign, sctx, in, &out); err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(out.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("kms: signature is not valid base64: %w", err)
+	}
+	return ethSignatureFromDER(der, digest, expectedPub)
+}
+
+func (s *AWSKMSSigner) PublicKey(ctx context.Context, derivationIndex uint32) ([]byte, error) {
+	keyARN, err := s.keyARNForIndex(derivationIndex)
+	if err != nil {
+		return nil, err
+	}
+	return s.publicKeyByARN(ctx, keyARN)
+}
+
+func (s *AWSKMSSigner) SignDigest(ctx context.Context, derivationIndex uint32, digest []byte, sctx SigningContext) ([]byte, error) {
+	keyARN, err := s.keyARNForIndex(derivationIndex)
+	if err != nil {
+		return nil, err
+	}
+	return s.signByARN(ctx, keyARN, digest, sctx)
+}
+
+func (s *AWSKMSSigner) CreateKey(ctx context.Context) (string, []byte, error) {
+	var out struct {
+		KeyMetadata struct {
+			Arn string `json:"Arn"`
+		} `json:"KeyMetadata"`
+	}
+	in := map[string]string{
+		"KeySpec":  kmsKeySpec,
+		"KeyUsage": "SIGN_VERIFY",
+	}
+	if err := s.call(ctx, kmsTargetCreateKey, nil, in, &out); err != nil {
+		return "", nil, err
+	}
+	if out.KeyMetadata.Arn == "" {
+		return "", nil, fmt.Errorf("kms: CreateKey returned no ARN")
+	}
+	pub, err := s.publicKeyByARN(ctx, out.KeyMetadata.Arn)
+	if err != nil {
+		return "", nil, err
+	}
+	return out.KeyMetadata.Arn, pub, nil
+}
+
+func (s *AWSKMSSigner) SignWithKey(ctx context.Context, keyARN string, digest []byte, sctx SigningContext) ([]byte, error) {
+	return s.signByARN(ctx, keyARN, digest, sctx)
+}
+
+func (s *AWSKMSSigner) DisableKey(ctx context.Context, keyARN string) error {
+	var out struct{}
+	return s.call(ctx, kmsTargetDisableKey, nil, map[string]string{"KeyId": keyARN}, &out)
+}
@@ -0,0 +1,89 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// derSignature encodes (r, s) the way KMS returns signatures.
+func derSignature(t *testing.T, r, s *big.Int) []byte {
+	t.Helper()
+	der, err := asn1.Marshal(struct {
+		R *big.Int
+		S *big.Int
+	}{r, s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestEthSignatureFromDER(t *testing.T) {
+	priv := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{0x17}, 32))
+	expectedPub := priv.PubKey().SerializeUncompressed()
+	digest := keccak256([]byte("kms signature normalization"))
+
+	// A known-good signature to compare against: SignCompact yields
+	// [V+27 || R || S] with S already canonical.
+	compact := ecdsa.SignCompact(priv, digest, false)
+	r := new(big.Int).SetBytes(compact[1:33])
+	s := new(big.Int).SetBytes(compact[33:65])
+	order := secp256k1.Params().N
+
+	lowS, err := ethSignatureFromDER(derSignature(t, r, s), digest, expectedPub)
+	if err != nil {
+		t.Fatalf("low-S conversion failed: %v", err)
+	}
+	if !bytes.Equal(lowS[0:32], compact[1:33]) || !bytes.Equal(lowS[32:64], compact[33:65]) {
+		t.Fatal("low-S signature altered r or s")
+	}
+	if lowS[64] != compact[0]-27 {
+		t.Fatalf("recovery ID = %d, want %d", lowS[64], compact[0]-27)
+	}
+
+	// KMS may hand back the high-S twin; it must fold to the identical
+	// canonical signature, recovery ID included.
+	highS, err := ethSignatureFromDER(derSignature(t, r, new(big.Int).Sub(order, s)), digest, expectedPub)
+	if err != nil {
+		t.Fatalf("high-S conversion failed: %v", err)
+	}
+	if !bytes.Equal(highS, lowS) {
+		t.Fatalf("high-S input normalized to %x, want %x", highS, lowS)
+	}
+
+	for _, tc := range []struct {
+		name string
+		der  []byte
+		pub  []byte
+	}{
+		{"malformed DER", []byte{0x30, 0x02, 0x01}, expectedPub},
+		{"zero S", derSignature(t, r, big.NewInt(0)), expectedPub},
+		{"S at the order", derSignature(t, r, order), expectedPub},
+		{"foreign key", derSignature(t, r, s), secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{0x29}, 32)).PubKey().SerializeUncompressed()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ethSignatureFromDER(tc.der, digest, tc.pub); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
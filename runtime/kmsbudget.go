@@ -0,0 +1,172 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// KMS calls are billed per request and rate limited by AWS, so all signer
+// traffic goes through a dispatcher: public key lookups are cached and
+// deduplicated (concurrent identical lookups share one backend call), call
+// volume is tracked per minute, and load is shed with RETRY_LATER before the
+// AWS quota is hit. Usage is exported through the module metrics registry.
+
+var (
+	metricKMSCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nakama_module_kms_calls_total",
+		Help: "KMS backend calls by operation.",
+	}, []string{"op"})
+
+	metricKMSShed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nakama_module_kms_calls_shed_total",
+		Help: "KMS calls refused because the per-minute budget was reached.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(metricKMSCalls, metricKMSShed)
+}
+
+// kmsDispatcher wraps a signer backend with caching and call budgeting. It
+// implements both KMSSigner and PerUserKeySigner, delegating the latter only
+// when the wrapped backend supports it.
+type kmsDispatcher struct {
+	inner KMSSigner
+
+	// Per-minute call accounting.
+	mu         sync.Mutex
+	minute     int64
+	callsInMin int
+
+	// Public key cache plus in-flight deduplication.
+	pubCache   sync.Map // cache key -> []byte
+	inflightMu sync.Mutex
+	inflight   map[string]chan struct{}
+}
+
+func newKMSDispatcher(inner KMSSigner) *kmsDispatcher {
+	return &kmsDispatcher{inner: inner, inflight: make(map[string]chan struct{})}
+}
+
+// reserveCall accounts one backend call against the per-minute budget.
+func (d *kmsDispatcher) reserveCall(op string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := moduleClock.Now().Unix() / 60
+	if now != d.minute {
+		d.minute = now
+		d.callsInMin = 0
+	}
+	if cfg.KMSCallsPerMinute > 0 && d.callsInMin >= cfg.KMSCallsPerMinute {
+		metricKMSShed.Inc()
+		return rpcError(errCodeRetryLater, "Signer backend call budget reached; retry shortly.", codes.ResourceExhausted)
+	}
+	d.callsInMin++
+	metricKMSCalls.WithLabelValues(op).Inc()
+	return nil
+}
+
+// cachedPublicKey serves a public key from cache, collapsing concurrent
+// lookups of the same key into one backend call.
+func (d *kmsDispatcher) cachedPublicKey(cacheKey, op string, fetch func() ([]byte, error)) ([]byte, error) {
+	for {
+		if pub, ok := d.pubCache.Load(cacheKey); ok {
+			return pub.([]byte), nil
+		}
+
+		d.inflightMu.Lock()
+		if wait, ok := d.inflight[cacheKey]; ok {
+			d.inflightMu.Unlock()
+			<-wait
+			continue // The winner populated the cache (or failed); re-check.
+		}
+		done := make(chan struct{})
+		d.inflight[cacheKey] = done
+		d.inflightMu.Unlock()
+
+		pub, err := func() ([]byte, error) {
+			if err := d.reserveCall(op); err != nil {
+				return nil, err
+			}
+			return fetch()
+		}()
+		if err == nil {
+			d.pubCache.Store(cacheKey, pub)
+		}
+
+		d.inflightMu.Lock()
+		delete(d.inflight, cacheKey)
+		close(done)
+		d.inflightMu.Unlock()
+		return pub, err
+	}
+}
+
+func (d *kmsDispatcher) PublicKey(ctx context.Context, derivationIndex uint32) ([]byte, error) {
+	return d.cachedPublicKey(fmt.Sprintf("index/%d", derivationIndex), "get_public_key", func() ([]byte, error) {
+		return d.inner.PublicKey(ctx, derivationIndex)
+	})
+}
+
+func (d *kmsDispatcher) SignDigest(ctx context.Context, derivationIndex uint32, digest []byte, sctx SigningContext) ([]byte, error) {
+	if err := d.reserveCall("sign"); err != nil {
+		return nil, err
+	}
+	return d.inner.SignDigest(ctx, derivationIndex, digest, sctx)
+}
+
+func (d *kmsDispatcher) CreateKey(ctx context.Context) (string, []byte, error) {
+	creator, ok := d.inner.(PerUserKeySigner)
+	if !ok {
+		return "", nil, fmt.Errorf("kms: signer backend does not support per-user keys")
+	}
+	if err := d.reserveCall("create_key"); err != nil {
+		return "", nil, err
+	}
+	keyARN, pub, err := creator.CreateKey(ctx)
+	if err == nil {
+		d.pubCache.Store("arn/"+keyARN, pub)
+	}
+	return keyARN, pub, err
+}
+
+func (d *kmsDispatcher) SignWithKey(ctx context.Context, keyARN string, digest []byte, sctx SigningContext) ([]byte, error) {
+	signer, ok := d.inner.(PerUserKeySigner)
+	if !ok {
+		return nil, fmt.Errorf("kms: signer backend does not support per-user keys")
+	}
+	if err := d.reserveCall("sign"); err != nil {
+		return nil, err
+	}
+	return signer.SignWithKey(ctx, keyARN, digest, sctx)
+}
+
+func (d *kmsDispatcher) DisableKey(ctx context.Context, keyARN string) error {
+	signer, ok := d.inner.(PerUserKeySigner)
+	if !ok {
+		return fmt.Errorf("kms: signer backend does not support per-user keys")
+	}
+	if err := d.reserveCall("disable_key"); err != nil {
+		return err
+	}
+	d.pubCache.Delete("arn/" + keyARN)
+	return signer.DisableKey(ctx, keyARN)
+}
@@ -0,0 +1,164 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Wallet key modes. Derived mode shares one master key and derives per-wallet
+// keys by index; per-user mode creates a dedicated KMS/HSM key at wallet
+// provisioning time and records its ARN on the wallet.
+const (
+	walletKeyModeDerived = "derived"
+	walletKeyModePerUser = "per-user"
+)
+
+// PerUserKeySigner is implemented by signer backends that can create and
+// manage one dedicated key per wallet (kms.CreateKey or CloudHSM key gen)
+// instead of deriving from a shared master.
+type PerUserKeySigner interface {
+	// CreateKey provisions a new signing key and returns its ARN and
+	// uncompressed secp256k1 public key.
+	CreateKey(ctx context.Context) (keyARN string, publicKey []byte, err error)
+	// SignWithKey signs a 32-byte digest with the key at keyARN, returning the
+	// same R || S || V layout as KMSSigner.SignDigest. The signing context
+	// accompanies the call to the backend.
+	SignWithKey(ctx context.Context, keyARN string, digest []byte, sctx SigningContext) ([]byte, error)
+	// DisableKey disables the key at keyARN, e.g. when the owning account is
+	// deleted. Disabled keys refuse further signing.
+	DisableKey(ctx context.Context, keyARN string) error
+}
+
+// perUserKeySigner returns a backend's per-user key support, or an error
+// when the backend or configured mode doesn't provide it.
+func perUserKeySigner(ctx context.Context, backendID string) (PerUserKeySigner, error) {
+	signer, err := GetKMSSigner(ctx, backendID)
+	if err != nil {
+		return nil, err
+	}
+	creator, ok := signer.(PerUserKeySigner)
+	if !ok {
+		return nil, fmt.Errorf("kms: signer backend does not support per-user keys")
+	}
+	return creator, nil
+}
+
+// Mock per-user keys derive material from HMAC(master, ARN), so signing needs
+// only the ARN and no key store. Disabled ARNs are tracked in memory; real
+// backends hold this state server-side.
+
+func (s *MockKMSSigner) keyFromARN(keyARN string) (*secp256k1.PrivateKey, error) {
+	mac := hmac.New(sha256.New, s.master)
+	mac.Write([]byte("key/"))
+	mac.Write([]byte(keyARN))
+	var scalar secp256k1.ModNScalar
+	if overflow := scalar.SetByteSlice(mac.Sum(nil)); overflow || scalar.IsZero() {
+		return nil, fmt.Errorf("kms: derived scalar out of range for key %s", keyARN)
+	}
+	return secp256k1.NewPrivateKey(&scalar), nil
+}
+
+var mockDisabledKeys sync.Map
+
+func (s *MockKMSSigner) CreateKey(ctx context.Context) (string, []byte, error) {
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", nil, err
+	}
+	keyARN := "arn:mock:kms:key/" + id
+	priv, err := s.keyFromARN(keyARN)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyARN, priv.PubKey().SerializeUncompressed(), nil
+}
+
+func (s *MockKMSSigner) SignWithKey(ctx context.Context, keyARN string, digest []byte, sctx SigningContext) ([]byte, error) {
+	if len(digest) != 32 {
+		return nil, fmt.Errorf("kms: digest must be 32 bytes, got %d", len(digest))
+	}
+	if _, disabled := mockDisabledKeys.Load(keyARN); disabled {
+		return nil, fmt.Errorf("kms: key %s is disabled", keyARN)
+	}
+	priv, err := s.keyFromARN(keyARN)
+	if err != nil {
+		return nil, err
+	}
+	compact := ecdsa.SignCompact(priv, digest, false)
+	sig := make([]byte, 65)
+	copy(sig[0:32], compact[1:33])
+	copy(sig[32:64], compact[33:65])
+	sig[64] = compact[0] - 27
+	return sig, nil
+}
+
+func (s *MockKMSSigner) DisableKey(ctx context.Context, keyARN string) error {
+	mockDisabledKeys.Store(keyARN, true)
+	return nil
+}
+
+// rpcAdminDisableWalletKey disables a user's dedicated wallet key. Called from
+// the account deletion pipeline so orphaned keys cannot sign. Server-to-server
+// only.
+func rpcAdminDisableWalletKey(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID string `json:"userId"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId.", codes.InvalidArgument)
+	}
+
+	wallet, err := getWallet(ctx, nk, req.UserID)
+	if err != nil {
+		logger.Error("Wallet read failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal)
+	}
+	if wallet == nil || wallet.KeyARN == "" {
+		return "", rpcError(errCodeNotFound, "User has no dedicated wallet key.", codes.NotFound)
+	}
+
+	signer, err := perUserKeySigner(ctx, wallet.Backend)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Signer backend does not support per-user keys.", codes.Internal)
+	}
+	if err := signer.DisableKey(ctx, wallet.KeyARN); err != nil {
+		logger.Error("Key disable failed for %v: %v", wallet.KeyARN, err)
+		return "", rpcError(errCodeInternal, "Key disable failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "wallet.key_disabled", req.UserID, map[string]interface{}{
+		"keyArn": wallet.KeyARN,
+	}); err != nil {
+		logger.Error("Audit append failed for key disable: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	return `{"disabled":true}`, nil
+}
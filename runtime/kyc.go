@@ -0,0 +1,223 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// KYC verification is delegated to a third-party provider. The module opens a
+// provider session per user, the provider reports the outcome through a
+// signed webhook RPC, and the resulting status gates high-value transactions
+// in the policy engine.
+
+const (
+	kycCollection        = "kyc"
+	kycStatusKey         = "status"
+	kycSessionCollection = "kyc_sessions"
+)
+
+// KYC statuses.
+const (
+	kycStatusNone     = "none"
+	kycStatusPending  = "pending"
+	kycStatusApproved = "approved"
+	kycStatusRejected = "rejected"
+)
+
+// KYCStatus is the per-user verification state.
+type KYCStatus struct {
+	Status    string `json:"status"`
+	SessionID string `json:"sessionId,omitempty"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// getKYCStatus reads a user's KYC state, defaulting to none.
+func getKYCStatus(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*KYCStatus, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: kycCollection,
+		Key:        kycStatusKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return &KYCStatus{Status: kycStatusNone}, nil
+	}
+	status := &KYCStatus{}
+	if err := json.Unmarshal([]byte(objects[0].Value), status); err != nil {
+		return nil, fmt.Errorf("kyc record corrupt for user %s: %w", userID, err)
+	}
+	return status, nil
+}
+
+func writeKYCStatus(ctx context.Context, nk nkruntime.NakamaModule, userID string, status *KYCStatus) error {
+	status.UpdatedAt = moduleClock.Now().Unix()
+	value, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     kycCollection,
+		Key:            kycStatusKey,
+		UserID:         userID,
+		Value:          string(value),
+		PermissionRead: 1,
+	}})
+	return err
+}
+
+// rpcStartKYC opens a provider verification session for the calling user and
+// returns the URL the client should send the user to.
+func rpcStartKYC(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if cfg.KYCProviderURL == "" {
+		return "", rpcError(errCodeInternal, "KYC is not configured on this deployment.", codes.FailedPrecondition)
+	}
+
+	status, err := getKYCStatus(ctx, nk, userID)
+	if err != nil {
+		logger.Error("KYC status read failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "KYC lookup failed.", codes.Internal)
+	}
+	if status.Status == kycStatusApproved {
+		out, _ := json.Marshal(map[string]string{"status": kycStatusApproved})
+		return string(out), nil
+	}
+
+	sessionID, err := moduleIDs.NewID()
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Session creation failed.", codes.Internal)
+	}
+
+	// Session -> user mapping for webhook correlation.
+	sessionValue, _ := json.Marshal(map[string]string{"userId": userID})
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: kycSessionCollection,
+		Key:        sessionID,
+		Value:      string(sessionValue),
+	}}); err != nil {
+		logger.Error("KYC session write failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Session creation failed.", codes.Internal)
+	}
+
+	status.Status = kycStatusPending
+	status.SessionID = sessionID
+	if err := writeKYCStatus(ctx, nk, userID, status); err != nil {
+		logger.Error("KYC status write failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Session creation failed.", codes.Internal)
+	}
+
+	sessionURL := fmt.Sprintf("%s?session=%s", cfg.KYCProviderURL, url.QueryEscape(sessionID))
+	out, _ := json.Marshal(map[string]string{
+		"status":    kycStatusPending,
+		"sessionId": sessionID,
+		"url":       sessionURL,
+	})
+	return string(out), nil
+}
+
+// kycWebhookBody is the provider result payload carried inside the signed
+// webhook envelope.
+type kycWebhookBody struct {
+	SessionID string `json:"sessionId"`
+	Status    string `json:"status"`
+}
+
+// rpcKYCWebhook ingests provider results. The envelope carries the raw body
+// and an HMAC-SHA256 signature over it computed with the shared webhook
+// secret, so results can't be forged even if the runtime HTTP key leaks.
+func rpcKYCWebhook(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	if cfg.KYCWebhookSecret == "" {
+		return "", rpcError(errCodeInternal, "KYC webhooks are not configured on this deployment.", codes.FailedPrecondition)
+	}
+
+	var envelope struct {
+		Body      string `json:"body"`
+		Signature string `json:"signature"`
+	}
+	// The provider posts the envelope and may add fields; strict decoding
+	// doesn't apply to schemas we don't own.
+	if err := json.Unmarshal([]byte(payload), &envelope); err != nil || envelope.Body == "" || envelope.Signature == "" {
+		return "", rpcError(errCodeBadInput, "Expects payload with body and signature fields.", codes.InvalidArgument)
+	}
+
+	mac := hmac.New(sha256.New, []byte(cfg.KYCWebhookSecret))
+	mac.Write([]byte(envelope.Body))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(envelope.Signature)) {
+		return "", rpcError(errCodePermissionDenied, "Webhook signature mismatch.", codes.PermissionDenied)
+	}
+
+	body := &kycWebhookBody{}
+	if err := json.Unmarshal([]byte(envelope.Body), body); err != nil || body.SessionID == "" {
+		return "", rpcError(errCodeBadInput, "Malformed webhook body.", codes.InvalidArgument)
+	}
+	if body.Status != kycStatusApproved && body.Status != kycStatusRejected {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Unknown KYC status %q.", body.Status), codes.InvalidArgument)
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: kycSessionCollection,
+		Key:        body.SessionID,
+	}})
+	if err != nil {
+		logger.Error("KYC session read failed: %v", err)
+		return "", rpcError(errCodeInternal, "Session lookup failed.", codes.Internal)
+	}
+	if len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "Unknown KYC session.", codes.NotFound)
+	}
+	var session struct {
+		UserID string `json:"userId"`
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), &session); err != nil {
+		return "", rpcError(errCodeInternal, "Session record corrupt.", codes.Internal)
+	}
+
+	if err := writeKYCStatus(ctx, nk, session.UserID, &KYCStatus{
+		Status:    body.Status,
+		SessionID: body.SessionID,
+	}); err != nil {
+		logger.Error("KYC status write failed for user %v: %v", session.UserID, err)
+		return "", rpcError(errCodeInternal, "Status update failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "kyc.result", session.UserID, map[string]interface{}{
+		"sessionId": body.SessionID,
+		"status":    body.Status,
+	}); err != nil {
+		logger.Error("Audit append failed for KYC session %v: %v", body.SessionID, err)
+	}
+
+	out, _ := json.Marshal(map[string]string{"userId": session.UserID, "status": body.Status})
+	return string(out), nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// In a multi-node cluster each background worker class must run on exactly
+// one node, or queue drains and broadcasts double up. Election uses a
+// storage-based lease per worker class: the holder heartbeats a conditional
+// write, and any node may take over once the lease expires. Followers keep
+// contending, so leadership moves within one TTL of the leader dying.
+
+const (
+	leaseCollection = "worker_leases"
+	leaseTTL        = 30 * time.Second
+	leaseInterval   = 10 * time.Second
+)
+
+// workerLease is the stored lease record for one worker class.
+type workerLease struct {
+	Holder     string `json:"holder"`
+	AcquiredAt int64  `json:"acquiredAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+// nodeID identifies this process in lease records; the cluster node name when
+// available, otherwise a random per-process ID.
+var nodeID = func() string {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "node-unknown"
+	}
+	return id.String()
+}()
+
+// leaseStatus tracks which worker classes this node currently leads, for
+// healthz reporting.
+var (
+	leaseStatusMu sync.RWMutex
+	leaseStatus   = make(map[string]*workerLease)
+)
+
+// leaseSnapshot reports per-worker-class leadership as seen by this node.
+func leaseSnapshot() map[string]interface{} {
+	leaseStatusMu.RLock()
+	defer leaseStatusMu.RUnlock()
+	out := make(map[string]interface{}, len(leaseStatus))
+	for class, lease := range leaseStatus {
+		out[class] = map[string]interface{}{
+			"holder": lease.Holder,
+			"leader": lease.Holder == nodeID,
+		}
+	}
+	return out
+}
+
+// tryAcquireLease attempts to acquire or renew the lease for a worker class.
+// It returns true while this node holds the lease.
+func tryAcquireLease(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, class string) bool {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: leaseCollection,
+		Key:        class,
+	}})
+	if err != nil {
+		logger.Warn("Lease read failed for worker %v: %v", class, err)
+		return false
+	}
+
+	now := moduleClock.Now()
+	version := "*"
+	current := &workerLease{}
+	if len(objects) > 0 {
+		version = objects[0].Version
+		if err := json.Unmarshal([]byte(objects[0].Value), current); err != nil {
+			logger.Warn("Lease record corrupt for worker %v: %v", class, err)
+			current = &workerLease{}
+		}
+	}
+
+	recordStatus := func(lease *workerLease) {
+		leaseStatusMu.Lock()
+		leaseStatus[class] = lease
+		leaseStatusMu.Unlock()
+	}
+
+	if current.Holder != "" && current.Holder != nodeID && now.Unix() < current.ExpiresAt {
+		// Someone else holds a live lease; stay a follower.
+		recordStatus(current)
+		return false
+	}
+
+	lease := &workerLease{
+		Holder:     nodeID,
+		AcquiredAt: current.AcquiredAt,
+		ExpiresAt:  now.Add(leaseTTL).Unix(),
+	}
+	if current.Holder != nodeID {
+		lease.AcquiredAt = now.Unix()
+	}
+	value, err := json.Marshal(lease)
+	if err != nil {
+		return false
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: leaseCollection,
+		Key:        class,
+		Value:      string(value),
+		Version:    version,
+	}}); err != nil {
+		// Lost the CAS race to another node; it is the leader now.
+		return false
+	}
+	if current.Holder != nodeID && current.Holder != "" {
+		logger.Info("Worker %v lease taken over from %v by %v", class, current.Holder, nodeID)
+	}
+	recordStatus(lease)
+	return true
+}
+
+// runLeasedWorker runs one worker class under lease: the pass function only
+// executes on ticks where this node holds the lease, and the lease is
+// heartbeat-renewed on the same cadence.
+func runLeasedWorker(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, class string, interval time.Duration, pass func(context.Context, nkruntime.Logger, nkruntime.NakamaModule)) {
+	// Heartbeat at least twice per TTL so a healthy leader never lapses.
+	heartbeat := leaseInterval
+	if interval < heartbeat {
+		heartbeat = interval
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	lastPass := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !tryAcquireLease(ctx, logger, nk, class) {
+				continue
+			}
+			if time.Since(lastPass) >= interval {
+				lastPass = moduleClock.Now()
+				pass(ctx, logger, nk)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Link tickets let the web portal hand an in-game session a signed,
+// short-lived, single-use proof of a Cognito subject instead of passing raw
+// ID tokens through the web flow. The portal (server-to-server) mints a
+// ticket, deep-links into the game, and the authenticated game session
+// consumes it to complete the custom ID link.
+
+const linkTicketCollection = "link_tickets"
+
+// linkTicket is the signed payload encoded into a ticket string.
+type linkTicket struct {
+	Sub       string `json:"sub"`
+	Email     string `json:"email,omitempty"`
+	Nonce     string `json:"nonce"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// CreateLinkTicketRequest is the payload for rpc_create_link_ticket. The
+// portal either asserts the subject directly or forwards the companion app's
+// ID token, which is verified against the link audience set.
+type CreateLinkTicketRequest struct {
+	Sub   string `json:"sub,omitempty"`
+	Email string `json:"email,omitempty"`
+	Token string `json:"token,omitempty"`
+}
+
+// CreateLinkTicketResponse is returned by rpc_create_link_ticket.
+type CreateLinkTicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// ConsumeLinkTicketRequest is the payload for rpc_consume_link_ticket.
+type ConsumeLinkTicketRequest struct {
+	Ticket string `json:"ticket"`
+}
+
+// ConsumeLinkTicketResponse is returned by rpc_consume_link_ticket.
+type ConsumeLinkTicketResponse struct {
+	Linked bool   `json:"linked"`
+	Sub    string `json:"sub"`
+}
+
+func signLinkTicket(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(cfg.LinkTicketSecret))
+	mac.Write(body)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func encodeLinkTicket(t *linkTicket) (string, error) {
+	body, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + signLinkTicket(body), nil
+}
+
+func decodeLinkTicket(s string) (*linkTicket, error) {
+	parts := strings.SplitN(s, ".", 2)
+	if len(parts) != 2 {
+		return nil, rpcError(errCodeTicketInvalid, "Malformed link ticket.", codes.InvalidArgument)
+	}
+	body, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, rpcError(errCodeTicketInvalid, "Malformed link ticket.", codes.InvalidArgument)
+	}
+	if !hmac.Equal([]byte(signLinkTicket(body)), []byte(parts[1])) {
+		return nil, rpcError(errCodeTicketInvalid, "Link ticket signature mismatch.", codes.PermissionDenied)
+	}
+	t := &linkTicket{}
+	if err := json.Unmarshal(body, t); err != nil {
+		return nil, rpcError(errCodeTicketInvalid, "Malformed link ticket.", codes.InvalidArgument)
+	}
+	return t, nil
+}
+
+// checkLinkEmailGuard blocks linking an incoming identity to an account that
+// already carries a different email. The existing email is taken from the
+// Nakama email identity first, then from account metadata. Accounts without
+// an email are unaffected, as is the guard when disabled in config.
+func checkLinkEmailGuard(ctx context.Context, nk nkruntime.NakamaModule, userID string, incomingEmail string) error {
+	if !cfg.LinkRequireEmailMatch {
+		return nil
+	}
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return rpcError(errCodeInternal, "Account lookup failed.", codes.Internal)
+	}
+
+	existing := account.GetEmail()
+	if existing == "" && account.GetUser().GetMetadata() != "" {
+		var metadata map[string]interface{}
+		if json.Unmarshal([]byte(account.GetUser().GetMetadata()), &metadata) == nil {
+			existing, _ = metadata["email"].(string)
+		}
+	}
+	if existing == "" {
+		return nil
+	}
+	if incomingEmail == "" || !strings.EqualFold(existing, incomingEmail) {
+		return rpcError(errCodeEmailMismatch, "Linked identity email does not match the account email.", codes.PermissionDenied)
+	}
+	return nil
+}
+
+// rpcCreateLinkTicket issues a signed link ticket for a Cognito subject.
+// Server-to-server only: the web portal has already authenticated the user
+// against Cognito and is trusted to assert the subject.
+func rpcCreateLinkTicket(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	if cfg.LinkTicketSecret == "" {
+		return "", rpcError(errCodeInternal, "Link tickets are not configured on this deployment.", codes.FailedPrecondition)
+	}
+
+	var req CreateLinkTicketRequest
+	if err := unmarshalPayload(payload, &req); err != nil || (req.Sub == "" && req.Token == "") {
+		return "", rpcError(errCodeBadInput, "Expects payload with a sub or token field.", codes.InvalidArgument)
+	}
+	if req.Token != "" {
+		claims, err := verifyIDToken(nil, req.Token, cfg.LinkAudiences)
+		if err != nil {
+			logger.Debug("Link token verification failed: %v", err)
+			return "", rpcError(errCodeAuthFailed, "ID token verification failed.", codes.Unauthenticated)
+		}
+		// Linking is step-up-worthy; see freshness.go.
+		if err := checkTokenFreshness(claims, tokenOpLink); err != nil {
+			return "", err
+		}
+		req.Sub = claims.Subject
+		if req.Email == "" && claims.EmailVerified {
+			req.Email = claims.Email
+		}
+	}
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", rpcError(errCodeInternal, "Ticket generation failed.", codes.Internal)
+	}
+
+	ticket := &linkTicket{
+		Sub:       req.Sub,
+		Email:     req.Email,
+		Nonce:     hex.EncodeToString(nonceBytes),
+		ExpiresAt: moduleClock.Now().Add(cfg.LinkTicketTTL).Unix(),
+	}
+	encoded, err := encodeLinkTicket(ticket)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Ticket generation failed.", codes.Internal)
+	}
+
+	// Record the pending nonce so the ticket is single-use even though the
+	// signature alone would verify.
+	value, _ := json.Marshal(map[string]interface{}{"sub": ticket.Sub, "exp": ticket.ExpiresAt})
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:      linkTicketCollection,
+		Key:             ticket.Nonce,
+		Value:           string(value),
+		PermissionRead:  0,
+		PermissionWrite: 0,
+	}}); err != nil {
+		logger.Error("Link ticket storage write failed: %v", err)
+		return "", rpcError(errCodeInternal, "Ticket generation failed.", codes.Internal)
+	}
+
+	out, _ := json.Marshal(&CreateLinkTicketResponse{Ticket: encoded, ExpiresAt: ticket.ExpiresAt})
+	return string(out), nil
+}
+
+// rpcConsumeLinkTicket completes a link started on the web portal. The caller
+// must be an authenticated game session; the ticket's Cognito subject is
+// linked to the calling account as a custom ID.
+func rpcConsumeLinkTicket(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if cfg.LinkTicketSecret == "" {
+		return "", rpcError(errCodeInternal, "Link tickets are not configured on this deployment.", codes.FailedPrecondition)
+	}
+
+	var req ConsumeLinkTicketRequest
+	if err := unmarshalPayload(payload, &req); err != nil || req.Ticket == "" {
+		return "", rpcError(errCodeBadInput, "Expects payload with a non-empty ticket field.", codes.InvalidArgument)
+	}
+
+	ticket, err := decodeLinkTicket(req.Ticket)
+	if err != nil {
+		return "", err
+	}
+	if moduleClock.Now().Unix() > ticket.ExpiresAt {
+		return "", rpcError(errCodeTicketExpired, "Link ticket has expired.", codes.DeadlineExceeded)
+	}
+
+	// The pending record must still exist; its absence means the ticket was
+	// already consumed.
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: linkTicketCollection,
+		Key:        ticket.Nonce,
+	}})
+	if err != nil {
+		logger.Error("Link ticket storage read failed: %v", err)
+		return "", rpcError(errCodeInternal, "Ticket verification failed.", codes.Internal)
+	}
+	if len(objects) == 0 {
+		return "", rpcError(errCodeTicketUsed, "Link ticket has already been consumed.", codes.FailedPrecondition)
+	}
+
+	// Consume before linking: a duplicate concurrent call fails the
+	// conditional delete rather than double-linking.
+	if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: linkTicketCollection,
+		Key:        ticket.Nonce,
+		Version:    objects[0].Version,
+	}}); err != nil {
+		return "", rpcError(errCodeTicketUsed, "Link ticket has already been consumed.", codes.FailedPrecondition)
+	}
+
+	if err := checkLinkEmailGuard(ctx, nk, userID, ticket.Email); err != nil {
+		return "", err
+	}
+
+	// Don't link identities Cognito has since disabled.
+	if err := checkUserEnabled(ctx, logger, nk, ticket.Sub); err != nil {
+		return "", err
+	}
+
+	if err := withRetry(ctx, logger, "link_custom", func() error {
+		return nk.LinkCustom(ctx, userID, customID(ticket.Sub))
+	}); err != nil {
+		logger.Error("LinkCustom failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Account link failed.", codes.Internal)
+	}
+
+	out, _ := json.Marshal(&ConsumeLinkTicketResponse{Linked: true, Sub: ticket.Sub})
+	return string(out), nil
+}
@@ -0,0 +1,93 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Listing RPCs share one pagination scheme so every list endpoint behaves
+// identically: normalized limits, opaque cursors, and cursors bound to the
+// filter they were issued under. A cursor embeds the underlying storage
+// cursor plus a hash of the filter, so resuming a page walk with a changed
+// filter fails loudly instead of silently skipping or duplicating rows.
+
+const (
+	listDefaultLimit = 20
+	listMaxLimit     = 100
+)
+
+// normalizeListLimit clamps a client limit to the shared defaults.
+func normalizeListLimit(limit int) int {
+	if limit <= 0 || limit > listMaxLimit {
+		return listDefaultLimit
+	}
+	return limit
+}
+
+// listFilterHash fingerprints a filter value for cursor binding.
+func listFilterHash(filter interface{}) string {
+	encoded, err := json.Marshal(filter)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8])
+}
+
+// listCursor is the decoded form of an opaque listing cursor.
+type listCursor struct {
+	// Storage is the underlying storage engine cursor.
+	Storage string `json:"s"`
+	// Filter is the hash of the filter the cursor was issued under.
+	Filter string `json:"f,omitempty"`
+}
+
+// encodeListCursor issues an opaque cursor, or "" at the end of the listing.
+func encodeListCursor(storageCursor string, filterHash string) string {
+	if storageCursor == "" {
+		return ""
+	}
+	encoded, err := json.Marshal(&listCursor{Storage: storageCursor, Filter: filterHash})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// decodeListCursor unwraps an opaque cursor and checks it was issued for the
+// same filter the caller is using now.
+func decodeListCursor(cursor string, filterHash string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", rpcError(errCodeBadInput, "Malformed listing cursor.", codes.InvalidArgument)
+	}
+	decoded := &listCursor{}
+	if err := json.Unmarshal(raw, decoded); err != nil {
+		return "", rpcError(errCodeBadInput, "Malformed listing cursor.", codes.InvalidArgument)
+	}
+	if decoded.Filter != filterHash {
+		return "", rpcError(errCodeBadInput, "Listing cursor was issued for a different filter.", codes.InvalidArgument)
+	}
+	return decoded.Storage, nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math/rand"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// The login counters say how often logins fail; this records why. Failures
+// are sampled into an analytics collection with the details the metrics
+// can't carry — which issuer the token named, what the audience mismatch
+// was, how old the token had grown, what platform the client reported — and
+// rpc_admin_login_failures summarizes them over a time window. Recording is
+// best effort and never alters the login outcome.
+
+const loginFailureCollection = "login_failures"
+
+// loginFailureScanCap bounds the summary scan, mirroring the statement
+// export cap.
+const loginFailureScanCap = 10000
+
+// Failure reasons recorded by the login paths.
+const (
+	loginFailUnknownTenant = "unknown_tenant"
+	loginFailVerify        = "verify_failed"
+	loginFailStaleToken    = "stale_token"
+	loginFailNonce         = "nonce"
+	loginFailQueueFull     = "queue_full"
+	loginFailBanned        = "banned"
+	loginFailAssertion     = "assertion"
+	loginFailNotInvited    = "not_invited"
+	loginFailDisabled      = "disabled"
+	loginFailInternal      = "internal"
+)
+
+// loginFailureRecord is one sampled failure.
+type loginFailureRecord struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+	// Detail carries the server-side error text, e.g. the audience mismatch.
+	Detail          string   `json:"detail,omitempty"`
+	Issuer          string   `json:"issuer,omitempty"`
+	Audience        []string `json:"audience,omitempty"`
+	TokenAgeSeconds int64    `json:"tokenAgeSeconds,omitempty"`
+	Platform        string   `json:"platform,omitempty"`
+	Tenant          string   `json:"tenant,omitempty"`
+	At              int64    `json:"at"`
+}
+
+type loginPlatformKey struct{}
+
+// loginPlatformContext pins the client-reported platform for the duration of
+// a login call so failure records deep in the shared path can carry it.
+func loginPlatformContext(ctx context.Context, platform string) context.Context {
+	if platform == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, loginPlatformKey{}, platform)
+}
+
+func loginPlatformFromContext(ctx context.Context) string {
+	platform, _ := ctx.Value(loginPlatformKey{}).(string)
+	return platform
+}
+
+// recordLoginFailure samples a failure into the analytics collection. Claims
+// may be nil when the token never parsed. Best effort by design.
+func recordLoginFailure(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, reason, detail string, claims *CognitoClaims) {
+	if cfg.LoginFailureSampleRate <= 0 {
+		return
+	}
+	if cfg.LoginFailureSampleRate < 1 && rand.Float64() >= cfg.LoginFailureSampleRate {
+		return
+	}
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return
+	}
+	record := &loginFailureRecord{
+		ID:       id,
+		Reason:   reason,
+		Detail:   detail,
+		Platform: loginPlatformFromContext(ctx),
+		Tenant:   tenantFromContext(ctx),
+		At:       moduleClock.Now().Unix(),
+	}
+	if claims != nil {
+		record.Issuer = claims.Issuer
+		record.Audience = claims.Audience
+		if claims.IssuedAt != nil {
+			record.TokenAgeSeconds = moduleClock.Now().Unix() - claims.IssuedAt.Unix()
+		}
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: loginFailureCollection,
+		Key:        record.ID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Warn("Login failure record write failed: %v", err)
+	}
+}
+
+// rpcAdminLoginFailures summarizes sampled login failures over a time
+// window. Server-to-server only.
+func rpcAdminLoginFailures(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		// From and To bound the window as Unix seconds; zero means open.
+		From int64 `json:"from,omitempty"`
+		To   int64 `json:"to,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed summary request.", codes.InvalidArgument)
+		}
+	}
+
+	reasons := make(map[string]int)
+	platforms := make(map[string]int)
+	tenants := make(map[string]int)
+	total := 0
+	scanned := 0
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", loginFailureCollection, 100, cursor)
+		if err != nil {
+			logger.Error("Login failure listing failed: %v", err)
+			return "", rpcError(errCodeInternal, "Failure summary failed.", codes.Internal)
+		}
+		for _, obj := range objects {
+			scanned++
+			record := &loginFailureRecord{}
+			if err := json.Unmarshal([]byte(obj.Value), record); err != nil {
+				continue
+			}
+			if (req.From != 0 && record.At < req.From) || (req.To != 0 && record.At > req.To) {
+				continue
+			}
+			total++
+			reasons[record.Reason]++
+			if record.Platform != "" {
+				platforms[record.Platform]++
+			}
+			if record.Tenant != "" {
+				tenants[record.Tenant]++
+			}
+		}
+		if next == "" || scanned >= loginFailureScanCap {
+			break
+		}
+		cursor = next
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"total":      total,
+		"reasons":    reasons,
+		"platforms":  platforms,
+		"tenants":    tenants,
+		"sampleRate": cfg.LoginFailureSampleRate,
+		"truncated":  scanned >= loginFailureScanCap,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,394 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Queueing one treasury transfer per holder (snapshot.go) pays gas for every
+// recipient whether or not they ever touch the funds. For large airdrops the
+// merkle path inverts that: the operator builds a merkle distribution from a
+// completed snapshot, funds the configured MerkleDistributor contract once,
+// and each holder claims their own share on-chain with a stored proof. The
+// module computes the root and per-user proofs and keeps them in storage; it
+// holds no treasury keys, so funding the distributor stays with the ops
+// pipeline — the create RPC hands back the calldata to run. Leaves are
+// keccak256(index ‖ account ‖ amount) with sorted-pair internal hashing, the
+// layout the reference MerkleDistributor verifies.
+
+const (
+	merkleDistCollection  = "merkle_distributions"
+	merkleProofCollection = "merkle_proofs"
+
+	// merkleClaimSelector is claim(uint256,address,uint256,bytes32[]).
+	merkleClaimSelector = "2e7ba6ef"
+)
+
+// merkleDistribution is one published distribution, stored system-owned.
+type merkleDistribution struct {
+	ID         string `json:"id"`
+	SnapshotID string `json:"snapshotId"`
+	Token      string `json:"token"`
+	Root       string `json:"root"`
+	TotalWei   string `json:"totalWei"`
+	Recipients int    `json:"recipients"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// merkleProofRecord is one user's claim material, stored under the user so
+// rpc_claim_airdrop reads only the caller's own record.
+type merkleProofRecord struct {
+	DistributionID string `json:"distributionId"`
+	Index          uint64 `json:"index"`
+	Address        string `json:"address"`
+	AmountWei      string `json:"amountWei"`
+	// Proof is the bottom-up sibling path, 0x-prefixed 32-byte hex.
+	Proof []string `json:"proof"`
+}
+
+// abiWord left-pads b into a 32-byte ABI word.
+func abiWord(b []byte) []byte {
+	word := make([]byte, 32)
+	copy(word[32-len(b):], b)
+	return word
+}
+
+// merkleLeaf hashes one distribution entry the way the distributor contract
+// does: keccak256(abi.encodePacked(uint256 index, address, uint256 amount)).
+func merkleLeaf(index uint64, address []byte, amount *big.Int) []byte {
+	return keccak256(abiWord(new(big.Int).SetUint64(index).Bytes()), address, abiWord(amount.Bytes()))
+}
+
+// merkleParent hashes a sorted node pair, matching OpenZeppelin's
+// MerkleProof.verify.
+func merkleParent(a, b []byte) []byte {
+	if string(a) > string(b) {
+		a, b = b, a
+	}
+	return keccak256(a, b)
+}
+
+// buildMerkleTree computes the root and one sibling path per leaf. Odd nodes
+// are promoted to the next level unhashed.
+func buildMerkleTree(leaves [][]byte) ([]byte, [][][]byte) {
+	proofs := make([][][]byte, len(leaves))
+	// positions[i] tracks where leaf i currently sits in the working level.
+	positions := make([]int, len(leaves))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleParent(level[i], level[i+1]))
+		}
+		for leaf, pos := range positions {
+			sibling := pos ^ 1
+			if sibling < len(level) {
+				proofs[leaf] = append(proofs[leaf], level[sibling])
+			}
+			positions[leaf] = pos / 2
+		}
+		level = next
+	}
+	return level[0], proofs
+}
+
+// merkleClaimCalldata encodes claim(index, account, amount, proof).
+func merkleClaimCalldata(index uint64, address []byte, amount *big.Int, proof []string) (string, error) {
+	data := make([]byte, 0, 4+32*(5+len(proof)))
+	data = append(data, mustParseHexData("0x"+merkleClaimSelector)...)
+	data = append(data, abiWord(new(big.Int).SetUint64(index).Bytes())...)
+	data = append(data, abiWord(address)...)
+	data = append(data, abiWord(amount.Bytes())...)
+	// Offset of the bytes32[] tail, relative to the start of the arguments.
+	data = append(data, abiWord(big.NewInt(128).Bytes())...)
+	data = append(data, abiWord(big.NewInt(int64(len(proof))).Bytes())...)
+	for _, node := range proof {
+		decoded, err := parseHexData(node)
+		if err != nil || len(decoded) != 32 {
+			return "", fmt.Errorf("malformed proof node %q", node)
+		}
+		data = append(data, decoded...)
+	}
+	return "0x" + hex.EncodeToString(data), nil
+}
+
+// rpcAdminCreateMerkleDistribution builds a merkle distribution from a
+// completed snapshot: proportional shares, root, and one stored proof per
+// holder. Returns the root and the treasury calldata that funds the
+// distributor. Server-to-server only.
+func rpcAdminCreateMerkleDistribution(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	if cfg.MerkleDistributorAddress == "" {
+		return "", rpcError(errCodeBadInput, "No merkle distributor contract is configured.", codes.FailedPrecondition)
+	}
+	var req struct {
+		SnapshotID string `json:"snapshotId"`
+		TotalWei   string `json:"totalWei"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.SnapshotID == "" || req.TotalWei == "" {
+		return "", rpcError(errCodeBadInput, "Expects a snapshotId and totalWei.", codes.InvalidArgument)
+	}
+	totalWei, err := parseWei(req.TotalWei)
+	if err != nil || totalWei.Sign() <= 0 {
+		return "", rpcError(errCodeBadInput, "totalWei must be a positive wei amount.", codes.InvalidArgument)
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: snapshotCollection,
+		Key:        req.SnapshotID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "Snapshot not found.", codes.NotFound)
+	}
+	snapshot := &tokenSnapshot{}
+	if err := json.Unmarshal([]byte(objects[0].Value), snapshot); err != nil {
+		return "", rpcError(errCodeInternal, "Snapshot record is corrupt.", codes.Internal)
+	}
+	if snapshot.Status != snapshotStatusComplete {
+		return "", rpcError(errCodeBadInput, "Snapshot has not completed.", codes.FailedPrecondition)
+	}
+	supply, ok := new(big.Int).SetString(snapshot.TotalSupply, 10)
+	if !ok || supply.Sign() <= 0 {
+		return "", rpcError(errCodeBadInput, "Snapshot recorded no holders.", codes.FailedPrecondition)
+	}
+
+	// Shares are proportional, same arithmetic as the queued airdrop path.
+	// Indexes are assigned in snapshot order, so rebuilding from the same
+	// snapshot and total reproduces the same tree.
+	type recipient struct {
+		holder *snapshotHolder
+		share  *big.Int
+	}
+	recipients := make([]*recipient, 0, len(snapshot.Holders))
+	for _, holder := range snapshot.Holders {
+		balance, ok := new(big.Int).SetString(holder.Balance, 10)
+		if !ok {
+			continue
+		}
+		share := new(big.Int).Div(new(big.Int).Mul(totalWei, balance), supply)
+		if share.Sign() <= 0 {
+			continue
+		}
+		recipients = append(recipients, &recipient{holder: holder, share: share})
+	}
+	if len(recipients) == 0 {
+		return "", rpcError(errCodeBadInput, "No holder earns a positive share of totalWei.", codes.FailedPrecondition)
+	}
+
+	leaves := make([][]byte, len(recipients))
+	distributed := new(big.Int)
+	for i, r := range recipients {
+		address, err := parseHexAddress(r.holder.Address)
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Snapshot holder address is corrupt.", codes.Internal)
+		}
+		leaves[i] = merkleLeaf(uint64(i), address, r.share)
+		distributed.Add(distributed, r.share)
+	}
+	root, proofs := buildMerkleTree(leaves)
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", rpcError(errCodeInternal, "ID generation failed.", codes.Internal)
+	}
+	for i, r := range recipients {
+		proof := make([]string, len(proofs[i]))
+		for j, node := range proofs[i] {
+			proof[j] = "0x" + hex.EncodeToString(node)
+		}
+		record := &merkleProofRecord{
+			DistributionID: id,
+			Index:          uint64(i),
+			Address:        r.holder.Address,
+			AmountWei:      r.share.String(),
+			Proof:          proof,
+		}
+		value, err := json.Marshal(record)
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection:     merkleProofCollection,
+			Key:            id,
+			UserID:         r.holder.UserID,
+			Value:          string(value),
+			PermissionRead: 1,
+		}}); err != nil {
+			logger.Error("Merkle proof write failed for holder %v: %v", r.holder.Address, err)
+			return "", rpcError(errCodeInternal, "Proof storage failed.", codes.Internal)
+		}
+	}
+
+	dist := &merkleDistribution{
+		ID:         id,
+		SnapshotID: req.SnapshotID,
+		Token:      snapshot.Token,
+		Root:       "0x" + hex.EncodeToString(root),
+		TotalWei:   totalWei.String(),
+		Recipients: len(recipients),
+		CreatedAt:  moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(dist)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: merkleDistCollection,
+		Key:        id,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Merkle distribution write failed for snapshot %v: %v", req.SnapshotID, err)
+		return "", rpcError(errCodeInternal, "Distribution storage failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "airdrop.merkle_created", "", map[string]interface{}{
+		"distributionId": id,
+		"snapshotId":     req.SnapshotID,
+		"root":           dist.Root,
+		"recipients":     len(recipients),
+		"totalWei":       totalWei.String(),
+	}); err != nil {
+		logger.Error("Audit append failed for merkle distribution %v: %v", id, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	distributor := mustParseHexData(cfg.MerkleDistributorAddress)
+	out, err := json.Marshal(map[string]interface{}{
+		"distributionId": id,
+		"root":           dist.Root,
+		"recipients":     len(recipients),
+		// distributedWei can undershoot totalWei by integer division dust.
+		"distributedWei": distributed.String(),
+		"distributor":    cfg.MerkleDistributorAddress,
+		// fundingCalldata is the token transfer the treasury signer submits
+		// against the snapshot's token contract to fund the distributor.
+		"fundingCalldata": erc20TransferCalldata(distributor, distributed),
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// rpcClaimAirdrop signs the distributor claim transaction for the calling
+// user with their stored proof. Gas, fees and nonce come from the client like
+// any other signing request; the claim call itself is built server-side.
+func rpcClaimAirdrop(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireSigningSession(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		DistributionID       string  `json:"distributionId"`
+		Gas                  uint64  `json:"gas"`
+		MaxFeePerGas         string  `json:"maxFeePerGas"`
+		MaxPriorityFeePerGas string  `json:"maxPriorityFeePerGas"`
+		Nonce                *uint64 `json:"nonce"`
+		WalletLabel          string  `json:"walletLabel,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.DistributionID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a distributionId and transaction fee fields.", codes.InvalidArgument)
+	}
+	if cfg.MerkleDistributorAddress == "" {
+		return "", rpcError(errCodeBadInput, "No merkle distributor contract is configured.", codes.FailedPrecondition)
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: merkleProofCollection,
+		Key:        req.DistributionID,
+		UserID:     userID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "No claim found for this distribution.", codes.NotFound)
+	}
+	proof := &merkleProofRecord{}
+	if err := json.Unmarshal([]byte(objects[0].Value), proof); err != nil {
+		return "", rpcError(errCodeInternal, "Proof record is corrupt.", codes.Internal)
+	}
+
+	wallet, err := ensureWalletLabeled(ctx, logger, nk, userID, req.WalletLabel)
+	if err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Error("Wallet lookup failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal)
+	}
+	// The proof commits to the address recorded at snapshot time; a rotated
+	// wallet cannot claim a leaf minted for its old key.
+	if wallet.Address != proof.Address {
+		return "", rpcError(errCodeBadInput, "Wallet address no longer matches the snapshot; claim from the recorded address.", codes.FailedPrecondition)
+	}
+
+	address, err := parseHexAddress(proof.Address)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Proof record is corrupt.", codes.Internal)
+	}
+	amount, ok := new(big.Int).SetString(proof.AmountWei, 10)
+	if !ok {
+		return "", rpcError(errCodeInternal, "Proof record is corrupt.", codes.Internal)
+	}
+	calldata, err := merkleClaimCalldata(proof.Index, address, amount, proof.Proof)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Proof record is corrupt.", codes.Internal)
+	}
+
+	txReq := &EVMTransactionRequest{
+		To:                   cfg.MerkleDistributorAddress,
+		Data:                 calldata,
+		Gas:                  req.Gas,
+		MaxFeePerGas:         req.MaxFeePerGas,
+		MaxPriorityFeePerGas: req.MaxPriorityFeePerGas,
+		Nonce:                req.Nonce,
+		WalletLabel:          req.WalletLabel,
+	}
+	record, err := signAndSendEVMTransaction(ctx, logger, nk, userID, wallet, txReq)
+	if err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Debug("Claim signing rejected for user %v: %v", userID, err)
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Transaction rejected: %v.", err), codes.InvalidArgument)
+	}
+	record.ExplorerURL = explorerTxURL(record.ChainID, record.Hash)
+
+	out, err := json.Marshal(record)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
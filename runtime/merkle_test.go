@@ -0,0 +1,79 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// merkleVerify replays a proof the way the distributor contract does.
+func merkleVerify(leaf []byte, proof [][]byte, root []byte) bool {
+	node := leaf
+	for _, sibling := range proof {
+		node = merkleParent(node, sibling)
+	}
+	return bytes.Equal(node, root)
+}
+
+func TestBuildMerkleTreeProofsVerify(t *testing.T) {
+	// Odd and even counts exercise both the paired and the promoted paths.
+	for _, count := range []int{1, 2, 3, 7, 8} {
+		leaves := make([][]byte, count)
+		for i := range leaves {
+			address := bytes.Repeat([]byte{byte(i + 1)}, 20)
+			leaves[i] = merkleLeaf(uint64(i), address, big.NewInt(int64(1000+i)))
+		}
+		root, proofs := buildMerkleTree(leaves)
+		for i, leaf := range leaves {
+			if !merkleVerify(leaf, proofs[i], root) {
+				t.Fatalf("count %d: proof for leaf %d does not verify", count, i)
+			}
+		}
+		// A proof must not verify someone else's leaf.
+		if count > 1 && merkleVerify(leaves[0], proofs[1], root) {
+			t.Fatalf("count %d: proof for leaf 1 verified leaf 0", count)
+		}
+	}
+}
+
+func TestMerkleClaimCalldataLayout(t *testing.T) {
+	address := bytes.Repeat([]byte{0xab}, 20)
+	proof := []string{
+		"0x" + fmt.Sprintf("%064x", 1),
+		"0x" + fmt.Sprintf("%064x", 2),
+	}
+	calldata, err := merkleClaimCalldata(7, address, big.NewInt(5), proof)
+	if err != nil {
+		t.Fatalf("merkleClaimCalldata failed: %v", err)
+	}
+	decoded := mustParseHexData(calldata)
+	// Selector plus four head words plus length word plus two proof nodes.
+	if len(decoded) != 4+32*7 {
+		t.Fatalf("expected %d bytes, got %d", 4+32*7, len(decoded))
+	}
+	if calldata[:10] != "0x"+merkleClaimSelector {
+		t.Fatalf("unexpected selector prefix %s", calldata[:10])
+	}
+	// The tail offset points at the length word, 128 bytes into the args.
+	if offset := new(big.Int).SetBytes(decoded[4+32*3 : 4+32*4]); offset.Int64() != 128 {
+		t.Fatalf("expected tail offset 128, got %v", offset)
+	}
+	if length := new(big.Int).SetBytes(decoded[4+32*4 : 4+32*5]); length.Int64() != 2 {
+		t.Fatalf("expected proof length 2, got %v", length)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Account metadata derived from Cognito claims (email, username, country) is
+// synced by a durable background worker instead of an AccountUpdateId call in
+// the login path. Login enqueues a storage-backed job; the worker drains the
+// queue with retries, and only ever overwrites the metadata fields the module
+// sources from Cognito so player-managed metadata is untouched.
+
+const metadataSyncCollection = "metadata_sync_queue"
+
+const (
+	metadataSyncInterval    = 10 * time.Second
+	metadataSyncMaxAttempts = 5
+)
+
+var metricMetadataSyncLag = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "nakama_module_metadata_sync_lag_seconds",
+	Help: "Age of the oldest queued metadata sync job.",
+})
+
+func init() {
+	metricsRegistry.MustRegister(metricMetadataSyncLag)
+}
+
+// metadataSyncJob is one queued account update.
+type metadataSyncJob struct {
+	UserID     string `json:"userId"`
+	Email      string `json:"email,omitempty"`
+	Username   string `json:"username,omitempty"`
+	Country    string `json:"country,omitempty"`
+	EnqueuedAt int64  `json:"enqueuedAt"`
+	Attempts   int    `json:"attempts"`
+}
+
+// queueMetadataSync enqueues a metadata update for the user. One job per user
+// is kept; a newer login simply replaces the pending job.
+func queueMetadataSync(ctx context.Context, nk nkruntime.NakamaModule, userID string, claims *CognitoClaims) error {
+	job := &metadataSyncJob{
+		UserID:     userID,
+		Email:      claims.Email,
+		Username:   claims.CognitoUsername,
+		Country:    claims.Country,
+		EnqueuedAt: moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: metadataSyncCollection,
+		Key:        userID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// applyMetadataSync merges the Cognito-sourced fields into the account's
+// existing metadata and writes it back.
+func applyMetadataSync(ctx context.Context, nk nkruntime.NakamaModule, job *metadataSyncJob) error {
+	account, err := nk.AccountGetId(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	metadata := make(map[string]interface{})
+	if raw := account.GetUser().GetMetadata(); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+			metadata = make(map[string]interface{})
+		}
+	}
+	if job.Email != "" {
+		metadata["email"] = job.Email
+	}
+	if job.Username != "" {
+		metadata["cognito_username"] = job.Username
+	}
+	if job.Country != "" {
+		metadata["country"] = job.Country
+	}
+
+	return nk.AccountUpdateId(ctx, job.UserID, "", metadata, "", "", "", "", "")
+}
+
+// runMetadataSyncPass drains the sync queue once. It runs on the node holding
+// the metadata_sync worker lease (see lease.go).
+func runMetadataSyncPass(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+	var oldest int64
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", metadataSyncCollection, 100, cursor)
+		if err != nil {
+			logger.Error("Metadata sync queue listing failed: %v", err)
+			return
+		}
+		for _, obj := range objects {
+			job := &metadataSyncJob{}
+			if err := json.Unmarshal([]byte(obj.Value), job); err != nil {
+				logger.Warn("Dropping corrupt metadata sync job %v: %v", obj.Key, err)
+				_ = nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{Collection: metadataSyncCollection, Key: obj.Key}})
+				continue
+			}
+			if oldest == 0 || job.EnqueuedAt < oldest {
+				oldest = job.EnqueuedAt
+			}
+
+			if err := applyMetadataSync(ctx, nk, job); err != nil {
+				job.Attempts++
+				if job.Attempts >= metadataSyncMaxAttempts {
+					logger.Error("Metadata sync for user %v failed permanently after %d attempts: %v", job.UserID, job.Attempts, err)
+					deadLetter(ctx, logger, nk, dlqClassMetadataSync, job.UserID, obj.Value, err.Error(), job.Attempts)
+					_ = nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{Collection: metadataSyncCollection, Key: obj.Key}})
+					continue
+				}
+				logger.Warn("Metadata sync for user %v failed (attempt %d): %v", job.UserID, job.Attempts, err)
+				if value, err := json.Marshal(job); err == nil {
+					// Conditional write: a fresher login job wins over the retry.
+					_, _ = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+						Collection: metadataSyncCollection,
+						Key:        obj.Key,
+						Value:      string(value),
+						Version:    obj.Version,
+					}})
+				}
+				continue
+			}
+			// Conditional delete: keep jobs re-enqueued mid-flight.
+			_ = nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+				Collection: metadataSyncCollection,
+				Key:        obj.Key,
+				Version:    obj.Version,
+			}})
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if oldest == 0 {
+		metricMetadataSyncLag.Set(0)
+	} else {
+		metricMetadataSyncLag.Set(time.Since(time.Unix(oldest, 0)).Seconds())
+	}
+}
+
+// dlqClassMetadataSync names this worker's jobs in the dead-letter store.
+const dlqClassMetadataSync = "metadata_sync"
+
+// retryMetadataSync re-enqueues a dead-lettered sync job with a fresh retry
+// budget; see dlq.go.
+func retryMetadataSync(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, entry *dlqEntry) error {
+	job := &metadataSyncJob{}
+	if err := json.Unmarshal([]byte(entry.Payload), job); err != nil {
+		return fmt.Errorf("dead letter payload corrupt: %w", err)
+	}
+	job.Attempts = 0
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: metadataSyncCollection,
+		Key:        job.UserID,
+		Value:      string(value),
+	}})
+	return err
+}
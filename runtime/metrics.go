@@ -0,0 +1,87 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/grpc/codes"
+)
+
+// Module metrics live in their own Prometheus registry, separate from
+// Nakama's built-in metrics, so deployments whose node metrics endpoint is
+// not scrapable (managed hosting) can still pull module metrics through
+// rpc_metrics.
+
+var (
+	metricsRegistry = prometheus.NewRegistry()
+
+	metricLogins = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nakama_module_logins_total",
+		Help: "Login attempts by result.",
+	}, []string{"result"})
+
+	// metricTokenFailures splits ID token validation failures by class so
+	// dashboards can tell an attack (bad signatures spiking) from a client
+	// bug (wrong audience); see classifyTokenError in auth.go.
+	metricTokenFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "nakama_module_token_validation_failures_total",
+		Help: "ID token validation failures by reason.",
+	}, []string{"reason"})
+
+	metricTxSigned = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nakama_module_transactions_signed_total",
+		Help: "Transactions signed by the module.",
+	})
+
+	metricWalletsProvisioned = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "nakama_module_wallets_provisioned_total",
+		Help: "Custodial wallets provisioned.",
+	})
+)
+
+func init() {
+	metricsRegistry.MustRegister(metricLogins, metricTokenFailures, metricTxSigned, metricWalletsProvisioned)
+}
+
+// rpcMetrics returns module metrics in Prometheus text exposition format.
+// Server-to-server only: an external collector polls this through the runtime
+// HTTP key when node-level scraping is unavailable.
+func rpcMetrics(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	families, err := metricsRegistry.Gather()
+	if err != nil {
+		logger.Error("Metrics gather failed: %v", err)
+		return "", rpcError(errCodeInternal, "Metrics collection failed.", codes.Internal)
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := expfmt.NewEncoder(buf, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			logger.Error("Metrics encode failed: %v", err)
+			return "", rpcError(errCodeInternal, "Metrics encoding failed.", codes.Internal)
+		}
+	}
+	return buf.String(), nil
+}
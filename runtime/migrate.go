@@ -0,0 +1,386 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Migration off the legacy JWT auth service re-keys accounts in place: the
+// importer accepts batches of legacy external ID to Cognito sub mappings,
+// re-links each Nakama account's custom identity and re-binds its identity
+// grant and wallet records. Every applied mapping is journaled first so a bad
+// batch can be rolled back account by account, dry runs report what would
+// change without touching anything, and batches sharing a job ID accumulate
+// progress in one job record.
+
+const (
+	migrationJobCollection     = "migration_jobs"
+	migrationJournalCollection = "migration_journal"
+	// migrationBatchCap bounds one importer call; the operator pages larger
+	// exports through repeated calls under the same job ID.
+	migrationBatchCap = 100
+)
+
+// migrationMapping is one account to move.
+type migrationMapping struct {
+	LegacyExternalID string `json:"legacyExternalId"`
+	CognitoSub       string `json:"cognitoSub"`
+}
+
+// migrationJournalEntry records one applied mapping with everything needed to
+// reverse it.
+type migrationJournalEntry struct {
+	JobID            string   `json:"jobId,omitempty"`
+	UserID           string   `json:"userId"`
+	LegacyExternalID string   `json:"legacyExternalId"`
+	NewExternalID    string   `json:"newExternalId"`
+	WalletKeys       []string `json:"walletKeys,omitempty"`
+	MigratedAt       int64    `json:"migratedAt"`
+}
+
+// migrationJob accumulates progress across batches.
+type migrationJob struct {
+	ID        string `json:"id"`
+	Processed int    `json:"processed"`
+	Migrated  int    `json:"migrated"`
+	Skipped   int    `json:"skipped"`
+	Failed    int    `json:"failed"`
+	StartedAt int64  `json:"startedAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// migrationResult is the per-mapping outcome reported to the caller.
+type migrationResult struct {
+	UserID  string `json:"userId,omitempty"`
+	Status  string `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	Wallets int    `json:"wallets,omitempty"`
+}
+
+// userIDByCustomID resolves the Nakama account currently linked to a custom
+// identity. The core exposes no lookup in this direction, so it goes straight
+// to the users table.
+func userIDByCustomID(ctx context.Context, db *sql.DB, customID string) (string, error) {
+	var userID string
+	err := db.QueryRowContext(ctx, "SELECT id FROM users WHERE custom_id = $1", customID).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("custom ID lookup failed: %w", err)
+	}
+	return userID, nil
+}
+
+// rebindUserWallets rewrites the ExternalID on every wallet bound to
+// fromExternalID and returns the affected wallet keys. Conditional writes
+// keep a concurrent rotation from being clobbered, as in recovery.go.
+func rebindUserWallets(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, fromExternalID, toExternalID string) ([]string, error) {
+	rebound := make([]string, 0, 1)
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", userID, tenantCollection(ctx, walletCollection), 100, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("wallet listing failed: %w", err)
+		}
+		for _, obj := range objects {
+			wallet := &Wallet{}
+			if err := json.Unmarshal([]byte(obj.Value), wallet); err != nil {
+				logger.Warn("Skipping corrupt wallet record %v: %v", obj.Key, err)
+				continue
+			}
+			if wallet.ExternalID != fromExternalID {
+				continue
+			}
+			wallet.ExternalID = toExternalID
+			value, err := json.Marshal(wallet)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+				Collection:     tenantCollection(ctx, walletCollection),
+				Key:            obj.Key,
+				UserID:         userID,
+				Value:          string(value),
+				Version:        obj.Version,
+				PermissionRead: 1,
+			}}); err != nil {
+				return nil, fmt.Errorf("wallet re-bind write failed for key %v: %w", obj.Key, err)
+			}
+			mirrorWalletV2(ctx, logger, nk, userID, obj.Key, wallet)
+			rebound = append(rebound, obj.Key)
+		}
+		if next == "" {
+			return rebound, nil
+		}
+		cursor = next
+	}
+}
+
+// writeIdentityGrant points externalIDForUser at the given external ID.
+func writeIdentityGrant(ctx context.Context, nk nkruntime.NakamaModule, userID, externalID string) error {
+	grant := &identityGrant{ExternalID: externalID, CreatedAt: moduleClock.Now().Unix()}
+	value, err := json.Marshal(grant)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: identityCollection,
+		Key:        identityKeyGrant,
+		UserID:     userID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// migrateOneAccount applies a single mapping and journals it.
+func migrateOneAccount(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, jobID string, mapping *migrationMapping) (*migrationResult, error) {
+	userID, err := userIDByCustomID(ctx, db, mapping.LegacyExternalID)
+	if err != nil {
+		return nil, err
+	}
+	if userID == "" {
+		return &migrationResult{Status: "skipped", Detail: "no account holds the legacy ID"}, nil
+	}
+	newExternalID := customID(mapping.CognitoSub)
+
+	// Journal before mutating; a crash mid-account leaves enough to finish or
+	// reverse the move by hand.
+	entry := &migrationJournalEntry{
+		JobID:            jobID,
+		UserID:           userID,
+		LegacyExternalID: mapping.LegacyExternalID,
+		NewExternalID:    newExternalID,
+		MigratedAt:       moduleClock.Now().Unix(),
+	}
+	if err := writeMigrationJournal(ctx, nk, entry); err != nil {
+		return nil, fmt.Errorf("journal write failed: %w", err)
+	}
+
+	// Re-link the custom identity so the next Cognito login lands on the same
+	// account instead of creating a fresh one.
+	if err := nk.UnlinkCustom(ctx, userID, mapping.LegacyExternalID); err != nil {
+		return nil, fmt.Errorf("unlink failed: %w", err)
+	}
+	if err := nk.LinkCustom(ctx, userID, newExternalID); err != nil {
+		// Put the legacy link back; a half-linked account can't log in at all.
+		if relinkErr := nk.LinkCustom(ctx, userID, mapping.LegacyExternalID); relinkErr != nil {
+			logger.Error("Migration rollback re-link failed for user %v: %v", userID, relinkErr)
+		}
+		return nil, fmt.Errorf("link failed: %w", err)
+	}
+
+	entry.WalletKeys, err = rebindUserWallets(ctx, logger, nk, userID, mapping.LegacyExternalID, newExternalID)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeMigrationJournal(ctx, nk, entry); err != nil {
+		return nil, fmt.Errorf("journal update failed: %w", err)
+	}
+	if err := writeIdentityGrant(ctx, nk, userID, newExternalID); err != nil {
+		return nil, fmt.Errorf("identity grant write failed: %w", err)
+	}
+
+	if err := appendAudit(ctx, nk, "migration.relinked", userID, map[string]interface{}{
+		"legacyExternalId": mapping.LegacyExternalID,
+		"newExternalId":    newExternalID,
+		"wallets":          len(entry.WalletKeys),
+		"jobId":            jobID,
+	}); err != nil {
+		return nil, fmt.Errorf("audit append failed: %w", err)
+	}
+	return &migrationResult{UserID: userID, Status: "migrated", Wallets: len(entry.WalletKeys)}, nil
+}
+
+func writeMigrationJournal(ctx context.Context, nk nkruntime.NakamaModule, entry *migrationJournalEntry) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: migrationJournalCollection,
+		Key:        entry.UserID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// rpcAdminMigrateAccounts imports a batch of legacy-to-Cognito mappings.
+// Server-to-server only. Dry runs resolve and count without writing.
+func rpcAdminMigrateAccounts(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		JobID    string              `json:"jobId,omitempty"`
+		DryRun   bool                `json:"dryRun,omitempty"`
+		Mappings []*migrationMapping `json:"mappings"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || len(req.Mappings) == 0 {
+		return "", rpcError(errCodeBadInput, "Expects a mappings list.", codes.InvalidArgument)
+	}
+	if len(req.Mappings) > migrationBatchCap {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("At most %d mappings per batch.", migrationBatchCap), codes.InvalidArgument)
+	}
+
+	job := &migrationJob{ID: req.JobID, StartedAt: moduleClock.Now().Unix()}
+	if req.JobID != "" {
+		if objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: migrationJobCollection,
+			Key:        req.JobID,
+		}}); err == nil && len(objects) > 0 {
+			if err := json.Unmarshal([]byte(objects[0].Value), job); err != nil {
+				job = &migrationJob{ID: req.JobID, StartedAt: moduleClock.Now().Unix()}
+			}
+		}
+	}
+
+	results := make([]*migrationResult, 0, len(req.Mappings))
+	for _, mapping := range req.Mappings {
+		if mapping.LegacyExternalID == "" || mapping.CognitoSub == "" {
+			return "", rpcError(errCodeBadInput, "Each mapping needs a legacyExternalId and cognitoSub.", codes.InvalidArgument)
+		}
+		job.Processed++
+
+		var result *migrationResult
+		if req.DryRun {
+			userID, err := userIDByCustomID(ctx, db, mapping.LegacyExternalID)
+			switch {
+			case err != nil:
+				result = &migrationResult{Status: "failed", Detail: err.Error()}
+			case userID == "":
+				result = &migrationResult{Status: "skipped", Detail: "no account holds the legacy ID"}
+			default:
+				result = &migrationResult{UserID: userID, Status: "would_migrate"}
+			}
+		} else {
+			var err error
+			if result, err = migrateOneAccount(ctx, logger, db, nk, req.JobID, mapping); err != nil {
+				logger.Error("Migration failed for legacy ID %v: %v", mapping.LegacyExternalID, err)
+				result = &migrationResult{Status: "failed", Detail: err.Error()}
+			}
+		}
+		switch result.Status {
+		case "migrated", "would_migrate":
+			job.Migrated++
+		case "skipped":
+			job.Skipped++
+		default:
+			job.Failed++
+		}
+		results = append(results, result)
+	}
+
+	if req.JobID != "" && !req.DryRun {
+		job.UpdatedAt = moduleClock.Now().Unix()
+		if value, err := json.Marshal(job); err == nil {
+			if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+				Collection: migrationJobCollection,
+				Key:        req.JobID,
+				Value:      string(value),
+			}}); err != nil {
+				logger.Warn("Migration job update failed for %v: %v", req.JobID, err)
+			}
+		}
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"dryRun":  req.DryRun,
+		"job":     job,
+		"results": results,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// rpcAdminRollbackMigration reverses one journaled migration: the account is
+// re-linked to its legacy ID and the wallet bindings and identity grant are
+// restored. Server-to-server only.
+func rpcAdminRollbackMigration(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		UserID string `json:"userId"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId.", codes.InvalidArgument)
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: migrationJournalCollection,
+		Key:        req.UserID,
+	}})
+	if err != nil {
+		logger.Error("Migration journal read failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Journal read failed.", codes.Internal)
+	}
+	if len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "No migration journal entry for the stated user.", codes.NotFound)
+	}
+	entry := &migrationJournalEntry{}
+	if err := json.Unmarshal([]byte(objects[0].Value), entry); err != nil {
+		return "", rpcError(errCodeInternal, "Journal entry is corrupt.", codes.Internal)
+	}
+
+	if err := nk.UnlinkCustom(ctx, req.UserID, entry.NewExternalID); err != nil {
+		logger.Error("Rollback unlink failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Rollback unlink failed.", codes.Internal)
+	}
+	if err := nk.LinkCustom(ctx, req.UserID, entry.LegacyExternalID); err != nil {
+		logger.Error("Rollback re-link failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Rollback re-link failed.", codes.Internal)
+	}
+	if _, err := rebindUserWallets(ctx, logger, nk, req.UserID, entry.NewExternalID, entry.LegacyExternalID); err != nil {
+		logger.Error("Rollback wallet re-bind failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Rollback wallet re-bind failed.", codes.Internal)
+	}
+	if err := writeIdentityGrant(ctx, nk, req.UserID, entry.LegacyExternalID); err != nil {
+		logger.Error("Rollback grant write failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Rollback grant write failed.", codes.Internal)
+	}
+	if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: migrationJournalCollection,
+		Key:        req.UserID,
+	}}); err != nil {
+		logger.Warn("Journal cleanup failed for user %v: %v", req.UserID, err)
+	}
+
+	if err := appendAudit(ctx, nk, "migration.rolled_back", req.UserID, map[string]interface{}{
+		"legacyExternalId": entry.LegacyExternalID,
+		"newExternalId":    entry.NewExternalID,
+	}); err != nil {
+		logger.Error("Audit append failed for migration rollback of user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"userId":     req.UserID,
+		"externalId": entry.LegacyExternalID,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
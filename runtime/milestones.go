@@ -0,0 +1,184 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Game progression hooks into wallet activity through milestones: when the
+// watcher confirms a user's first transaction, their tenth, or a cumulative
+// volume threshold, an achievement record is written and the user is notified
+// over the wallet event stream and a persistent notification. The thresholds
+// form the milestone table and come from configuration.
+
+const (
+	milestonesKey         = "milestones"
+	achievementCollection = "achievements"
+
+	notificationCodeMilestone = 103
+)
+
+// milestoneState is the per-user counter record milestones are evaluated
+// against, stored in the wallet meta collection.
+type milestoneState struct {
+	TxCount int `json:"txCount"`
+	// VolumeWei is the cumulative confirmed transfer volume, as a decimal
+	// string since it can exceed int64.
+	VolumeWei string `json:"volumeWei"`
+	// Achieved maps milestone names to unlock times.
+	Achieved  map[string]int64 `json:"achieved,omitempty"`
+	UpdatedAt int64            `json:"updatedAt"`
+}
+
+// achievementRecord is one unlocked milestone, readable by the owning user.
+type achievementRecord struct {
+	Milestone  string `json:"milestone"`
+	TxID       string `json:"txId"`
+	UnlockedAt int64  `json:"unlockedAt"`
+}
+
+// newlyCrossed returns the milestone names the updated counters crossed for
+// the first time.
+func (s *milestoneState) newlyCrossed(volume *big.Int) []string {
+	var crossed []string
+	for _, threshold := range cfg.MilestoneTxCounts {
+		if s.TxCount >= threshold {
+			crossed = append(crossed, fmt.Sprintf("tx_count_%d", threshold))
+		}
+	}
+	for _, threshold := range cfg.MilestoneVolumeWei {
+		if volume.Cmp(threshold) >= 0 {
+			crossed = append(crossed, fmt.Sprintf("volume_%s", threshold))
+		}
+	}
+	fresh := crossed[:0]
+	for _, name := range crossed {
+		if _, done := s.Achieved[name]; !done {
+			fresh = append(fresh, name)
+		}
+	}
+	return fresh
+}
+
+// recordTxMilestones advances the user's milestone counters for a confirmed
+// transaction and unlocks any newly crossed milestones. Called by the status
+// tracker; failures are the caller's to log, confirmation never depends on
+// milestone bookkeeping.
+func recordTxMilestones(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID string, record *TransactionRecord) error {
+	if len(cfg.MilestoneTxCounts) == 0 && len(cfg.MilestoneVolumeWei) == 0 {
+		return nil
+	}
+
+	txValue := new(big.Int)
+	if record.Value != "" {
+		if v, ok := new(big.Int).SetString(record.Value, 10); ok {
+			txValue = v
+		}
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: walletMetaCollection,
+			Key:        milestonesKey,
+			UserID:     userID,
+		}})
+		if err != nil {
+			return err
+		}
+
+		state := &milestoneState{VolumeWei: "0"}
+		version := "*"
+		if len(objects) > 0 {
+			if err := json.Unmarshal([]byte(objects[0].Value), state); err != nil {
+				return fmt.Errorf("milestone record corrupt for user %s: %w", userID, err)
+			}
+			version = objects[0].Version
+		}
+
+		volume, ok := new(big.Int).SetString(state.VolumeWei, 10)
+		if !ok {
+			volume = new(big.Int)
+		}
+		state.TxCount++
+		volume.Add(volume, txValue)
+		state.VolumeWei = volume.String()
+
+		unlocked := state.newlyCrossed(volume)
+		now := moduleClock.Now().Unix()
+		for _, name := range unlocked {
+			if state.Achieved == nil {
+				state.Achieved = make(map[string]int64)
+			}
+			state.Achieved[name] = now
+		}
+		state.UpdatedAt = now
+
+		value, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: walletMetaCollection,
+			Key:        milestonesKey,
+			UserID:     userID,
+			Value:      string(value),
+			Version:    version,
+		}}); err != nil {
+			continue // CAS race, retry.
+		}
+
+		for _, name := range unlocked {
+			unlockMilestone(ctx, logger, nk, userID, name, record.ID, now)
+		}
+		return nil
+	}
+	return fmt.Errorf("milestone contention for user %s, giving up", userID)
+}
+
+// unlockMilestone writes the achievement record and announces it. All of this
+// is best effort: the counters above are the source of truth and a milestone
+// is never unlocked twice.
+func unlockMilestone(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, name, txID string, unlockedAt int64) {
+	value, err := json.Marshal(&achievementRecord{Milestone: name, TxID: txID, UnlockedAt: unlockedAt})
+	if err != nil {
+		return
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     achievementCollection,
+		Key:            name,
+		UserID:         userID,
+		Value:          string(value),
+		PermissionRead: 1,
+	}}); err != nil {
+		logger.Warn("Achievement write failed for %v of user %v: %v", name, userID, err)
+	}
+
+	if err := pushWalletEvent(ctx, nk, userID, &WalletEvent{
+		Type:    "milestone.unlocked",
+		Details: map[string]interface{}{"milestone": name, "txId": txID},
+	}); err != nil {
+		logger.Warn("Milestone event push failed for user %v: %v", userID, err)
+	}
+	if err := nk.NotificationSend(ctx, userID, "Milestone unlocked",
+		map[string]interface{}{"milestone": name}, notificationCodeMilestone, "", true); err != nil {
+		logger.Warn("Milestone notification failed for user %v: %v", userID, err)
+	}
+}
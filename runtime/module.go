@@ -0,0 +1,242 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package runtime implements the Cognito authentication and custodial wallet
+// module loaded into the Nakama server runtime.
+package runtime
+
+import (
+	"context"
+	"database/sql"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// moduleSurface selects which halves of the module an entrypoint registers.
+// The combined entrypoint is the default; the auth-only and wallet-only
+// entrypoints back the split plugin build targets (see plugin/), letting the
+// two halves load as independent plugins without colliding on RPC names.
+type moduleSurface int
+
+const (
+	surfaceAuth moduleSurface = 1 << iota
+	surfaceWallet
+
+	surfaceAll = surfaceAuth | surfaceWallet
+)
+
+// InitModule wires up module configuration and registers all RPC handlers.
+func InitModule(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, initializer nkruntime.Initializer) error {
+	return initModule(ctx, logger, db, nk, initializer, surfaceAll)
+}
+
+// InitAuthModule registers only the Cognito authentication surfaces: login,
+// linking, admission, claim gating and their admin RPCs. Wallet surfaces are
+// never registered regardless of the configured profile, so auth-only
+// operators can build the auth plugin target without wallet code paths.
+func InitAuthModule(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, initializer nkruntime.Initializer) error {
+	return initModule(ctx, logger, db, nk, initializer, surfaceAuth)
+}
+
+// InitWalletModule registers only the wallet and custody surfaces. Auth RPCs
+// stay with the auth plugin; sessions created there work here since both
+// plugins share the server's session layer.
+func InitWalletModule(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, initializer nkruntime.Initializer) error {
+	return initModule(ctx, logger, db, nk, initializer, surfaceWallet)
+}
+
+func initModule(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, initializer nkruntime.Initializer, surface moduleSurface) error {
+	// State lives on the instance and is published atomically, so a reload
+	// or a concurrent entrypoint replaces it coherently; see instance.go.
+	m, logger, err := newModule(ctx, logger, surface)
+	if err != nil {
+		return err
+	}
+	m.install()
+
+	// Both surfaces write audit entries, so the analytics sink starts for
+	// every entrypoint that configures one.
+	if m.cfg.SinkEnabled() {
+		dataSinkExporter = &dataExporter{logger: logger, sink: newDataSink(m.cfg)}
+		go dataSinkExporter.run(ctx)
+	}
+
+	rpcs := map[string]func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error){}
+
+	if surface&surfaceAuth != 0 {
+		// Auth surfaces exist in every profile. Shared infrastructure RPCs
+		// (health, schema, metrics, dead letters) also live here since the
+		// auth plugin is present in every deployment.
+		rpcs["rpc_login"] = rpcLogin
+		rpcs["rpc_create_auth_nonce"] = rpcCreateAuthNonce
+		rpcs["rpc_create_link_ticket"] = withScope("link", "rpc_create_link_ticket", rpcCreateLinkTicket)
+		rpcs["rpc_consume_link_ticket"] = rpcConsumeLinkTicket
+		rpcs["rpc_metrics"] = withScope("metrics", "rpc_metrics", rpcMetrics)
+		rpcs["rpc_admin_login_failures"] = withScope("metrics", "rpc_admin_login_failures", rpcAdminLoginFailures)
+		rpcs["rpc_admin_set_geo_override"] = withScope("identity", "rpc_admin_set_geo_override", rpcAdminSetGeoOverride)
+		rpcs["rpc_admin_set_login_limits"] = withScope("identity", "rpc_admin_set_login_limits", rpcAdminSetLoginLimits)
+		rpcs["rpc_admin_allowlist_add"] = withScope("identity", "rpc_admin_allowlist_add", rpcAdminAllowlistAdd)
+		rpcs["rpc_admin_allowlist_remove"] = withScope("identity", "rpc_admin_allowlist_remove", rpcAdminAllowlistRemove)
+		rpcs["rpc_admin_allowlist_list"] = withScope("identity", "rpc_admin_allowlist_list", rpcAdminAllowlistList)
+		rpcs["rpc_admin_migrate_accounts"] = withScope("identity", "rpc_admin_migrate_accounts", rpcAdminMigrateAccounts)
+		rpcs["rpc_admin_rollback_migration"] = withScope("identity", "rpc_admin_rollback_migration", rpcAdminRollbackMigration)
+		rpcs["rpc_admin_list_dead_letters"] = withScope("events", "rpc_admin_list_dead_letters", rpcAdminListDeadLetters)
+		rpcs["rpc_admin_resolve_dead_letters"] = withScope("events", "rpc_admin_resolve_dead_letters", rpcAdminResolveDeadLetters)
+		rpcs["rpc_healthz"] = rpcHealthz
+		rpcs["rpc_schema"] = rpcSchema
+		rpcs["rpc_continue_response"] = rpcContinueResponse
+
+		if m.cfg.ALBSignerARN != "" {
+			rpcs["rpc_login_alb"] = rpcLoginALB
+		}
+	}
+
+	if surface&surfaceWallet != 0 && m.cfg.WalletReadEnabled() {
+		rpcs["rpc_get_wallet"] = rpcGetWallet
+		rpcs["rpc_preview_wallet_address"] = rpcPreviewWalletAddress
+		rpcs["rpc_issue_readonly_session"] = rpcIssueReadonlySession
+		rpcs["rpc_subscribe_wallet_events"] = rpcSubscribeWalletEvents
+		rpcs["rpc_admin_push_chain_event"] = withScope("events", "rpc_admin_push_chain_event", rpcAdminPushChainEvent)
+		rpcs["rpc_list_transactions"] = rpcListTransactions
+		rpcs["rpc_export_statement"] = rpcExportStatement
+		rpcs["rpc_set_preferences"] = rpcSetPreferences
+		rpcs["rpc_list_tokens"] = rpcListTokens
+		rpcs["rpc_admin_upsert_token"] = withScope("registry", "rpc_admin_upsert_token", rpcAdminUpsertToken)
+		rpcs["rpc_admin_grant_wallet_access"] = withScope("identity", "rpc_admin_grant_wallet_access", rpcAdminGrantWalletAccess)
+		rpcs["rpc_admin_disable_wallet_key"] = withScope("identity", "rpc_admin_disable_wallet_key", rpcAdminDisableWalletKey)
+		rpcs["rpc_admin_recover_wallet"] = withScope("identity", "rpc_admin_recover_wallet", rpcAdminRecoverWallet)
+		rpcs["rpc_admin_delete_wallet"] = withScope("identity", "rpc_admin_delete_wallet", rpcAdminDeleteWallet)
+		rpcs["rpc_admin_restore_wallet"] = withScope("identity", "rpc_admin_restore_wallet", rpcAdminRestoreWallet)
+		rpcs["rpc_admin_wallet_schema_status"] = withScope("identity", "rpc_admin_wallet_schema_status", rpcAdminWalletSchemaStatus)
+		rpcs["rpc_verify_signature"] = rpcVerifySignature
+		rpcs["rpc_get_ownership_proof"] = rpcGetOwnershipProof
+		rpcs["rpc_validate_address"] = rpcValidateAddress
+		rpcs["rpc_set_guardians"] = rpcSetGuardians
+		rpcs["rpc_guardian_approve"] = rpcGuardianApprove
+
+		webhooksConfigured := m.cfg.WebhookURL != ""
+		for _, tenant := range m.cfg.Tenants {
+			webhooksConfigured = webhooksConfigured || tenant.WebhookURL != ""
+		}
+		if webhooksConfigured {
+			webhookLogger = logger
+			rpcs["rpc_admin_list_webhook_failures"] = withScope("events", "rpc_admin_list_webhook_failures", rpcAdminListWebhookFailures)
+			rpcs["rpc_admin_replay_webhook"] = withScope("events", "rpc_admin_replay_webhook", rpcAdminReplayWebhook)
+		}
+
+		if m.cfg.SNSTopicARN != "" {
+			eventPublisher = &snsPublisher{logger: logger}
+			go eventPublisher.run(ctx)
+		}
+
+		if m.cfg.SandboxMode {
+			rpcs["rpc_faucet"] = rpcFaucet
+			rpcs["rpc_simulate_flow"] = rpcSimulateFlow
+		}
+
+		if err := seedTokenRegistry(ctx, logger, nk); err != nil {
+			return err
+		}
+
+		// In-process API for sibling Go modules in the same plugin.
+		setWalletService(&moduleWalletService{logger: logger, nk: nk})
+	}
+
+	if surface&surfaceWallet != 0 && m.cfg.CustodyEnabled() {
+		rpcs["rpc_sign_and_send"] = rpcSignAndSend
+		rpcs["rpc_transfer"] = rpcTransfer
+		if m.cfg.EVMRPCURL != "" {
+			rpcs["rpc_get_fee_estimate"] = rpcGetFeeEstimate
+		}
+		rpcs["rpc_rotate_wallet"] = rpcRotateWallet
+		rpcs["rpc_admin_create_intent"] = withScope("treasury", "rpc_admin_create_intent", rpcAdminCreateIntent)
+		rpcs["rpc_admin_forward_deposit"] = withScope("treasury", "rpc_admin_forward_deposit", rpcAdminForwardDeposit)
+		rpcs["rpc_admin_mark_tx_status"] = withScope("events", "rpc_admin_mark_tx_status", rpcAdminMarkTxStatus)
+		rpcs["rpc_admin_upload_abi"] = withScope("registry", "rpc_admin_upload_abi", rpcAdminUploadABI)
+		rpcs["rpc_start_kyc"] = rpcStartKYC
+		rpcs["rpc_kyc_webhook"] = withScope("kyc", "rpc_kyc_webhook", rpcKYCWebhook)
+		rpcs["rpc_admin_gas_report"] = withScope("treasury", "rpc_admin_gas_report", rpcAdminGasReport)
+		rpcs["rpc_admin_export_key_inventory"] = withScope("treasury", "rpc_admin_export_key_inventory", rpcAdminExportKeyInventory)
+		rpcs["rpc_admin_validate_key_inventory"] = withScope("treasury", "rpc_admin_validate_key_inventory", rpcAdminValidateKeyInventory)
+		rpcs["rpc_admin_schedule_snapshot"] = withScope("treasury", "rpc_admin_schedule_snapshot", rpcAdminScheduleSnapshot)
+		rpcs["rpc_admin_airdrop_from_snapshot"] = withScope("treasury", "rpc_admin_airdrop_from_snapshot", rpcAdminAirdropFromSnapshot)
+		if m.cfg.MerkleDistributorAddress != "" {
+			rpcs["rpc_admin_create_merkle_distribution"] = withScope("treasury", "rpc_admin_create_merkle_distribution", rpcAdminCreateMerkleDistribution)
+			rpcs["rpc_claim_airdrop"] = rpcClaimAirdrop
+		}
+		rpcs["rpc_admin_flag_fraud"] = withScope("treasury", "rpc_admin_flag_fraud", rpcAdminFlagFraud)
+		rpcs["rpc_admin_resolve_clawback"] = withScope("treasury", "rpc_admin_resolve_clawback", rpcAdminResolveClawback)
+	}
+
+	registeredRPCs = registeredRPCs[:0]
+	for name, fn := range rpcs {
+		fn = withErrorEnvelope(name, withPayloadGuard(name, fn))
+		if m.cfg.LogRedactPII {
+			fn = withRedaction(fn)
+		}
+		if err := initializer.RegisterRpc(name, fn); err != nil {
+			return err
+		}
+		registeredRPCs = append(registeredRPCs, name)
+	}
+
+	// Stock SDK auth: Cognito ID tokens submitted as custom IDs are verified
+	// and rewritten to cognito:{sub} before authentication; see hooks.go.
+	if surface&surfaceAuth != 0 {
+		if err := initializer.RegisterBeforeAuthenticateCustom(beforeAuthenticateCustom); err != nil {
+			return err
+		}
+	}
+
+	runWarmup(ctx, logger)
+
+	// Workers run under a storage lease so exactly one cluster node drains
+	// each queue; see lease.go.
+	if node, ok := ctx.Value(nkruntime.RUNTIME_CTX_NODE).(string); ok && node != "" {
+		nodeID = node
+	}
+	if surface&surfaceAuth != 0 {
+		go runLeasedWorker(ctx, logger, nk, "metadata_sync", metadataSyncInterval, runMetadataSyncPass)
+	}
+	if surface&surfaceAuth != 0 && m.cfg.JWKSPrefetch {
+		// Every node prefetches; key caches are per process.
+		go runJWKSPrefetcher(ctx, logger)
+	}
+	if surface&surfaceWallet != 0 && m.cfg.WalletReadEnabled() && m.cfg.DormancyMonths > 0 {
+		go runLeasedWorker(ctx, logger, nk, "dormancy_sweep", dormancyInterval, runDormancyPass)
+	}
+	if surface&surfaceWallet != 0 && m.cfg.CustodyEnabled() && m.cfg.EVMRPCURL != "" {
+		go runLeasedWorker(ctx, logger, nk, "token_snapshot", snapshotWorkerInterval, runSnapshotPass)
+	}
+	if surface&surfaceWallet != 0 && m.cfg.WalletReadEnabled() && m.cfg.ResponseCacheTTL > 0 {
+		// Every node polls; each process cleans its own cache.
+		go runCacheBusPoller(ctx, logger, nk)
+	}
+	if surface&surfaceWallet != 0 && m.cfg.WalletReadEnabled() && m.cfg.ReconcileEnabled() {
+		go runLeasedWorker(ctx, logger, nk, "reconciliation", reconcileInterval, func(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+			runReconciliationPass(ctx, logger, db, nk)
+		})
+	}
+	if surface&surfaceWallet != 0 && m.cfg.WalletReadEnabled() {
+		go runLeasedWorker(ctx, logger, nk, "wallet_purge", walletPurgeInterval, runWalletPurgePass)
+		go runLeasedWorker(ctx, logger, nk, "spending_insights", insightsPassInterval, runInsightsPass)
+	}
+	if surface&surfaceWallet != 0 && m.cfg.WalletReadEnabled() && m.cfg.WalletSchemaPhase == walletSchemaPhaseDual {
+		go runLeasedWorker(ctx, logger, nk, "wallet_schema_migration", walletSchemaMigrateInterval, runWalletSchemaMigrationPass)
+	}
+
+	logger.Info("Cognito wallet module loaded, version: %v (%v, built %v), profile: %v, issuer: %v",
+		moduleVersion, moduleCommit, moduleBuildDate, m.cfg.Profile, m.cfg.Issuer())
+	return nil
+}
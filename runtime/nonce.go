@@ -0,0 +1,128 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// OIDC nonce support for the login flow. Clients that bind a nonce into
+// their authorization request can pass the expected value with rpc_login and
+// the module checks it against the token's nonce claim. Clients that want
+// the server to own the nonce lifecycle call rpc_create_auth_nonce first:
+// server-issued nonces are stored single-use, so a replayed ID token fails
+// even when its signature and expiry are still valid.
+
+const authNonceCollection = "auth_nonces"
+
+// authNoncePrefix marks server-issued nonces so the login path knows to
+// enforce single use; client-managed nonces pass through unprefixed.
+const authNoncePrefix = "srvn-"
+
+// authNonceTTL bounds how long an issued nonce stays redeemable.
+const authNonceTTL = 10 * time.Minute
+
+// authNonceRecord is one issued, not-yet-consumed nonce.
+type authNonceRecord struct {
+	Nonce     string `json:"nonce"`
+	IssuedAt  int64  `json:"issuedAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// checkLoginNonce validates the token's nonce claim against the caller's
+// expectation and consumes server-issued nonces. A nil error means the login
+// may proceed.
+func checkLoginNonce(ctx context.Context, nk nkruntime.NakamaModule, expected, claimed string) error {
+	if expected != "" && claimed != expected {
+		return fmt.Errorf("token nonce %q does not match the expected nonce", claimed)
+	}
+	if len(claimed) > len(authNoncePrefix) && claimed[:len(authNoncePrefix)] == authNoncePrefix {
+		return consumeAuthNonce(ctx, nk, claimed)
+	}
+	return nil
+}
+
+// consumeAuthNonce redeems a server-issued nonce exactly once. The versioned
+// delete guarantees two concurrent logins with the same token cannot both
+// pass.
+func consumeAuthNonce(ctx context.Context, nk nkruntime.NakamaModule, nonce string) error {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: authNonceCollection,
+		Key:        nonce,
+	}})
+	if err != nil {
+		return fmt.Errorf("nonce lookup failed: %w", err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("nonce %q is unknown or already used", nonce)
+	}
+	record := &authNonceRecord{}
+	if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+		return fmt.Errorf("nonce record corrupt: %w", err)
+	}
+	if moduleClock.Now().Unix() > record.ExpiresAt {
+		return fmt.Errorf("nonce %q has expired", nonce)
+	}
+	if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: authNonceCollection,
+		Key:        nonce,
+		Version:    objects[0].Version,
+	}}); err != nil {
+		return fmt.Errorf("nonce %q was consumed concurrently", nonce)
+	}
+	return nil
+}
+
+// rpcCreateAuthNonce issues a single-use nonce for an OIDC authorization
+// request. Callable without a session since it precedes login.
+func rpcCreateAuthNonce(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Nonce generation failed.", codes.Internal)
+	}
+	record := &authNonceRecord{
+		Nonce:     authNoncePrefix + id,
+		IssuedAt:  moduleClock.Now().Unix(),
+		ExpiresAt: moduleClock.Now().Add(authNonceTTL).Unix(),
+	}
+	value, err := json.Marshal(record)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Nonce encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: authNonceCollection,
+		Key:        record.Nonce,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Nonce write failed: %v", err)
+		return "", rpcError(errCodeInternal, "Nonce issuance failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"nonce":     record.Nonce,
+		"expiresAt": record.ExpiresAt,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
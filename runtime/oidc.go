@@ -0,0 +1,96 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// The issuer's OIDC discovery document is fetched at init so non-Cognito
+// issuers with different endpoint layouts work without config overrides.
+// Discovery failure falls back to the Cognito JWKS convention.
+
+// oidcDiscovery is the subset of the discovery document the module uses.
+type oidcDiscovery struct {
+	Issuer          string   `json:"issuer"`
+	JWKSURI         string   `json:"jwks_uri"`
+	IDTokenAlgs     []string `json:"id_token_signing_alg_values_supported"`
+	ClaimsSupported []string `json:"claims_supported"`
+}
+
+// idTokenAlgs are the signing algorithms accepted for ID tokens. The default
+// is RS256; discovery narrows or widens it within the RSA family, which is
+// all the JWKS cache can serve.
+var idTokenAlgs = []string{"RS256"}
+
+// rsaAlgs is the set of JWS algorithms the module can actually verify.
+var rsaAlgs = map[string]bool{"RS256": true, "RS384": true, "RS512": true}
+
+// discoverOIDC fetches and validates the issuer's discovery document.
+func discoverOIDC(issuer string) (*oidcDiscovery, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery returned status %d", resp.StatusCode)
+	}
+
+	doc := &oidcDiscovery{}
+	if err := json.NewDecoder(resp.Body).Decode(doc); err != nil {
+		return nil, fmt.Errorf("oidc: discovery decode failed: %w", err)
+	}
+	if doc.JWKSURI == "" {
+		return nil, fmt.Errorf("oidc: discovery document has no jwks_uri")
+	}
+	if doc.Issuer != "" && doc.Issuer != issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match configured issuer %q", doc.Issuer, issuer)
+	}
+	return doc, nil
+}
+
+// resolveJWKSURL discovers the issuer's JWKS endpoint and token algorithms,
+// falling back to the Cognito convention when discovery fails. The config is
+// passed in because this runs during instance construction; see instance.go.
+func resolveJWKSURL(c *Config, logger nkruntime.Logger) string {
+	doc, err := discoverOIDC(c.Issuer())
+	if err != nil {
+		logger.Warn("OIDC discovery failed, falling back to Cognito JWKS convention: %v", err)
+		return c.JWKSURL()
+	}
+
+	if len(doc.IDTokenAlgs) > 0 {
+		algs := make([]string, 0, len(doc.IDTokenAlgs))
+		for _, alg := range doc.IDTokenAlgs {
+			if rsaAlgs[alg] {
+				algs = append(algs, alg)
+			}
+		}
+		if len(algs) > 0 {
+			idTokenAlgs = algs
+		}
+	}
+	logger.Info("OIDC discovery ok, jwks_uri: %v, algorithms: %v, claims: %v",
+		doc.JWKSURI, idTokenAlgs, len(doc.ClaimsSupported))
+	return doc.JWKSURI
+}
@@ -0,0 +1,142 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Partner services — tournament platforms, airdrop operators — need to check
+// that a custodial address really belongs to a given player without calling
+// back into the module per request. rpc_get_ownership_proof issues them a
+// self-contained bundle signed twice: the wallet key signs it personal_sign
+// style, so anyone can recover the signature against the bundled address,
+// and the server countersigns with HMAC-SHA256 under a secret shared with
+// partners, binding the bundle to this deployment. The Cognito subject rides
+// along as a hash so partners can correlate a player across proofs without
+// receiving the subject itself.
+
+// proofVersion stamps bundles so partners can handle format changes.
+const proofVersion = 1
+
+// proofTTL bounds how long partners should accept a bundle.
+const proofTTL = 15 * time.Minute
+
+// ownershipBundle is the signed document. Signatures cover its canonical
+// JSON encoding (sorted keys, no insignificant whitespace; see canonjson.go).
+type ownershipBundle struct {
+	Version   int    `json:"version"`
+	Address   string `json:"address"`
+	UserID    string `json:"userId"`
+	SubHash   string `json:"subHash"`
+	ChainID   int64  `json:"chainId"`
+	IssuedAt  int64  `json:"issuedAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// ownershipWalletSign signs the digest with the wallet's key, routing per-key
+// and derived wallets the same way the transaction path does; see evm.go.
+func ownershipWalletSign(ctx context.Context, wallet *Wallet, digest []byte) ([]byte, error) {
+	sctx := signingContextFor(wallet, signPurposeOwnershipProof)
+	if wallet.KeyARN != "" {
+		signer, err := perUserKeySigner(ctx, wallet.Backend)
+		if err != nil {
+			return nil, err
+		}
+		return signer.SignWithKey(ctx, wallet.KeyARN, digest, sctx)
+	}
+	signer, err := GetKMSSigner(ctx, wallet.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return signer.SignDigest(ctx, wallet.DerivationIndex, digest, sctx)
+}
+
+// rpcGetOwnershipProof returns a dual-signed proof that the caller's
+// custodial address belongs to their account.
+func rpcGetOwnershipProof(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if cfg.ProofSigningSecret == "" {
+		return "", rpcError(errCodeBadInput, "Ownership proofs are not configured on this deployment.", codes.FailedPrecondition)
+	}
+	if err := checkAgeWalletAccess(ctx, nk, userID); err != nil {
+		return "", err
+	}
+
+	wallet, err := ensureWallet(ctx, logger, nk, userID)
+	if err != nil {
+		return "", err
+	}
+
+	subHash := sha256.Sum256([]byte(wallet.ExternalID))
+	now := moduleClock.Now().Unix()
+	bundle := &ownershipBundle{
+		Version:   proofVersion,
+		Address:   wallet.Address,
+		UserID:    userID,
+		SubHash:   hex.EncodeToString(subHash[:]),
+		ChainID:   cfg.EVMChainID,
+		IssuedAt:  now,
+		ExpiresAt: now + int64(proofTTL/time.Second),
+	}
+	canonical, err := canonicalJSON(bundle)
+	if err != nil {
+		return "", err
+	}
+
+	walletSig, err := ownershipWalletSign(ctx, wallet, personalSignDigest(canonical))
+	if err != nil {
+		return "", fmt.Errorf("proof signing failed: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.ProofSigningSecret))
+	mac.Write(canonical)
+	serverSig := mac.Sum(nil)
+
+	// Proof issuance is a user flow; a failed audit write degrades to a
+	// warning rather than refusing the proof.
+	if err := appendAudit(ctx, nk, "proof.issued", userID, map[string]interface{}{
+		"address":   wallet.Address,
+		"expiresAt": bundle.ExpiresAt,
+	}); err != nil {
+		logger.Warn("Audit write for ownership proof failed: %v", err)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"bundle": bundle,
+		// Partners verify walletSignature by recovering the personal_sign
+		// digest of the bundle's canonical JSON against bundle.address, and
+		// serverSignature as HMAC-SHA256 of the same bytes under the shared
+		// secret.
+		"walletSignature": "0x" + hex.EncodeToString(walletSig),
+		"serverSignature": hex.EncodeToString(serverSig),
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
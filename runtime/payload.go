@@ -0,0 +1,159 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// Every registered RPC runs behind a payload guard: oversized payloads are
+// rejected before any handler work, and JSON payloads are scanned for the
+// two shapes handlers never produce legitimately but attackers do — deep
+// nesting that burns CPU in the decoder, and duplicate object keys whose
+// last-wins resolution can smuggle a second value past validation that only
+// looked at the first. Handlers decode through unmarshalPayload, which adds
+// an opt-in strict mode rejecting fields the request schema doesn't declare.
+
+const (
+	// payloadDefaultMaxBytes caps RPC payloads unless overridden per RPC.
+	payloadDefaultMaxBytes = 256 * 1024
+	// payloadDefaultMaxDepth caps JSON nesting; module schemas are at most a
+	// few levels deep, so the ceiling is generous.
+	payloadDefaultMaxDepth = 32
+)
+
+var metricPayloadRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "nakama_module_payload_rejected_total",
+	Help: "RPC payloads rejected by the payload guard, by reason.",
+}, []string{"reason"})
+
+func init() {
+	metricsRegistry.MustRegister(metricPayloadRejected)
+}
+
+// payloadLimitFor resolves the byte cap for an RPC: the per-RPC override
+// when configured, else the default. Zero disables the cap.
+func payloadLimitFor(name string) int {
+	if limit, ok := cfg.PayloadLimits[name]; ok {
+		return limit
+	}
+	return cfg.MaxPayloadBytes
+}
+
+// sanitizeJSONPayload walks the payload's token stream, rejecting malformed
+// JSON, nesting beyond the configured depth and duplicate keys within an
+// object. Non-JSON payloads are the handler's problem; the scan only runs on
+// payloads that look like JSON.
+func sanitizeJSONPayload(payload string) error {
+	trimmed := strings.TrimSpace(payload)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return nil
+	}
+
+	type frame struct {
+		object    bool
+		keys      map[string]bool
+		expectKey bool
+	}
+	var stack []frame
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			// Token reports plain EOF even mid-container; unclosed nesting is
+			// truncated input, not a complete payload.
+			if len(stack) != 0 {
+				return fmt.Errorf("payload is not valid JSON")
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("payload is not valid JSON")
+		}
+		// A composite or scalar token fills the value slot of an enclosing
+		// object, re-arming that object's key expectation.
+		markValue := func() {
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].expectKey = true
+			}
+		}
+		switch t := tok.(type) {
+		case json.Delim:
+			switch t {
+			case '{', '[':
+				markValue()
+				stack = append(stack, frame{object: t == '{', keys: map[string]bool{}, expectKey: true})
+				if cfg.PayloadMaxDepth > 0 && len(stack) > cfg.PayloadMaxDepth {
+					return fmt.Errorf("payload exceeds %d levels of nesting", cfg.PayloadMaxDepth)
+				}
+			case '}', ']':
+				stack = stack[:len(stack)-1]
+			}
+		default:
+			top := len(stack) - 1
+			if top >= 0 && stack[top].object && stack[top].expectKey {
+				key, _ := t.(string)
+				if stack[top].keys[key] {
+					return fmt.Errorf("payload repeats the key %q", key)
+				}
+				stack[top].keys[key] = true
+				stack[top].expectKey = false
+				continue
+			}
+			markValue()
+		}
+	}
+}
+
+// withPayloadGuard enforces the size cap and JSON sanitization for one RPC.
+// Applied to every registration; see initModule.
+func withPayloadGuard(name string, fn func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error)) func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+		if limit := payloadLimitFor(name); limit > 0 && len(payload) > limit {
+			metricPayloadRejected.WithLabelValues("size").Inc()
+			return "", rpcError(errCodeBadInput,
+				fmt.Sprintf("Payload exceeds the %d byte limit for this RPC.", limit), codes.InvalidArgument)
+		}
+		if err := sanitizeJSONPayload(payload); err != nil {
+			metricPayloadRejected.WithLabelValues("shape").Inc()
+			return "", rpcError(errCodeBadInput, fmt.Sprintf("Malformed payload: %v.", err), codes.InvalidArgument)
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
+
+// unmarshalPayload decodes an RPC request payload. With strict fields
+// configured, payloads carrying fields the request schema doesn't declare
+// are rejected instead of silently dropped. Payloads from external systems
+// (provider webhooks) decode with plain json.Unmarshal since their schemas
+// are not ours to pin.
+func unmarshalPayload(payload string, v interface{}) error {
+	if cfg.PayloadStrictFields {
+		dec := json.NewDecoder(strings.NewReader(payload))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+	return json.Unmarshal([]byte(payload), v)
+}
@@ -0,0 +1,56 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeJSONPayload(t *testing.T) {
+	prevCfg := cfg
+	t.Cleanup(func() { cfg = prevCfg })
+	cfg = &Config{PayloadMaxDepth: 4}
+
+	for _, tc := range []struct {
+		name    string
+		payload string
+		ok      bool
+	}{
+		{"empty", "", true},
+		{"non-JSON", "plain text", true},
+		{"flat object", `{"a":1,"b":"x"}`, true},
+		{"array of objects", `[{"a":1},{"a":2}]`, true},
+		{"same key in sibling objects", `{"a":{"k":1},"b":{"k":2}}`, true},
+		{"key repeated as value", `{"a":"a"}`, true},
+		{"at depth limit", `{"a":{"b":{"c":{"d":1}}}}`, true},
+		{"malformed", `{"a":`, false},
+		{"trailing garbage", `{"a":1}}`, false},
+		{"duplicate key", `{"a":1,"a":2}`, false},
+		{"duplicate key nested", `{"a":{"b":1,"b":2}}`, false},
+		{"over depth limit", `{"a":{"b":{"c":{"d":{"e":1}}}}}`, false},
+		{"deep array nesting", strings.Repeat("[", 5) + strings.Repeat("]", 5), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := sanitizeJSONPayload(tc.payload)
+			if tc.ok && err != nil {
+				t.Fatalf("rejected valid payload: %v", err)
+			}
+			if !tc.ok && err == nil {
+				t.Fatal("accepted invalid payload")
+			}
+		})
+	}
+}
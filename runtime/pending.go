@@ -0,0 +1,171 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Each user may have only a bounded number of unconfirmed transactions in
+// flight. Beyond rate limiting, the cap keeps nonce chains shallow — a deep
+// chain behind one stuck transaction can strand funds. Sign requests reserve
+// a slot before signing; the watcher releases it when it reports the terminal
+// status via rpc_admin_mark_tx_status.
+
+const pendingTxKey = "pending_tx"
+
+// pendingTxRecord counts a user's in-flight transactions.
+type pendingTxRecord struct {
+	Count     int   `json:"count"`
+	UpdatedAt int64 `json:"updatedAt"`
+}
+
+// adjustPendingTx applies delta to the user's in-flight count. With a
+// positive delta and a configured cap, the adjustment fails with
+// TOO_MANY_PENDING when the cap is already reached.
+func adjustPendingTx(ctx context.Context, nk nkruntime.NakamaModule, userID string, delta int) error {
+	for attempt := 0; attempt < 5; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: walletMetaCollection,
+			Key:        pendingTxKey,
+			UserID:     userID,
+		}})
+		if err != nil {
+			return err
+		}
+
+		record := &pendingTxRecord{}
+		version := "*"
+		if len(objects) > 0 {
+			if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+				return fmt.Errorf("pending tx record corrupt for user %s: %w", userID, err)
+			}
+			version = objects[0].Version
+		}
+
+		if delta > 0 && cfg.MaxInFlightTx > 0 && record.Count >= cfg.MaxInFlightTx {
+			return rpcError(errCodeTooManyPending,
+				fmt.Sprintf("Too many pending transactions (%d in flight, cap %d).", record.Count, cfg.MaxInFlightTx),
+				codes.ResourceExhausted)
+		}
+		record.Count += delta
+		if record.Count < 0 {
+			record.Count = 0
+		}
+		record.UpdatedAt = moduleClock.Now().Unix()
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: walletMetaCollection,
+			Key:        pendingTxKey,
+			UserID:     userID,
+			Value:      string(value),
+			Version:    version,
+		}}); err != nil {
+			continue // CAS race, retry.
+		}
+		return nil
+	}
+	return fmt.Errorf("pending tx contention for user %s, giving up", userID)
+}
+
+// rpcAdminMarkTxStatus records the terminal status the watcher observed for a
+// transaction, releases its in-flight slot and notifies the user's sessions.
+func rpcAdminMarkTxStatus(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID string `json:"userId"`
+		TxID   string `json:"txId"`
+		Status string `json:"status"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" || req.TxID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId, txId and status.", codes.InvalidArgument)
+	}
+	if req.Status != txStatusConfirmed && req.Status != txStatusFailed {
+		return "", rpcError(errCodeBadInput, "Status must be confirmed or failed.", codes.InvalidArgument)
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: tenantCollection(ctx, txCollection),
+		Key:        req.TxID,
+		UserID:     req.UserID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "Transaction record not found.", codes.NotFound)
+	}
+	record := &TransactionRecord{}
+	if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+		logger.Error("Transaction record corrupt at %v: %v", req.TxID, err)
+		return "", rpcError(errCodeInternal, "Transaction record corrupt.", codes.Internal)
+	}
+	if record.Status != txStatusSigned && record.Status != txStatusBroadcast {
+		return "", rpcError(errCodeBadInput, "Transaction already has a terminal status.", codes.FailedPrecondition)
+	}
+
+	record.Status = req.Status
+	value, err := json.Marshal(record)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Record encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     tenantCollection(ctx, txCollection),
+		Key:            record.ID,
+		UserID:         req.UserID,
+		Value:          string(value),
+		Version:        objects[0].Version,
+		PermissionRead: 1,
+	}}); err != nil {
+		logger.Error("Transaction status write failed for %v: %v", req.TxID, err)
+		return "", rpcError(errCodeInternal, "Status update failed.", codes.Internal)
+	}
+
+	if err := adjustPendingTx(ctx, nk, req.UserID, -1); err != nil {
+		logger.Warn("Pending count release failed for user %v: %v", req.UserID, err)
+	}
+	cacheInvalidateCluster(ctx, logger, nk, req.UserID, "tx_status")
+	if req.Status == txStatusConfirmed {
+		// Best effort; progression bookkeeping must not fail confirmation.
+		if err := recordTxMilestones(ctx, logger, nk, req.UserID, record); err != nil {
+			logger.Warn("Milestone update failed for user %v: %v", req.UserID, err)
+		}
+	}
+	eventDetails := map[string]interface{}{"txId": record.ID, "hash": record.Hash}
+	if record.Category != "" {
+		eventDetails["category"] = record.Category
+	}
+	if link := explorerTxURL(record.ChainID, record.Hash); link != "" {
+		eventDetails["explorerUrl"] = link
+	}
+	if err := pushWalletEvent(ctx, nk, req.UserID, &WalletEvent{
+		Type:    "tx." + req.Status,
+		Details: eventDetails,
+	}); err != nil {
+		logger.Warn("Wallet event push failed for tx %v: %v", record.ID, err)
+	}
+
+	return `{"updated":true}`, nil
+}
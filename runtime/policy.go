@@ -0,0 +1,60 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"math/big"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// The policy engine runs before any transaction is signed. Checks accumulate
+// here as policies are added; each returns a structured error the client can
+// act on, or nil to allow signing to proceed.
+
+// evaluateTransactionPolicy applies all configured policy checks to a
+// transaction about to be signed for the user.
+func evaluateTransactionPolicy(ctx context.Context, nk nkruntime.NakamaModule, userID string, value *big.Int) error {
+	if err := checkKYCPolicy(ctx, nk, userID, value); err != nil {
+		return err
+	}
+	if err := checkJurisdiction(ctx, nk, userID, geoOpTransfer); err != nil {
+		return err
+	}
+	if err := checkAgeSigningPolicy(ctx, nk, userID, value); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkKYCPolicy requires an approved KYC status for transactions at or above
+// the configured value threshold. No threshold configured means no gating.
+// Tenants can carry their own threshold; see tenant.go.
+func checkKYCPolicy(ctx context.Context, nk nkruntime.NakamaModule, userID string, value *big.Int) error {
+	threshold := tenantKYCThreshold(ctx)
+	if threshold == nil || value.Cmp(threshold) < 0 {
+		return nil
+	}
+	status, err := getKYCStatus(ctx, nk, userID)
+	if err != nil {
+		return rpcError(errCodeInternal, "KYC lookup failed.", codes.Internal)
+	}
+	if status.Status != kycStatusApproved {
+		return rpcError(errCodeKYCRequired, "Transaction value requires approved KYC verification.", codes.FailedPrecondition)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Global audiences want values in their own currency. Preferences are stored
+// per user and shared across their devices: the display currency steers every
+// price-feed conversion (statements, fee estimates), while the locale is the
+// client's cue for number and date formatting.
+
+const (
+	prefsCollection = "preferences"
+	prefsKey        = "prefs"
+)
+
+var (
+	// prefsLocalePattern accepts BCP 47-shaped tags like "en", "pt-BR" or
+	// "zh-Hant-TW" without enumerating the registry.
+	prefsLocalePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	// prefsCurrencyPattern accepts ISO 4217 alphabetic codes.
+	prefsCurrencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// UserPreferences are the stored display preferences for one user.
+type UserPreferences struct {
+	// Locale is a BCP 47 language tag, empty for the client default.
+	Locale string `json:"locale,omitempty"`
+	// FiatCurrency is the ISO 4217 code fiat valuations are requested in,
+	// empty for the price feed's default currency.
+	FiatCurrency string `json:"fiatCurrency,omitempty"`
+	// WeeklyInsights opts the user into the weekly spending summary
+	// notification; see insights.go.
+	WeeklyInsights bool  `json:"weeklyInsights,omitempty"`
+	UpdatedAt      int64 `json:"updatedAt,omitempty"`
+}
+
+// userPreferences loads a user's stored preferences; absence and read errors
+// both fall back to defaults so display conversion never blocks a read path.
+func userPreferences(ctx context.Context, nk nkruntime.NakamaModule, userID string) *UserPreferences {
+	prefs := &UserPreferences{}
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: prefsCollection,
+		Key:        prefsKey,
+		UserID:     userID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return prefs
+	}
+	if err := json.Unmarshal([]byte(objects[0].Value), prefs); err != nil {
+		return &UserPreferences{}
+	}
+	return prefs
+}
+
+// rpcSetPreferences stores the calling user's locale and display currency.
+// Empty fields clear back to the defaults.
+func rpcSetPreferences(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	req := &UserPreferences{}
+	if err := unmarshalPayload(payload, req); err != nil {
+		return "", rpcError(errCodeBadInput, "Malformed preferences request.", codes.InvalidArgument)
+	}
+
+	req.FiatCurrency = strings.ToUpper(strings.TrimSpace(req.FiatCurrency))
+	req.Locale = strings.TrimSpace(req.Locale)
+	if req.Locale != "" && !prefsLocalePattern.MatchString(req.Locale) {
+		return "", rpcError(errCodeBadInput, "Locale must be a BCP 47 language tag.", codes.InvalidArgument)
+	}
+	if req.FiatCurrency != "" && !prefsCurrencyPattern.MatchString(req.FiatCurrency) {
+		return "", rpcError(errCodeBadInput, "Display currency must be a three-letter ISO 4217 code.", codes.InvalidArgument)
+	}
+	req.UpdatedAt = moduleClock.Now().Unix()
+
+	value, err := json.Marshal(req)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     prefsCollection,
+		Key:            prefsKey,
+		UserID:         userID,
+		Value:          string(value),
+		PermissionRead: 1,
+	}}); err != nil {
+		logger.Error("Preferences write failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Preferences could not be saved.", codes.Internal)
+	}
+	return string(value), nil
+}
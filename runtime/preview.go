@@ -0,0 +1,164 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Users can see their future wallet address before opting into custody. In
+// derived key mode the address is fixed by the derivation index, so the
+// preview reserves an index for the identity and derives the address from it
+// without writing a wallet record; first provisioning consumes the
+// reservation, which makes the preview and the eventual address identical.
+// Per-user key mode creates a fresh KMS key at provisioning time, so no
+// address exists to preview there.
+
+const (
+	previewCollection = "wallet_previews"
+	previewKey        = "preview"
+)
+
+// walletPreview reserves a derivation index for a not-yet-provisioned
+// default wallet.
+type walletPreview struct {
+	DerivationIndex uint32 `json:"derivationIndex"`
+	Address         string `json:"address"`
+	CreatedAt       int64  `json:"createdAt"`
+}
+
+// getWalletPreview reads a user's address reservation, nil when absent.
+func getWalletPreview(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*walletPreview, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: tenantCollection(ctx, previewCollection),
+		Key:        previewKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	preview := &walletPreview{}
+	if err := json.Unmarshal([]byte(objects[0].Value), preview); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// reserveWalletPreview allocates a derivation index and records it for the
+// user. A concurrent reservation loses the create-only write and re-reads the
+// winner, so repeated calls return one stable address.
+func reserveWalletPreview(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*walletPreview, error) {
+	index, err := nextDerivationIndex(ctx, nk)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := GetKMSSigner(ctx, cfg.KMSDefaultBackend)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := signer.PublicKey(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	preview := &walletPreview{
+		DerivationIndex: index,
+		Address:         ethereumAddress(pub),
+		CreatedAt:       moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(preview)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: tenantCollection(ctx, previewCollection),
+		Key:        previewKey,
+		UserID:     userID,
+		Value:      string(value),
+		Version:    "*",
+	}}); err != nil {
+		existing, readErr := getWalletPreview(ctx, nk, userID)
+		if readErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+	return preview, nil
+}
+
+// consumeWalletPreview removes a user's reservation after provisioning. The
+// index is already bound to the wallet record, so failure here is harmless.
+func consumeWalletPreview(ctx context.Context, nk nkruntime.NakamaModule, userID string) {
+	_ = nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: tenantCollection(ctx, previewCollection),
+		Key:        previewKey,
+		UserID:     userID,
+	}})
+}
+
+// rpcPreviewWalletAddress returns the address the authenticated user's
+// default wallet will have once provisioned, without provisioning it.
+func rpcPreviewWalletAddress(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	resp := struct {
+		Address string `json:"address"`
+		// Preview is false once the wallet actually exists.
+		Preview     bool   `json:"preview"`
+		ExplorerURL string `json:"explorerUrl,omitempty"`
+	}{}
+
+	// An existing wallet is its own best preview.
+	wallet, err := getWalletLabeled(ctx, nk, userID, "")
+	if err != nil {
+		return "", err
+	}
+	if wallet != nil {
+		resp.Address = wallet.Address
+	} else {
+		if cfg.WalletKeyMode == walletKeyModePerUser {
+			return "", rpcError(errCodeBadInput,
+				"Address preview is unavailable: per-user keys are created at provisioning time.", codes.FailedPrecondition)
+		}
+		preview, err := getWalletPreview(ctx, nk, userID)
+		if err != nil {
+			return "", err
+		}
+		if preview == nil {
+			if preview, err = reserveWalletPreview(ctx, nk, userID); err != nil {
+				return "", err
+			}
+		}
+		resp.Address = preview.Address
+		resp.Preview = true
+	}
+	resp.ExplorerURL = explorerAddressURL(cfg.EVMChainID, resp.Address)
+
+	encoded, err := json.Marshal(&resp)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// The dispatcher's in-memory public key cache (see kmsbudget.go) is cold
+// after every restart, and for backends where computing a signature's
+// recovery ID needs the public key, that cold start puts a GetPublicKey
+// round trip inside the first sign of every wallet. This file adds the
+// persistent layer: public keys are written to storage keyed by the wallet's
+// external ID when a wallet is provisioned or rotated, and primed back into
+// the dispatcher cache on wallet reads. Entries are validated against the
+// wallet address on both sides, so a stale or corrupted entry can never
+// produce a key the wallet doesn't hash to; validation failure just falls
+// back to the backend lookup.
+
+const pubKeyCacheCollection = "pubkey_cache"
+
+// pubKeyCacheEntry is one wallet's cached public key. PublicKey is the
+// uncompressed hex encoding; Address binds the entry to the wallet it was
+// warmed for.
+type pubKeyCacheEntry struct {
+	ExternalID string `json:"externalId"`
+	Label      string `json:"label,omitempty"`
+	Address    string `json:"address"`
+	PublicKey  string `json:"publicKey"`
+	WarmedAt   int64  `json:"warmedAt"`
+}
+
+// pubKeyCacheKey is the storage key for a wallet's entry.
+func pubKeyCacheKey(wallet *Wallet) string {
+	return wallet.ExternalID + "/" + walletKey(wallet.Label)
+}
+
+// dispatcherCacheKey mirrors the dispatcher's in-memory cache keying.
+func dispatcherCacheKey(wallet *Wallet) string {
+	if wallet.KeyARN != "" {
+		return "arn/" + wallet.KeyARN
+	}
+	return fmt.Sprintf("index/%d", wallet.DerivationIndex)
+}
+
+// warmPublicKeyCache fetches a wallet's public key through the dispatcher and
+// persists it. Best effort: warming exists to cut latency, never to gate a
+// flow.
+func warmPublicKeyCache(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, wallet *Wallet) {
+	var pub []byte
+	if wallet.KeyARN != "" {
+		// Per-user keys return their public key at creation; the dispatcher
+		// already caches it under the ARN, so read it back from there.
+		signer, err := GetKMSSigner(ctx, wallet.Backend)
+		if err != nil {
+			return
+		}
+		dispatcher, ok := signer.(*kmsDispatcher)
+		if !ok {
+			return
+		}
+		cached, ok := dispatcher.pubCache.Load("arn/" + wallet.KeyARN)
+		if !ok {
+			return
+		}
+		pub = cached.([]byte)
+	} else {
+		signer, err := GetKMSSigner(ctx, wallet.Backend)
+		if err != nil {
+			return
+		}
+		fetched, err := signer.PublicKey(ctx, wallet.DerivationIndex)
+		if err != nil {
+			logger.Warn("Public key warm fetch failed for wallet %v: %v", wallet.Address, err)
+			return
+		}
+		pub = fetched
+	}
+	if !strings.EqualFold(ethereumAddress(pub), wallet.Address) {
+		logger.Warn("Public key warm for wallet %v does not hash to its address, skipping", wallet.Address)
+		return
+	}
+
+	entry := &pubKeyCacheEntry{
+		ExternalID: wallet.ExternalID,
+		Label:      wallet.Label,
+		Address:    wallet.Address,
+		PublicKey:  hex.EncodeToString(pub),
+		WarmedAt:   moduleClock.Now().Unix(),
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: pubKeyCacheCollection,
+		Key:        pubKeyCacheKey(wallet),
+		Value:      string(value),
+	}}); err != nil {
+		logger.Warn("Public key cache write failed for wallet %v: %v", wallet.Address, err)
+	}
+}
+
+// primePublicKeyCache loads a wallet's persisted public key into the
+// dispatcher's in-memory cache, so the first sign after a restart skips the
+// backend lookup. Missing or invalid entries are re-warmed. Best effort.
+func primePublicKeyCache(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, wallet *Wallet) {
+	signer, err := GetKMSSigner(ctx, wallet.Backend)
+	if err != nil {
+		return
+	}
+	dispatcher, ok := signer.(*kmsDispatcher)
+	if !ok {
+		return
+	}
+	if _, ok := dispatcher.pubCache.Load(dispatcherCacheKey(wallet)); ok {
+		return
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: pubKeyCacheCollection,
+		Key:        pubKeyCacheKey(wallet),
+	}})
+	if err != nil || len(objects) == 0 {
+		warmPublicKeyCache(ctx, logger, nk, wallet)
+		return
+	}
+	entry := &pubKeyCacheEntry{}
+	if err := json.Unmarshal([]byte(objects[0].Value), entry); err != nil {
+		warmPublicKeyCache(ctx, logger, nk, wallet)
+		return
+	}
+	pub, err := hex.DecodeString(entry.PublicKey)
+	// A rotation changes the address, so an entry warmed for the old key
+	// fails this check and is replaced rather than primed.
+	if err != nil || !strings.EqualFold(entry.Address, wallet.Address) ||
+		!strings.EqualFold(ethereumAddress(pub), wallet.Address) {
+		warmPublicKeyCache(ctx, logger, nk, wallet)
+		return
+	}
+	dispatcher.pubCache.Store(dispatcherCacheKey(wallet), pub)
+}
@@ -0,0 +1,165 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Data platforms that consume from SQS get wallet events through an SNS
+// topic instead of (or alongside) the HTTP webhook. Events are buffered and
+// flushed as PublishBatch calls — SNS caps a batch at ten entries — with a
+// bounded retry per batch. Like the other AWS touchpoints in this module the
+// endpoint speaks the service's wire protocol and is fronted by a
+// credential-holding proxy; see status.go for the same arrangement.
+
+const (
+	// snsBatchMax is the SNS PublishBatch entry limit.
+	snsBatchMax = 10
+	// snsFlushInterval bounds how long a buffered event waits for a batch.
+	snsFlushInterval = time.Second
+	snsPublishRetry  = 3
+	snsTimeout       = 5 * time.Second
+	// snsBufferCap sheds events instead of growing without bound when the
+	// endpoint is down; deliveries are best effort like the HTTP webhook.
+	snsBufferCap = 1000
+)
+
+// snsEntry is one buffered event awaiting a batch.
+type snsEntry struct {
+	ID      string
+	Message string
+}
+
+// snsPublisher batches wallet events onto the configured SNS topic.
+type snsPublisher struct {
+	logger nkruntime.Logger
+
+	mu     sync.Mutex
+	buffer []snsEntry
+}
+
+// eventPublisher is nil unless NAKAMA_SNS_TOPIC_ARN is configured.
+var eventPublisher *snsPublisher
+
+// enqueue buffers one event for the next batch flush.
+func (p *snsPublisher) enqueue(message string) {
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		p.logger.Warn("SNS entry ID generation failed: %v", err)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buffer) >= snsBufferCap {
+		p.logger.Warn("SNS buffer full, dropping event %v", id)
+		return
+	}
+	p.buffer = append(p.buffer, snsEntry{ID: id, Message: message})
+}
+
+// run flushes batches until the module context ends.
+func (p *snsPublisher) run(ctx context.Context) {
+	ticker := time.NewTicker(snsFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.flush(ctx)
+		}
+	}
+}
+
+// flush drains the buffer in batch-sized chunks.
+func (p *snsPublisher) flush(ctx context.Context) {
+	for {
+		p.mu.Lock()
+		if len(p.buffer) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		n := len(p.buffer)
+		if n > snsBatchMax {
+			n = snsBatchMax
+		}
+		batch := p.buffer[:n]
+		p.buffer = p.buffer[n:]
+		p.mu.Unlock()
+
+		if err := p.publishBatch(ctx, batch); err != nil {
+			p.logger.Warn("SNS publish failed, dropping %d events: %v", len(batch), err)
+		}
+	}
+}
+
+// publishBatch posts one PublishBatch call, retrying transient failures.
+func (p *snsPublisher) publishBatch(ctx context.Context, batch []snsEntry) error {
+	form := url.Values{
+		"Action":   {"PublishBatch"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {cfg.SNSTopicARN},
+	}
+	for i, entry := range batch {
+		member := "PublishBatchRequestEntries.member." + strconv.Itoa(i+1)
+		form.Set(member+".Id", entry.ID)
+		form.Set(member+".Message", entry.Message)
+	}
+	body := form.Encode()
+
+	var lastErr error
+	for attempt := 0; attempt < snsPublishRetry; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		callCtx, cancel := context.WithTimeout(ctx, snsTimeout)
+		req, err := http.NewRequestWithContext(callCtx, http.MethodPost, cfg.SNSEndpointURL, strings.NewReader(body))
+		if err != nil {
+			cancel()
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := http.DefaultClient.Do(req)
+		cancel()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			return nil
+		}
+		lastErr = fmt.Errorf("publish returned HTTP %d", resp.StatusCode)
+		// Client errors won't improve on retry.
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+			return lastErr
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,125 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Companion apps — web portals, stat trackers — embed wallet views but must
+// never sign. A logged-in game session can mint a short-lived read-only
+// session bound to a device: the token carries a wallet:read scope var and a
+// companion audience var, and every signing RPC refuses it. Read-only
+// sessions cannot mint further sessions, so a leaked companion token never
+// escalates.
+
+const (
+	sessionScopeVar    = "wallet_scope"
+	scopeWalletRead    = "wallet:read"
+	sessionAudienceVar = "aud"
+	readonlyAudience   = "companion"
+	sessionDeviceVar   = "device"
+
+	readonlySessionTTL = 1 * time.Hour
+)
+
+// sessionReadOnly reports whether the calling session carries the read-only
+// wallet scope.
+func sessionReadOnly(ctx context.Context) bool {
+	vars, _ := ctx.Value(nkruntime.RUNTIME_CTX_VARS).(map[string]string)
+	return vars[sessionScopeVar] == scopeWalletRead
+}
+
+// requireSigningSession guards RPCs that sign or mutate wallet state against
+// read-only companion sessions.
+func requireSigningSession(ctx context.Context) error {
+	if sessionReadOnly(ctx) {
+		return rpcError(errCodePermissionDenied, "RPC is not available to read-only companion sessions.", codes.PermissionDenied)
+	}
+	return nil
+}
+
+// ReadonlySessionResponse is the rpc_issue_readonly_session response body.
+type ReadonlySessionResponse struct {
+	Token     string `json:"token"`
+	DeviceID  string `json:"deviceId"`
+	ExpiresAt int64  `json:"expiresAt"`
+}
+
+// rpcIssueReadonlySession mints a wallet:read-only session for a companion
+// device on behalf of the calling user.
+func rpcIssueReadonlySession(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireSigningSession(ctx); err != nil {
+		// A read-only session refreshing itself would defeat the TTL.
+		return "", err
+	}
+
+	var req struct {
+		DeviceID string `json:"deviceId"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.DeviceID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a deviceId to bind the session to.", codes.InvalidArgument)
+	}
+
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		logger.Error("Account lookup failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Account lookup failed.", codes.Internal)
+	}
+
+	vars := map[string]string{
+		sessionScopeVar:    scopeWalletRead,
+		sessionAudienceVar: readonlyAudience,
+		sessionDeviceVar:   req.DeviceID,
+	}
+	if tenant := tenantFromContext(ctx); tenant != "" {
+		vars[sessionTenantVar] = tenant
+	}
+
+	expiresAt := moduleClock.Now().Add(readonlySessionTTL).Unix()
+	token, _, err := nk.AuthenticateTokenGenerate(userID, account.GetUser().GetUsername(), expiresAt, vars)
+	if err != nil {
+		logger.Error("Read-only session generation failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Session creation failed.", codes.Internal)
+	}
+
+	// Best effort; issuance is visible in the audit trail, not gated on it.
+	if err := appendAudit(ctx, nk, "session.readonly_issued", userID, map[string]interface{}{
+		"device":    req.DeviceID,
+		"expiresAt": expiresAt,
+	}); err != nil {
+		logger.Warn("Audit append failed for read-only session of user %v: %v", userID, err)
+	}
+
+	out, err := json.Marshal(&ReadonlySessionResponse{
+		Token:     token,
+		DeviceID:  req.DeviceID,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,280 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Games bridging virtual currency to tokens accumulate three views of the
+// same value: the virtual balances in Nakama's user wallets, the bridge
+// ledger entries recorded as value crosses, and the actual on-chain treasury
+// balances. A nightly leased worker sums all three, writes a reconciliation
+// report, and alerts the ops webhook when the views disagree beyond the
+// configured tolerance. Bridge ledger entries are written by the bridge
+// watcher, which like the chain watcher runs out of process.
+
+const (
+	bridgeLedgerCollection  = "bridge_ledger"
+	reconcileReportsCollect = "reconciliation_reports"
+
+	reconcileInterval  = 24 * time.Hour
+	reconcileTimeout   = 2 * time.Minute
+	reconcileRPCLimit  = 10 * time.Second
+	reconcileLedgerCap = 100000
+)
+
+var metricReconcileRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "nakama_module_reconcile_runs_total",
+	Help: "Reconciliation passes by outcome.",
+}, []string{"outcome"})
+
+func init() {
+	metricsRegistry.MustRegister(metricReconcileRuns)
+}
+
+// bridgeLedgerEntry is one recorded crossing. Direction "in" moves value
+// into the treasury (virtual currency minted against a deposit), "out" moves
+// it back out (burn and withdraw).
+type bridgeLedgerEntry struct {
+	ID        string `json:"id"`
+	Direction string `json:"direction"`
+	AmountWei string `json:"amountWei"`
+	Hash      string `json:"hash,omitempty"`
+	At        int64  `json:"at"`
+}
+
+// reconciliationReport is the stored result of one pass.
+type reconciliationReport struct {
+	RunAt int64 `json:"runAt"`
+	// VirtualUnits is the summed virtual currency across user wallets;
+	// VirtualWei is its wei equivalent at the configured bridge rate.
+	VirtualUnits string `json:"virtualUnits"`
+	VirtualWei   string `json:"virtualWei"`
+	// LedgerNetWei is bridged-in minus bridged-out.
+	LedgerNetWei string `json:"ledgerNetWei"`
+	// OnChainWei is the summed treasury and deposit address balances.
+	OnChainWei     string `json:"onChainWei"`
+	LedgerEntries  int    `json:"ledgerEntries"`
+	MaxDiscrepancy string `json:"maxDiscrepancy"`
+	ToleranceWei   string `json:"toleranceWei"`
+	Balanced       bool   `json:"balanced"`
+	// Error is set when a source could not be read and the pass aborted.
+	Error string `json:"error,omitempty"`
+}
+
+// sumVirtualBalances totals the configured virtual currency across all user
+// wallets straight from the server's wallet column.
+func sumVirtualBalances(ctx context.Context, db *sql.DB) (*big.Int, error) {
+	query := "SELECT COALESCE(SUM((wallet->>$1)::numeric), 0) FROM users WHERE wallet->>$1 IS NOT NULL"
+	var total string
+	if err := db.QueryRowContext(ctx, query, cfg.BridgeCurrency).Scan(&total); err != nil {
+		return nil, fmt.Errorf("virtual balance sum failed: %w", err)
+	}
+	// Numeric sums may render with a fractional part; virtual currencies are
+	// integral so truncation is exact.
+	if i := strings.IndexByte(total, '.'); i >= 0 {
+		total = total[:i]
+	}
+	v, ok := new(big.Int).SetString(total, 10)
+	if !ok {
+		return nil, fmt.Errorf("virtual balance sum %q is not numeric", total)
+	}
+	return v, nil
+}
+
+// sumBridgeLedger nets the recorded crossings: in minus out, in wei.
+func sumBridgeLedger(ctx context.Context, nk nkruntime.NakamaModule) (*big.Int, int, error) {
+	net := new(big.Int)
+	entries := 0
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", bridgeLedgerCollection, 100, cursor)
+		if err != nil {
+			return nil, 0, fmt.Errorf("bridge ledger listing failed: %w", err)
+		}
+		for _, obj := range objects {
+			entry := &bridgeLedgerEntry{}
+			if err := json.Unmarshal([]byte(obj.Value), entry); err != nil {
+				return nil, 0, fmt.Errorf("bridge ledger entry %v corrupt: %w", obj.Key, err)
+			}
+			amount, err := parseWei(entry.AmountWei)
+			if err != nil {
+				return nil, 0, fmt.Errorf("bridge ledger entry %v corrupt: %w", obj.Key, err)
+			}
+			switch entry.Direction {
+			case "in":
+				net.Add(net, amount)
+			case "out":
+				net.Sub(net, amount)
+			default:
+				return nil, 0, fmt.Errorf("bridge ledger entry %v has unknown direction %q", obj.Key, entry.Direction)
+			}
+			entries++
+		}
+		if next == "" || entries >= reconcileLedgerCap {
+			return net, entries, nil
+		}
+		cursor = next
+	}
+}
+
+// fetchOnChainBalance reads one address balance over JSON-RPC.
+func fetchOnChainBalance(ctx context.Context, address string) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(ctx, reconcileRPCLimit)
+	defer cancel()
+
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"eth_getBalance","params":[%q,"latest"]}`, address)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.EVMRPCURL, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("balance fetch failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("balance response malformed: %w", err)
+	}
+	if decoded.Error != nil {
+		return nil, fmt.Errorf("balance fetch failed: %s", decoded.Error.Message)
+	}
+	v, ok := new(big.Int).SetString(strings.TrimPrefix(decoded.Result, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("balance %q is not valid hex", decoded.Result)
+	}
+	return v, nil
+}
+
+// runReconciliationPass produces one report. It runs on the node holding the
+// reconciliation worker lease.
+func runReconciliationPass(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule) {
+	ctx, cancel := context.WithTimeout(ctx, reconcileTimeout)
+	defer cancel()
+
+	report := &reconciliationReport{
+		RunAt:        moduleClock.Now().Unix(),
+		ToleranceWei: cfg.ReconcileToleranceWei.String(),
+	}
+
+	virtual, err := sumVirtualBalances(ctx, db)
+	if err == nil {
+		report.VirtualUnits = virtual.String()
+		virtualWei := new(big.Int).Mul(virtual, cfg.BridgeRateWei)
+		report.VirtualWei = virtualWei.String()
+
+		var ledgerNet *big.Int
+		ledgerNet, report.LedgerEntries, err = sumBridgeLedger(ctx, nk)
+		if err == nil {
+			report.LedgerNetWei = ledgerNet.String()
+
+			onChain := new(big.Int)
+			for _, address := range cfg.TreasuryAddresses {
+				var balance *big.Int
+				if balance, err = fetchOnChainBalance(ctx, address); err != nil {
+					break
+				}
+				onChain.Add(onChain, balance)
+			}
+			if err == nil {
+				report.OnChainWei = onChain.String()
+				// The ledger should back the virtual supply and match the
+				// chain; the report carries the worse of the two gaps.
+				gapChain := new(big.Int).Sub(onChain, ledgerNet)
+				gapVirtual := new(big.Int).Sub(ledgerNet, virtualWei)
+				max := new(big.Int).Abs(gapChain)
+				if abs := new(big.Int).Abs(gapVirtual); abs.Cmp(max) > 0 {
+					max = abs
+				}
+				report.MaxDiscrepancy = max.String()
+				report.Balanced = max.Cmp(cfg.ReconcileToleranceWei) <= 0
+			}
+		}
+	}
+	if err != nil {
+		report.Error = err.Error()
+		logger.Error("Reconciliation pass failed: %v", err)
+		metricReconcileRuns.WithLabelValues("error").Inc()
+	} else if report.Balanced {
+		metricReconcileRuns.WithLabelValues("balanced").Inc()
+	} else {
+		logger.Error("Reconciliation discrepancy of %v wei exceeds tolerance %v", report.MaxDiscrepancy, report.ToleranceWei)
+		metricReconcileRuns.WithLabelValues("discrepancy").Inc()
+		go alertReconciliation(logger, report)
+	}
+
+	value, marshalErr := json.Marshal(report)
+	if marshalErr != nil {
+		return
+	}
+	key := moduleClock.Now().UTC().Format("2006-01-02")
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: reconcileReportsCollect,
+		Key:        key,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Reconciliation report write failed: %v", err)
+	}
+}
+
+// alertReconciliation posts a discrepancy alert to the ops webhook.
+func alertReconciliation(logger nkruntime.Logger, report *reconciliationReport) {
+	if cfg.AlertWebhookURL == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dlqAlertTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"alert":          "reconciliation_discrepancy",
+		"maxDiscrepancy": report.MaxDiscrepancy,
+		"toleranceWei":   report.ToleranceWei,
+		"virtualWei":     report.VirtualWei,
+		"ledgerNetWei":   report.LedgerNetWei,
+		"onChainWei":     report.OnChainWei,
+		"node":           nodeID,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.AlertWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.Warn("Reconciliation alert failed: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,147 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Migrating users between Cognito pools changes their sub, which orphans
+// wallets keyed to the old external ID. Recovery is admin-assisted: the
+// operator states the old external ID and supplies a fresh ID token proving
+// control of the new identity, and every wallet and the identity grant are
+// re-bound in one pass. The re-bind is recorded with irreversible audit
+// entries carrying both identities.
+
+// rpcAdminRecoverWallet re-binds a user's wallets from an old external ID to
+// the identity proven by a fresh ID token. Server-to-server only.
+func rpcAdminRecoverWallet(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID        string `json:"userId"`
+		OldExternalID string `json:"oldExternalId"`
+		Token         string `json:"token"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" || req.OldExternalID == "" || req.Token == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId, oldExternalId and token.", codes.InvalidArgument)
+	}
+
+	// The token proves the new identity is live and under the user's control;
+	// an operator-stated mapping alone is not enough to move a wallet.
+	claims, err := verifyIDToken(nil, req.Token, cfg.LoginAudiences)
+	if err != nil {
+		logger.Debug("Recovery token verification failed: %v", err)
+		return "", rpcError(errCodeAuthFailed, "ID token verification failed.", codes.Unauthenticated)
+	}
+	// Re-binding a wallet demands a recent interactive login, not a cached
+	// token; see freshness.go.
+	if err := checkTokenFreshness(claims, tokenOpRecover); err != nil {
+		return "", err
+	}
+	newExternalID := customID(claims.Subject)
+	if newExternalID == req.OldExternalID {
+		return "", rpcError(errCodeBadInput, "Token already belongs to the stated external ID.", codes.InvalidArgument)
+	}
+
+	// Re-bind every wallet currently keyed to the old identity. Conditional
+	// writes keep a concurrent rotation or provision from being clobbered.
+	rebound := make([]string, 0, 1)
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", req.UserID, tenantCollection(ctx, walletCollection), 100, cursor)
+		if err != nil {
+			logger.Error("Wallet listing failed for user %v: %v", req.UserID, err)
+			return "", rpcError(errCodeInternal, "Wallet listing failed.", codes.Internal)
+		}
+		for _, obj := range objects {
+			wallet := &Wallet{}
+			if err := json.Unmarshal([]byte(obj.Value), wallet); err != nil {
+				logger.Warn("Skipping corrupt wallet record %v: %v", obj.Key, err)
+				continue
+			}
+			if wallet.ExternalID != req.OldExternalID {
+				continue
+			}
+			wallet.ExternalID = newExternalID
+			value, err := json.Marshal(wallet)
+			if err != nil {
+				return "", rpcError(errCodeInternal, "Wallet encoding failed.", codes.Internal)
+			}
+			if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+				Collection:     tenantCollection(ctx, walletCollection),
+				Key:            obj.Key,
+				UserID:         req.UserID,
+				Value:          string(value),
+				Version:        obj.Version,
+				PermissionRead: 1,
+			}}); err != nil {
+				logger.Error("Wallet re-bind write failed for user %v key %v: %v", req.UserID, obj.Key, err)
+				return "", rpcError(errCodeInternal, "Wallet re-bind failed.", codes.Internal)
+			}
+			mirrorWalletV2(ctx, logger, nk, req.UserID, obj.Key, wallet)
+			rebound = append(rebound, wallet.Address)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(rebound) == 0 {
+		return "", rpcError(errCodeNotFound, "No wallet is bound to the stated external ID.", codes.NotFound)
+	}
+
+	// The identity grant makes externalIDForUser resolve to the new subject
+	// even while the account's custom ID still names the old pool.
+	grant := &identityGrant{ExternalID: newExternalID, CreatedAt: moduleClock.Now().Unix()}
+	value, err := json.Marshal(grant)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Grant encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: identityCollection,
+		Key:        identityKeyGrant,
+		UserID:     req.UserID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Identity grant write failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Grant write failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "wallet.recovered", req.UserID, map[string]interface{}{
+		"oldExternalId": req.OldExternalID,
+		"newExternalId": newExternalID,
+		"addresses":     rebound,
+	}); err != nil {
+		logger.Error("Audit append failed for wallet recovery of user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"externalId": newExternalID,
+		"addresses":  rebound,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// With NAKAMA_LOG_REDACT_PII set, every module log line passes through a
+// redaction layer: emails and Cognito subjects are replaced by short stable
+// hashes (so the same identity still correlates across lines) and wallet
+// addresses are truncated. Nakama user IDs and record IDs are left alone —
+// they are the correlation handles support works with and carry no PII on
+// their own.
+
+var (
+	redactEmailRe = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// Cognito subjects only appear in logs behind the module's custom ID
+	// prefix, which keeps this from matching unrelated UUIDs.
+	redactSubRe = regexp.MustCompile(`cognito:[0-9a-fA-F-]{8,}`)
+	// Wallet addresses: 0x followed by exactly 40 hex characters.
+	redactAddressRe = regexp.MustCompile(`0x[0-9a-fA-F]{40}`)
+)
+
+// redactHash renders a stable 8-hex-digit handle for a redacted value.
+func redactHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:4])
+}
+
+// redactPII scrubs one rendered log line.
+func redactPII(line string) string {
+	line = redactEmailRe.ReplaceAllStringFunc(line, func(m string) string {
+		return "email#" + redactHash(m)
+	})
+	line = redactSubRe.ReplaceAllStringFunc(line, func(m string) string {
+		return "cognito:#" + redactHash(m)
+	})
+	line = redactAddressRe.ReplaceAllStringFunc(line, func(m string) string {
+		return m[:8] + "…" + m[len(m)-4:]
+	})
+	return line
+}
+
+// redactedLogger wraps a runtime logger, scrubbing formatted output and field
+// values.
+type redactedLogger struct {
+	inner nkruntime.Logger
+}
+
+// redactLogger wraps a logger with PII redaction when the mode is enabled.
+// The config is passed in because this runs during instance construction,
+// before the package aliases point at the new state; see instance.go.
+func redactLogger(c *Config, logger nkruntime.Logger) nkruntime.Logger {
+	if !c.LogRedactPII {
+		return logger
+	}
+	if _, ok := logger.(*redactedLogger); ok {
+		return logger
+	}
+	return &redactedLogger{inner: logger}
+}
+
+func (l *redactedLogger) render(format string, v ...interface{}) string {
+	return redactPII(fmt.Sprintf(format, v...))
+}
+
+func (l *redactedLogger) Debug(format string, v ...interface{}) {
+	l.inner.Debug("%s", l.render(format, v...))
+}
+
+func (l *redactedLogger) Info(format string, v ...interface{}) {
+	l.inner.Info("%s", l.render(format, v...))
+}
+
+func (l *redactedLogger) Warn(format string, v ...interface{}) {
+	l.inner.Warn("%s", l.render(format, v...))
+}
+
+func (l *redactedLogger) Error(format string, v ...interface{}) {
+	l.inner.Error("%s", l.render(format, v...))
+}
+
+func (l *redactedLogger) WithField(key string, v interface{}) nkruntime.Logger {
+	return &redactedLogger{inner: l.inner.WithField(key, redactPII(fmt.Sprintf("%v", v)))}
+}
+
+func (l *redactedLogger) WithFields(fields map[string]interface{}) nkruntime.Logger {
+	scrubbed := make(map[string]interface{}, len(fields))
+	for key, v := range fields {
+		scrubbed[key] = redactPII(fmt.Sprintf("%v", v))
+	}
+	return &redactedLogger{inner: l.inner.WithFields(scrubbed)}
+}
+
+func (l *redactedLogger) Fields() map[string]interface{} {
+	return l.inner.Fields()
+}
+
+// withRedaction wraps an RPC handler so its per-call logger scrubs PII.
+func withRedaction(fn func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error)) func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+		return fn(ctx, redactLogger(cfg, logger), db, nk, payload)
+	}
+}
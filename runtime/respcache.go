@@ -0,0 +1,110 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Clients poll wallet reads aggressively, so cacheable responses are served
+// from a per-user in-memory cache for a short configurable TTL. Each cached
+// body carries a content version; a client that passes its last-seen version
+// gets a NOT_MODIFIED error instead of the unchanged body. Entries are
+// invalidated when a transaction reaches a terminal status or the wallet
+// changes, so the TTL only bounds staleness for writes this process didn't
+// observe.
+
+// cachedBody is one cached RPC response.
+type cachedBody struct {
+	Body    string
+	Version string
+	Expires time.Time
+}
+
+var (
+	respCacheMu sync.RWMutex
+	respCache   = make(map[string]*cachedBody)
+)
+
+// respCacheKey scopes cache entries per user and endpoint.
+func respCacheKey(userID, endpoint string) string {
+	return userID + "/" + endpoint
+}
+
+// respCacheGet returns a live cache entry, or nil.
+func respCacheGet(userID, endpoint string) *cachedBody {
+	if cfg.ResponseCacheTTL <= 0 {
+		return nil
+	}
+	respCacheMu.RLock()
+	entry := respCache[respCacheKey(userID, endpoint)]
+	respCacheMu.RUnlock()
+	if entry == nil || moduleClock.Now().After(entry.Expires) {
+		return nil
+	}
+	return entry
+}
+
+// contentVersion derives the version tag clients echo back for conditional
+// requests.
+func contentVersion(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:8])
+}
+
+// respCachePut stores a response body under its version.
+func respCachePut(userID, endpoint, body, version string) {
+	if cfg.ResponseCacheTTL <= 0 {
+		return
+	}
+	respCacheMu.Lock()
+	respCache[respCacheKey(userID, endpoint)] = &cachedBody{
+		Body:    body,
+		Version: version,
+		Expires: moduleClock.Now().Add(cfg.ResponseCacheTTL),
+	}
+	respCacheMu.Unlock()
+}
+
+// respCacheInvalidate drops all of a user's cached responses, e.g. after a
+// transaction confirms or a wallet mutates.
+func respCacheInvalidate(userID string) {
+	respCacheMu.Lock()
+	for key := range respCache {
+		if len(key) > len(userID) && key[:len(userID)] == userID && key[len(userID)] == '/' {
+			delete(respCache, key)
+		}
+	}
+	respCacheMu.Unlock()
+}
+
+// respCacheFlush drops every cached response, used when this node can no
+// longer tell which entries are stale; see cachebus.go.
+func respCacheFlush() {
+	respCacheMu.Lock()
+	respCache = make(map[string]*cachedBody)
+	respCacheMu.Unlock()
+}
+
+// notModifiedError signals that the client's last-seen version is still
+// current and the body was omitted.
+func notModifiedError() error {
+	return rpcError(errCodeNotModified, "Content has not changed.", codes.FailedPrecondition)
+}
@@ -0,0 +1,99 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// Intermittent database or network hiccups inside Nakama core calls used to
+// surface to users as hard auth failures. Short-lived failures are retried
+// with jittered backoff inside the request deadline; permanent failures
+// (wrong input, not found, permission) return immediately.
+
+const (
+	retryMaxAttempts = 3
+	retryBaseBackoff = 50 * time.Millisecond
+)
+
+var metricRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "nakama_module_retries_total",
+	Help: "Transient-error retries by operation.",
+}, []string{"op"})
+
+func init() {
+	metricsRegistry.MustRegister(metricRetries)
+}
+
+// isTransientError classifies an error from a Nakama core or storage call as
+// worth retrying.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var nkErr *nkruntime.Error
+	if errors.As(err, &nkErr) {
+		switch codes.Code(nkErr.Code) {
+		case codes.Unavailable, codes.Aborted, codes.ResourceExhausted, codes.Internal:
+			return true
+		default:
+			return false
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, marker := range []string{"connection refused", "connection reset", "bad connection", "timeout", "timed out", "broken pipe", "unexpected eof"} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry runs fn, retrying transient failures with jittered exponential
+// backoff while the context allows it. op labels the retry metric.
+func withRetry(ctx context.Context, logger nkruntime.Logger, op string, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < retryMaxAttempts; attempt++ {
+		if attempt > 0 {
+			backoff := retryBaseBackoff << (attempt - 1)
+			// Up to 50% jitter to avoid synchronized retries.
+			backoff += time.Duration(rand.Int63n(int64(backoff)))
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			metricRetries.WithLabelValues(op).Inc()
+			logger.Debug("Retrying %v after transient error (attempt %d): %v", op, attempt+1, err)
+		}
+		if err = fn(); err == nil || !isTransientError(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Minimal RLP encoder covering the shapes needed for Ethereum transaction
+// envelopes: byte strings, unsigned integers (minimal big-endian form) and
+// nested lists. Decoding is intentionally not implemented; the module only
+// ever constructs transactions.
+
+func rlpEncode(item interface{}) ([]byte, error) {
+	switch v := item.(type) {
+	case []byte:
+		return rlpEncodeBytes(v), nil
+	case string:
+		return rlpEncodeBytes([]byte(v)), nil
+	case uint64:
+		return rlpEncodeBytes(rlpUintBytes(v)), nil
+	case *big.Int:
+		if v == nil || v.Sign() == 0 {
+			return rlpEncodeBytes(nil), nil
+		}
+		if v.Sign() < 0 {
+			return nil, fmt.Errorf("rlp: cannot encode negative integer")
+		}
+		return rlpEncodeBytes(v.Bytes()), nil
+	case []interface{}:
+		var payload []byte
+		for _, elem := range v {
+			enc, err := rlpEncode(elem)
+			if err != nil {
+				return nil, err
+			}
+			payload = append(payload, enc...)
+		}
+		return append(rlpListHeader(len(payload)), payload...), nil
+	default:
+		return nil, fmt.Errorf("rlp: unsupported type %T", item)
+	}
+}
+
+func rlpEncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return b
+	}
+	if len(b) < 56 {
+		return append([]byte{0x80 + byte(len(b))}, b...)
+	}
+	lenBytes := rlpUintBytes(uint64(len(b)))
+	out := append([]byte{0xb7 + byte(len(lenBytes))}, lenBytes...)
+	return append(out, b...)
+}
+
+func rlpListHeader(payloadLen int) []byte {
+	if payloadLen < 56 {
+		return []byte{0xc0 + byte(payloadLen)}
+	}
+	lenBytes := rlpUintBytes(uint64(payloadLen))
+	return append([]byte{0xf7 + byte(len(lenBytes))}, lenBytes...)
+}
+
+// rlpUintBytes returns the minimal big-endian representation of v, empty for
+// zero as RLP requires.
+func rlpUintBytes(v uint64) []byte {
+	if v == 0 {
+		return nil
+	}
+	var out []byte
+	for v > 0 {
+		out = append([]byte{byte(v)}, out...)
+		v >>= 8
+	}
+	return out
+}
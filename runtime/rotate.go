@@ -0,0 +1,245 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Compromised or exposed addresses are retired by rotation: the wallet gets a
+// fresh key and address, and the old address moves to the wallet's deprecated
+// list where the chain watcher keeps watching it. Assets found on a
+// deprecated address — the initial sweep and any late incoming transfers —
+// are forwarded by signing a transfer from the old key to the current
+// address via rpc_admin_forward_deposit.
+
+// DeprecatedAddress is a retired wallet address that remains watchable.
+type DeprecatedAddress struct {
+	Address         string `json:"address"`
+	DerivationIndex uint32 `json:"derivationIndex"`
+	KeyARN          string `json:"keyArn,omitempty"`
+	DeprecatedAt    int64  `json:"deprecatedAt"`
+}
+
+// rotateWallet provisions fresh key material for an existing wallet and
+// deprecates the current address. The write is conditional on the record
+// version so concurrent rotations cannot both win.
+func rotateWallet(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID string) (*Wallet, error) {
+	if err := checkWalletDeleted(ctx, nk, userID); err != nil {
+		return nil, err
+	}
+	wallet, version, err := readWalletForUpdate(ctx, nk, userID, "")
+	if err != nil {
+		return nil, fmt.Errorf("wallet record corrupt for user %s: %w", userID, err)
+	}
+	if wallet == nil {
+		return nil, rpcError(errCodeNotFound, "User has no wallet to rotate.", codes.NotFound)
+	}
+
+	wallet.DeprecatedAddresses = append(wallet.DeprecatedAddresses, &DeprecatedAddress{
+		Address:         wallet.Address,
+		DerivationIndex: wallet.DerivationIndex,
+		KeyARN:          wallet.KeyARN,
+		DeprecatedAt:    moduleClock.Now().Unix(),
+	})
+
+	// Rotation stays on the wallet's own backend; moving a user between
+	// backends is a provisioning decision, not a rotation side effect.
+	if cfg.WalletKeyMode == walletKeyModePerUser {
+		signer, err := perUserKeySigner(ctx, wallet.Backend)
+		if err != nil {
+			return nil, err
+		}
+		keyARN, pub, err := signer.CreateKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("wallet: rotation key creation failed: %w", err)
+		}
+		wallet.KeyARN = keyARN
+		wallet.Address = ethereumAddress(pub)
+	} else {
+		index, err := nextDerivationIndex(ctx, nk)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := GetKMSSigner(ctx, wallet.Backend)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := signer.PublicKey(ctx, index)
+		if err != nil {
+			return nil, fmt.Errorf("wallet: rotation key derivation failed: %w", err)
+		}
+		wallet.DerivationIndex = index
+		wallet.KeyARN = ""
+		wallet.Address = ethereumAddress(pub)
+	}
+
+	if err := storeWallet(ctx, nk, userID, "", wallet, version); err != nil {
+		return nil, rpcError(errCodeInternal, "Wallet rotation lost a concurrent update; retry.", codes.Aborted)
+	}
+
+	// Replace the cached public key: the old entry no longer matches the
+	// wallet address and would only fail validation; see pubkeycache.go.
+	warmPublicKeyCache(ctx, logger, nk, wallet)
+
+	logger.Info("Rotated wallet for user %v to %v", userID, wallet.Address)
+	return wallet, nil
+}
+
+// rpcRotateWallet retires the calling user's current address and provisions a
+// new one. The old address stays on the wallet's deprecated list for the
+// watcher; sweeping and forwarding happen through rpc_admin_forward_deposit
+// as balances are observed.
+func rpcRotateWallet(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireSigningSession(ctx); err != nil {
+		return "", err
+	}
+	// Users with guardians configured need K-of-N approval to rotate.
+	if err := requireGuardianApproval(ctx, logger, nk, userID, guardianOpRotate); err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Error("Guardian check failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Guardian check failed.", codes.Internal)
+	}
+
+	wallet, err := rotateWallet(ctx, logger, nk, userID)
+	if err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Error("Wallet rotation failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Wallet rotation failed.", codes.Internal)
+	}
+
+	cacheInvalidateCluster(ctx, logger, nk, userID, "wallet_rotated")
+
+	old := wallet.DeprecatedAddresses[len(wallet.DeprecatedAddresses)-1]
+	if err := appendAudit(ctx, nk, "wallet.rotated", userID, map[string]interface{}{
+		"oldAddress": old.Address,
+		"newAddress": wallet.Address,
+	}); err != nil {
+		logger.Error("Audit append failed for wallet rotation: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+	// Best effort: subscribed sessions learn the new address immediately.
+	if err := pushWalletEvent(ctx, nk, userID, &WalletEvent{
+		Type:    "wallet.rotated",
+		Details: map[string]interface{}{"address": wallet.Address},
+	}); err != nil {
+		logger.Warn("Wallet event push failed for rotation of user %v: %v", userID, err)
+	}
+
+	out, err := json.Marshal(wallet)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// rpcAdminForwardDeposit signs a transfer moving a balance the watcher found
+// on a deprecated address to the wallet's current address. Used both for the
+// initial post-rotation sweep and for late incoming transfers. Returns the
+// raw signed transaction for the watcher to broadcast.
+func rpcAdminForwardDeposit(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID  string `json:"userId"`
+		Address string `json:"address"`
+		// Transfer parameters supplied by the watcher.
+		Value                string  `json:"value"`
+		Gas                  uint64  `json:"gas"`
+		MaxFeePerGas         string  `json:"maxFeePerGas"`
+		MaxPriorityFeePerGas string  `json:"maxPriorityFeePerGas"`
+		Nonce                *uint64 `json:"nonce"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" || req.Address == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId, deprecated address and transfer parameters.", codes.InvalidArgument)
+	}
+
+	wallet, err := getWallet(ctx, nk, req.UserID)
+	if err != nil {
+		logger.Error("Wallet read failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal)
+	}
+	if wallet == nil {
+		return "", rpcError(errCodeNotFound, "User has no wallet.", codes.NotFound)
+	}
+	var deprecated *DeprecatedAddress
+	for _, candidate := range wallet.DeprecatedAddresses {
+		if candidate.Address == req.Address {
+			deprecated = candidate
+			break
+		}
+	}
+	if deprecated == nil {
+		return "", rpcError(errCodeNotFound, "Address is not a deprecated address of this wallet.", codes.NotFound)
+	}
+
+	// Sign with the retired key, paying the current address. The external ID
+	// carries over so the signing context stays attributable to the owner.
+	source := &Wallet{
+		ExternalID:      wallet.ExternalID,
+		Address:         deprecated.Address,
+		DerivationIndex: deprecated.DerivationIndex,
+		KeyARN:          deprecated.KeyARN,
+	}
+	txReq := &EVMTransactionRequest{
+		To:                   wallet.Address,
+		Value:                req.Value,
+		Gas:                  req.Gas,
+		MaxFeePerGas:         req.MaxFeePerGas,
+		MaxPriorityFeePerGas: req.MaxPriorityFeePerGas,
+		Nonce:                req.Nonce,
+	}
+	raw, hash, err := signEVMTransaction(ctx, source, txReq, signPurposeDepositForward)
+	if err != nil {
+		logger.Error("Forward signing failed for address %v: %v", req.Address, err)
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Forward transaction rejected: %v.", err), codes.InvalidArgument)
+	}
+
+	if err := appendAudit(ctx, nk, "wallet.deposit_forwarded", req.UserID, map[string]interface{}{
+		"from":           deprecated.Address,
+		"to":             wallet.Address,
+		"value":          req.Value,
+		"hash":           fmt.Sprintf("0x%x", hash),
+		"signingContext": signingContextFor(source, signPurposeDepositForward),
+	}); err != nil {
+		logger.Error("Audit append failed for deposit forward: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(map[string]string{
+		"raw":  fmt.Sprintf("0x%x", raw),
+		"hash": fmt.Sprintf("0x%x", hash),
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
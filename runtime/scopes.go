@@ -0,0 +1,178 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// All internal services share the runtime HTTP key, so the key alone cannot
+// tell callers apart. Server-to-server RPCs therefore carry a service token in
+// the X-Service-Token header identifying a named service with configured
+// scopes, enforced by a registration-time wrapper and recorded in audits.
+//
+// Token format: <service>:<unix-seconds>:<hex hmac-sha256(secret, service:ts)>
+// Tokens older than the acceptance window are rejected to blunt replay.
+
+const (
+	serviceTokenHeader = "x-service-token"
+	serviceTokenMaxAge = 5 * time.Minute
+)
+
+// ServiceIdentity names one internal caller and the scopes it holds.
+type ServiceIdentity struct {
+	Secret string   `json:"secret"`
+	Scopes []string `json:"scopes"`
+}
+
+func (s *ServiceIdentity) hasScope(scope string) bool {
+	for _, held := range s.Scopes {
+		if held == scope || held == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// loadServiceIdentities parses NAKAMA_SERVICE_IDENTITIES, a JSON object of
+// service name to identity. Empty disables scope enforcement entirely, which
+// keeps single-service deployments working unchanged.
+func loadServiceIdentities(ctx context.Context) (map[string]*ServiceIdentity, error) {
+	raw := moduleEnv(ctx, "NAKAMA_SERVICE_IDENTITIES")
+	if raw == "" {
+		return nil, nil
+	}
+	identities := make(map[string]*ServiceIdentity)
+	if err := json.Unmarshal([]byte(raw), &identities); err != nil {
+		return nil, fmt.Errorf("invalid NAKAMA_SERVICE_IDENTITIES: %w", err)
+	}
+	for name, identity := range identities {
+		if identity.Secret == "" {
+			return nil, fmt.Errorf("invalid NAKAMA_SERVICE_IDENTITIES: service %q has no secret", name)
+		}
+	}
+	return identities, nil
+}
+
+// serviceTokenFromContext reads the service token header of an HTTP RPC call.
+func serviceTokenFromContext(ctx context.Context) string {
+	headers, ok := ctx.Value(nkruntime.RUNTIME_CTX_HEADERS).(map[string][]string)
+	if !ok {
+		return ""
+	}
+	for name, values := range headers {
+		if strings.EqualFold(name, serviceTokenHeader) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func serviceTokenMAC(secret, service string, ts int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s:%d", service, ts)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mintServiceToken builds a token for a service identity; used by tests and
+// internal tooling.
+func mintServiceToken(service, secret string, now time.Time) string {
+	ts := now.Unix()
+	return fmt.Sprintf("%s:%d:%s", service, ts, serviceTokenMAC(secret, service, ts))
+}
+
+// verifyServiceToken resolves and authenticates the calling service.
+func verifyServiceToken(token string) (string, error) {
+	parts := strings.SplitN(token, ":", 3)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed service token")
+	}
+	service := parts[0]
+	identity, ok := cfg.ServiceIdentities[service]
+	if !ok {
+		return "", fmt.Errorf("unknown service %q", service)
+	}
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("malformed service token timestamp")
+	}
+	age := time.Since(time.Unix(ts, 0))
+	if age > serviceTokenMaxAge || age < -serviceTokenMaxAge {
+		return "", fmt.Errorf("service token outside acceptance window")
+	}
+	expected := serviceTokenMAC(identity.Secret, service, ts)
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return "", fmt.Errorf("service token signature mismatch")
+	}
+	return service, nil
+}
+
+// requireScope authenticates a server-to-server caller and checks it holds
+// the scope. With no identities configured it degrades to requireServer.
+// Returns the service name for audit attribution ("" when unenforced).
+func requireScope(ctx context.Context, scope string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	if len(cfg.ServiceIdentities) == 0 {
+		return "", nil
+	}
+	token := serviceTokenFromContext(ctx)
+	if token == "" {
+		return "", rpcError(errCodePermissionDenied, "RPC requires a service token.", codes.PermissionDenied)
+	}
+	service, err := verifyServiceToken(token)
+	if err != nil {
+		return "", rpcError(errCodePermissionDenied, "Service token rejected.", codes.PermissionDenied)
+	}
+	if !cfg.ServiceIdentities[service].hasScope(scope) {
+		return "", rpcError(errCodePermissionDenied,
+			fmt.Sprintf("Service %q lacks the %q scope.", service, scope), codes.PermissionDenied)
+	}
+	return service, nil
+}
+
+// withScope wraps an admin RPC so the caller must hold the scope. The
+// resolved service name is audited alongside the call.
+func withScope(scope, name string, fn func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error)) func(context.Context, nkruntime.Logger, *sql.DB, nkruntime.NakamaModule, string) (string, error) {
+	return func(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+		service, err := requireScope(ctx, scope)
+		if err != nil {
+			return "", err
+		}
+		if service != "" {
+			if err := appendAudit(ctx, nk, "service.call", "", map[string]interface{}{
+				"service": service,
+				"rpc":     name,
+				"scope":   scope,
+			}); err != nil {
+				logger.Warn("Audit append failed for service call %v by %v: %v", name, service, err)
+			}
+		}
+		return fn(ctx, logger, db, nk, payload)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Other Go modules compiled into the same Nakama plugin (crafting, minting,
+// match logic) can drive wallets in process through WalletService, bypassing
+// the RPC JSON layer and its session checks. Callers are trusted code; they
+// are responsible for deciding which user an operation runs as.
+
+// WalletService is the in-process wallet API exposed to sibling modules.
+type WalletService interface {
+	// EnsureWallet returns the user's wallet, provisioning one on first use.
+	EnsureWallet(ctx context.Context, userID string) (*Wallet, error)
+	// Sign runs the full signing pipeline (context validation, policy, gas
+	// sponsorship, signing, record persistence, audit) for the user.
+	Sign(ctx context.Context, userID string, req *EVMTransactionRequest) (*TransactionRecord, error)
+	// SubmitAction records a module-initiated wallet action in the audit log
+	// and notifies the user's subscribed sessions.
+	SubmitAction(ctx context.Context, userID, action string, details map[string]interface{}) error
+}
+
+var (
+	walletServiceMu sync.RWMutex
+	walletService   WalletService
+)
+
+// GetWalletService returns the in-process wallet API. It is available after
+// InitModule completes in a profile with wallet surfaces enabled.
+func GetWalletService() (WalletService, error) {
+	walletServiceMu.RLock()
+	defer walletServiceMu.RUnlock()
+	if walletService == nil {
+		return nil, fmt.Errorf("wallet service not initialized; check the module profile")
+	}
+	return walletService, nil
+}
+
+func setWalletService(s WalletService) {
+	walletServiceMu.Lock()
+	walletService = s
+	walletServiceMu.Unlock()
+}
+
+// moduleWalletService implements WalletService over the same internals the
+// RPC handlers use.
+type moduleWalletService struct {
+	logger nkruntime.Logger
+	nk     nkruntime.NakamaModule
+}
+
+func (s *moduleWalletService) EnsureWallet(ctx context.Context, userID string) (*Wallet, error) {
+	return ensureWallet(ctx, s.logger, s.nk, userID)
+}
+
+func (s *moduleWalletService) Sign(ctx context.Context, userID string, req *EVMTransactionRequest) (*TransactionRecord, error) {
+	if !cfg.CustodyEnabled() {
+		return nil, fmt.Errorf("signing is not available in the %s profile", cfg.Profile)
+	}
+	wallet, err := ensureWallet(ctx, s.logger, s.nk, userID)
+	if err != nil {
+		return nil, err
+	}
+	return signAndSendEVMTransaction(ctx, s.logger, s.nk, userID, wallet, req)
+}
+
+func (s *moduleWalletService) SubmitAction(ctx context.Context, userID, action string, details map[string]interface{}) error {
+	if err := appendAudit(ctx, s.nk, "module."+action, userID, details); err != nil {
+		return err
+	}
+	if err := pushWalletEvent(ctx, s.nk, userID, &WalletEvent{Type: action, Details: details}); err != nil {
+		s.logger.Warn("Wallet event push failed for action %v of user %v: %v", action, userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Client error-handling UX is hard to test against real failures: an expired
+// token or a frozen wallet takes manual setup and isn't repeatable.
+// rpc_simulate_flow, registered only in sandbox mode like rpc_faucet, drives
+// the login, wallet and sign steps of the pipeline and injects the failure
+// named in the payload at the right step, returning the exact error envelope
+// the production path emits so clients render the real thing. Steps without
+// an injected failure run their benign real-world equivalent.
+
+// Injectable failures, named after what QA selects in the test plan.
+const (
+	simulateFailExpiredToken = "expired_token"
+	simulateFailFrozenWallet = "frozen_wallet"
+	simulateFailRateLimit    = "rate_limit"
+)
+
+// simulateStepResult is one pipeline step's outcome.
+type simulateStepResult struct {
+	Step   string          `json:"step"`
+	Status string          `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// simulateError renders the given production error the way a failed RPC
+// delivers it, so the step result carries the same envelope.
+func simulateError(err error) json.RawMessage {
+	if rpcErr, ok := err.(*nkruntime.Error); ok {
+		return json.RawMessage(rpcErr.Message)
+	}
+	raw, _ := json.Marshal(map[string]string{"message": err.Error()})
+	return raw
+}
+
+// rpcSimulateFlow runs the login→wallet→sign pipeline with an injectable
+// failure per step. Registered only in sandbox mode.
+func rpcSimulateFlow(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	var req struct {
+		Failures []string `json:"failures,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed simulation request.", codes.InvalidArgument)
+		}
+	}
+	inject := make(map[string]bool, len(req.Failures))
+	for _, failure := range req.Failures {
+		switch failure {
+		case simulateFailExpiredToken, simulateFailFrozenWallet, simulateFailRateLimit:
+			inject[failure] = true
+		default:
+			return "", rpcError(errCodeBadInput, "Unknown failure flag: "+failure+".", codes.InvalidArgument)
+		}
+	}
+
+	results := make([]*simulateStepResult, 0, 3)
+	failed := false
+
+	// Login step. The session already proved itself to reach this RPC, so
+	// success is a no-op; the injected failure mirrors freshness.go.
+	login := &simulateStepResult{Step: "login", Status: "ok"}
+	if inject[simulateFailExpiredToken] {
+		login.Status = "error"
+		login.Error = simulateError(rpcError(errCodeStaleToken, "Token is too old for this operation; log in again.", codes.Unauthenticated))
+		failed = true
+	}
+	results = append(results, login)
+
+	// Wallet step provisions for real so later steps have an address; the
+	// injected failure mirrors clawback.go without freezing anything.
+	wallet := &simulateStepResult{Step: "wallet", Status: "ok"}
+	switch {
+	case failed:
+		wallet.Status = "skipped"
+	case inject[simulateFailFrozenWallet]:
+		wallet.Status = "error"
+		wallet.Error = simulateError(rpcError(errCodePermissionDenied, "Wallet is frozen pending investigation.", codes.PermissionDenied))
+		failed = true
+	default:
+		if _, err := ensureWallet(ctx, logger, nk, userID); err != nil {
+			logger.Error("Wallet provisioning failed in simulation for user %v: %v", userID, err)
+			wallet.Status = "error"
+			wallet.Error = simulateError(rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal))
+			failed = true
+		}
+	}
+	results = append(results, wallet)
+
+	// Sign step never signs — QA is testing UX, not the signer. The injected
+	// failure mirrors the admission backoff envelope, hint included.
+	sign := &simulateStepResult{Step: "sign", Status: "ok"}
+	switch {
+	case failed:
+		sign.Status = "skipped"
+	case inject[simulateFailRateLimit]:
+		sign.Status = "error"
+		sign.Error = simulateError(rpcErrorRetry(errCodeQueueFull, "Login queue is full; retry shortly.", concurrencyRetryAfter, codes.ResourceExhausted))
+	}
+	results = append(results, sign)
+
+	out, err := json.Marshal(map[string]interface{}{
+		"simulated": true,
+		"steps":     results,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
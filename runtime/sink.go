@@ -0,0 +1,292 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The analytics warehouse consumes audit log and transaction records in near
+// real time through a data sink: a buffered exporter flushing batches to one
+// of several destinations. Records are wrapped in a versioned envelope so
+// downstream schemas can evolve without guessing at payload shape. Delivery
+// is best effort — the buffer is bounded, and when the destination is down
+// long enough to fill it, new records are dropped and counted rather than
+// backing up the signing path. Storage remains the source of truth;
+// reconciliation of dropped records is a warehouse-side backfill from the
+// audit log collection.
+
+// Sink kinds accepted by NAKAMA_SINK_KIND.
+const (
+	sinkKindFirehose = "firehose"
+	sinkKindBigQuery = "bigquery"
+	sinkKindHTTP     = "http"
+)
+
+const (
+	// sinkSchemaVersion stamps every exported envelope.
+	sinkSchemaVersion = 1
+	// sinkBatchMax bounds one delivery call. Firehose caps PutRecordBatch at
+	// 500 records; the other sinks use the same ceiling for parity.
+	sinkBatchMax      = 500
+	sinkFlushInterval = time.Second
+	sinkTimeout       = 10 * time.Second
+	sinkRetry         = 3
+	// sinkBufferCap sheds records instead of growing without bound when the
+	// destination is down; see the package comment above.
+	sinkBufferCap = 10000
+)
+
+var metricSinkDropped = prometheus.NewCounter(prometheus.CounterOpts{
+	Name: "nakama_module_sink_records_dropped_total",
+	Help: "Analytics sink records dropped due to a full buffer or failed delivery.",
+})
+
+func init() {
+	metricsRegistry.MustRegister(metricSinkDropped)
+}
+
+// sinkEnvelope wraps one exported record.
+type sinkEnvelope struct {
+	Schema int         `json:"schema"`
+	Kind   string      `json:"kind"`
+	Node   string      `json:"node"`
+	At     int64       `json:"at"`
+	Record interface{} `json:"record"`
+}
+
+// dataSink delivers one batch of encoded envelopes to a destination.
+type dataSink interface {
+	deliver(ctx context.Context, batch []json.RawMessage) error
+}
+
+// dataExporter buffers envelopes and flushes them in batches, mirroring the
+// SNS publisher's shape; see publisher.go.
+type dataExporter struct {
+	logger nkruntime.Logger
+	sink   dataSink
+
+	mu     sync.Mutex
+	buffer []json.RawMessage
+}
+
+// dataSinkExporter is nil unless NAKAMA_SINK_KIND is configured.
+var dataSinkExporter *dataExporter
+
+// newDataSink builds the destination selected by the config. Kind and URL
+// were validated at config load.
+func newDataSink(c *Config) dataSink {
+	switch c.SinkKind {
+	case sinkKindFirehose:
+		return &firehoseSink{url: c.SinkURL, stream: c.SinkStream}
+	case sinkKindBigQuery:
+		return &bigQuerySink{url: c.SinkURL, token: c.SinkAuthToken}
+	default:
+		return &httpSink{url: c.SinkURL, token: c.SinkAuthToken}
+	}
+}
+
+// sinkExport buffers one record for the analytics sink. A no-op when no sink
+// is configured, and never an error: export is a side channel off the write
+// paths it observes.
+func sinkExport(kind string, record interface{}) {
+	exporter := dataSinkExporter
+	if exporter == nil {
+		return
+	}
+	encoded, err := json.Marshal(&sinkEnvelope{
+		Schema: sinkSchemaVersion,
+		Kind:   kind,
+		Node:   nodeID,
+		At:     moduleClock.Now().Unix(),
+		Record: record,
+	})
+	if err != nil {
+		exporter.logger.Warn("sink envelope encode failed: %v", err)
+		return
+	}
+	exporter.enqueue(encoded)
+}
+
+// enqueue buffers one envelope for the next batch flush.
+func (e *dataExporter) enqueue(encoded json.RawMessage) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.buffer) >= sinkBufferCap {
+		metricSinkDropped.Inc()
+		return
+	}
+	e.buffer = append(e.buffer, encoded)
+}
+
+// run flushes batches until the module context ends.
+func (e *dataExporter) run(ctx context.Context) {
+	ticker := time.NewTicker(sinkFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.flush(ctx)
+		}
+	}
+}
+
+// flush drains the buffer in batch-sized chunks, retrying transient delivery
+// failures before dropping a batch.
+func (e *dataExporter) flush(ctx context.Context) {
+	for {
+		e.mu.Lock()
+		if len(e.buffer) == 0 {
+			e.mu.Unlock()
+			return
+		}
+		n := len(e.buffer)
+		if n > sinkBatchMax {
+			n = sinkBatchMax
+		}
+		batch := e.buffer[:n]
+		e.buffer = e.buffer[n:]
+		e.mu.Unlock()
+
+		var lastErr error
+		for attempt := 0; attempt < sinkRetry; attempt++ {
+			if attempt > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Duration(attempt) * time.Second):
+				}
+			}
+			callCtx, cancel := context.WithTimeout(ctx, sinkTimeout)
+			lastErr = e.sink.deliver(callCtx, batch)
+			cancel()
+			if lastErr == nil {
+				break
+			}
+		}
+		if lastErr != nil {
+			metricSinkDropped.Add(float64(len(batch)))
+			e.logger.Warn("sink delivery failed, dropping %d records: %v", len(batch), lastErr)
+		}
+	}
+}
+
+// sinkPost issues one delivery call and maps non-2xx statuses to errors.
+func sinkPost(ctx context.Context, url string, contentType string, token string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("sink returned HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// firehoseSink posts PutRecordBatch calls against the Firehose wire protocol.
+// Like the other AWS touchpoints in this module the endpoint is a
+// credential-holding proxy in front of the regional API; see status.go.
+type firehoseSink struct {
+	url    string
+	stream string
+}
+
+func (s *firehoseSink) deliver(ctx context.Context, batch []json.RawMessage) error {
+	type firehoseRecord struct {
+		Data string `json:"Data"`
+	}
+	records := make([]firehoseRecord, 0, len(batch))
+	for _, encoded := range batch {
+		records = append(records, firehoseRecord{
+			Data: base64.StdEncoding.EncodeToString(append(encoded, '\n')),
+		})
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"DeliveryStreamName": s.stream,
+		"Records":            records,
+	})
+	if err != nil {
+		return err
+	}
+	return sinkPost(ctx, s.url, "application/x-amz-json-1.1", "", map[string]string{
+		"X-Amz-Target": "Firehose_20150804.PutRecordBatch",
+	}, body)
+}
+
+// bigQuerySink posts streaming insertAll calls. The envelope is the row, so
+// the destination table needs schema, kind, node, at and a record column.
+type bigQuerySink struct {
+	url   string
+	token string
+}
+
+func (s *bigQuerySink) deliver(ctx context.Context, batch []json.RawMessage) error {
+	type bigQueryRow struct {
+		JSON json.RawMessage `json:"json"`
+	}
+	rows := make([]bigQueryRow, 0, len(batch))
+	for _, encoded := range batch {
+		rows = append(rows, bigQueryRow{JSON: encoded})
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"kind": "bigquery#tableDataInsertAllRequest",
+		"rows": rows,
+	})
+	if err != nil {
+		return err
+	}
+	return sinkPost(ctx, s.url, "application/json", s.token, nil, body)
+}
+
+// httpSink posts batches as NDJSON, one envelope per line, for warehouses
+// fronted by a custom ingest endpoint (Redshift via an ingestion service,
+// self-hosted collectors).
+type httpSink struct {
+	url   string
+	token string
+}
+
+func (s *httpSink) deliver(ctx context.Context, batch []json.RawMessage) error {
+	var body bytes.Buffer
+	for _, encoded := range batch {
+		body.Write(encoded)
+		body.WriteByte('\n')
+	}
+	return sinkPost(ctx, s.url, "application/x-ndjson", s.token, nil, body.Bytes())
+}
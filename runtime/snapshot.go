@@ -0,0 +1,476 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Token-holder airdrops start from a snapshot: the operator schedules a block
+// height, a leased worker waits for the chain to reach it and records every
+// custodial wallet's balance of the configured token at exactly that height,
+// and rpc_admin_airdrop_from_snapshot later splits a treasury amount across
+// the recorded holders proportionally. Queue entries are consumed by the
+// treasury signer out of process; the RPC is called repeatedly, one batch per
+// call, and reports progress so the operator can resume an interrupted run.
+
+const (
+	snapshotCollection     = "airdrop_snapshots"
+	airdropQueueCollection = "airdrop_queue"
+	airdropStateCollection = "airdrop_state"
+
+	snapshotWorkerInterval = time.Minute
+	snapshotRPCTimeout     = 10 * time.Second
+	// snapshotMaxWallets bounds one snapshot pass; larger fleets need an
+	// out-of-process indexer anyway.
+	snapshotMaxWallets = 10000
+	airdropBatchCap    = 500
+
+	snapshotStatusScheduled = "scheduled"
+	snapshotStatusComplete  = "complete"
+	snapshotStatusFailed    = "failed"
+
+	// erc20BalanceOfSelector is balanceOf(address).
+	erc20BalanceOfSelector = "70a08231"
+)
+
+// snapshotHolder is one wallet's recorded balance.
+type snapshotHolder struct {
+	UserID  string `json:"userId"`
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+}
+
+// tokenSnapshot is one scheduled or taken snapshot.
+type tokenSnapshot struct {
+	ID          string            `json:"id"`
+	Token       string            `json:"token"`
+	BlockNumber uint64            `json:"blockNumber"`
+	Status      string            `json:"status"`
+	Error       string            `json:"error,omitempty"`
+	Holders     []*snapshotHolder `json:"holders,omitempty"`
+	TotalSupply string            `json:"totalSupply,omitempty"`
+	ScheduledAt int64             `json:"scheduledAt"`
+	TakenAt     int64             `json:"takenAt,omitempty"`
+}
+
+// airdropState tracks batch progress for one snapshot's airdrop.
+type airdropState struct {
+	SnapshotID string `json:"snapshotId"`
+	TotalWei   string `json:"totalWei"`
+	NextIndex  int    `json:"nextIndex"`
+	Queued     int    `json:"queued"`
+	StartedAt  int64  `json:"startedAt"`
+	UpdatedAt  int64  `json:"updatedAt"`
+}
+
+// airdropQueueEntry is one queued treasury transfer.
+type airdropQueueEntry struct {
+	ID         string `json:"id"`
+	SnapshotID string `json:"snapshotId"`
+	UserID     string `json:"userId"`
+	Address    string `json:"address"`
+	AmountWei  string `json:"amountWei"`
+	Status     string `json:"status"`
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// ethCallJSONRPC issues a raw JSON-RPC call against the configured endpoint
+// and returns the hex result.
+func ethCallJSONRPC(ctx context.Context, method, params string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, snapshotRPCTimeout)
+	defer cancel()
+
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":%q,"params":%s}`, method, params)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.EVMRPCURL, bytes.NewReader([]byte(body)))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return "", fmt.Errorf("%s response malformed: %w", method, err)
+	}
+	if decoded.Error != nil {
+		return "", fmt.Errorf("%s failed: %s", method, decoded.Error.Message)
+	}
+	return decoded.Result, nil
+}
+
+// ethBlockNumber returns the chain head height.
+func ethBlockNumber(ctx context.Context) (uint64, error) {
+	result, err := ethCallJSONRPC(ctx, "eth_blockNumber", "[]")
+	if err != nil {
+		return 0, err
+	}
+	v, ok := new(big.Int).SetString(strings.TrimPrefix(result, "0x"), 16)
+	if !ok {
+		return 0, fmt.Errorf("block number %q is not valid hex", result)
+	}
+	return v.Uint64(), nil
+}
+
+// erc20BalanceAt reads a token balance at a specific block height.
+func erc20BalanceAt(ctx context.Context, token, address string, block uint64) (*big.Int, error) {
+	data := "0x" + erc20BalanceOfSelector + fmt.Sprintf("%064s", strings.TrimPrefix(strings.ToLower(address), "0x"))
+	params := fmt.Sprintf(`[{"to":%q,"data":%q},"0x%x"]`, token, data, block)
+	result, err := ethCallJSONRPC(ctx, "eth_call", params)
+	if err != nil {
+		return nil, err
+	}
+	hexValue := strings.TrimPrefix(result, "0x")
+	if hexValue == "" {
+		return new(big.Int), nil
+	}
+	v, ok := new(big.Int).SetString(hexValue, 16)
+	if !ok {
+		return nil, fmt.Errorf("balance %q is not valid hex", result)
+	}
+	return v, nil
+}
+
+// runSnapshotPass executes any scheduled snapshot whose block height the
+// chain has reached.
+func runSnapshotPass(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+	head, err := ethBlockNumber(ctx)
+	if err != nil {
+		logger.Warn("Snapshot head lookup failed: %v", err)
+		return
+	}
+
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", snapshotCollection, 100, cursor)
+		if err != nil {
+			logger.Error("Snapshot listing failed: %v", err)
+			return
+		}
+		for _, obj := range objects {
+			snapshot := &tokenSnapshot{}
+			if err := json.Unmarshal([]byte(obj.Value), snapshot); err != nil {
+				logger.Warn("Skipping corrupt snapshot record %v: %v", obj.Key, err)
+				continue
+			}
+			if snapshot.Status != snapshotStatusScheduled || snapshot.BlockNumber > head {
+				continue
+			}
+			takeSnapshot(ctx, logger, nk, snapshot)
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
+
+// takeSnapshot records every custodial wallet's token balance at the
+// snapshot's block height and stores the result. Wallets are namespaced per
+// tenant, so the scan walks every tenant collection like the other
+// cross-user walkers.
+func takeSnapshot(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, snapshot *tokenSnapshot) {
+	holders := make([]*snapshotHolder, 0, 64)
+	total := new(big.Int)
+	scanned := 0
+	var scanErr error
+	capped := false
+
+scan:
+	for _, collection := range tenantCollections(walletCollection) {
+		cursor := ""
+		for {
+			objects, next, err := nk.StorageList(ctx, "", "", collection, 100, cursor)
+			if err != nil {
+				scanErr = fmt.Errorf("wallet listing failed in %s: %w", collection, err)
+				break scan
+			}
+			for _, obj := range objects {
+				wallet := &Wallet{}
+				if err := json.Unmarshal([]byte(obj.Value), wallet); err != nil {
+					logger.Warn("Skipping corrupt wallet record %v: %v", obj.Key, err)
+					continue
+				}
+				if scanned >= snapshotMaxWallets {
+					// A capped scan would silently shortchange every holder
+					// past the cap; that is a failure, not a result.
+					capped = true
+					break scan
+				}
+				scanned++
+				balance, err := erc20BalanceAt(ctx, snapshot.Token, wallet.Address, snapshot.BlockNumber)
+				if err != nil {
+					scanErr = err
+					break scan
+				}
+				if balance.Sign() > 0 {
+					holders = append(holders, &snapshotHolder{
+						UserID:  obj.UserId,
+						Address: wallet.Address,
+						Balance: balance.String(),
+					})
+					total.Add(total, balance)
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+
+	if scanErr != nil {
+		// Leave the snapshot scheduled; a transient RPC outage retries on the
+		// next pass rather than recording a partial holder set.
+		logger.Error("Snapshot %v failed at block %d: %v", snapshot.ID, snapshot.BlockNumber, scanErr)
+		return
+	}
+	if capped {
+		// The cap is a fleet-size condition, not a transient one; retrying
+		// would hit it again, so the snapshot fails terminally.
+		snapshot.Status = snapshotStatusFailed
+		snapshot.Error = fmt.Sprintf("wallet count exceeds the %d-wallet snapshot cap", snapshotMaxWallets)
+		snapshot.TakenAt = moduleClock.Now().Unix()
+		if err := writeSnapshot(ctx, nk, snapshot); err != nil {
+			logger.Error("Snapshot write failed for %v: %v", snapshot.ID, err)
+		}
+		logger.Error("Snapshot %v failed at block %d: %v", snapshot.ID, snapshot.BlockNumber, snapshot.Error)
+		return
+	}
+
+	snapshot.Status = snapshotStatusComplete
+	snapshot.Holders = holders
+	snapshot.TotalSupply = total.String()
+	snapshot.TakenAt = moduleClock.Now().Unix()
+	if err := writeSnapshot(ctx, nk, snapshot); err != nil {
+		logger.Error("Snapshot write failed for %v: %v", snapshot.ID, err)
+		return
+	}
+	logger.Info("Snapshot %v recorded %d holders at block %d", snapshot.ID, len(holders), snapshot.BlockNumber)
+}
+
+func writeSnapshot(ctx context.Context, nk nkruntime.NakamaModule, snapshot *tokenSnapshot) error {
+	value, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: snapshotCollection,
+		Key:        snapshot.ID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// rpcAdminScheduleSnapshot schedules a token balance snapshot at a block
+// height. Server-to-server only.
+func rpcAdminScheduleSnapshot(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		Token       string `json:"token"`
+		BlockNumber uint64 `json:"blockNumber"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.BlockNumber == 0 {
+		return "", rpcError(errCodeBadInput, "Expects a token and blockNumber.", codes.InvalidArgument)
+	}
+	if _, err := parseHexAddress(req.Token); err != nil {
+		return "", rpcError(errCodeBadInput, "Token must be a 0x-prefixed 20-byte address.", codes.InvalidArgument)
+	}
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", rpcError(errCodeInternal, "ID generation failed.", codes.Internal)
+	}
+	snapshot := &tokenSnapshot{
+		ID:          id,
+		Token:       strings.ToLower(req.Token),
+		BlockNumber: req.BlockNumber,
+		Status:      snapshotStatusScheduled,
+		ScheduledAt: moduleClock.Now().Unix(),
+	}
+	if err := writeSnapshot(ctx, nk, snapshot); err != nil {
+		logger.Error("Snapshot schedule write failed: %v", err)
+		return "", rpcError(errCodeInternal, "Snapshot could not be scheduled.", codes.Internal)
+	}
+	if err := appendAudit(ctx, nk, "snapshot.scheduled", "", map[string]interface{}{
+		"snapshotId":  id,
+		"token":       snapshot.Token,
+		"blockNumber": req.BlockNumber,
+	}); err != nil {
+		logger.Error("Audit append failed for snapshot %v: %v", id, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// rpcAdminAirdropFromSnapshot queues one batch of proportional treasury
+// transfers to a completed snapshot's holders. Repeated calls work through
+// the holder list and report progress; the queue is drained by the treasury
+// signer out of process. Server-to-server only.
+func rpcAdminAirdropFromSnapshot(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		SnapshotID string `json:"snapshotId"`
+		TotalWei   string `json:"totalWei"`
+		BatchSize  int    `json:"batchSize,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.SnapshotID == "" || req.TotalWei == "" {
+		return "", rpcError(errCodeBadInput, "Expects a snapshotId and totalWei.", codes.InvalidArgument)
+	}
+	totalWei, err := parseWei(req.TotalWei)
+	if err != nil || totalWei.Sign() <= 0 {
+		return "", rpcError(errCodeBadInput, "totalWei must be a positive wei amount.", codes.InvalidArgument)
+	}
+	if req.BatchSize <= 0 || req.BatchSize > airdropBatchCap {
+		req.BatchSize = 100
+	}
+
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: snapshotCollection,
+		Key:        req.SnapshotID,
+	}})
+	if err != nil || len(objects) == 0 {
+		return "", rpcError(errCodeNotFound, "Snapshot not found.", codes.NotFound)
+	}
+	snapshot := &tokenSnapshot{}
+	if err := json.Unmarshal([]byte(objects[0].Value), snapshot); err != nil {
+		return "", rpcError(errCodeInternal, "Snapshot record is corrupt.", codes.Internal)
+	}
+	if snapshot.Status != snapshotStatusComplete {
+		return "", rpcError(errCodeBadInput, "Snapshot has not completed.", codes.FailedPrecondition)
+	}
+	supply, ok := new(big.Int).SetString(snapshot.TotalSupply, 10)
+	if !ok || supply.Sign() <= 0 {
+		return "", rpcError(errCodeBadInput, "Snapshot recorded no holders.", codes.FailedPrecondition)
+	}
+
+	// Resume from the stored cursor so an interrupted run continues instead
+	// of double-queueing early holders.
+	state := &airdropState{SnapshotID: req.SnapshotID, TotalWei: totalWei.String(), StartedAt: moduleClock.Now().Unix()}
+	stateObjects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: airdropStateCollection,
+		Key:        req.SnapshotID,
+	}})
+	if err == nil && len(stateObjects) > 0 {
+		if err := json.Unmarshal([]byte(stateObjects[0].Value), state); err == nil && state.TotalWei != totalWei.String() {
+			return "", rpcError(errCodeBadInput, "totalWei differs from the amount this airdrop started with.", codes.FailedPrecondition)
+		}
+	}
+
+	end := state.NextIndex + req.BatchSize
+	if end > len(snapshot.Holders) {
+		end = len(snapshot.Holders)
+	}
+	for _, holder := range snapshot.Holders[state.NextIndex:end] {
+		balance, ok := new(big.Int).SetString(holder.Balance, 10)
+		if !ok {
+			continue
+		}
+		share := new(big.Int).Div(new(big.Int).Mul(totalWei, balance), supply)
+		if share.Sign() <= 0 {
+			continue
+		}
+		id, err := moduleIDs.NewID()
+		if err != nil {
+			return "", rpcError(errCodeInternal, "ID generation failed.", codes.Internal)
+		}
+		entry := &airdropQueueEntry{
+			ID:         id,
+			SnapshotID: req.SnapshotID,
+			UserID:     holder.UserID,
+			Address:    holder.Address,
+			AmountWei:  share.String(),
+			Status:     "queued",
+			CreatedAt:  moduleClock.Now().Unix(),
+		}
+		value, err := json.Marshal(entry)
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: airdropQueueCollection,
+			Key:        id,
+			Value:      string(value),
+		}}); err != nil {
+			logger.Error("Airdrop queue write failed for holder %v: %v", holder.Address, err)
+			return "", rpcError(errCodeInternal, "Airdrop queueing failed.", codes.Internal)
+		}
+		state.Queued++
+	}
+	state.NextIndex = end
+	state.UpdatedAt = moduleClock.Now().Unix()
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: airdropStateCollection,
+		Key:        req.SnapshotID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Airdrop state write failed for snapshot %v: %v", req.SnapshotID, err)
+		return "", rpcError(errCodeInternal, "Airdrop progress could not be saved.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "airdrop.batch_queued", "", map[string]interface{}{
+		"snapshotId": req.SnapshotID,
+		"queued":     state.Queued,
+		"remaining":  len(snapshot.Holders) - state.NextIndex,
+	}); err != nil {
+		logger.Error("Audit append failed for airdrop on snapshot %v: %v", req.SnapshotID, err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"snapshotId": req.SnapshotID,
+		"queued":     state.Queued,
+		"remaining":  len(snapshot.Holders) - state.NextIndex,
+		"done":       state.NextIndex >= len(snapshot.Holders),
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
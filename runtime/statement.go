@@ -0,0 +1,320 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Statement export serves tax reporting and support: a user's transactions
+// over a date range rendered as CSV or JSON, with fiat valuations at
+// transaction time when a price feed is configured. Small statements come
+// back inline; large ones are written to storage for the client to fetch.
+
+const (
+	statementCollection = "statements"
+	// statementInlineCap is the largest statement returned inline; bigger
+	// ones are stored and referenced instead.
+	statementInlineCap = 256 * 1024
+	// statementMaxRecords bounds how many transactions one export scans.
+	statementMaxRecords = 10000
+
+	priceFeedTimeout  = 3 * time.Second
+	priceFeedCacheTTL = time.Hour
+)
+
+// Statement formats.
+const (
+	statementFormatCSV  = "csv"
+	statementFormatJSON = "json"
+)
+
+type priceCacheEntry struct {
+	Price    string
+	Currency string
+	Expires  time.Time
+}
+
+var (
+	priceCacheMu sync.Mutex
+	priceCache   = make(map[string]*priceCacheEntry)
+)
+
+// fiatValueAt values a wei amount at the historic price closest to the given
+// time, via the configured price feed. A non-empty currency requests that
+// quote currency from the feed; empty takes the feed default. Returns empty
+// strings when the feed is unconfigured or unavailable; statements render the
+// columns blank.
+func fiatValueAt(ctx context.Context, chainID int64, valueWei string, at int64, currency string) (value, outCurrency string) {
+	if cfg.PriceFeedURL == "" || valueWei == "" || valueWei == "0" {
+		return "", ""
+	}
+	wei, ok := new(big.Int).SetString(valueWei, 10)
+	if !ok {
+		return "", ""
+	}
+
+	// Prices are cached per chain and hour; tax reporting doesn't need finer
+	// granularity and the feed shouldn't be hit once per row.
+	hour := at - at%3600
+	cacheKey := fmt.Sprintf("%d/%d/%s", chainID, hour, currency)
+	priceCacheMu.Lock()
+	entry := priceCache[cacheKey]
+	priceCacheMu.Unlock()
+	if entry == nil || moduleClock.Now().After(entry.Expires) {
+		ctx, cancel := context.WithTimeout(ctx, priceFeedTimeout)
+		defer cancel()
+		query := url.Values{
+			"chainId": {strconv.FormatInt(chainID, 10)},
+			"at":      {strconv.FormatInt(hour, 10)},
+		}
+		if currency != "" {
+			query.Set("currency", currency)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.PriceFeedURL+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", ""
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", ""
+		}
+		defer resp.Body.Close()
+		var decoded struct {
+			Price    string `json:"price"`
+			Currency string `json:"currency"`
+		}
+		if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&decoded) != nil || decoded.Price == "" {
+			return "", ""
+		}
+		entry = &priceCacheEntry{
+			Price:    decoded.Price,
+			Currency: decoded.Currency,
+			Expires:  moduleClock.Now().Add(priceFeedCacheTTL),
+		}
+		priceCacheMu.Lock()
+		priceCache[cacheKey] = entry
+		priceCacheMu.Unlock()
+	}
+
+	price, ok := new(big.Float).SetString(entry.Price)
+	if !ok {
+		return "", ""
+	}
+	ether := new(big.Float).Quo(new(big.Float).SetInt(wei), big.NewFloat(1e18))
+	return new(big.Float).Mul(ether, price).Text('f', 2), entry.Currency
+}
+
+// StatementRow is one transaction in a statement.
+type StatementRow struct {
+	ID           string `json:"id"`
+	Hash         string `json:"hash"`
+	ChainID      int64  `json:"chainId"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	ValueWei     string `json:"valueWei"`
+	Status       string `json:"status"`
+	Category     string `json:"category,omitempty"`
+	Memo         string `json:"memo,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+	FiatValue    string `json:"fiatValue,omitempty"`
+	FiatCurrency string `json:"fiatCurrency,omitempty"`
+}
+
+// statementCSV renders rows in a fixed column order.
+func statementCSV(rows []*StatementRow) (string, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.Write([]string{"id", "hash", "chainId", "from", "to", "valueWei", "status", "category", "memo", "createdAt", "fiatValue", "fiatCurrency"}); err != nil {
+		return "", err
+	}
+	for _, row := range rows {
+		if err := w.Write([]string{
+			row.ID, row.Hash, strconv.FormatInt(row.ChainID, 10), row.From, row.To,
+			row.ValueWei, row.Status, row.Category, row.Memo, row.CreatedAt, row.FiatValue, row.FiatCurrency,
+		}); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// ExportStatementResponse is returned by rpc_export_statement. Either Content
+// is set (inline) or Key names the stored statement object.
+type ExportStatementResponse struct {
+	Format  string `json:"format"`
+	Count   int    `json:"count"`
+	Content string `json:"content,omitempty"`
+	// Key is set when the statement exceeded the inline cap and was written
+	// to the statements collection under the calling user.
+	Key       string `json:"key,omitempty"`
+	SizeBytes int    `json:"sizeBytes"`
+}
+
+// rpcExportStatement generates a CSV or JSON statement of the calling user's
+// transactions over a date range. Exports are a jurisdiction-restricted
+// operation; see geo.go.
+func rpcExportStatement(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := checkJurisdiction(ctx, nk, userID, geoOpExport); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Format string `json:"format,omitempty"`
+		From   int64  `json:"from,omitempty"`
+		To     int64  `json:"to,omitempty"`
+		// Token is the step-up proof when exports require token freshness;
+		// see freshness.go.
+		Token string `json:"token,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed export request.", codes.InvalidArgument)
+		}
+	}
+	if err := requireFreshUserToken(ctx, nk, userID, req.Token, tokenOpExport); err != nil {
+		return "", err
+	}
+	switch req.Format {
+	case "":
+		req.Format = statementFormatCSV
+	case statementFormatCSV, statementFormatJSON:
+	default:
+		return "", rpcError(errCodeBadInput, "Format must be csv or json.", codes.InvalidArgument)
+	}
+	if req.To == 0 {
+		req.To = moduleClock.Now().Unix()
+	}
+	if req.From > req.To {
+		return "", rpcError(errCodeBadInput, "Range start is after range end.", codes.InvalidArgument)
+	}
+
+	prefs := userPreferences(ctx, nk, userID)
+	rows := make([]*StatementRow, 0, 64)
+	cursor := ""
+	scanned := 0
+	for {
+		objects, next, err := nk.StorageList(ctx, "", userID, tenantCollection(ctx, txCollection), 100, cursor)
+		if err != nil {
+			logger.Error("Statement listing failed for user %v: %v", userID, err)
+			return "", rpcError(errCodeInternal, "Statement generation failed.", codes.Internal)
+		}
+		for _, obj := range objects {
+			scanned++
+			record := &TransactionRecord{}
+			if err := json.Unmarshal([]byte(obj.Value), record); err != nil {
+				logger.Warn("Skipping corrupt transaction record %v: %v", obj.Key, err)
+				continue
+			}
+			if record.CreatedAt < req.From || record.CreatedAt > req.To {
+				continue
+			}
+			fiat, fiatCurrency := fiatValueAt(ctx, record.ChainID, record.Value, record.CreatedAt, prefs.FiatCurrency)
+			rows = append(rows, &StatementRow{
+				ID:           record.ID,
+				Hash:         record.Hash,
+				ChainID:      record.ChainID,
+				From:         record.From,
+				To:           record.To,
+				ValueWei:     record.Value,
+				Status:       record.Status,
+				Category:     record.Category,
+				Memo:         record.Memo,
+				CreatedAt:    time.Unix(record.CreatedAt, 0).UTC().Format(time.RFC3339),
+				FiatValue:    fiat,
+				FiatCurrency: fiatCurrency,
+			})
+		}
+		if next == "" || scanned >= statementMaxRecords {
+			break
+		}
+		cursor = next
+	}
+
+	var content string
+	if req.Format == statementFormatCSV {
+		content, err = statementCSV(rows)
+	} else {
+		var encoded []byte
+		encoded, err = json.Marshal(rows)
+		content = string(encoded)
+	}
+	if err != nil {
+		logger.Error("Statement encoding failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Statement generation failed.", codes.Internal)
+	}
+
+	resp := &ExportStatementResponse{Format: req.Format, Count: len(rows), SizeBytes: len(content)}
+	if len(content) <= statementInlineCap {
+		resp.Content = content
+	} else {
+		// Storage values must be JSON objects, so the rendered statement is
+		// wrapped regardless of format.
+		stored, err := json.Marshal(map[string]string{"format": req.Format, "content": content})
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Statement generation failed.", codes.Internal)
+		}
+		key, err := moduleIDs.NewID()
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Statement generation failed.", codes.Internal)
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection:     statementCollection,
+			Key:            key,
+			UserID:         userID,
+			Value:          string(stored),
+			PermissionRead: 1,
+		}}); err != nil {
+			logger.Error("Statement store failed for user %v: %v", userID, err)
+			return "", rpcError(errCodeInternal, "Statement store failed.", codes.Internal)
+		}
+		resp.Key = key
+	}
+
+	// Best effort; exports are read-only but worth a trail for support.
+	if err := appendAudit(ctx, nk, "statement.exported", userID, map[string]interface{}{
+		"format": req.Format,
+		"from":   req.From,
+		"to":     req.To,
+		"count":  len(rows),
+	}); err != nil {
+		logger.Warn("Audit append failed for statement export of user %v: %v", userID, err)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
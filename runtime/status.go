@@ -0,0 +1,137 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// ID tokens from disabled Cognito users keep validating until they expire, so
+// signature checks alone leave a window where a disabled identity can still
+// open sessions. When NAKAMA_COGNITO_STATUS_URL is configured the module asks
+// Cognito directly via AdminGetUser before establishing a session or link.
+// Results are cached briefly, and the check fails open: a status outage must
+// not take logins down with it.
+
+const (
+	userStatusCacheTTL = time.Minute
+	userStatusTimeout  = 3 * time.Second
+
+	// adminGetUserTarget is the X-Amz-Target for the Cognito IDP JSON API.
+	adminGetUserTarget = "AWSCognitoIdentityProviderService.AdminGetUser"
+)
+
+type userStatusEntry struct {
+	Enabled bool
+	Expires time.Time
+}
+
+var (
+	userStatusMu    sync.Mutex
+	userStatusCache = make(map[string]*userStatusEntry)
+)
+
+// cognitoUserEnabled reports whether the Cognito user identified by sub is
+// still enabled in the pool, caching the answer for userStatusCacheTTL.
+func cognitoUserEnabled(ctx context.Context, sub string) (bool, error) {
+	userStatusMu.Lock()
+	entry := userStatusCache[sub]
+	userStatusMu.Unlock()
+	if entry != nil && moduleClock.Now().Before(entry.Expires) {
+		return entry.Enabled, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, userStatusTimeout)
+	defer cancel()
+
+	// Subjects double as usernames in pools that generate them; pools with
+	// aliases resolve subs through the same call.
+	body, _ := json.Marshal(map[string]string{
+		"UserPoolId": cfg.CognitoUserPoolID,
+		"Username":   sub,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.CognitoStatusURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", adminGetUserTarget)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("status lookup failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Enabled *bool  `json:"Enabled"`
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return false, fmt.Errorf("status response malformed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		// A subject Cognito no longer knows is as unusable as a disabled one.
+		if strings.Contains(decoded.Type, "UserNotFoundException") {
+			return false, nil
+		}
+		return false, fmt.Errorf("status lookup returned HTTP %d: %s", resp.StatusCode, decoded.Type)
+	}
+	if decoded.Enabled == nil {
+		return false, fmt.Errorf("status response missing Enabled field")
+	}
+
+	userStatusMu.Lock()
+	userStatusCache[sub] = &userStatusEntry{
+		Enabled: *decoded.Enabled,
+		Expires: moduleClock.Now().Add(userStatusCacheTTL),
+	}
+	userStatusMu.Unlock()
+	return *decoded.Enabled, nil
+}
+
+// checkUserEnabled gates a login or link on the subject's live Cognito status.
+// Returns nil when the check is unconfigured or unreachable, and
+// ACCOUNT_DISABLED when Cognito reports the user disabled or gone.
+func checkUserEnabled(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, sub string) error {
+	if cfg.CognitoStatusURL == "" {
+		return nil
+	}
+	enabled, err := cognitoUserEnabled(ctx, sub)
+	if err != nil {
+		logger.Warn("Cognito status check failed for sub %v, allowing: %v", sub, err)
+		return nil
+	}
+	if enabled {
+		return nil
+	}
+	metricLogins.WithLabelValues("disabled").Inc()
+	if err := appendAudit(ctx, nk, "login.disabled", "", map[string]interface{}{
+		"sub": sub,
+	}); err != nil {
+		logger.Warn("Audit append failed for disabled login of sub %v: %v", sub, err)
+	}
+	return rpcError(errCodeAccountDisabled, "Account is disabled.", codes.PermissionDenied)
+}
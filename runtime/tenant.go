@@ -0,0 +1,175 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Several game titles can share one cluster running this module. Each title
+// is a tenant with its own Cognito pool, wallet namespace, policy thresholds
+// and webhook endpoint, configured as a JSON array in NAKAMA_TENANTS. A
+// login that names a tenant is verified against that tenant's issuer and the
+// tenant ID rides in the session vars, so every later call resolves its
+// tenant from the session. Tenant wallets and transaction histories live in
+// suffixed storage collections; account-level state (freeze, KYC, dormancy)
+// deliberately spans tenants, since those concern the person, not the title.
+
+// sessionTenantVar is the session token var carrying the tenant ID.
+const sessionTenantVar = "tenant"
+
+// TenantConfig is one title's overrides. Empty fields fall back to the
+// module-level configuration.
+type TenantConfig struct {
+	ID                string   `json:"id"`
+	CognitoRegion     string   `json:"cognitoRegion"`
+	CognitoUserPoolID string   `json:"cognitoUserPoolId"`
+	LoginAudiences    []string `json:"loginAudiences,omitempty"`
+	WebhookURL        string   `json:"webhookUrl,omitempty"`
+	WebhookSecret     string   `json:"webhookSecret,omitempty"`
+	// KYCTxThresholdWei overrides the KYC gating threshold; see policy.go.
+	KYCTxThresholdWei string `json:"kycTxThresholdWei,omitempty"`
+
+	kycThreshold *big.Int
+}
+
+// Issuer returns the expected `iss` claim for this tenant's ID tokens.
+func (t *TenantConfig) Issuer() string {
+	return fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", t.CognitoRegion, t.CognitoUserPoolID)
+}
+
+// JWKSURL returns the Cognito-convention JWKS endpoint for this tenant.
+func (t *TenantConfig) JWKSURL() string {
+	return t.Issuer() + "/.well-known/jwks.json"
+}
+
+// loadTenants parses NAKAMA_TENANTS. Absent means single-tenant operation.
+func loadTenants(ctx context.Context) (map[string]*TenantConfig, error) {
+	raw := moduleEnv(ctx, "NAKAMA_TENANTS")
+	if raw == "" {
+		return nil, nil
+	}
+	var list []*TenantConfig
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, fmt.Errorf("invalid NAKAMA_TENANTS: %w", err)
+	}
+	tenants := make(map[string]*TenantConfig, len(list))
+	for _, tenant := range list {
+		if tenant.ID == "" || tenant.CognitoRegion == "" || tenant.CognitoUserPoolID == "" {
+			return nil, fmt.Errorf("invalid NAKAMA_TENANTS: each tenant needs an id, cognitoRegion and cognitoUserPoolId")
+		}
+		if _, dup := tenants[tenant.ID]; dup {
+			return nil, fmt.Errorf("invalid NAKAMA_TENANTS: duplicate tenant %q", tenant.ID)
+		}
+		if tenant.KYCTxThresholdWei != "" {
+			threshold, ok := new(big.Int).SetString(tenant.KYCTxThresholdWei, 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid NAKAMA_TENANTS: tenant %q kycTxThresholdWei is not an integer", tenant.ID)
+			}
+			tenant.kycThreshold = threshold
+		}
+		tenants[tenant.ID] = tenant
+	}
+	return tenants, nil
+}
+
+// tenantJWKS lazily holds one key manager per active tenant, bounded by the
+// configured issuer cap; the module-level jwksManager serves the default
+// tenant. See jwksCache in jwks.go.
+var tenantJWKS = &jwksCache{entries: make(map[string]*jwksCacheEntry)}
+
+// tenantKeys resolves the key manager for a tenant, creating it on first
+// use. Tenant pools skip discovery; the Cognito JWKS convention always holds
+// for them since tenants are keyed by region and pool ID.
+func tenantKeys(tenant *TenantConfig) *JWKSManager {
+	return tenantJWKS.manager(tenant.ID, tenant.JWKSURL(), cfg.JWKSCacheTTL, cfg.JWKSMinTTL, cfg.JWKSMaxTTL)
+}
+
+// tenantByID resolves a tenant ID to its configuration. The empty ID is the
+// default tenant and resolves to nil.
+func tenantByID(id string) (*TenantConfig, error) {
+	if id == "" {
+		return nil, nil
+	}
+	tenant, ok := cfg.Tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant %q", id)
+	}
+	return tenant, nil
+}
+
+// tenantCtxKey overrides the session-var resolution, for admin RPCs acting
+// on a named tenant's data.
+type tenantCtxKey struct{}
+
+// tenantContext returns a context pinned to the given tenant ID.
+func tenantContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantCtxKey{}, id)
+}
+
+// tenantFromContext resolves the calling tenant: an explicit pin first, then
+// the session var stamped at login. Empty is the default tenant, which is
+// also what server-to-server calls without a pin resolve to.
+func tenantFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantCtxKey{}).(string); ok {
+		return id
+	}
+	vars, _ := ctx.Value(nkruntime.RUNTIME_CTX_VARS).(map[string]string)
+	return vars[sessionTenantVar]
+}
+
+// tenantCollection namespaces a storage collection for the calling tenant.
+// The default tenant keeps the bare name so single-tenant deployments are
+// unaffected and existing data stays addressable.
+func tenantCollection(ctx context.Context, base string) string {
+	if id := tenantFromContext(ctx); id != "" {
+		return base + "#" + id
+	}
+	return base
+}
+
+// tenantCollections returns the collection name for every tenant including
+// the default, for workers that sweep all of them.
+func tenantCollections(base string) []string {
+	out := make([]string, 0, 1+len(cfg.Tenants))
+	out = append(out, base)
+	for id := range cfg.Tenants {
+		out = append(out, base+"#"+id)
+	}
+	return out
+}
+
+// tenantWebhook returns the webhook endpoint and secret for a tenant,
+// falling back to the module-level endpoint.
+func tenantWebhook(id string) (url, secret string) {
+	if tenant, err := tenantByID(id); err == nil && tenant != nil && tenant.WebhookURL != "" {
+		return tenant.WebhookURL, tenant.WebhookSecret
+	}
+	return cfg.WebhookURL, cfg.WebhookSecret
+}
+
+// tenantKYCThreshold returns the KYC gating threshold for the calling
+// tenant, or the module-level threshold.
+func tenantKYCThreshold(ctx context.Context) *big.Int {
+	if tenant, err := tenantByID(tenantFromContext(ctx)); err == nil && tenant != nil && tenant.kycThreshold != nil {
+		return tenant.kycThreshold
+	}
+	return cfg.KYCTxThresholdWei
+}
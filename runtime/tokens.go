@@ -0,0 +1,268 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// The token registry is the single source of token metadata (symbol,
+// decimals, icon) so clients stop hard-coding it. It is storage-backed,
+// seeded from config at startup and editable by admins at runtime.
+
+const tokenCollection = "token_registry"
+
+// TokenInfo describes one token on one chain. Address "native" denotes the
+// chain's native asset.
+type TokenInfo struct {
+	ChainID    int64  `json:"chainId"`
+	Address    string `json:"address"`
+	Symbol     string `json:"symbol"`
+	Decimals   int    `json:"decimals"`
+	IconURL    string `json:"iconUrl,omitempty"`
+	Precedence int    `json:"precedence,omitempty"` // Lower sorts first in listings.
+}
+
+// tokenNativeAddress is the registry address for a chain's native asset.
+const tokenNativeAddress = "native"
+
+func tokenRegistryKey(chainID int64, address string) string {
+	return fmt.Sprintf("%d:%s", chainID, strings.ToLower(address))
+}
+
+func (t *TokenInfo) validate() error {
+	if t.ChainID <= 0 {
+		return fmt.Errorf("chainId must be positive")
+	}
+	if t.Address != tokenNativeAddress {
+		if _, err := parseHexAddress(t.Address); err != nil {
+			return fmt.Errorf("invalid token address: %v", err)
+		}
+	}
+	if t.Symbol == "" {
+		return fmt.Errorf("symbol must be set")
+	}
+	if t.Decimals < 0 || t.Decimals > 36 {
+		return fmt.Errorf("decimals out of range")
+	}
+	return nil
+}
+
+func writeToken(ctx context.Context, nk nkruntime.NakamaModule, token *TokenInfo) error {
+	token.Address = strings.ToLower(token.Address)
+	value, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     tokenCollection,
+		Key:            tokenRegistryKey(token.ChainID, token.Address),
+		Value:          string(value),
+		PermissionRead: 2,
+	}})
+	return err
+}
+
+// lookupToken fetches registry metadata for a token, nil when unregistered.
+func lookupToken(ctx context.Context, nk nkruntime.NakamaModule, chainID int64, address string) (*TokenInfo, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: tokenCollection,
+		Key:        tokenRegistryKey(chainID, address),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	token := &TokenInfo{}
+	if err := json.Unmarshal([]byte(objects[0].Value), token); err != nil {
+		return nil, fmt.Errorf("token registry entry corrupt: %w", err)
+	}
+	return token, nil
+}
+
+// formatTokenAmount renders a raw integer token amount as a decimal string
+// using the token's decimals, trimming trailing zeros.
+func formatTokenAmount(amount *big.Int, decimals int) string {
+	if decimals == 0 {
+		return amount.String()
+	}
+	divisor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(amount, divisor, new(big.Int))
+	fracStr := strings.TrimRight(fmt.Sprintf("%0*s", decimals, frac.Abs(frac).String()), "0")
+	if fracStr == "" {
+		return whole.String()
+	}
+	return whole.String() + "." + fracStr
+}
+
+// parseTokenAmount converts a human-unit decimal amount ("1.5") into raw
+// integer units using the token's decimals.
+func parseTokenAmount(amount string, decimals int) (*big.Int, error) {
+	whole := amount
+	frac := ""
+	if i := strings.IndexByte(amount, '.'); i >= 0 {
+		whole, frac = amount[:i], amount[i+1:]
+	}
+	if whole == "" && frac == "" {
+		return nil, fmt.Errorf("amount must be set")
+	}
+	if len(frac) > decimals {
+		return nil, fmt.Errorf("amount has more than %d decimal places", decimals)
+	}
+	digits := whole + frac + strings.Repeat("0", decimals-len(frac))
+	v, ok := new(big.Int).SetString(digits, 10)
+	if !ok || v.Sign() < 0 {
+		return nil, fmt.Errorf("amount %q is not a non-negative decimal", amount)
+	}
+	return v, nil
+}
+
+// lookupTokenBySymbol resolves a registry entry by symbol on a chain,
+// case-insensitively. Nil when no entry matches.
+func lookupTokenBySymbol(ctx context.Context, nk nkruntime.NakamaModule, chainID int64, symbol string) (*TokenInfo, error) {
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", tokenCollection, 100, cursor)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			token := &TokenInfo{}
+			if err := json.Unmarshal([]byte(obj.Value), token); err != nil {
+				continue
+			}
+			if token.ChainID == chainID && strings.EqualFold(token.Symbol, symbol) {
+				return token, nil
+			}
+		}
+		if next == "" {
+			return nil, nil
+		}
+		cursor = next
+	}
+}
+
+// seedTokenRegistry loads config-declared tokens at startup. Existing
+// registry entries win over seeds so runtime edits survive restarts.
+func seedTokenRegistry(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) error {
+	seed := moduleEnv(ctx, "NAKAMA_TOKEN_REGISTRY_SEED")
+	if seed == "" {
+		return nil
+	}
+	var tokens []*TokenInfo
+	if err := json.Unmarshal([]byte(seed), &tokens); err != nil {
+		return fmt.Errorf("invalid NAKAMA_TOKEN_REGISTRY_SEED: %w", err)
+	}
+	for _, token := range tokens {
+		if err := token.validate(); err != nil {
+			return fmt.Errorf("invalid seed token %s: %w", token.Symbol, err)
+		}
+		existing, err := lookupToken(ctx, nk, token.ChainID, token.Address)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			continue
+		}
+		if err := writeToken(ctx, nk, token); err != nil {
+			return err
+		}
+		logger.Info("Seeded token registry entry %v (chain %v)", token.Symbol, token.ChainID)
+	}
+	return nil
+}
+
+// rpcAdminUpsertToken creates or replaces a token registry entry.
+// Server-to-server only.
+func rpcAdminUpsertToken(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	token := &TokenInfo{}
+	if err := unmarshalPayload(payload, token); err != nil {
+		return "", rpcError(errCodeBadInput, "Expects a token registry entry payload.", codes.InvalidArgument)
+	}
+	if err := token.validate(); err != nil {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Invalid token entry: %v.", err), codes.InvalidArgument)
+	}
+	if err := writeToken(ctx, nk, token); err != nil {
+		logger.Error("Token registry write failed: %v", err)
+		return "", rpcError(errCodeInternal, "Token registry write failed.", codes.Internal)
+	}
+	out, _ := json.Marshal(token)
+	return string(out), nil
+}
+
+// rpcListTokens returns all registered tokens, optionally filtered by chain,
+// ordered by display precedence then symbol.
+func rpcListTokens(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		ChainID int64 `json:"chainId,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed listing request.", codes.InvalidArgument)
+		}
+	}
+
+	tokens := make([]*TokenInfo, 0)
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", tokenCollection, 100, cursor)
+		if err != nil {
+			logger.Error("Token registry listing failed: %v", err)
+			return "", rpcError(errCodeInternal, "Token listing failed.", codes.Internal)
+		}
+		for _, obj := range objects {
+			token := &TokenInfo{}
+			if err := json.Unmarshal([]byte(obj.Value), token); err != nil {
+				logger.Warn("Skipping corrupt token registry entry %v: %v", obj.Key, err)
+				continue
+			}
+			if req.ChainID != 0 && token.ChainID != req.ChainID {
+				continue
+			}
+			tokens = append(tokens, token)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Precedence != tokens[j].Precedence {
+			return tokens[i].Precedence < tokens[j].Precedence
+		}
+		return tokens[i].Symbol < tokens[j].Symbol
+	})
+
+	out, err := json.Marshal(map[string]interface{}{"tokens": tokens})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,336 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// rpc_transfer is the high-level send surface for game code: chain, asset,
+// recipient and a human-unit amount. Decimals, calldata, fee selection,
+// policy and signing are handled internally by the same pipeline raw
+// rpc_sign_and_send uses. Each transfer carries a caller-chosen idempotency
+// key; a replayed key returns the original transfer instead of signing
+// twice, so game servers can retry blindly across timeouts.
+
+const transferCollection = "transfers"
+
+// Transfer statuses. Signed transfers track the underlying transaction
+// record for terminal status.
+const (
+	transferStatusPending = "pending"
+	transferStatusSigned  = "signed"
+)
+
+// erc20TransferSelector is the 4-byte selector of transfer(address,uint256).
+const erc20TransferSelector = "a9059cbb"
+
+// transferTokenGas is the gas limit used for registry token transfers; plain
+// native sends use the protocol minimum.
+const (
+	transferNativeGas = 21000
+	transferTokenGas  = 65000
+)
+
+// TransferRequest is the rpc_transfer request body.
+type TransferRequest struct {
+	// ChainID defaults to the configured chain.
+	ChainID int64 `json:"chainId,omitempty"`
+	// Asset is a registry token symbol, or "native" for the chain's own
+	// asset. Defaults to native.
+	Asset string `json:"asset,omitempty"`
+	To    string `json:"to"`
+	// Amount is in human units, e.g. "1.5".
+	Amount string `json:"amount"`
+	// IdempotencyKey deduplicates retries; required.
+	IdempotencyKey string `json:"idempotencyKey"`
+	// Nonce may be omitted when the module manages nonces itself (see
+	// txnonce.go) and is required otherwise; a supplied value always wins.
+	Nonce       *uint64           `json:"nonce"`
+	WalletLabel string            `json:"walletLabel,omitempty"`
+	Memo        string            `json:"memo,omitempty"`
+	SponsorGas  bool              `json:"sponsorGas,omitempty"`
+	Context     map[string]string `json:"context,omitempty"`
+}
+
+// TransferRecord tracks one idempotent transfer and its underlying
+// transaction.
+type TransferRecord struct {
+	ID             string `json:"id"`
+	IdempotencyKey string `json:"idempotencyKey"`
+	ChainID        int64  `json:"chainId"`
+	Asset          string `json:"asset"`
+	To             string `json:"to"`
+	Amount         string `json:"amount"`
+	AmountRaw      string `json:"amountRaw"`
+	TxID           string `json:"txId,omitempty"`
+	Hash           string `json:"hash,omitempty"`
+	Status         string `json:"status"`
+	CreatedAt      int64  `json:"createdAt"`
+	// Replayed is set at response time when an idempotency key was reused.
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// erc20TransferCalldata ABI-encodes transfer(address,uint256).
+func erc20TransferCalldata(to []byte, amount *big.Int) string {
+	data := make([]byte, 0, 4+32+32)
+	selector, _ := hex.DecodeString(erc20TransferSelector)
+	data = append(data, selector...)
+	padded := make([]byte, 32)
+	copy(padded[12:], to)
+	data = append(data, padded...)
+	amountWord := make([]byte, 32)
+	amount.FillBytes(amountWord)
+	data = append(data, amountWord...)
+	return "0x" + hex.EncodeToString(data)
+}
+
+// rpcTransfer signs an asset transfer for the calling user's wallet.
+func rpcTransfer(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireSigningSession(ctx); err != nil {
+		return "", err
+	}
+
+	req := &TransferRequest{}
+	if err := unmarshalPayload(payload, req); err != nil {
+		return "", rpcError(errCodeBadInput, "Expects a transfer request payload.", codes.InvalidArgument)
+	}
+	if req.To == "" || req.Amount == "" || req.IdempotencyKey == "" {
+		return "", rpcError(errCodeBadInput, "Expects to, amount and idempotencyKey.", codes.InvalidArgument)
+	}
+	if req.Nonce == nil && !txNonceManagerEnabled() {
+		return "", rpcError(errCodeBadInput, "Expects a nonce.", codes.InvalidArgument)
+	}
+	if req.ChainID == 0 {
+		req.ChainID = cfg.EVMChainID
+	}
+	if req.ChainID != cfg.EVMChainID {
+		return "", rpcError(errCodeBadInput, "Requested chain is not served by this deployment.", codes.InvalidArgument)
+	}
+	recipient, err := parseHexAddress(req.To)
+	if err != nil {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Invalid recipient: %v.", err), codes.InvalidArgument)
+	}
+	if req.Asset == "" {
+		req.Asset = tokenNativeAddress
+	}
+
+	// Replay check first: a reused key short-circuits before any chain work.
+	existing, err := readTransferRecord(ctx, nk, userID, req.IdempotencyKey)
+	if err != nil {
+		logger.Error("Transfer replay check failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Transfer lookup failed.", codes.Internal)
+	}
+	if existing != nil {
+		existing.Replayed = true
+		out, err := json.Marshal(existing)
+		if err != nil {
+			return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+		}
+		return string(out), nil
+	}
+
+	// Resolve the asset to raw units and calldata.
+	decimals := 18
+	var token *TokenInfo
+	if req.Asset != tokenNativeAddress {
+		token, err = lookupTokenBySymbol(ctx, nk, req.ChainID, req.Asset)
+		if err != nil {
+			logger.Error("Token registry lookup failed for %v: %v", req.Asset, err)
+			return "", rpcError(errCodeInternal, "Token lookup failed.", codes.Internal)
+		}
+		if token == nil || token.Address == tokenNativeAddress {
+			if token != nil {
+				// Registry entries for the native asset route as native sends.
+				token = nil
+			} else {
+				return "", rpcError(errCodeBadInput, fmt.Sprintf("Asset %q is not in the token registry for chain %d.", req.Asset, req.ChainID), codes.InvalidArgument)
+			}
+		} else {
+			decimals = token.Decimals
+		}
+	}
+	amountRaw, err := parseTokenAmount(req.Amount, decimals)
+	if err != nil {
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Invalid amount: %v.", err), codes.InvalidArgument)
+	}
+
+	// Fees come from the oracle so callers never pick them; the suggested
+	// ceiling mirrors rpc_get_fee_estimate.
+	snap, _, err := feeOracleShared.snapshot(ctx, req.ChainID)
+	if err != nil {
+		logger.Warn("Fee oracle unavailable for transfer by user %v: %v", userID, err)
+		return "", rpcError(errCodeRetryLater, "Fee data is unavailable; retry shortly.", codes.Unavailable)
+	}
+	maxFee := new(big.Int).Mul(snap.BaseFee, big.NewInt(2))
+	priority := new(big.Int)
+	if median := snap.Priority["p50"]; median != nil {
+		maxFee.Add(maxFee, median)
+		priority.Set(median)
+	}
+
+	evmReq := &EVMTransactionRequest{
+		Nonce:                req.Nonce,
+		MaxFeePerGas:         maxFee.String(),
+		MaxPriorityFeePerGas: priority.String(),
+		WalletLabel:          req.WalletLabel,
+		Memo:                 req.Memo,
+		SponsorGas:           req.SponsorGas,
+		Context:              req.Context,
+	}
+	if token == nil {
+		evmReq.To = req.To
+		evmReq.Value = amountRaw.String()
+		evmReq.Gas = transferNativeGas
+	} else {
+		evmReq.To = token.Address
+		evmReq.Value = "0"
+		evmReq.Data = erc20TransferCalldata(recipient, amountRaw)
+		evmReq.Gas = transferTokenGas
+		if evmReq.Memo != "" {
+			// The memo channel is the calldata, which token transfers occupy.
+			return "", rpcError(errCodeBadInput, "Memos are only supported on native transfers.", codes.InvalidArgument)
+		}
+	}
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Transfer ID generation failed.", codes.Internal)
+	}
+	record := &TransferRecord{
+		ID:             id,
+		IdempotencyKey: req.IdempotencyKey,
+		ChainID:        req.ChainID,
+		Asset:          req.Asset,
+		To:             req.To,
+		Amount:         req.Amount,
+		AmountRaw:      amountRaw.String(),
+		Status:         transferStatusPending,
+		CreatedAt:      moduleClock.Now().Unix(),
+	}
+	// Reserve the idempotency key with a create-only write before signing so
+	// two concurrent retries cannot both reach the signer.
+	if reserved, err := writeTransferRecord(ctx, nk, userID, record, "*"); err != nil {
+		logger.Error("Transfer reservation failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Transfer reservation failed.", codes.Internal)
+	} else if !reserved {
+		return "", rpcError(errCodeRetryLater, "A transfer with this idempotency key is already in flight.", codes.Aborted)
+	}
+
+	wallet, err := ensureWalletLabeled(ctx, logger, nk, userID, req.WalletLabel)
+	if err != nil {
+		releaseTransferReservation(ctx, logger, nk, userID, req.IdempotencyKey)
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Error("Wallet lookup failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal)
+	}
+
+	txRecord, err := signAndSendEVMTransaction(ctx, logger, nk, userID, wallet, evmReq)
+	if err != nil {
+		// A failed signing releases the key so the caller can retry.
+		releaseTransferReservation(ctx, logger, nk, userID, req.IdempotencyKey)
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Debug("Transfer signing rejected for user %v: %v", userID, err)
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Transfer rejected: %v.", err), codes.InvalidArgument)
+	}
+
+	record.TxID = txRecord.ID
+	record.Hash = txRecord.Hash
+	record.Status = transferStatusSigned
+	if _, err := writeTransferRecord(ctx, nk, userID, record, ""); err != nil {
+		// The transaction is signed and recorded; the transfer view lagging
+		// behind is recoverable from the tx record.
+		logger.Error("Transfer record update failed for user %v: %v", userID, err)
+	}
+
+	out, err := json.Marshal(record)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// readTransferRecord fetches a transfer by idempotency key, nil when unused.
+func readTransferRecord(ctx context.Context, nk nkruntime.NakamaModule, userID, key string) (*TransferRecord, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: tenantCollection(ctx, transferCollection),
+		Key:        key,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	record := &TransferRecord{}
+	if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+		return nil, fmt.Errorf("transfer record corrupt: %w", err)
+	}
+	return record, nil
+}
+
+// writeTransferRecord persists a transfer under its idempotency key. With
+// version "*" the write is create-only and a conflict returns false.
+func writeTransferRecord(ctx context.Context, nk nkruntime.NakamaModule, userID string, record *TransferRecord, version string) (bool, error) {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return false, err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     tenantCollection(ctx, transferCollection),
+		Key:            record.IdempotencyKey,
+		UserID:         userID,
+		Value:          string(value),
+		Version:        version,
+		PermissionRead: 1,
+	}})
+	if err != nil {
+		if version == "*" {
+			// A version conflict means the key is already reserved.
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseTransferReservation drops a reserved idempotency key after a failed
+// signing so retries are not locked out. Best effort.
+func releaseTransferReservation(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, key string) {
+	if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: tenantCollection(ctx, transferCollection),
+		Key:        key,
+		UserID:     userID,
+	}}); err != nil {
+		logger.Warn("Transfer reservation release failed for user %v key %v: %v", userID, key, err)
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+const txCollection = "transactions"
+
+// Transaction statuses.
+const (
+	txStatusSigned    = "signed"
+	txStatusBroadcast = "broadcast"
+	txStatusConfirmed = "confirmed"
+	txStatusFailed    = "failed"
+)
+
+// TransactionRecord is the stored view of a signed transaction.
+type TransactionRecord struct {
+	ID            string            `json:"id"`
+	ChainID       int64             `json:"chainId"`
+	Hash          string            `json:"hash"`
+	From          string            `json:"from"`
+	To            string            `json:"to"`
+	Value         string            `json:"value,omitempty"`
+	Data          string            `json:"data,omitempty"`
+	Decoded       *DecodedCall      `json:"decoded,omitempty"`
+	Memo          string            `json:"memo,omitempty"`
+	Authorization *TxAuthorization  `json:"authorization,omitempty"`
+	Nonce         uint64            `json:"nonce"`
+	Sponsored     bool              `json:"sponsored,omitempty"`
+	Category      string            `json:"category,omitempty"`
+	Context       map[string]string `json:"context,omitempty"`
+	Raw           string            `json:"raw"`
+	Status        string            `json:"status"`
+	CreatedAt     int64             `json:"createdAt"`
+	// ExplorerURL is filled in at response time, never stored; see explorer.go.
+	ExplorerURL string `json:"explorerUrl,omitempty"`
+}
+
+// writeTransactionRecord persists a transaction record under the owning user.
+func writeTransactionRecord(ctx context.Context, nk nkruntime.NakamaModule, userID string, record *TransactionRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     tenantCollection(ctx, txCollection),
+		Key:            record.ID,
+		UserID:         userID,
+		Value:          string(value),
+		PermissionRead: 1,
+	}}); err != nil {
+		return fmt.Errorf("transaction record write failed: %w", err)
+	}
+	sinkExport("transaction", record)
+	return nil
+}
+
+// signAndSendEVMTransaction runs the signing pipeline for a user request:
+// validation, calldata decoding, signing, record persistence, audit and —
+// with NAKAMA_EVM_BROADCAST enabled — submission to the configured node; see
+// broadcast.go. Without broadcasting the signed transaction is returned with
+// its locally computed hash for the caller to submit.
+func signAndSendEVMTransaction(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID string, wallet *Wallet, req *EVMTransactionRequest) (*TransactionRecord, error) {
+	if err := checkWalletFrozen(ctx, nk, userID); err != nil {
+		return nil, err
+	}
+	value, err := parseWei(req.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateTxContext(req.Context); err != nil {
+		return nil, err
+	}
+	if err := applyMemo(req); err != nil {
+		return nil, err
+	}
+	if err := validateFeeSanity(ctx, logger, req); err != nil {
+		return nil, err
+	}
+	if req.Authorization != nil {
+		if err := verifyTxAuthorization(userID, req, req.Authorization); err != nil {
+			return nil, err
+		}
+	}
+	// Intent gating: a referenced intent must match and is consumed; with
+	// enforcement on, client-built requests without one are refused outright.
+	if req.IntentID != "" {
+		if err := consumeIntent(ctx, nk, userID, req.IntentID, req, value); err != nil {
+			return nil, err
+		}
+	} else if cfg.RequireTxIntent && req.Authorization == nil {
+		return nil, fmt.Errorf("transaction requires a pre-authorized intent")
+	}
+	if err := evaluateTransactionPolicy(ctx, nk, userID, value); err != nil {
+		return nil, err
+	}
+	if err := screenDestination(ctx, logger, nk, userID, req.To); err != nil {
+		return nil, err
+	}
+
+	if req.SponsorGas {
+		maxFee, err := parseWei(req.MaxFeePerGas)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAndRecordGasSponsorship(ctx, nk, userID, cfg.EVMChainID, req.Context["feature"], req.Gas, maxFee); err != nil {
+			return nil, err
+		}
+	}
+
+	// Reserve an in-flight slot before signing; released by the watcher when
+	// the transaction reaches a terminal status, or below on failure.
+	if err := adjustPendingTx(ctx, nk, userID, 1); err != nil {
+		return nil, err
+	}
+	releaseSlot := func() {
+		if err := adjustPendingTx(ctx, nk, userID, -1); err != nil {
+			logger.Warn("Pending slot release failed for user %v: %v", userID, err)
+		}
+	}
+
+	// Fill the nonce server-side when the caller left it out; allocated after
+	// the slot reservation so a cap refusal never burns a nonce. A supplied
+	// value always wins; see txnonce.go.
+	nonceFilled := false
+	if req.Nonce == nil && txNonceManagerEnabled() {
+		nonce, err := allocateTxNonce(ctx, nk, wallet.Address)
+		if err != nil {
+			releaseSlot()
+			return nil, err
+		}
+		req.Nonce = &nonce
+		nonceFilled = true
+	}
+	releaseNonce := func() {
+		if nonceFilled {
+			releaseTxNonce(ctx, logger, nk, wallet.Address, *req.Nonce)
+		}
+	}
+
+	raw, hash, err := signEVMTransaction(ctx, wallet, req, signPurposeUserTx)
+	if err != nil {
+		releaseSlot()
+		releaseNonce()
+		return nil, err
+	}
+
+	decoded, err := decodeCalldata(ctx, nk, cfg.EVMChainID, req.To, mustParseHexData(req.Data))
+	if err != nil {
+		// Best-effort: a broken registry entry must not block signing.
+		logger.Warn("Calldata decode failed for tx to %v: %v", req.To, err)
+	}
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		releaseSlot()
+		releaseNonce()
+		return nil, err
+	}
+	record := &TransactionRecord{
+		ID:            id,
+		ChainID:       cfg.EVMChainID,
+		Hash:          "0x" + hex.EncodeToString(hash),
+		From:          wallet.Address,
+		To:            req.To,
+		Value:         req.Value,
+		Data:          req.Data,
+		Decoded:       decoded,
+		Memo:          req.Memo,
+		Authorization: req.Authorization,
+		Nonce:         *req.Nonce,
+		Sponsored:     req.SponsorGas,
+		Category:      categorizeTransaction(req.To, req.Data),
+		Context:       req.Context,
+		Raw:           "0x" + hex.EncodeToString(raw),
+		Status:        txStatusSigned,
+		CreatedAt:     moduleClock.Now().Unix(),
+	}
+
+	if err := withRetry(ctx, logger, "tx_record_write", func() error {
+		return writeTransactionRecord(ctx, nk, userID, record)
+	}); err != nil {
+		releaseSlot()
+		releaseNonce()
+		return nil, err
+	}
+
+	auditDetails := map[string]interface{}{
+		"txId":           record.ID,
+		"hash":           record.Hash,
+		"to":             record.To,
+		"value":          record.Value,
+		"chainId":        record.ChainID,
+		"signingContext": signingContextFor(wallet, signPurposeUserTx),
+	}
+	if decoded != nil {
+		auditDetails["decoded"] = decoded
+	}
+	if record.Category != "" {
+		auditDetails["category"] = record.Category
+	}
+	if req.IntentID != "" {
+		auditDetails["intentId"] = req.IntentID
+	}
+	if len(req.Context) > 0 {
+		auditDetails["context"] = req.Context
+	}
+	if req.Authorization != nil {
+		auditDetails["eventId"] = req.Authorization.EventID
+		auditDetails["rule"] = req.Authorization.Rule
+	}
+	if err := appendAudit(ctx, nk, "tx.signed", userID, auditDetails); err != nil {
+		logger.Error("Audit append failed for tx %v: %v", record.ID, err)
+		return nil, err
+	}
+	metricTxSigned.Inc()
+	// Best effort; dormancy tracking must not fail signing.
+	if err := touchActivity(ctx, nk, userID, "tx"); err != nil {
+		logger.Warn("Activity record failed for user %v: %v", userID, err)
+	}
+
+	// Blob transactions are excluded from auto-broadcast: the signed envelope
+	// here is the canonical (hashing) form, but eth_sendRawTransaction wants
+	// the network wrapper with the blob sidecar, which travels with the
+	// external broadcaster. They stay signed for that pipeline to pick up.
+	if cfg.EVMBroadcast && cfg.EVMRPCURL != "" && !isBlobTransaction(req) {
+		if err := broadcastTransactionRecord(ctx, logger, nk, userID, record); err != nil {
+			var rejected *txRejectedError
+			if errors.As(err, &rejected) {
+				// The node will never accept this transaction; close out the
+				// record so the nonce and pending slot are not tied up.
+				record.Status = txStatusFailed
+				if writeErr := writeTransactionRecord(ctx, nk, userID, record); writeErr != nil {
+					logger.Warn("Failed-status write failed for tx %v: %v", record.ID, writeErr)
+				}
+				releaseSlot()
+				releaseNonce()
+				return nil, rpcError(errCodeBadInput, fmt.Sprintf("Transaction rejected by the node: %v.", rejected.message), codes.InvalidArgument)
+			}
+			// Transient exhaustion: the signed transaction is persisted and the
+			// watcher or a re-broadcast can still land it.
+			logger.Error("Broadcast failed for tx %v: %v", record.ID, err)
+			return nil, rpcError(errCodeInternal, "Transaction was signed but broadcast failed; it remains queued.", codes.Unavailable)
+		}
+	}
+
+	return record, nil
+}
+
+// mustParseHexData is parseHexData for inputs already validated by the
+// signing path.
+func mustParseHexData(s string) []byte {
+	b, _ := parseHexData(s)
+	return b
+}
+
+// rpcSignAndSend signs an EVM transaction for the calling user's wallet.
+func rpcSignAndSend(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireSigningSession(ctx); err != nil {
+		return "", err
+	}
+
+	req := &EVMTransactionRequest{}
+	if err := unmarshalPayload(payload, req); err != nil {
+		return "", rpcError(errCodeBadInput, "Expects an EVM transaction request payload.", codes.InvalidArgument)
+	}
+
+	wallet, err := ensureWalletLabeled(ctx, logger, nk, userID, req.WalletLabel)
+	if err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Error("Wallet lookup failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal)
+	}
+
+	record, err := signAndSendEVMTransaction(ctx, logger, nk, userID, wallet, req)
+	if err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Debug("Transaction signing rejected for user %v: %v", userID, err)
+		return "", rpcError(errCodeBadInput, fmt.Sprintf("Transaction rejected: %v.", err), codes.InvalidArgument)
+	}
+	record.ExplorerURL = explorerTxURL(record.ChainID, record.Hash)
+
+	out, err := json.Marshal(record)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// ListTransactionsResponse is returned by rpc_list_transactions.
+type ListTransactionsResponse struct {
+	Transactions []*TransactionRecord `json:"transactions"`
+	Cursor       string               `json:"cursor,omitempty"`
+}
+
+// rpcListTransactions lists the calling user's transaction records.
+func rpcListTransactions(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Limit    int               `json:"limit,omitempty"`
+		Cursor   string            `json:"cursor,omitempty"`
+		Context  map[string]string `json:"context,omitempty"`
+		Category string            `json:"category,omitempty"`
+		// Gzip asks for a compressed response envelope; see compress.go.
+		Gzip bool `json:"gzip,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed listing request.", codes.InvalidArgument)
+		}
+	}
+	if req.Category != "" && !txCategories[req.Category] {
+		return "", rpcError(errCodeBadInput, "Unknown transaction category.", codes.InvalidArgument)
+	}
+	req.Limit = normalizeListLimit(req.Limit)
+	fhash := listFilterHash(map[string]interface{}{"context": req.Context, "category": req.Category})
+	storageCursor, err := decodeListCursor(req.Cursor, fhash)
+	if err != nil {
+		return "", err
+	}
+
+	objects, cursor, err := nk.StorageList(ctx, "", userID, tenantCollection(ctx, txCollection), req.Limit, storageCursor)
+	if err != nil {
+		logger.Error("Transaction listing failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Transaction listing failed.", codes.Internal)
+	}
+
+	resp := &ListTransactionsResponse{Transactions: make([]*TransactionRecord, 0, len(objects)), Cursor: encodeListCursor(cursor, fhash)}
+	for _, obj := range objects {
+		record := &TransactionRecord{}
+		if err := json.Unmarshal([]byte(obj.Value), record); err != nil {
+			logger.Warn("Skipping corrupt transaction record %v: %v", obj.Key, err)
+			continue
+		}
+		if !matchesTxContextFilter(record.Context, req.Context) {
+			continue
+		}
+		if req.Category != "" && record.Category != req.Category {
+			continue
+		}
+		record.ExplorerURL = explorerTxURL(record.ChainID, record.Hash)
+		resp.Transactions = append(resp.Transactions, record)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	encoded, err := encodeResponse(userID, string(out), req.Gzip)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return encoded, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Transactions triggered by game logic on a user's behalf (quest rewards,
+// crafting mints) carry an authorization artifact: the game event that caused
+// the spend, the rule that permitted it, and an HMAC over the intent. The
+// artifact is verified at signing time and stored with the transaction
+// record, so post-hoc disputes can tie a spend back to the user action.
+
+// TxAuthorization is the artifact attached to server-initiated transactions.
+type TxAuthorization struct {
+	// EventID identifies the game event that triggered the transaction.
+	EventID string `json:"eventId"`
+	// Rule names the game rule that permitted it.
+	Rule     string `json:"rule"`
+	IssuedAt int64  `json:"issuedAt"`
+	// Signature is hex HMAC-SHA256 over the intent, keyed by
+	// NAKAMA_TX_AUTH_SECRET.
+	Signature string `json:"signature"`
+}
+
+// txIntentMAC signs the fields that define the intent: who spends, why, to
+// whom and how much.
+func txIntentMAC(userID string, req *EVMTransactionRequest, auth *TxAuthorization) string {
+	mac := hmac.New(sha256.New, []byte(cfg.TxAuthSecret))
+	fmt.Fprintf(mac, "%s|%s|%s|%d|%s|%s", userID, auth.EventID, auth.Rule, auth.IssuedAt, req.To, req.Value)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewTxAuthorization builds a signed authorization artifact for a
+// server-initiated transaction. Exported for sibling modules using the
+// in-process WalletService.
+func NewTxAuthorization(userID, eventID, rule string, req *EVMTransactionRequest) (*TxAuthorization, error) {
+	if cfg.TxAuthSecret == "" {
+		return nil, fmt.Errorf("NAKAMA_TX_AUTH_SECRET is not configured")
+	}
+	if eventID == "" || rule == "" {
+		return nil, fmt.Errorf("authorization requires an event ID and rule")
+	}
+	auth := &TxAuthorization{
+		EventID:  eventID,
+		Rule:     rule,
+		IssuedAt: moduleClock.Now().Unix(),
+	}
+	auth.Signature = txIntentMAC(userID, req, auth)
+	return auth, nil
+}
+
+// verifyTxAuthorization checks an artifact against the request it rides on.
+func verifyTxAuthorization(userID string, req *EVMTransactionRequest, auth *TxAuthorization) error {
+	if cfg.TxAuthSecret == "" {
+		return fmt.Errorf("authorization attached but NAKAMA_TX_AUTH_SECRET is not configured")
+	}
+	if auth.EventID == "" || auth.Rule == "" || auth.Signature == "" {
+		return fmt.Errorf("authorization artifact is incomplete")
+	}
+	if !hmac.Equal([]byte(txIntentMAC(userID, req, auth)), []byte(auth.Signature)) {
+		return fmt.Errorf("authorization signature mismatch")
+	}
+	return nil
+}
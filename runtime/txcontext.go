@@ -0,0 +1,92 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Sign requests may carry a game context object (feature name, item ID,
+// match ID, ...) that is validated against a configured schema, persisted on
+// the transaction record, attached to audit entries and available as a
+// listing filter for analytics.
+
+// txContextField describes one allowed context key.
+type txContextField struct {
+	Required  bool `json:"required,omitempty"`
+	MaxLength int  `json:"maxLength,omitempty"`
+}
+
+const txContextDefaultMaxLength = 128
+
+// defaultTxContextSchema applies when NAKAMA_TX_CONTEXT_SCHEMA is unset.
+var defaultTxContextSchema = map[string]*txContextField{
+	"feature": {},
+	"itemId":  {},
+	"matchId": {},
+}
+
+// loadTxContextSchema parses the configured context schema.
+func loadTxContextSchema(ctx context.Context) (map[string]*txContextField, error) {
+	raw := moduleEnv(ctx, "NAKAMA_TX_CONTEXT_SCHEMA")
+	if raw == "" {
+		return defaultTxContextSchema, nil
+	}
+	schema := make(map[string]*txContextField)
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, fmt.Errorf("invalid NAKAMA_TX_CONTEXT_SCHEMA: %w", err)
+	}
+	return schema, nil
+}
+
+// validateTxContext checks a request's context object against the schema:
+// unknown keys are rejected, required keys must be present, and values are
+// length-bounded.
+func validateTxContext(tags map[string]string) error {
+	for key, value := range tags {
+		field, ok := cfg.TxContextSchema[key]
+		if !ok {
+			return fmt.Errorf("unknown context key %q", key)
+		}
+		maxLength := field.MaxLength
+		if maxLength == 0 {
+			maxLength = txContextDefaultMaxLength
+		}
+		if len(value) == 0 || len(value) > maxLength {
+			return fmt.Errorf("context key %q value length out of range", key)
+		}
+	}
+	for key, field := range cfg.TxContextSchema {
+		if field.Required {
+			if _, ok := tags[key]; !ok {
+				return fmt.Errorf("context key %q is required", key)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesTxContextFilter reports whether a record's tags contain every
+// key/value pair of the filter.
+func matchesTxContextFilter(tags, filter map[string]string) bool {
+	for key, value := range filter {
+		if tags[key] != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// Clients used to supply the transaction nonce themselves, which falls apart
+// the moment two requests for one wallet race: both read the same chain
+// nonce and one transaction silently replaces the other. The module now
+// tracks the next nonce per address in a system-owned storage record,
+// allocated under the same CAS-loop discipline as the pending-transaction
+// counter. A tracker is seeded from the node's pending transaction count on
+// first use, so filling needs the chain RPC endpoint; a caller-supplied
+// nonce still wins, which keeps watcher-driven flows such as deposit
+// forwarding intact. A broadcast the node rejects before mining hands its
+// nonce back — or, when the gap is not at the top of the chain, re-seeds the
+// tracker from the node — so one failed transaction does not strand every
+// one behind it.
+
+const (
+	txNonceCollection    = "tx_nonces"
+	txNonceAttempts      = 5
+	noncePendingBlockTag = "pending"
+)
+
+// txNonceRecord tracks the next unallocated nonce for one address.
+type txNonceRecord struct {
+	Next      uint64 `json:"next"`
+	UpdatedAt int64  `json:"updatedAt"`
+}
+
+// txNonceManagerEnabled reports whether the module can fill nonces itself;
+// the tracker seed needs the chain endpoint.
+func txNonceManagerEnabled() bool {
+	return cfg.EVMRPCURL != ""
+}
+
+// ethGetTransactionCount returns an address's pending-block transaction
+// count — the next nonce the node would accept, mempool included.
+func ethGetTransactionCount(ctx context.Context, address string) (uint64, error) {
+	result, err := ethCallJSONRPC(ctx, "eth_getTransactionCount", fmt.Sprintf(`[%q, %q]`, address, noncePendingBlockTag))
+	if err != nil {
+		return 0, err
+	}
+	count, err := strconv.ParseUint(strings.TrimPrefix(result, "0x"), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("eth_getTransactionCount returned malformed count %q", result)
+	}
+	return count, nil
+}
+
+// allocateTxNonce hands out the next nonce for an address and advances the
+// tracker, seeding it from the node on first use. Concurrent allocations are
+// serialized by the conditional write; the loser re-reads and takes the next
+// value.
+func allocateTxNonce(ctx context.Context, nk nkruntime.NakamaModule, address string) (uint64, error) {
+	key := strings.ToLower(address)
+	for attempt := 0; attempt < txNonceAttempts; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: txNonceCollection,
+			Key:        key,
+		}})
+		if err != nil {
+			return 0, err
+		}
+
+		record := &txNonceRecord{}
+		version := "*"
+		if len(objects) > 0 {
+			if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+				return 0, fmt.Errorf("nonce record corrupt for address %s: %w", address, err)
+			}
+			version = objects[0].Version
+		} else {
+			next, err := ethGetTransactionCount(ctx, address)
+			if err != nil {
+				return 0, fmt.Errorf("nonce seed failed for address %s: %w", address, err)
+			}
+			record.Next = next
+		}
+
+		nonce := record.Next
+		record.Next = nonce + 1
+		record.UpdatedAt = moduleClock.Now().Unix()
+		value, err := json.Marshal(record)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: txNonceCollection,
+			Key:        key,
+			Value:      string(value),
+			Version:    version,
+		}}); err != nil {
+			continue // CAS race, retry.
+		}
+		return nonce, nil
+	}
+	return 0, fmt.Errorf("nonce contention for address %s, giving up", address)
+}
+
+// releaseTxNonce returns a nonce whose transaction never reached the mempool.
+// When it is still the most recently allocated value the tracker simply rolls
+// back; a gap below the top cannot be closed locally, so the tracker is
+// re-seeded from the node instead. Best effort — a missed release self-heals
+// on the next re-seed.
+func releaseTxNonce(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, address string, nonce uint64) {
+	key := strings.ToLower(address)
+	for attempt := 0; attempt < txNonceAttempts; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: txNonceCollection,
+			Key:        key,
+		}})
+		if err != nil || len(objects) == 0 {
+			return
+		}
+		record := &txNonceRecord{}
+		if err := json.Unmarshal([]byte(objects[0].Value), record); err != nil {
+			return
+		}
+
+		if record.Next == nonce+1 {
+			record.Next = nonce
+		} else {
+			next, err := ethGetTransactionCount(ctx, address)
+			if err != nil {
+				logger.Warn("Nonce re-seed failed for address %v: %v", address, err)
+				return
+			}
+			// Never roll below the chain's own view; pending transactions
+			// above the gap keep their nonces.
+			if next >= record.Next {
+				return
+			}
+			record.Next = next
+		}
+		record.UpdatedAt = moduleClock.Now().Unix()
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: txNonceCollection,
+			Key:        key,
+			Value:      string(value),
+			Version:    objects[0].Version,
+		}}); err != nil {
+			continue // CAS race, retry.
+		}
+		return
+	}
+	logger.Warn("Nonce release contention for address %v, leaving tracker as is", address)
+}
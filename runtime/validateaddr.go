@@ -0,0 +1,229 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Clients validate recipient addresses before submitting a transfer, so typos
+// fail in the send form instead of at signing. rpc_validate_address checks
+// the address shape per chain — EVM addresses including their EIP-55
+// checksum, Solana addresses as 32-byte base58 — and returns the normalized
+// form clients should submit. For EVM it additionally classifies the address
+// as an EOA or a contract through eth_getCode when an RPC endpoint is
+// configured, since sending game currency to a random contract is almost
+// always a mistake. Classifications are cached; code at an address can only
+// appear, not change shape, so a short TTL is plenty.
+
+const (
+	validateChainEVM    = "evm"
+	validateChainSolana = "solana"
+
+	validateCacheTTL = 10 * time.Minute
+)
+
+// base58Alphabet is the Bitcoin alphabet Solana addresses use.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// validateCacheEntry is one cached EVM classification.
+type validateCacheEntry struct {
+	Type    string
+	Expires time.Time
+}
+
+var (
+	validateCacheMu sync.Mutex
+	validateCache   = make(map[string]*validateCacheEntry)
+)
+
+// eip55Checksum renders a 20-byte address with its EIP-55 mixed-case
+// checksum.
+func eip55Checksum(address []byte) string {
+	lower := hex.EncodeToString(address)
+	digest := keccak256([]byte(lower))
+	out := make([]byte, len(lower))
+	for i, c := range []byte(lower) {
+		nibble := digest[i/2]
+		if i%2 == 0 {
+			nibble >>= 4
+		}
+		if c >= 'a' && nibble&0x0f >= 8 {
+			c -= 'a' - 'A'
+		}
+		out[i] = c
+	}
+	return "0x" + string(out)
+}
+
+// base58Decode decodes a base58 string, rejecting characters outside the
+// alphabet.
+func base58Decode(s string) ([]byte, error) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, r := range s {
+		index := strings.IndexRune(base58Alphabet, r)
+		if index < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		value.Mul(value, radix).Add(value, big.NewInt(int64(index)))
+	}
+	decoded := value.Bytes()
+	// Leading '1' characters encode leading zero bytes.
+	for i := 0; i < len(s) && s[i] == '1'; i++ {
+		decoded = append([]byte{0}, decoded...)
+	}
+	return decoded, nil
+}
+
+// validateEVMAddress checks shape and checksum, returning the normalized
+// EIP-55 form. Addresses written in one case carry no checksum and pass;
+// mixed-case addresses must match their checksum exactly.
+func validateEVMAddress(address string) (string, error) {
+	decoded, err := parseHexAddress(address)
+	if err != nil {
+		return "", err
+	}
+	normalized := eip55Checksum(decoded)
+	bare := address[2:]
+	if bare != strings.ToLower(bare) && bare != strings.ToUpper(bare) && address != normalized {
+		return "", fmt.Errorf("address fails its EIP-55 checksum")
+	}
+	return normalized, nil
+}
+
+// validateSolanaAddress checks that the address is 32 base58-encoded bytes,
+// the shape of an ed25519 public key. On-curve verification is left to the
+// chain; off-curve program addresses are valid destinations too.
+func validateSolanaAddress(address string) (string, error) {
+	decoded, err := base58Decode(address)
+	if err != nil {
+		return "", err
+	}
+	if len(decoded) != 32 {
+		return "", fmt.Errorf("address must decode to 32 bytes, got %d", len(decoded))
+	}
+	return address, nil
+}
+
+// evmAddressType classifies an address as "eoa" or "contract" via
+// eth_getCode, caching the answer.
+func evmAddressType(ctx context.Context, address string) (string, bool, error) {
+	key := strings.ToLower(address)
+	validateCacheMu.Lock()
+	entry := validateCache[key]
+	validateCacheMu.Unlock()
+	if entry != nil && moduleClock.Now().Before(entry.Expires) {
+		return entry.Type, true, nil
+	}
+
+	result, err := ethCallJSONRPC(ctx, "eth_getCode", fmt.Sprintf(`[%q, "latest"]`, address))
+	if err != nil {
+		return "", false, err
+	}
+	addressType := "eoa"
+	if strings.TrimPrefix(result, "0x") != "" {
+		addressType = "contract"
+	}
+
+	validateCacheMu.Lock()
+	validateCache[key] = &validateCacheEntry{
+		Type:    addressType,
+		Expires: moduleClock.Now().Add(validateCacheTTL),
+	}
+	validateCacheMu.Unlock()
+	return addressType, false, nil
+}
+
+// ValidateAddressResponse is returned by rpc_validate_address.
+type ValidateAddressResponse struct {
+	Valid bool `json:"valid"`
+	// Reason explains an invalid address; empty when valid.
+	Reason string `json:"reason,omitempty"`
+	// Normalized is the form clients should submit: EIP-55 for EVM.
+	Normalized string `json:"normalized,omitempty"`
+	// Type is "eoa" or "contract" for EVM addresses when an RPC endpoint is
+	// configured, empty otherwise.
+	Type   string `json:"type,omitempty"`
+	Cached bool   `json:"cached,omitempty"`
+}
+
+// rpcValidateAddress validates a recipient address for a chain. The default
+// chain is EVM.
+func rpcValidateAddress(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if _, err := requireUser(ctx); err != nil {
+		return "", err
+	}
+	var req struct {
+		Address string `json:"address"`
+		Chain   string `json:"chain,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.Address == "" {
+		return "", rpcError(errCodeBadInput, "Expects an address and optional chain.", codes.InvalidArgument)
+	}
+	if req.Chain == "" {
+		req.Chain = validateChainEVM
+	}
+
+	resp := &ValidateAddressResponse{}
+	switch req.Chain {
+	case validateChainEVM:
+		normalized, err := validateEVMAddress(req.Address)
+		if err != nil {
+			resp.Reason = err.Error()
+			break
+		}
+		resp.Valid = true
+		resp.Normalized = normalized
+		if cfg.EVMRPCURL != "" {
+			addressType, cached, err := evmAddressType(ctx, normalized)
+			if err != nil {
+				// Classification is advisory; shape validity stands alone.
+				logger.Warn("eth_getCode classification failed for %v: %v", normalized, err)
+			} else {
+				resp.Type = addressType
+				resp.Cached = cached
+			}
+		}
+	case validateChainSolana:
+		normalized, err := validateSolanaAddress(req.Address)
+		if err != nil {
+			resp.Reason = err.Error()
+			break
+		}
+		resp.Valid = true
+		resp.Normalized = normalized
+	default:
+		return "", rpcError(errCodeBadInput,
+			fmt.Sprintf("Unsupported chain %q; expected %q or %q.", req.Chain, validateChainEVM, validateChainSolana), codes.InvalidArgument)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
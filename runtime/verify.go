@@ -0,0 +1,235 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Ownership proofs for external (non-custodial) wallets come in two shapes:
+// EOAs sign with a key that can be recovered from the signature, while
+// smart-contract wallets (Safe, Argent) have no key to recover and are
+// checked on chain through EIP-1271 isValidSignature instead. Verification
+// results are cached briefly since linking flows re-submit the same proof.
+
+const (
+	// eip1271Magic is the isValidSignature(bytes32,bytes) success return
+	// value, which equals the function selector.
+	eip1271Magic = "1626ba7e"
+
+	verifyCacheTTL     = 5 * time.Minute
+	verifyCallTimeout  = 5 * time.Second
+	personalSignPrefix = "\x19Ethereum Signed Message:\n"
+)
+
+// verifyCacheEntry is one cached verification outcome.
+type verifyCacheEntry struct {
+	Valid   bool
+	Method  string
+	Expires time.Time
+}
+
+var (
+	verifyCacheMu sync.Mutex
+	verifyCache   = make(map[string]*verifyCacheEntry)
+)
+
+// personalSignDigest hashes a message the way wallets do for personal_sign.
+func personalSignDigest(message []byte) []byte {
+	return keccak256([]byte(fmt.Sprintf("%s%d", personalSignPrefix, len(message))), message)
+}
+
+// recoverEOA checks whether a 65-byte R||S||V signature over digest recovers
+// to the given address. Wallets disagree on the V encoding — personal_sign
+// implementations emit 27/28 while raw signers emit 0/1 — so both are
+// accepted.
+func recoverEOA(address string, digest, sig []byte) bool {
+	if len(sig) != 65 {
+		return false
+	}
+	v := sig[64]
+	if v >= 27 {
+		v -= 27
+	}
+	if v > 1 {
+		return false
+	}
+	// RecoverCompact wants [V+27 || R || S].
+	compact := make([]byte, 65)
+	compact[0] = v + 27
+	copy(compact[1:], sig[:64])
+	pub, _, err := ecdsa.RecoverCompact(compact, digest)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(ethereumAddress(pub.SerializeUncompressed()), address)
+}
+
+// eip1271Calldata encodes isValidSignature(bytes32 digest, bytes signature).
+func eip1271Calldata(digest, sig []byte) []byte {
+	selector, _ := hex.DecodeString(eip1271Magic)
+	data := make([]byte, 0, 4+32*3+((len(sig)+31)/32)*32)
+	data = append(data, selector...)
+	data = append(data, digest...)
+	// Offset of the bytes argument relative to the argument block.
+	var word [32]byte
+	word[31] = 0x40
+	data = append(data, word[:]...)
+	word = [32]byte{}
+	word[31] = byte(len(sig))
+	word[30] = byte(len(sig) >> 8)
+	data = append(data, word[:]...)
+	data = append(data, sig...)
+	if pad := len(sig) % 32; pad != 0 {
+		data = append(data, make([]byte, 32-pad)...)
+	}
+	return data
+}
+
+// verifyEIP1271 asks the contract at address whether the signature is valid
+// for the digest via eth_call.
+func verifyEIP1271(ctx context.Context, address string, digest, sig []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, verifyCallTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1,
+		"method": "eth_call",
+		"params": []interface{}{map[string]string{
+			"to":   address,
+			"data": "0x" + hex.EncodeToString(eip1271Calldata(digest, sig)),
+		}, "latest"},
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.EVMRPCURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("eth_call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var decoded struct {
+		Result string `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return false, fmt.Errorf("eth_call response malformed: %w", err)
+	}
+	if decoded.Error != nil {
+		// A revert means the contract rejected the signature (or implements
+		// no EIP-1271 at all); that's a negative result, not an error.
+		return false, nil
+	}
+	result := strings.TrimPrefix(decoded.Result, "0x")
+	return strings.HasPrefix(strings.ToLower(result), eip1271Magic), nil
+}
+
+// VerifySignatureResponse is returned by rpc_verify_signature.
+type VerifySignatureResponse struct {
+	Valid bool `json:"valid"`
+	// Method is "ecrecover" for EOAs or "eip1271" for contract wallets.
+	Method string `json:"method,omitempty"`
+	Cached bool   `json:"cached,omitempty"`
+}
+
+// rpcVerifySignature checks an external wallet's ownership proof: a
+// personal_sign signature over the given message, claimed to come from the
+// given address. EOA signatures are recovered locally; contract wallets are
+// checked on chain via EIP-1271 when an RPC endpoint is configured.
+func rpcVerifySignature(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if _, err := requireUser(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Address   string `json:"address"`
+		Message   string `json:"message"`
+		Signature string `json:"signature"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.Address == "" || req.Message == "" || req.Signature == "" {
+		return "", rpcError(errCodeBadInput, "Expects an address, message and signature.", codes.InvalidArgument)
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(req.Signature, "0x"))
+	if err != nil || len(sig) == 0 {
+		return "", rpcError(errCodeBadInput, "Signature must be hex.", codes.InvalidArgument)
+	}
+
+	digest := personalSignDigest([]byte(req.Message))
+	cacheKey := strings.ToLower(req.Address) + "/" + hex.EncodeToString(keccak256(digest, sig))
+
+	verifyCacheMu.Lock()
+	entry := verifyCache[cacheKey]
+	verifyCacheMu.Unlock()
+	if entry != nil && moduleClock.Now().Before(entry.Expires) {
+		out, _ := json.Marshal(&VerifySignatureResponse{Valid: entry.Valid, Method: entry.Method, Cached: true})
+		return string(out), nil
+	}
+
+	resp := &VerifySignatureResponse{}
+	if recoverEOA(req.Address, digest, sig) {
+		resp.Valid = true
+		resp.Method = "ecrecover"
+	} else if cfg.EVMRPCURL != "" {
+		valid, err := verifyEIP1271(ctx, req.Address, digest, sig)
+		if err != nil {
+			logger.Warn("EIP-1271 check failed for %v: %v", req.Address, err)
+			return "", rpcError(errCodeRetryLater, "On-chain signature check is unavailable; retry shortly.", codes.Unavailable)
+		}
+		resp.Valid = valid
+		if valid {
+			resp.Method = "eip1271"
+		}
+	}
+
+	verifyCacheMu.Lock()
+	verifyCache[cacheKey] = &verifyCacheEntry{
+		Valid:   resp.Valid,
+		Method:  resp.Method,
+		Expires: moduleClock.Now().Add(verifyCacheTTL),
+	}
+	// Opportunistically drop expired results while holding the lock; the keys
+	// are caller-supplied, so the map must not grow unbounded.
+	now := moduleClock.Now()
+	for key, cached := range verifyCache {
+		if now.After(cached.Expires) {
+			delete(verifyCache, key)
+		}
+	}
+	verifyCacheMu.Unlock()
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+func TestRecoverEOAAcceptsBothVEncodings(t *testing.T) {
+	priv := secp256k1.PrivKeyFromBytes(bytes.Repeat([]byte{0x42}, 32))
+	address := ethereumAddress(priv.PubKey().SerializeUncompressed())
+	digest := personalSignDigest([]byte("prove it"))
+
+	// SignCompact produces [V+27 || R || S]; rearrange to Ethereum's R||S||V.
+	compact := ecdsa.SignCompact(priv, digest, false)
+	sig := make([]byte, 65)
+	copy(sig, compact[1:])
+
+	for _, tc := range []struct {
+		name string
+		v    byte
+	}{
+		{"raw", compact[0] - 27},
+		{"personal_sign", compact[0]},
+	} {
+		sig[64] = tc.v
+		if !recoverEOA(address, digest, sig) {
+			t.Errorf("%s encoding (V=%d) did not recover", tc.name, tc.v)
+		}
+		if recoverEOA("0x1111111111111111111111111111111111111111", digest, sig) {
+			t.Errorf("%s encoding recovered to a foreign address", tc.name)
+		}
+	}
+
+	sig[64] = 2
+	if recoverEOA(address, digest, sig) {
+		t.Error("out-of-range recovery byte was accepted")
+	}
+	if recoverEOA(address, digest, sig[:64]) {
+		t.Error("truncated signature was accepted")
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Build information, stamped at link time:
+//
+//	go build -ldflags "-X .../runtime.moduleVersion=1.4.0 \
+//	    -X .../runtime.moduleCommit=$(git rev-parse --short HEAD) \
+//	    -X .../runtime.moduleBuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Unstamped builds report the dev defaults so local binaries are recognisable
+// in logs and health checks.
+var (
+	moduleVersion   = "0.0.0-dev"
+	moduleCommit    = "unknown"
+	moduleBuildDate = "unknown"
+)
+
+// registeredRPCs records what InitModule registered, for rpc_schema.
+var registeredRPCs []string
+
+// BuildInfo is the version block shared by rpc_healthz and rpc_schema.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	Profile   string `json:"profile"`
+}
+
+func buildInfo() *BuildInfo {
+	return &BuildInfo{
+		Version:   moduleVersion,
+		Commit:    moduleCommit,
+		BuildDate: moduleBuildDate,
+		Profile:   cfg.Profile,
+	}
+}
+
+// compareVersions orders two dotted numeric versions, ignoring any
+// pre-release suffix (so "0.0.0-dev" compares as "0.0.0"). Returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	trim := func(v string) []string {
+		if i := strings.IndexAny(v, "-+"); i >= 0 {
+			v = v[:i]
+		}
+		return strings.Split(v, ".")
+	}
+	as, bs := trim(a), trim(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		if i < len(as) {
+			an, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			bn, _ = strconv.Atoi(bs[i])
+		}
+		if an != bn {
+			if an < bn {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// checkMinVersion enforces a client-declared minimum module version so
+// mismatched rollouts fail loudly instead of with confusing downstream errors.
+func checkMinVersion(minVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+	if compareVersions(moduleVersion, minVersion) < 0 {
+		return rpcError(errCodeVersionMismatch,
+			fmt.Sprintf("Module version %s is below the required minimum %s.", moduleVersion, minVersion),
+			codes.FailedPrecondition)
+	}
+	return nil
+}
+
+// rpcHealthz reports module liveness and build information. Clients may pass
+// {"minVersion": "..."} to assert a minimum deployed module version.
+func rpcHealthz(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	var req struct {
+		MinVersion string `json:"minVersion,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed health check request.", codes.InvalidArgument)
+		}
+	}
+	if err := checkMinVersion(req.MinVersion); err != nil {
+		return "", err
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"status":  "ok",
+		"build":   buildInfo(),
+		"warmup":  warmupSnapshot(),
+		"node":    nodeID,
+		"workers": leaseSnapshot(),
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// rpcSchema describes the registered RPC surface and build, so clients and
+// tooling can discover what this deployment exposes.
+func rpcSchema(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	rpcs := make([]string, len(registeredRPCs))
+	copy(rpcs, registeredRPCs)
+	sort.Strings(rpcs)
+
+	// The error contract travels with the surface description so client SDKs
+	// generate their retry policy from the deployment instead of hard-coding
+	// it.
+	retryable := make([]string, 0, len(retryableCodes))
+	for code := range retryableCodes {
+		retryable = append(retryable, code)
+	}
+	sort.Strings(retryable)
+
+	out, err := json.Marshal(map[string]interface{}{
+		"build": buildInfo(),
+		"rpcs":  rpcs,
+		"errors": map[string]interface{}{
+			"retryableCodes": retryable,
+			// retryAfterMs, when present in an envelope, is the minimum
+			// client backoff before resubmitting.
+			"retryAfterHint": "retryAfterMs",
+			// httpStatus in every envelope echoes the status the gateway
+			// emits, for clients behind status-flattening proxies.
+			"httpStatusHint": "httpStatus",
+		},
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
@@ -0,0 +1,371 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	walletCollection     = "wallets"
+	walletKeyEVM         = "evm"
+	walletMetaCollection = "wallet_meta"
+	derivationCounterKey = "derivation_counter"
+)
+
+// Wallet is the custodial wallet record stored per user. Users may hold
+// multiple labeled wallets ("savings", "spending"); the unlabeled default
+// keeps the original storage key so single-wallet clients are unaffected.
+type Wallet struct {
+	Address         string `json:"address"`
+	Label           string `json:"label,omitempty"`
+	DerivationIndex uint32 `json:"derivationIndex"`
+	// KeyARN is set in per-user key mode and names the dedicated KMS/HSM key
+	// this wallet signs with; empty wallets use master-key derivation.
+	KeyARN     string `json:"keyArn,omitempty"`
+	ExternalID string `json:"externalId"`
+	// Backend names the signer backend this wallet signs with; see kms.go.
+	// Empty on wallets provisioned before backends were recorded, which
+	// resolve to the mock backend.
+	Backend   string `json:"backend,omitempty"`
+	CreatedAt int64  `json:"createdAt"`
+	// DeprecatedAddresses are retired by rotation but stay watchable so late
+	// deposits can be forwarded.
+	DeprecatedAddresses []*DeprecatedAddress `json:"deprecatedAddresses,omitempty"`
+}
+
+// externalIDForUser resolves the identity a user's wallet is keyed to: the
+// module-owned Cognito custom ID, or an explicit identity grant for legacy
+// accounts (see identity.go). Users with neither have no wallet access.
+func externalIDForUser(ctx context.Context, nk nkruntime.NakamaModule, userID string) (string, error) {
+	account, err := nk.AccountGetId(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("account lookup failed: %w", err)
+	}
+	id := account.GetCustomId()
+	if _, ok := subFromCustomID(id); ok {
+		return id, nil
+	}
+	grant, err := identityGrantForUser(ctx, nk, userID)
+	if err != nil {
+		return "", fmt.Errorf("identity grant lookup failed: %w", err)
+	}
+	if grant != nil {
+		return grant.ExternalID, nil
+	}
+	return "", rpcError(errCodePermissionDenied, "Account has no linked Cognito identity.", codes.PermissionDenied)
+}
+
+// walletKey maps a wallet label to its storage key. The default (unlabeled)
+// wallet keeps the original key for backward compatibility.
+func walletKey(label string) string {
+	if label == "" {
+		return walletKeyEVM
+	}
+	return walletKeyEVM + ":" + label
+}
+
+// validWalletLabel bounds labels to short, URL- and key-safe names.
+func validWalletLabel(label string) bool {
+	if len(label) > 32 {
+		return false
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// getWallet reads a user's default wallet record, returning nil when none
+// exists.
+func getWallet(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*Wallet, error) {
+	return getWalletLabeled(ctx, nk, userID, "")
+}
+
+// getWalletLabeled reads one of a user's labeled wallet records. During the
+// schema migration the v2 collection is preferred with a v1 fallback; see
+// walletschema.go.
+func getWalletLabeled(ctx context.Context, nk nkruntime.NakamaModule, userID, label string) (*Wallet, error) {
+	if cfg.WalletSchemaPhase != walletSchemaPhaseLegacy {
+		wallet, _, err := readWalletAt(ctx, nk, tenantCollection(ctx, walletCollectionV2), userID, walletKey(label))
+		if err != nil {
+			return nil, fmt.Errorf("wallet record corrupt for user %s: %w", userID, err)
+		}
+		if wallet != nil {
+			return wallet, nil
+		}
+	}
+	wallet, _, err := readWalletAt(ctx, nk, tenantCollection(ctx, walletCollection), userID, walletKey(label))
+	if err != nil {
+		return nil, fmt.Errorf("wallet record corrupt for user %s: %w", userID, err)
+	}
+	return wallet, nil
+}
+
+// nextDerivationIndex allocates a unique derivation index via a compare-and-
+// swap on a system-owned counter record.
+func nextDerivationIndex(ctx context.Context, nk nkruntime.NakamaModule) (uint32, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: walletMetaCollection,
+			Key:        derivationCounterKey,
+		}})
+		if err != nil {
+			return 0, err
+		}
+		var current uint64
+		version := "*"
+		if len(objects) > 0 {
+			var counter struct {
+				Next uint64 `json:"next"`
+			}
+			if err := json.Unmarshal([]byte(objects[0].Value), &counter); err != nil {
+				return 0, err
+			}
+			current = counter.Next
+			version = objects[0].Version
+		}
+		value := fmt.Sprintf(`{"next":%s}`, strconv.FormatUint(current+1, 10))
+		if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+			Collection: walletMetaCollection,
+			Key:        derivationCounterKey,
+			Value:      value,
+			Version:    version,
+		}}); err != nil {
+			// Lost the CAS race, retry with the fresh counter value.
+			continue
+		}
+		return uint32(current), nil
+	}
+	return 0, fmt.Errorf("wallet: derivation counter contention, giving up")
+}
+
+// countWallets counts a user's provisioned wallets across all labels.
+func countWallets(ctx context.Context, nk nkruntime.NakamaModule, userID string) (int, error) {
+	count := 0
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", userID, tenantCollection(ctx, walletCollection), 100, cursor)
+		if err != nil {
+			return 0, err
+		}
+		count += len(objects)
+		if next == "" {
+			return count, nil
+		}
+		cursor = next
+	}
+}
+
+// ensureWallet returns the user's default wallet, provisioning one on first
+// use.
+func ensureWallet(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID string) (*Wallet, error) {
+	return ensureWalletLabeled(ctx, logger, nk, userID, "")
+}
+
+// ensureWalletLabeled returns the user's wallet for a label, provisioning one
+// on first use. Labeled wallets count against the per-user wallet bound.
+func ensureWalletLabeled(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, label string) (*Wallet, error) {
+	if !validWalletLabel(label) {
+		return nil, rpcError(errCodeBadInput, "Wallet label must be 1-32 characters of a-z, 0-9, - or _.", codes.InvalidArgument)
+	}
+	// Soft-deleted wallets refuse all operations until restored or purged.
+	if err := checkWalletDeleted(ctx, nk, userID); err != nil {
+		return nil, err
+	}
+
+	var wallet *Wallet
+	err := withRetry(ctx, logger, "wallet_read", func() error {
+		var readErr error
+		wallet, readErr = getWalletLabeled(ctx, nk, userID, label)
+		return readErr
+	})
+	if err != nil {
+		return nil, err
+	}
+	if wallet != nil {
+		return wallet, nil
+	}
+
+	externalID, err := externalIDForUser(ctx, nk, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if label != "" && cfg.MaxWalletsPerUser > 0 {
+		count, err := countWallets(ctx, nk, userID)
+		if err != nil {
+			return nil, err
+		}
+		if count >= cfg.MaxWalletsPerUser {
+			return nil, rpcError(errCodeBudgetExceeded,
+				fmt.Sprintf("Wallet limit reached (%d of %d).", count, cfg.MaxWalletsPerUser), codes.ResourceExhausted)
+		}
+	}
+
+	wallet = &Wallet{
+		Label:      label,
+		ExternalID: externalID,
+		Backend:    cfg.KMSDefaultBackend,
+		CreatedAt:  moduleClock.Now().Unix(),
+	}
+	reserved := false
+	if cfg.WalletKeyMode == walletKeyModePerUser {
+		signer, err := perUserKeySigner(ctx, wallet.Backend)
+		if err != nil {
+			return nil, err
+		}
+		keyARN, pub, err := signer.CreateKey(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("wallet: key creation failed: %w", err)
+		}
+		wallet.KeyARN = keyARN
+		wallet.Address = ethereumAddress(pub)
+	} else {
+		var index uint32
+		// An address preview reserved an index for the default wallet; honor
+		// it so the provisioned address matches the preview. See preview.go.
+		if label == "" {
+			preview, err := getWalletPreview(ctx, nk, userID)
+			if err != nil {
+				return nil, err
+			}
+			if preview != nil {
+				index = preview.DerivationIndex
+				reserved = true
+			}
+		}
+		if !reserved {
+			var err error
+			if index, err = nextDerivationIndex(ctx, nk); err != nil {
+				return nil, err
+			}
+		}
+		signer, err := GetKMSSigner(ctx, wallet.Backend)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := signer.PublicKey(ctx, index)
+		if err != nil {
+			return nil, fmt.Errorf("wallet: public key derivation failed: %w", err)
+		}
+		wallet.DerivationIndex = index
+		wallet.Address = ethereumAddress(pub)
+	}
+	// Conditional first write: a concurrent provision attempt loses and
+	// re-reads the winner's record. The migration phase decides which
+	// collections the record lands in; see walletschema.go.
+	if err := storeWallet(ctx, nk, userID, label, wallet, "*"); err != nil {
+		existing, readErr := getWalletLabeled(ctx, nk, userID, label)
+		if readErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, err
+	}
+
+	if reserved {
+		consumeWalletPreview(ctx, nk, userID)
+	}
+	// Persist the public key so signing stays warm across restarts.
+	warmPublicKeyCache(ctx, logger, nk, wallet)
+	metricWalletsProvisioned.Inc()
+	if wallet.KeyARN != "" {
+		logger.Info("Provisioned wallet %v for user %v with dedicated key %v", wallet.Address, userID, wallet.KeyARN)
+	} else {
+		logger.Info("Provisioned wallet %v for user %v at derivation index %v", wallet.Address, userID, wallet.DerivationIndex)
+	}
+	return wallet, nil
+}
+
+// WalletResponse is returned by rpc_get_wallet: the wallet plus a content
+// version for conditional polling.
+type WalletResponse struct {
+	*Wallet
+	Version string `json:"version,omitempty"`
+	// ExplorerURL links the wallet address on the configured explorer.
+	ExplorerURL string `json:"explorerUrl,omitempty"`
+}
+
+// rpcGetWallet returns the calling user's wallet, provisioning it if needed.
+// An optional label selects one of multiple wallets; omitted means the
+// default wallet. Polling clients may pass the last-seen version in
+// ifVersion and get NOT_MODIFIED back while the wallet is unchanged.
+func rpcGetWallet(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	userID, err := requireUser(ctx)
+	if err != nil {
+		return "", err
+	}
+	var req struct {
+		Label     string `json:"label,omitempty"`
+		IfVersion string `json:"ifVersion,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed wallet request.", codes.InvalidArgument)
+		}
+	}
+
+	endpoint := "get_wallet:" + req.Label
+	if entry := respCacheGet(userID, endpoint); entry != nil {
+		if req.IfVersion != "" && req.IfVersion == entry.Version {
+			return "", notModifiedError()
+		}
+		return entry.Body, nil
+	}
+
+	if err := checkAgeWalletAccess(ctx, nk, userID); err != nil {
+		return "", err
+	}
+
+	wallet, err := ensureWalletLabeled(ctx, logger, nk, userID, req.Label)
+	if err != nil {
+		if rpcErr, ok := err.(*nkruntime.Error); ok {
+			return "", rpcErr
+		}
+		logger.Error("Wallet provisioning failed for user %v: %v", userID, err)
+		return "", rpcError(errCodeInternal, "Wallet lookup failed.", codes.Internal)
+	}
+	// Clients call this right after login, which makes it the natural spot
+	// to prime the signer's public key cache; see pubkeycache.go.
+	primePublicKeyCache(ctx, logger, nk, wallet)
+
+	content, err := json.Marshal(wallet)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	version := contentVersion(string(content))
+	out, err := json.Marshal(&WalletResponse{
+		Wallet:      wallet,
+		Version:     version,
+		ExplorerURL: explorerAddressURL(cfg.EVMChainID, wallet.Address),
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	respCachePut(userID, endpoint, string(out), version)
+	if req.IfVersion != "" && req.IfVersion == version {
+		return "", notModifiedError()
+	}
+	return string(out), nil
+}
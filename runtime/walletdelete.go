@@ -0,0 +1,280 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Deleting wallet records the moment an account is deleted risks stranding
+// funds that are still on chain. Account deletion therefore soft-deletes the
+// wallet: a deletion marker blocks all wallet operations for a configurable
+// grace period during which support can restore access, and a scheduled
+// worker performs the final purge — wallet records removed, dedicated keys
+// disabled — once the window lapses.
+
+const (
+	walletDeletionKey   = "deletion"
+	walletPurgeInterval = 24 * time.Hour
+)
+
+// walletDeletionState is the soft-delete marker in the wallet meta
+// collection.
+type walletDeletionState struct {
+	DeletedAt  int64 `json:"deletedAt"`
+	PurgeAfter int64 `json:"purgeAfter"`
+	PurgedAt   int64 `json:"purgedAt,omitempty"`
+}
+
+// readWalletDeletion returns a user's deletion marker, or nil when the
+// wallet is not deleted.
+func readWalletDeletion(ctx context.Context, nk nkruntime.NakamaModule, userID string) (*walletDeletionState, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: walletMetaCollection,
+		Key:        walletDeletionKey,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	state := &walletDeletionState{}
+	if err := json.Unmarshal([]byte(objects[0].Value), state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// checkWalletDeleted refuses wallet operations for soft-deleted wallets.
+func checkWalletDeleted(ctx context.Context, nk nkruntime.NakamaModule, userID string) error {
+	state, err := readWalletDeletion(ctx, nk, userID)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		return rpcError(errCodeAccountDisabled, "Wallet is pending deletion.", codes.PermissionDenied)
+	}
+	return nil
+}
+
+// rpcAdminDeleteWallet soft-deletes a user's wallets. Called from the account
+// deletion pipeline; the final purge happens after the grace period. Server-
+// to-server only.
+func rpcAdminDeleteWallet(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID string `json:"userId"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId.", codes.InvalidArgument)
+	}
+
+	now := moduleClock.Now()
+	state := &walletDeletionState{
+		DeletedAt:  now.Unix(),
+		PurgeAfter: now.Add(time.Duration(cfg.WalletDeleteGraceDays) * 24 * time.Hour).Unix(),
+	}
+	value, err := json.Marshal(state)
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Marker encoding failed.", codes.Internal)
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: walletMetaCollection,
+		Key:        walletDeletionKey,
+		UserID:     req.UserID,
+		Value:      string(value),
+	}}); err != nil {
+		logger.Error("Deletion marker write failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Deletion marker write failed.", codes.Internal)
+	}
+	cacheInvalidateCluster(ctx, logger, nk, req.UserID, "wallet_deleted")
+
+	if err := appendAudit(ctx, nk, "wallet.soft_deleted", req.UserID, map[string]interface{}{
+		"purgeAfter": state.PurgeAfter,
+	}); err != nil {
+		logger.Error("Audit append failed for wallet soft delete: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, _ := json.Marshal(state)
+	return string(out), nil
+}
+
+// rpcAdminRestoreWallet lifts a soft delete during the grace period. Once the
+// purge has run there is nothing left to restore. Server-to-server only.
+func rpcAdminRestoreWallet(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		UserID string `json:"userId"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || req.UserID == "" {
+		return "", rpcError(errCodeBadInput, "Expects a userId.", codes.InvalidArgument)
+	}
+
+	state, err := readWalletDeletion(ctx, nk, req.UserID)
+	if err != nil {
+		logger.Error("Deletion marker read failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Deletion marker lookup failed.", codes.Internal)
+	}
+	if state == nil {
+		return "", rpcError(errCodeNotFound, "Wallet is not pending deletion.", codes.NotFound)
+	}
+	if state.PurgedAt != 0 {
+		return "", rpcError(errCodeNotFound, "Wallet was already purged.", codes.NotFound)
+	}
+
+	if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+		Collection: walletMetaCollection,
+		Key:        walletDeletionKey,
+		UserID:     req.UserID,
+	}}); err != nil {
+		logger.Error("Deletion marker removal failed for user %v: %v", req.UserID, err)
+		return "", rpcError(errCodeInternal, "Restore failed.", codes.Internal)
+	}
+
+	if err := appendAudit(ctx, nk, "wallet.restored", req.UserID, map[string]interface{}{
+		"deletedAt": state.DeletedAt,
+	}); err != nil {
+		logger.Error("Audit append failed for wallet restore: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	return `{"restored":true}`, nil
+}
+
+// runWalletPurgePass finalizes soft deletes whose grace period has lapsed:
+// wallet records are removed, dedicated keys disabled, and the marker kept
+// with the purge time as a tombstone.
+func runWalletPurgePass(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+	now := moduleClock.Now().Unix()
+
+	cursor := ""
+	for {
+		objects, next, err := nk.StorageList(ctx, "", "", walletMetaCollection, 100, cursor)
+		if err != nil {
+			logger.Error("Wallet purge scan failed: %v", err)
+			return
+		}
+		for _, obj := range objects {
+			if obj.Key != walletDeletionKey || obj.UserId == "" {
+				continue
+			}
+			state := &walletDeletionState{}
+			if err := json.Unmarshal([]byte(obj.Value), state); err != nil {
+				continue
+			}
+			if state.PurgedAt != 0 || now < state.PurgeAfter {
+				continue
+			}
+			purgeWallets(ctx, logger, nk, obj.UserId, state, obj.Version)
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
+
+// purgeWallets removes a user's wallet records across all tenant namespaces
+// and disables dedicated keys.
+func purgeWallets(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID string, state *walletDeletionState, version string) {
+	var addresses []string
+	for _, collection := range tenantCollections(walletCollection) {
+		objects, _, err := nk.StorageList(ctx, "", userID, collection, 100, "")
+		if err != nil {
+			logger.Error("Wallet listing failed for purge of user %v: %v", userID, err)
+			return
+		}
+
+		for _, obj := range objects {
+			wallet := &Wallet{}
+			if err := json.Unmarshal([]byte(obj.Value), wallet); err != nil {
+				continue
+			}
+			if wallet.KeyARN != "" {
+				signer, err := perUserKeySigner(ctx, wallet.Backend)
+				if err == nil {
+					if err := signer.DisableKey(ctx, wallet.KeyARN); err != nil {
+						logger.Warn("Key disable failed during purge of %v: %v", wallet.KeyARN, err)
+					}
+				}
+			}
+			if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+				Collection: collection,
+				Key:        obj.Key,
+				UserID:     userID,
+			}}); err != nil {
+				logger.Error("Wallet record delete failed for user %v key %v: %v", userID, obj.Key, err)
+				return
+			}
+			addresses = append(addresses, wallet.Address)
+		}
+	}
+	// Migrated copies go too; see walletschema.go.
+	if cfg.WalletSchemaPhase != walletSchemaPhaseLegacy {
+		for _, collection := range tenantCollections(walletCollectionV2) {
+			objects, _, err := nk.StorageList(ctx, "", userID, collection, 100, "")
+			if err != nil {
+				logger.Error("Wallet v2 listing failed for purge of user %v: %v", userID, err)
+				return
+			}
+			for _, obj := range objects {
+				if err := nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{
+					Collection: collection,
+					Key:        obj.Key,
+					UserID:     userID,
+				}}); err != nil {
+					logger.Error("Wallet v2 record delete failed for user %v key %v: %v", userID, obj.Key, err)
+					return
+				}
+			}
+		}
+	}
+
+	state.PurgedAt = moduleClock.Now().Unix()
+	value, err := json.Marshal(state)
+	if err != nil {
+		return
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: walletMetaCollection,
+		Key:        walletDeletionKey,
+		UserID:     userID,
+		Value:      string(value),
+		Version:    version,
+	}}); err != nil {
+		logger.Error("Purge tombstone write failed for user %v: %v", userID, err)
+		return
+	}
+	if err := appendAudit(ctx, nk, "wallet.purged", userID, map[string]interface{}{
+		"addresses": addresses,
+	}); err != nil {
+		logger.Warn("Audit append failed for wallet purge of user %v: %v", userID, err)
+	}
+}
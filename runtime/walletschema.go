@@ -0,0 +1,336 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// The wallet schema is moving to a chain-qualified layout ("wallets_v2",
+// records carrying an explicit schema version and chain) ahead of multi-chain
+// support. The cutover is a phased dual-write so old and new server builds
+// can run side by side during a rolling deploy without losing or duplicating
+// wallets:
+//
+//	legacy  reads and writes the v1 collection only (default).
+//	dual    v1 stays authoritative; every write lands in both collections and
+//	        a leased worker backfills v2 until it converges.
+//	v2      v2 becomes authoritative; writes still mirror back to v1 so any
+//	        remaining legacy-phase node keeps a complete view.
+//
+// The v1 collection therefore stays complete through both migration phases,
+// which is why cross-user walkers (dormancy, inventory, snapshots) keep
+// listing it; retiring v1 is a later change once every node runs v2.
+
+const (
+	walletCollectionV2 = "wallets_v2"
+	walletSchemaV2     = 2
+	walletChainEVM     = "evm"
+
+	walletSchemaPhaseLegacy = "legacy"
+	walletSchemaPhaseDual   = "dual"
+	walletSchemaPhaseV2     = "v2"
+
+	walletSchemaProgressKey     = "schema_migration"
+	walletSchemaMigrateInterval = time.Minute
+	// walletSchemaMigrateBatch bounds one backfill pass so the worker shares
+	// the storage layer politely with live traffic.
+	walletSchemaMigrateBatch = 500
+)
+
+// walletRecordV2 is the v2 storage envelope: the v1 wallet fields inline plus
+// the schema version and chain, so a v1 reader pointed at a v2 record still
+// parses it.
+type walletRecordV2 struct {
+	Schema int    `json:"schema"`
+	Chain  string `json:"chain"`
+	*Wallet
+}
+
+// marshalWalletV2 renders a wallet in the v2 envelope.
+func marshalWalletV2(wallet *Wallet) (string, error) {
+	value, err := json.Marshal(&walletRecordV2{Schema: walletSchemaV2, Chain: walletChainEVM, Wallet: wallet})
+	return string(value), err
+}
+
+// readWalletAt reads one wallet record from a specific collection, returning
+// the storage version alongside for conditional rewrites. Both schema shapes
+// unmarshal into Wallet; the v2 envelope fields are ignored.
+func readWalletAt(ctx context.Context, nk nkruntime.NakamaModule, collection, userID, key string) (*Wallet, string, error) {
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: collection,
+		Key:        key,
+		UserID:     userID,
+	}})
+	if err != nil {
+		return nil, "", err
+	}
+	if len(objects) == 0 {
+		return nil, "", nil
+	}
+	wallet := &Wallet{}
+	if err := json.Unmarshal([]byte(objects[0].Value), wallet); err != nil {
+		return nil, "", err
+	}
+	return wallet, objects[0].Version, nil
+}
+
+// readWalletForUpdate resolves a wallet for a conditional rewrite: the record
+// plus the CAS version against the phase's authoritative collection. A wallet
+// present only in the fallback collection returns version "*", so the rewrite
+// becomes a conditional create in the authoritative one.
+func readWalletForUpdate(ctx context.Context, nk nkruntime.NakamaModule, userID, label string) (*Wallet, string, error) {
+	key := walletKey(label)
+	if cfg.WalletSchemaPhase == walletSchemaPhaseV2 {
+		wallet, version, err := readWalletAt(ctx, nk, tenantCollection(ctx, walletCollectionV2), userID, key)
+		if err != nil || wallet != nil {
+			return wallet, version, err
+		}
+		wallet, _, err = readWalletAt(ctx, nk, tenantCollection(ctx, walletCollection), userID, key)
+		return wallet, "*", err
+	}
+	return readWalletAt(ctx, nk, tenantCollection(ctx, walletCollection), userID, key)
+}
+
+// storeWallet writes a wallet under the configured phase: a conditional write
+// to the authoritative collection, mirrored to the other collection in the
+// same storage batch so neither copy can land without the other.
+func storeWallet(ctx context.Context, nk nkruntime.NakamaModule, userID, label string, wallet *Wallet, version string) error {
+	key := walletKey(label)
+	v1Value, err := json.Marshal(wallet)
+	if err != nil {
+		return err
+	}
+	v1Write := &nkruntime.StorageWrite{
+		Collection:     tenantCollection(ctx, walletCollection),
+		Key:            key,
+		UserID:         userID,
+		Value:          string(v1Value),
+		PermissionRead: 1,
+	}
+	if cfg.WalletSchemaPhase == walletSchemaPhaseLegacy {
+		v1Write.Version = version
+		_, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{v1Write})
+		return err
+	}
+
+	v2Value, err := marshalWalletV2(wallet)
+	if err != nil {
+		return err
+	}
+	v2Write := &nkruntime.StorageWrite{
+		Collection:     tenantCollection(ctx, walletCollectionV2),
+		Key:            key,
+		UserID:         userID,
+		Value:          v2Value,
+		PermissionRead: 1,
+	}
+	if cfg.WalletSchemaPhase == walletSchemaPhaseV2 {
+		v2Write.Version = version
+	} else {
+		v1Write.Version = version
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{v1Write, v2Write})
+	return err
+}
+
+// mirrorWalletV2 copies one updated v1 record into the v2 collection for
+// writers that rewrite v1 in place (identity re-binds). Best effort: the
+// backfill worker converges any miss.
+func mirrorWalletV2(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, userID, key string, wallet *Wallet) {
+	if cfg.WalletSchemaPhase == walletSchemaPhaseLegacy {
+		return
+	}
+	value, err := marshalWalletV2(wallet)
+	if err != nil {
+		return
+	}
+	if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection:     tenantCollection(ctx, walletCollectionV2),
+		Key:            key,
+		UserID:         userID,
+		Value:          value,
+		PermissionRead: 1,
+	}}); err != nil {
+		logger.Warn("Wallet v2 mirror write failed for user %v key %v: %v", userID, key, err)
+	}
+}
+
+// walletSchemaProgress tracks the backfill across tenant collections.
+type walletSchemaProgress struct {
+	// Collection is the v1 tenant collection currently being walked.
+	Collection string `json:"collection,omitempty"`
+	Cursor     string `json:"cursor,omitempty"`
+	Scanned    int    `json:"scanned"`
+	Copied     int    `json:"copied"`
+	Done       bool   `json:"done"`
+	StartedAt  int64  `json:"startedAt,omitempty"`
+	UpdatedAt  int64  `json:"updatedAt,omitempty"`
+}
+
+func readWalletSchemaProgress(ctx context.Context, nk nkruntime.NakamaModule) (*walletSchemaProgress, error) {
+	progress := &walletSchemaProgress{}
+	objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+		Collection: walletMetaCollection,
+		Key:        walletSchemaProgressKey,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) > 0 {
+		if err := json.Unmarshal([]byte(objects[0].Value), progress); err != nil {
+			return nil, err
+		}
+	}
+	return progress, nil
+}
+
+func writeWalletSchemaProgress(ctx context.Context, nk nkruntime.NakamaModule, progress *walletSchemaProgress) error {
+	progress.UpdatedAt = moduleClock.Now().Unix()
+	value, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: walletMetaCollection,
+		Key:        walletSchemaProgressKey,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// runWalletSchemaMigrationPass backfills the v2 collection from v1 while the
+// dual phase runs: records missing from v2 are copied and records that drifted
+// (direct v1 rewrites) are overwritten, since v1 is authoritative in this
+// phase. Progress survives restarts through the tracker record.
+func runWalletSchemaMigrationPass(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule) {
+	progress, err := readWalletSchemaProgress(ctx, nk)
+	if err != nil {
+		logger.Warn("Wallet schema progress read failed: %v", err)
+		return
+	}
+	if progress.Done {
+		return
+	}
+	if progress.StartedAt == 0 {
+		progress.StartedAt = moduleClock.Now().Unix()
+	}
+
+	collections := tenantCollections(walletCollection)
+	// Resume at the collection the tracker left off in.
+	start := 0
+	for i, collection := range collections {
+		if collection == progress.Collection {
+			start = i
+			break
+		}
+	}
+
+	budget := walletSchemaMigrateBatch
+	for _, collection := range collections[start:] {
+		if collection != progress.Collection {
+			progress.Collection = collection
+			progress.Cursor = ""
+		}
+		// Tenant collections suffix the base with "#tenant"; carry it over.
+		v2Collection := walletCollectionV2 + collection[len(walletCollection):]
+		for budget > 0 {
+			objects, next, err := nk.StorageList(ctx, "", "", collection, 100, progress.Cursor)
+			if err != nil {
+				logger.Warn("Wallet schema listing failed in %v: %v", collection, err)
+				return
+			}
+			for _, obj := range objects {
+				budget--
+				progress.Scanned++
+				wallet := &Wallet{}
+				if err := json.Unmarshal([]byte(obj.Value), wallet); err != nil {
+					logger.Warn("Skipping corrupt wallet record %v: %v", obj.Key, err)
+					continue
+				}
+				expected, err := marshalWalletV2(wallet)
+				if err != nil {
+					continue
+				}
+				existing, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+					Collection: v2Collection,
+					Key:        obj.Key,
+					UserID:     obj.UserId,
+				}})
+				if err != nil {
+					logger.Warn("Wallet v2 read failed for key %v: %v", obj.Key, err)
+					continue
+				}
+				if len(existing) > 0 && existing[0].Value == expected {
+					continue
+				}
+				if _, err := nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+					Collection:     v2Collection,
+					Key:            obj.Key,
+					UserID:         obj.UserId,
+					Value:          expected,
+					PermissionRead: 1,
+				}}); err != nil {
+					logger.Warn("Wallet v2 backfill write failed for key %v: %v", obj.Key, err)
+					continue
+				}
+				progress.Copied++
+			}
+			progress.Cursor = next
+			if next == "" {
+				break
+			}
+		}
+		if budget <= 0 {
+			break
+		}
+		if progress.Cursor == "" && collection == collections[len(collections)-1] {
+			progress.Done = true
+			logger.Info("Wallet schema backfill complete: %v records scanned, %v copied", progress.Scanned, progress.Copied)
+		}
+	}
+
+	if err := writeWalletSchemaProgress(ctx, nk, progress); err != nil {
+		logger.Warn("Wallet schema progress write failed: %v", err)
+	}
+}
+
+// rpcAdminWalletSchemaStatus reports the configured phase and the backfill
+// tracker, so the operator knows when it is safe to advance phases.
+// Server-to-server only.
+func rpcAdminWalletSchemaStatus(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+	progress, err := readWalletSchemaProgress(ctx, nk)
+	if err != nil {
+		logger.Error("Wallet schema progress read failed: %v", err)
+		return "", rpcError(errCodeInternal, "Progress read failed.", codes.Internal)
+	}
+	out, err := json.Marshal(map[string]interface{}{
+		"phase":    cfg.WalletSchemaPhase,
+		"progress": progress,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
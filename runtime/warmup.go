@@ -0,0 +1,109 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+)
+
+// First-login latency used to spike on the lazy JWKS fetch and the first
+// signer call. InitModule now runs a bounded, best-effort warmup pass so those
+// costs are paid before traffic arrives. Failures are logged and reported in
+// rpc_healthz but never block startup.
+
+const warmupTimeout = 5 * time.Second
+
+// warmupResult records the outcome of one warmup target.
+type warmupResult struct {
+	Status     string `json:"status"` // ok, failed or skipped.
+	Detail     string `json:"detail,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+}
+
+var (
+	warmupMu      sync.RWMutex
+	warmupResults map[string]*warmupResult
+)
+
+// warmupSnapshot returns a copy of the warmup outcomes for healthz.
+func warmupSnapshot() map[string]*warmupResult {
+	warmupMu.RLock()
+	defer warmupMu.RUnlock()
+	out := make(map[string]*warmupResult, len(warmupResults))
+	for k, v := range warmupResults {
+		out[k] = v
+	}
+	return out
+}
+
+// runWarmup pre-fetches the JWKS document, pings the signer backend and dials
+// the EVM RPC endpoint when configured.
+func runWarmup(ctx context.Context, logger nkruntime.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+
+	targets := map[string]func() (string, error){
+		"jwks": func() (string, error) {
+			return "", jwksManager.refresh()
+		},
+	}
+	if kmsSigner != nil {
+		targets["signer"] = func() (string, error) {
+			_, err := kmsSigner.PublicKey(ctx, 0)
+			return "", err
+		}
+	}
+	if cfg.EVMRPCURL != "" {
+		targets["evm_rpc"] = func() (string, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.EVMRPCURL,
+				strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`))
+			if err != nil {
+				return "", err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return "", err
+			}
+			resp.Body.Close()
+			return resp.Status, nil
+		}
+	}
+
+	results := make(map[string]*warmupResult, len(targets))
+	for name, probe := range targets {
+		start := moduleClock.Now()
+		detail, err := probe()
+		result := &warmupResult{Status: "ok", Detail: detail, DurationMS: time.Since(start).Milliseconds()}
+		if err != nil {
+			result.Status = "failed"
+			result.Detail = err.Error()
+			logger.Warn("Warmup target %v failed after %vms: %v", name, result.DurationMS, err)
+		} else {
+			logger.Info("Warmup target %v ok in %vms", name, result.DurationMS)
+		}
+		results[name] = result
+	}
+
+	warmupMu.Lock()
+	warmupResults = results
+	warmupMu.Unlock()
+}
@@ -0,0 +1,338 @@
+// Copyright 2025 The Nakama Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	nkruntime "github.com/heroiclabs/nakama-common/runtime"
+	"google.golang.org/grpc/codes"
+)
+
+// Wallet events are mirrored to an external consumer over HTTP when
+// NAKAMA_WEBHOOK_URL is configured. Consumers occasionally drop deliveries,
+// so every attempt is persisted with its outcome (status, latency, response
+// code); operators list failures and re-send selected events through admin
+// RPCs. Failed deliveries carry an exponential backoff window that replays
+// honour unless forced.
+
+const (
+	webhookCollection = "webhook_deliveries"
+	webhookTimeout    = 5 * time.Second
+
+	// Backoff after a failed attempt doubles per attempt, capped.
+	webhookBackoffBase = time.Minute
+	webhookBackoffCap  = time.Hour
+
+	// webhookDeadLetterAttempts is the replay count after which a delivery
+	// moves to the shared dead-letter store; see dlq.go.
+	webhookDeadLetterAttempts = 5
+)
+
+// dlqClassWebhook names failed deliveries in the dead-letter store.
+const dlqClassWebhook = "webhook"
+
+// Delivery statuses.
+const (
+	webhookStatusDelivered = "delivered"
+	webhookStatusFailed    = "failed"
+)
+
+// webhookSignatureHeader carries the HMAC-SHA256 of the request body computed
+// with NAKAMA_WEBHOOK_SECRET, so consumers can authenticate deliveries.
+const webhookSignatureHeader = "X-Nakama-Signature"
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookLogger is the module logger handed to off-request-path deliveries,
+// set during InitModule when webhooks are configured.
+var webhookLogger nkruntime.Logger
+
+// webhookDelivery is the persisted record of one event's delivery attempts.
+type webhookDelivery struct {
+	ID     string `json:"id"`
+	UserID string `json:"userId"`
+	// Tenant routes the delivery to a per-tenant endpoint; see tenant.go.
+	Tenant     string `json:"tenant,omitempty"`
+	Type       string `json:"type"`
+	Payload    string `json:"payload"`
+	Status     string `json:"status"`
+	HTTPStatus int    `json:"httpStatus,omitempty"`
+	LatencyMs  int64  `json:"latencyMs"`
+	Attempts   int    `json:"attempts"`
+	LastError  string `json:"lastError,omitempty"`
+	// NextRetryAt is the earliest time a replay is allowed after a failure.
+	NextRetryAt int64 `json:"nextRetryAt,omitempty"`
+	CreatedAt   int64 `json:"createdAt"`
+	UpdatedAt   int64 `json:"updatedAt"`
+}
+
+// webhookSignature computes the delivery signature for a body.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// attemptWebhook posts the delivery payload once and updates the record's
+// outcome fields in place.
+func attemptWebhook(ctx context.Context, delivery *webhookDelivery) {
+	delivery.Attempts++
+	delivery.UpdatedAt = moduleClock.Now().Unix()
+
+	start := moduleClock.Now()
+	fail := func(httpStatus int, cause string) {
+		delivery.Status = webhookStatusFailed
+		delivery.HTTPStatus = httpStatus
+		delivery.LastError = cause
+		backoff := webhookBackoffBase << (delivery.Attempts - 1)
+		if backoff > webhookBackoffCap || backoff <= 0 {
+			backoff = webhookBackoffCap
+		}
+		delivery.NextRetryAt = moduleClock.Now().Add(backoff).Unix()
+	}
+
+	url, secret := tenantWebhook(delivery.Tenant)
+	if url == "" {
+		fail(0, "no webhook endpoint configured for tenant")
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader([]byte(delivery.Payload)))
+	if err != nil {
+		fail(0, err.Error())
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		req.Header.Set(webhookSignatureHeader, webhookSignature(secret, []byte(delivery.Payload)))
+	}
+
+	resp, err := webhookClient.Do(req)
+	delivery.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		fail(0, err.Error())
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		fail(resp.StatusCode, resp.Status)
+		return
+	}
+	delivery.Status = webhookStatusDelivered
+	delivery.HTTPStatus = resp.StatusCode
+	delivery.LastError = ""
+	delivery.NextRetryAt = 0
+}
+
+// writeWebhookDelivery persists a delivery record as a system-owned object.
+func writeWebhookDelivery(ctx context.Context, nk nkruntime.NakamaModule, delivery *webhookDelivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	_, err = nk.StorageWrite(ctx, []*nkruntime.StorageWrite{{
+		Collection: webhookCollection,
+		Key:        delivery.ID,
+		Value:      string(value),
+	}})
+	return err
+}
+
+// forwardWebhook mirrors a wallet event to the configured consumer and
+// records the attempt. Called off the request path; delivery failures are
+// recorded, not surfaced.
+func forwardWebhook(logger nkruntime.Logger, nk nkruntime.NakamaModule, tenant, userID string, event *WalletEvent, payload string) {
+	// The triggering request's context may be gone by the time this runs.
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout+time.Second)
+	defer cancel()
+
+	id, err := moduleIDs.NewID()
+	if err != nil {
+		logger.Warn("Webhook delivery ID generation failed: %v", err)
+		return
+	}
+	delivery := &webhookDelivery{
+		ID:        id,
+		UserID:    userID,
+		Tenant:    tenant,
+		Type:      event.Type,
+		Payload:   payload,
+		CreatedAt: moduleClock.Now().Unix(),
+	}
+	attemptWebhook(ctx, delivery)
+	if delivery.Status == webhookStatusFailed {
+		logger.Warn("Webhook delivery %v failed (attempt %d): %v", delivery.ID, delivery.Attempts, delivery.LastError)
+	}
+	if err := writeWebhookDelivery(ctx, nk, delivery); err != nil {
+		logger.Error("Webhook delivery record write failed for %v: %v", delivery.ID, err)
+	}
+}
+
+// rpcAdminListWebhookFailures lists failed deliveries, optionally filtered by
+// event type and creation time. Server-to-server only.
+func rpcAdminListWebhookFailures(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		Type   string `json:"type,omitempty"`
+		Since  int64  `json:"since,omitempty"`
+		Limit  int    `json:"limit,omitempty"`
+		Cursor string `json:"cursor,omitempty"`
+	}
+	if payload != "" {
+		if err := unmarshalPayload(payload, &req); err != nil {
+			return "", rpcError(errCodeBadInput, "Malformed listing request.", codes.InvalidArgument)
+		}
+	}
+	req.Limit = normalizeListLimit(req.Limit)
+
+	objects, cursor, err := nk.StorageList(ctx, "", "", webhookCollection, req.Limit, req.Cursor)
+	if err != nil {
+		logger.Error("Webhook delivery listing failed: %v", err)
+		return "", rpcError(errCodeInternal, "Delivery listing failed.", codes.Internal)
+	}
+
+	failures := make([]*webhookDelivery, 0, len(objects))
+	for _, obj := range objects {
+		delivery := &webhookDelivery{}
+		if err := json.Unmarshal([]byte(obj.Value), delivery); err != nil {
+			logger.Warn("Skipping corrupt webhook delivery record %v: %v", obj.Key, err)
+			continue
+		}
+		if delivery.Status != webhookStatusFailed {
+			continue
+		}
+		if req.Type != "" && delivery.Type != req.Type {
+			continue
+		}
+		if req.Since > 0 && delivery.CreatedAt < req.Since {
+			continue
+		}
+		failures = append(failures, delivery)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{
+		"failures": failures,
+		"cursor":   cursor,
+	})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// rpcAdminReplayWebhook re-sends selected failed deliveries. Replays respect
+// each delivery's backoff window unless force is set. Server-to-server only.
+func rpcAdminReplayWebhook(ctx context.Context, logger nkruntime.Logger, db *sql.DB, nk nkruntime.NakamaModule, payload string) (string, error) {
+	if err := requireServer(ctx); err != nil {
+		return "", err
+	}
+
+	var req struct {
+		IDs   []string `json:"ids"`
+		Force bool     `json:"force,omitempty"`
+	}
+	if err := unmarshalPayload(payload, &req); err != nil || len(req.IDs) == 0 {
+		return "", rpcError(errCodeBadInput, "Expects a non-empty ids list.", codes.InvalidArgument)
+	}
+
+	results := make(map[string]string, len(req.IDs))
+	for _, id := range req.IDs {
+		objects, err := nk.StorageRead(ctx, []*nkruntime.StorageRead{{
+			Collection: webhookCollection,
+			Key:        id,
+		}})
+		if err != nil {
+			logger.Error("Webhook delivery read failed for %v: %v", id, err)
+			return "", rpcError(errCodeInternal, "Delivery lookup failed.", codes.Internal)
+		}
+		if len(objects) == 0 {
+			results[id] = "not_found"
+			continue
+		}
+		delivery := &webhookDelivery{}
+		if err := json.Unmarshal([]byte(objects[0].Value), delivery); err != nil {
+			results[id] = "corrupt"
+			continue
+		}
+		if delivery.Status == webhookStatusDelivered {
+			results[id] = webhookStatusDelivered
+			continue
+		}
+		if !req.Force && delivery.NextRetryAt > moduleClock.Now().Unix() {
+			results[id] = "backoff"
+			continue
+		}
+
+		attemptWebhook(ctx, delivery)
+		if delivery.Status == webhookStatusFailed && delivery.Attempts >= webhookDeadLetterAttempts {
+			// Nobody is answering; move it out of the replay set so the
+			// failure list stays actionable.
+			value, _ := json.Marshal(delivery)
+			deadLetter(ctx, logger, nk, dlqClassWebhook, delivery.UserID, string(value), delivery.LastError, delivery.Attempts)
+			_ = nk.StorageDelete(ctx, []*nkruntime.StorageDelete{{Collection: webhookCollection, Key: id}})
+			results[id] = "dead_lettered"
+			continue
+		}
+		if err := writeWebhookDelivery(ctx, nk, delivery); err != nil {
+			logger.Error("Webhook delivery record write failed for %v: %v", id, err)
+			return "", rpcError(errCodeInternal, "Delivery record write failed.", codes.Internal)
+		}
+		results[id] = delivery.Status
+	}
+
+	if err := appendAudit(ctx, nk, "webhook.replayed", "", map[string]interface{}{
+		"ids":     req.IDs,
+		"force":   req.Force,
+		"results": results,
+	}); err != nil {
+		logger.Error("Audit append failed for webhook replay: %v", err)
+		return "", rpcError(errCodeInternal, "Audit write failed.", codes.Internal)
+	}
+
+	out, err := json.Marshal(map[string]interface{}{"results": results})
+	if err != nil {
+		return "", rpcError(errCodeInternal, "Response encoding failed.", codes.Internal)
+	}
+	return string(out), nil
+}
+
+// retryWebhookDelivery re-attempts a dead-lettered delivery once; see dlq.go.
+// Success writes the delivered record back into the delivery log.
+func retryWebhookDelivery(ctx context.Context, logger nkruntime.Logger, nk nkruntime.NakamaModule, entry *dlqEntry) error {
+	delivery := &webhookDelivery{}
+	if err := json.Unmarshal([]byte(entry.Payload), delivery); err != nil {
+		return fmt.Errorf("dead letter payload corrupt: %w", err)
+	}
+	attemptWebhook(ctx, delivery)
+	if delivery.Status != webhookStatusDelivered {
+		return fmt.Errorf("delivery failed again: %s", delivery.LastError)
+	}
+	if err := writeWebhookDelivery(ctx, nk, delivery); err != nil {
+		logger.Warn("Webhook delivery record write failed for retried %v: %v", delivery.ID, err)
+	}
+	return nil
+}